@@ -0,0 +1,278 @@
+package apiv1
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BasePath префикс маршрутов API
+const BasePath = "/api/v1"
+
+// Operation операция API: по этому описанию регистрируется маршрут и строится
+// документ OpenAPI
+type Operation struct {
+	ID          string
+	Method      string
+	Path        string // относительно BasePath, параметры в стиле gin: /clients/:id
+	Summary     string
+	Query       []Param
+	Request     interface{} // значение типа тела запроса; nil — без тела
+	Response    interface{} // значение типа тела ответа; nil — без тела
+	Status      int         // код успешного ответа
+	ContentType string      // тип успешного ответа, по умолчанию application/json
+	Conditional bool        // ответ содержит ETag, запрос принимает If-Match
+}
+
+// Param параметр строки запроса
+type Param struct {
+	Name        string
+	Type        string // string или integer
+	Description string
+}
+
+// Route зарегистрированный маршрут
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Document строит документ OpenAPI 3 по списку операций
+func Document(ops []Operation) map[string]interface{} {
+	b := &schemaBuilder{components: make(map[string]interface{})}
+	errorRef := b.schema(reflect.TypeOf(ErrorResponse{}))
+
+	paths := make(map[string]interface{})
+	for _, op := range ops {
+		path, pathParams := openAPIPath(op.Path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+
+		params := make([]interface{}, 0)
+		for _, name := range pathParams {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, param := range op.Query {
+			params = append(params, map[string]interface{}{
+				"name": param.Name, "in": "query", "description": param.Description,
+				"schema": map[string]interface{}{"type": param.Type},
+			})
+		}
+		// If-Match относится к существующей записи, путь которой содержит ее ID
+		ifMatch := op.Conditional && len(pathParams) > 0
+		if ifMatch {
+			params = append(params, map[string]interface{}{
+				"name": "If-Match", "in": "header",
+				"description": "ETag записи; при несовпадении ответ 412",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(op.Status)}
+		if op.Response != nil {
+			contentType := op.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			schema := map[string]interface{}{"type": "string"}
+			if contentType == "application/json" {
+				schema = b.schema(reflect.TypeOf(op.Response))
+			}
+			success["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{"schema": schema},
+			}
+		}
+		if op.Conditional {
+			success["headers"] = map[string]interface{}{
+				"ETag": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			}
+		}
+		errorResponse := func(description string) map[string]interface{} {
+			return map[string]interface{}{
+				"description": description,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorRef},
+				},
+			}
+		}
+		responses := map[string]interface{}{
+			fmt.Sprint(op.Status): success,
+			"default":             errorResponse("Ошибка"),
+		}
+		if ifMatch {
+			responses["412"] = errorResponse("Запись изменена, код version_conflict")
+		}
+
+		operation := map[string]interface{}{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"responses":   responses,
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "WireGuard Web Manager API",
+			"version": "1",
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": BasePath}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": b.components},
+	}
+}
+
+// CheckRoutes сверяет операции с маршрутами, зарегистрированными под
+// BasePath: у каждой операции должен быть маршрут, а у каждого маршрута —
+// описание в документе
+func CheckRoutes(ops []Operation, routes []Route) error {
+	documented := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		documented[op.Method+" "+BasePath+op.Path] = false
+	}
+
+	var problems []string
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, BasePath+"/") {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		if _, ok := documented[key]; !ok {
+			problems = append(problems, "undocumented route "+key)
+			continue
+		}
+		documented[key] = true
+	}
+	for key, registered := range documented {
+		if !registered {
+			problems = append(problems, "documented operation without route "+key)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi document does not match routes: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// openAPIPath переводит путь gin в путь OpenAPI и возвращает имена параметров
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			name := segment[1:]
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	nullableTimeType = reflect.TypeOf(NullableTime{})
+)
+
+// schemaBuilder строит схемы JSON по типам Go; структуры выносятся в components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == nullableTimeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+		nullable = true
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		schema = map[string]interface{}{"type": "integer", "format": "int64"}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer", "format": "int64", "minimum": 0}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice:
+		schema = map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = nil // защита от рекурсии
+			b.components[name] = b.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if nullable {
+			return map[string]interface{}{"allOf": []interface{}{ref}, "nullable": true}
+		}
+		return ref
+	default:
+		schema = map[string]interface{}{}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	b.fields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			b.fields(field.Type, properties)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if parts := strings.Split(tag, ","); parts[0] != "" {
+				name = parts[0]
+			}
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
@@ -0,0 +1,70 @@
+package apiv1
+
+import "net/http"
+
+// Идентификаторы операций
+const (
+	OpListServers     = "listServers"
+	OpCreateServer    = "createServer"
+	OpGetServer       = "getServer"
+	OpUpdateServer    = "updateServer"
+	OpDeleteServer    = "deleteServer"
+	OpListClients     = "listClients"
+	OpCreateClient    = "createClient"
+	OpGetClient       = "getClient"
+	OpPatchClient     = "patchClient"
+	OpDeleteClient    = "deleteClient"
+	OpDisableClient   = "disableClient"
+	OpEnableClient    = "enableClient"
+	OpGetClientConfig = "getClientConfig"
+	OpGetSiteLink     = "getClientSiteLink"
+	OpGetStats        = "getStats"
+	OpGetOpenAPI      = "getOpenAPI"
+)
+
+// Operations все операции API v1
+var Operations = []Operation{
+	{ID: OpListServers, Method: http.MethodGet, Path: "/servers", Summary: "Список серверов",
+		Response: ServerList{}, Status: http.StatusOK},
+	{ID: OpCreateServer, Method: http.MethodPost, Path: "/servers", Summary: "Создать сервер",
+		Request: CreateServerRequest{}, Response: Server{}, Status: http.StatusCreated, Conditional: true},
+	{ID: OpGetServer, Method: http.MethodGet, Path: "/servers/:id", Summary: "Получить сервер",
+		Response: Server{}, Status: http.StatusOK, Conditional: true},
+	{ID: OpUpdateServer, Method: http.MethodPut, Path: "/servers/:id", Summary: "Изменить сервер",
+		Request: UpdateServerRequest{}, Response: Server{}, Status: http.StatusOK, Conditional: true},
+	{ID: OpDeleteServer, Method: http.MethodDelete, Path: "/servers/:id", Summary: "Удалить сервер вместе с клиентами",
+		Status: http.StatusNoContent, Conditional: true},
+
+	{ID: OpListClients, Method: http.MethodGet, Path: "/clients", Summary: "Список клиентов",
+		Query: []Param{
+			{Name: "search", Type: "string", Description: "Подстрока имени, email, адреса или открытого ключа"},
+			{Name: "status", Type: "string", Description: "Состояния через запятую: active, disabled, expired, quota_exceeded, outside_schedule"},
+			{Name: "server_id", Type: "string"},
+			{Name: "tag", Type: "string"},
+			{Name: "sort", Type: "string", Description: "name, email, address, created, last_handshake или traffic; префикс - для обратного порядка"},
+			{Name: "limit", Type: "integer", Description: "Размер страницы, не больше 1000"},
+			{Name: "cursor", Type: "string", Description: "next_cursor предыдущей страницы"},
+		},
+		Response: ClientList{}, Status: http.StatusOK},
+	{ID: OpCreateClient, Method: http.MethodPost, Path: "/clients", Summary: "Создать клиента",
+		Request: CreateClientRequest{}, Response: Client{}, Status: http.StatusCreated, Conditional: true},
+	{ID: OpGetClient, Method: http.MethodGet, Path: "/clients/:id", Summary: "Получить клиента",
+		Response: Client{}, Status: http.StatusOK, Conditional: true},
+	{ID: OpPatchClient, Method: http.MethodPatch, Path: "/clients/:id", Summary: "Изменить поля клиента",
+		Request: PatchClientRequest{}, Response: Client{}, Status: http.StatusOK, Conditional: true},
+	{ID: OpDeleteClient, Method: http.MethodDelete, Path: "/clients/:id", Summary: "Удалить клиента",
+		Status: http.StatusNoContent, Conditional: true},
+	{ID: OpDisableClient, Method: http.MethodPost, Path: "/clients/:id/disable", Summary: "Отключить клиента",
+		Response: Client{}, Status: http.StatusOK, Conditional: true},
+	{ID: OpEnableClient, Method: http.MethodPost, Path: "/clients/:id/enable", Summary: "Включить клиента",
+		Response: Client{}, Status: http.StatusOK, Conditional: true},
+	{ID: OpGetClientConfig, Method: http.MethodGet, Path: "/clients/:id/config", Summary: "Скачать конфигурацию клиента",
+		Response: "", ContentType: "text/plain", Status: http.StatusOK},
+	{ID: OpGetSiteLink, Method: http.MethodGet, Path: "/clients/:id/site-link", Summary: "Встречная площадка для сервера на другой стороне",
+		Response: CreateClientRequest{}, Status: http.StatusOK},
+
+	{ID: OpGetStats, Method: http.MethodGet, Path: "/stats", Summary: "Сводка по клиентам",
+		Response: Stats{}, Status: http.StatusOK},
+	{ID: OpGetOpenAPI, Method: http.MethodGet, Path: "/openapi.json", Summary: "Этот документ OpenAPI",
+		Response: map[string]interface{}{}, Status: http.StatusOK},
+}
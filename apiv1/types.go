@@ -0,0 +1,291 @@
+package apiv1
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"wireguard-web-manager/models"
+)
+
+// Server сервер. Приватный ключ в ответах не передается.
+type Server struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	ListenPort   int        `json:"listen_port"`
+	PublicKey    string     `json:"public_key"`
+	Network      string     `json:"network"`
+	DNS          string     `json:"dns"`
+	AllowedIPs   string     `json:"allowed_ips"`
+	Endpoint     string     `json:"endpoint"`
+	IsActive     bool       `json:"is_active"`
+	KeyRotatedAt *time.Time `json:"key_rotated_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Version      int64      `json:"version"`
+}
+
+// ServerList список серверов
+type ServerList struct {
+	Items []Server `json:"items"`
+}
+
+// CreateServerRequest создание сервера. Без private_key ключ генерируется.
+type CreateServerRequest struct {
+	Name       string `json:"name"`
+	ListenPort int    `json:"listen_port"`
+	PrivateKey string `json:"private_key,omitempty"`
+	Network    string `json:"network"`
+	DNS        string `json:"dns"`
+	AllowedIPs string `json:"allowed_ips"`
+	Endpoint   string `json:"endpoint"`
+}
+
+// UpdateServerRequest изменение сервера. Пустой private_key оставляет ключ.
+type UpdateServerRequest struct {
+	ListenPort int    `json:"listen_port"`
+	PrivateKey string `json:"private_key,omitempty"`
+	Network    string `json:"network"`
+	DNS        string `json:"dns"`
+	AllowedIPs string `json:"allowed_ips"`
+	Endpoint   string `json:"endpoint"`
+}
+
+// Client клиент. Приватные ключи в ответах не передаются.
+type Client struct {
+	ID               string           `json:"id"`
+	ServerID         string           `json:"server_id"`
+	Name             string           `json:"name"`
+	Email            string           `json:"email"`
+	Tags             []string         `json:"tags"`
+	PublicKey        string           `json:"public_key"`
+	ClientKey        bool             `json:"client_key"`
+	AllowedIPs       string           `json:"allowed_ips"`
+	Status           string           `json:"status"`
+	IsActive         bool             `json:"is_active"`
+	IsDisabled       bool             `json:"is_disabled"`
+	Downloaded       bool             `json:"downloaded"`
+	ConfigOutdated   bool             `json:"config_outdated"`
+	ReceiveBytes     int64            `json:"receive_bytes"`
+	TransmitBytes    int64            `json:"transmit_bytes"`
+	LastHandshake    *time.Time       `json:"last_handshake,omitempty"`
+	QuotaBytes       int64            `json:"quota_bytes"`
+	QuotaPeriod      string           `json:"quota_period,omitempty"`
+	PeriodUsage      int64            `json:"period_usage"`
+	IngressKbit      uint64           `json:"ingress_kbit"`
+	EgressKbit       uint64           `json:"egress_kbit"`
+	Schedule         *models.Schedule `json:"schedule,omitempty"`
+	ExpiresAt        *time.Time       `json:"expires_at,omitempty"`
+	RotationDeadline *time.Time       `json:"rotation_deadline,omitempty"`
+	Kind             string           `json:"kind,omitempty"`
+	Subnets          []string         `json:"subnets,omitempty"`
+	LocalSubnets     []string         `json:"local_subnets,omitempty"`
+	Endpoint         string           `json:"endpoint,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	Version          int64            `json:"version"`
+}
+
+// ClientList страница списка клиентов
+type ClientList struct {
+	Items      []Client `json:"items"`
+	Total      int      `json:"total"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// CreateClientRequest создание клиента. Без ключей пара генерируется
+// сервером, с одним public_key приватный ключ остается у клиента; без
+// allowed_ips адрес выделяется из сети сервера. Площадке (kind site) нужны
+// subnets и endpoint.
+type CreateClientRequest struct {
+	ServerID    string           `json:"server_id"`
+	Name        string           `json:"name"`
+	Email       string           `json:"email,omitempty"`
+	Tags        []string         `json:"tags,omitempty"`
+	PublicKey   string           `json:"public_key,omitempty"`
+	PrivateKey  string           `json:"private_key,omitempty"`
+	AllowedIPs  string           `json:"allowed_ips,omitempty"`
+	QuotaBytes  int64            `json:"quota_bytes,omitempty"`
+	QuotaPeriod string           `json:"quota_period,omitempty"`
+	IngressKbit uint64           `json:"ingress_kbit,omitempty"`
+	EgressKbit  uint64           `json:"egress_kbit,omitempty"`
+	Schedule    *models.Schedule `json:"schedule,omitempty"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`
+
+	Kind         string   `json:"kind,omitempty"`          // site — площадка
+	Subnets      []string `json:"subnets,omitempty"`       // сети за площадкой
+	LocalSubnets []string `json:"local_subnets,omitempty"` // сети за сервером, доступные площадке
+	Endpoint     string   `json:"endpoint,omitempty"`      // адрес шлюза площадки host:port
+}
+
+// PatchClientRequest частичное изменение клиента; отсутствующие поля не меняются
+type PatchClientRequest struct {
+	Name        *string      `json:"name,omitempty"`
+	Email       *string      `json:"email,omitempty"`
+	Tags        *[]string    `json:"tags,omitempty"`
+	AllowedIPs  *string      `json:"allowed_ips,omitempty"`
+	QuotaBytes  *int64       `json:"quota_bytes,omitempty"`
+	QuotaPeriod *string      `json:"quota_period,omitempty"`
+	ExpiresAt   NullableTime `json:"expires_at"` // null снимает срок действия
+	IngressKbit *uint64      `json:"ingress_kbit,omitempty"`
+	EgressKbit  *uint64      `json:"egress_kbit,omitempty"`
+
+	// Только для площадки
+	Subnets      *[]string `json:"subnets,omitempty"`
+	LocalSubnets *[]string `json:"local_subnets,omitempty"`
+	Endpoint     *string   `json:"endpoint,omitempty"`
+}
+
+// NullableTime время, которое в запросе можно не передать, передать
+// значением или передать null
+type NullableTime struct {
+	Set   bool       // поле есть в запросе
+	Value *time.Time // nil при null
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		t.Value = nil
+		return nil
+	}
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	t.Value = &value
+	return nil
+}
+
+func (t NullableTime) MarshalJSON() ([]byte, error) {
+	if t.Value == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Value)
+}
+
+// Stats сводка по клиентам
+type Stats = models.Stats
+
+// Error ошибка запроса: стабильный код для программ и сообщение для людей
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse тело ответа с ошибкой
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// Коды ошибок
+const (
+	CodeInvalidRequest  = "invalid_request"  // неверные данные или параметры запроса
+	CodeUnauthorized    = "unauthorized"     // нужен вход пользователем панели
+	CodeNotFound        = "not_found"        // запись не найдена
+	CodeServerNotFound  = "server_not_found" // сервер клиента не найден
+	CodeServerExists    = "server_exists"    // сервер с таким именем уже есть
+	CodeAddressTaken    = "address_taken"    // адрес занят другим клиентом
+	CodeKeyTaken        = "key_taken"        // открытый ключ занят другим клиентом
+	CodeConflict        = "conflict"         // операция невозможна в текущем состоянии
+	CodeVersionConflict = "version_conflict" // запись изменена, If-Match не совпал
+	CodeWireGuard       = "wireguard_error"  // не удалось изменить интерфейс WireGuard
+	CodeInternal        = "internal_error"
+)
+
+// FromServer представление сервера в API
+func FromServer(server *models.Server) Server {
+	return Server{
+		ID:           server.ID,
+		Name:         server.Name,
+		ListenPort:   server.ListenPort,
+		PublicKey:    server.PublicKey,
+		Network:      server.Network,
+		DNS:          server.DNS,
+		AllowedIPs:   server.AllowedIPs,
+		Endpoint:     server.Endpoint,
+		IsActive:     server.IsActive,
+		KeyRotatedAt: server.KeyRotatedAt,
+		CreatedAt:    server.CreatedAt,
+		UpdatedAt:    server.UpdatedAt,
+		Version:      server.Version,
+	}
+}
+
+// FromClient представление клиента в API
+func FromClient(client *models.Client) Client {
+	tags := client.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return Client{
+		ID:               client.ID,
+		ServerID:         client.ServerID,
+		Name:             client.Name,
+		Email:            client.Email,
+		Tags:             tags,
+		PublicKey:        client.PublicKey,
+		ClientKey:        client.ClientKey,
+		AllowedIPs:       client.AllowedIPs,
+		Status:           client.Status(),
+		IsActive:         client.IsActive,
+		IsDisabled:       client.IsDisabled,
+		Downloaded:       client.Downloaded,
+		ConfigOutdated:   client.ConfigOutdated,
+		ReceiveBytes:     client.ReceiveBytes,
+		TransmitBytes:    client.TransmitBytes,
+		LastHandshake:    client.LastHandshake,
+		QuotaBytes:       client.QuotaBytes,
+		QuotaPeriod:      client.QuotaPeriod,
+		PeriodUsage:      client.PeriodUsage,
+		IngressKbit:      client.IngressKbit,
+		EgressKbit:       client.EgressKbit,
+		Schedule:         client.Schedule,
+		ExpiresAt:        client.ExpiresAt,
+		RotationDeadline: client.RotationDeadline,
+		Kind:             client.Kind,
+		Subnets:          client.Subnets,
+		LocalSubnets:     client.LocalSubnets,
+		Endpoint:         client.Endpoint,
+		CreatedAt:        client.CreatedAt,
+		UpdatedAt:        client.UpdatedAt,
+		Version:          client.Version,
+	}
+}
+
+// ToServer сервер из запроса на создание
+func (r *CreateServerRequest) ToServer() models.Server {
+	return models.Server{
+		Name:       r.Name,
+		ListenPort: r.ListenPort,
+		PrivateKey: r.PrivateKey,
+		Network:    r.Network,
+		DNS:        r.DNS,
+		AllowedIPs: r.AllowedIPs,
+		Endpoint:   r.Endpoint,
+	}
+}
+
+// ToClient клиент из запроса на создание
+func (r *CreateClientRequest) ToClient() models.Client {
+	return models.Client{
+		ServerID:    r.ServerID,
+		Name:        r.Name,
+		Email:       r.Email,
+		Tags:        r.Tags,
+		PublicKey:   r.PublicKey,
+		PrivateKey:  r.PrivateKey,
+		AllowedIPs:  r.AllowedIPs,
+		QuotaBytes:  r.QuotaBytes,
+		QuotaPeriod: r.QuotaPeriod,
+		IngressKbit: r.IngressKbit,
+		EgressKbit:  r.EgressKbit,
+		Schedule:    r.Schedule,
+		ExpiresAt:   r.ExpiresAt,
+
+		Kind:         r.Kind,
+		Subnets:      r.Subnets,
+		LocalSubnets: r.LocalSubnets,
+		Endpoint:     r.Endpoint,
+	}
+}
@@ -0,0 +1,349 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Действия журнала аудита
+const (
+	ActionServerCreate   = "server.create"
+	ActionServerUpdate   = "server.update"
+	ActionServerDelete   = "server.delete"
+	ActionServerRotate   = "server.key_rotate"
+	ActionClientCreate   = "client.create"
+	ActionClientUpdate   = "client.update"
+	ActionClientDisable  = "client.disable"
+	ActionClientEnable   = "client.enable"
+	ActionClientDelete   = "client.delete"
+	ActionClientSchedule = "client.schedule"
+	ActionClientRotate   = "client.key_rotate"
+	ActionRotateCancel   = "client.key_rotate_cancel"
+	ActionRotateComplete = "client.key_rotate_complete"
+	ActionConfigDownload = "client.config_download"
+	ActionConfigEmail    = "client.config_email"
+	ActionLinkCreate     = "client.link_create"
+	ActionLinkRevoke     = "client.link_revoke"
+	ActionLinkDownload   = "client.link_download"
+	ActionClientExport   = "client.export"
+	ActionGroupCreate    = "group.create"
+	ActionGroupUpdate    = "group.update"
+	ActionGroupDelete    = "group.delete"
+	ActionWebhookCreate  = "webhook.create"
+	ActionWebhookDelete  = "webhook.delete"
+	ActionBackupCreate   = "backup.create"
+	ActionBackupRestore  = "backup.restore"
+)
+
+// redacted заменяет значения секретных полей в журнале
+const redacted = "***"
+
+// secretFields поля, значения которых не попадают в журнал
+var secretFields = map[string]bool{
+	"private_key":         true,
+	"pending_private_key": true,
+	"secret":              true,
+}
+
+// ignoredFields служебные поля и счетчики, изменение которых не считается правкой
+var ignoredFields = map[string]bool{
+	"updated_at":           true,
+	"receive_bytes":        true,
+	"transmit_bytes":       true,
+	"counter_rx":           true,
+	"counter_tx":           true,
+	"last_handshake":       true,
+	"period_usage":         true,
+	"next_schedule_change": true,
+}
+
+// Entry запись журнала аудита
+type Entry struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	SourceIP   string    `json:"source_ip"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	TargetName string    `json:"target_name,omitempty"`
+	Changes    []Change  `json:"changes,omitempty"`
+}
+
+// Change изменение одного поля объекта
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Filter условия выборки записей журнала
+type Filter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+}
+
+// Log журнал аудита, дописываемый в файл в формате JSON Lines.
+// Записи не изменяются и не удаляются.
+type Log struct {
+	mu      sync.RWMutex
+	file    *os.File
+	entries []Entry
+}
+
+// Open открывает журнал по пути path, загружая уже сохраненные записи.
+// Последняя запись, недописанная из-за сбоя, удаляется из файла. Пустой
+// путь создает журнал только в памяти.
+func Open(path string) (*Log, error) {
+	l := &Log{}
+	if path == "" {
+		return l, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	entries, keep, err := readEntries(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	if err := repairTail(file, keep); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("repair audit log: %w", err)
+	}
+
+	l.entries = entries
+	l.file = file
+	return l, nil
+}
+
+// readEntries читает записи журнала по строкам и возвращает их вместе с
+// длиной файла, которую нужно сохранить. Последняя строка без перевода
+// строки, которая не разбирается, остается от записи, прерванной сбоем, и
+// отбрасывается; ошибка в любой другой строке возвращается.
+func readEntries(r io.Reader) ([]Entry, int64, error) {
+	var (
+		entries []Entry
+		offset  int64
+	)
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, 0, err
+		}
+		complete := err == nil
+
+		if len(bytes.TrimSpace(data)) > 0 {
+			var entry Entry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				if !complete {
+					log.Printf("журнал аудита: отброшена незавершенная последняя запись (%d байт)", len(data))
+					return entries, offset, nil
+				}
+				return nil, 0, fmt.Errorf("line %d: %w", line, err)
+			}
+			entries = append(entries, entry)
+		}
+		offset += int64(len(data))
+		if !complete {
+			return entries, offset, nil
+		}
+	}
+}
+
+// repairTail обрезает файл журнала до длины keep и завершает последнюю
+// строку переводом строки, чтобы следующая запись начиналась с новой строки
+func repairTail(file *os.File, keep int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > keep {
+		if err := file.Truncate(keep); err != nil {
+			return err
+		}
+	}
+	if keep == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, keep-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		_, err = file.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// Close закрывает файл журнала
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Record дописывает запись в журнал, заполняя ее идентификатор и время
+func (l *Log) Record(entry Entry) error {
+	entry.ID = uuid.New().String()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("encode audit entry: %w", err)
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write audit entry: %w", err)
+		}
+	}
+
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// Query возвращает записи, подходящие под фильтр, от новых к старым
+func (l *Log) Query(filter Filter) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make([]Entry, 0)
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		entry := l.entries[i]
+		if !filter.matches(entry) {
+			continue
+		}
+		result = append(result, entry)
+		if filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+// WriteJSONLines выгружает записи в формате JSON Lines
+func WriteJSONLines(w io.Writer, entries []Entry) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+func (f Filter) matches(entry Entry) bool {
+	if f.Actor != "" && entry.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.TargetType != "" && entry.TargetType != f.TargetType {
+		return false
+	}
+	if f.TargetID != "" && entry.TargetID != f.TargetID {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Diff сравнивает JSON-представления объектов before и after и возвращает
+// изменившиеся поля. Любой из объектов может быть nil — при создании или
+// удалении. Значения секретных полей заменяются на "***".
+func Diff(before, after interface{}) []Change {
+	beforeFields := toFields(before)
+	afterFields := toFields(after)
+
+	keys := make(map[string]struct{})
+	for key := range beforeFields {
+		keys[key] = struct{}{}
+	}
+	for key := range afterFields {
+		keys[key] = struct{}{}
+	}
+
+	changes := make([]Change, 0)
+	for key := range keys {
+		if ignoredFields[key] {
+			continue
+		}
+		oldValue, newValue := beforeFields[key], afterFields[key]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if secretFields[key] {
+			oldValue, newValue = redactValue(oldValue), redactValue(newValue)
+		}
+		changes = append(changes, Change{Field: key, Before: oldValue, After: newValue})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func toFields(value interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return fields
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return map[string]interface{}{}
+	}
+	return fields
+}
+
+func redactValue(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return redacted
+}
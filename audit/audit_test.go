@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLog записывает в файл журнала строки content и открывает его
+func writeLog(t *testing.T, content string) (*Log, string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path)
+	if err == nil {
+		t.Cleanup(func() { l.Close() })
+	}
+	return l, path, err
+}
+
+const (
+	firstLine  = `{"id":"1","action":"client.create","target_id":"a"}` + "\n"
+	secondLine = `{"id":"2","action":"client.delete","target_id":"a"}` + "\n"
+)
+
+func TestOpenTruncatedLastLine(t *testing.T) {
+	l, path, err := writeLog(t, firstLine+secondLine+`{"id":"3","action":"cli`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := l.Query(Filter{}); len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if data, _ := os.ReadFile(path); string(data) != firstLine+secondLine {
+		t.Errorf("truncated record left in file: %q", data)
+	}
+
+	if err := l.Record(Entry{Action: ActionClientCreate, TargetID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+	if entries := reopened.Query(Filter{}); len(entries) != 3 || entries[0].TargetID != "b" {
+		t.Errorf("after reopen: %+v", entries)
+	}
+}
+
+func TestOpenUnterminatedLastLine(t *testing.T) {
+	l, path, err := writeLog(t, firstLine+strings.TrimSuffix(secondLine, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := l.Query(Filter{}); len(entries) != 2 {
+		t.Fatalf("complete record without newline dropped: %d entries", len(entries))
+	}
+	if err := l.Record(Entry{Action: ActionClientCreate, TargetID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); len(lines) != 3 || lines[1] != strings.TrimSuffix(secondLine, "\n") {
+		t.Errorf("records not separated by newlines: %q", data)
+	}
+}
+
+func TestOpenCorruptedLine(t *testing.T) {
+	if _, _, err := writeLog(t, firstLine+"not json\n"+secondLine); err == nil {
+		t.Fatal("corrupted record in the middle of the log was accepted")
+	}
+}
+
+func TestOpenEmpty(t *testing.T) {
+	l, _, err := writeLog(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := l.Query(Filter{}); len(entries) != 0 {
+		t.Errorf("got %d entries from an empty log", len(entries))
+	}
+}
@@ -0,0 +1,353 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/config"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/users"
+	"wireguard-web-manager/webhooks"
+	"wireguard-web-manager/wireguard"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// FormatVersion версия формата резервной копии. Во второй версии добавлены
+// пользователи панели и настройки; архивы первой версии читаются без них.
+const FormatVersion = 2
+
+// encryptedMagic начало зашифрованного архива; незашифрованный архив — gzip
+var encryptedMagic = []byte("WGMBAK\x01")
+
+// Параметры scrypt для ключа из пароля
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	saltLen = 16
+)
+
+var (
+	ErrPassphraseRequired = errors.New("backup is encrypted, passphrase required")
+	ErrWrongPassphrase    = errors.New("wrong passphrase or corrupted backup")
+)
+
+// Archive полное состояние менеджера: серверы с ключами, клиенты, группы,
+// подписки на события, пользователи панели и настройки
+type Archive struct {
+	Version   int                     `json:"version"`
+	CreatedAt time.Time               `json:"created_at"`
+	Servers   []*models.Server        `json:"servers"`
+	Clients   []*models.Client        `json:"clients"`
+	Groups    []*models.Group         `json:"groups"`
+	Webhooks  []webhooks.Subscription `json:"webhooks"`
+	Users     []users.Entry           `json:"users"`
+	Settings  string                  `json:"settings,omitempty"` // файл настроек YAML
+}
+
+// Collect собирает архив из хранилища, диспетчера событий, файла
+// пользователей и действующих настроек. dispatcher и userStore могут быть nil.
+func Collect(storage *models.Storage, dispatcher *webhooks.Dispatcher, userStore *users.Store, settings config.Config) (*Archive, error) {
+	archive := &Archive{
+		Version:   FormatVersion,
+		CreatedAt: time.Now(),
+		Webhooks:  []webhooks.Subscription{},
+		Users:     []users.Entry{},
+	}
+	archive.Servers, archive.Clients = storage.Snapshot()
+	sort.Slice(archive.Servers, func(i, j int) bool { return archive.Servers[i].ID < archive.Servers[j].ID })
+	sort.Slice(archive.Clients, func(i, j int) bool {
+		if archive.Clients[i].ServerID != archive.Clients[j].ServerID {
+			return archive.Clients[i].ServerID < archive.Clients[j].ServerID
+		}
+		return archive.Clients[i].Name < archive.Clients[j].Name
+	})
+	for _, group := range storage.GetAllGroups() {
+		copied := *group
+		archive.Groups = append(archive.Groups, &copied)
+	}
+	if dispatcher != nil {
+		archive.Webhooks = dispatcher.SubscriptionsWithSecrets()
+	}
+	if userStore != nil {
+		archive.Users = userStore.Entries()
+	}
+	data, err := config.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("encode settings: %w", err)
+	}
+	archive.Settings = string(data)
+	return archive, nil
+}
+
+// Write записывает архив в w. С непустым паролем архив шифруется AES-256-GCM
+// ключом, полученным из пароля через scrypt.
+func Write(w io.Writer, archive *Archive, passphrase string) error {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if err := json.NewEncoder(gz).Encode(archive); err != nil {
+		return fmt.Errorf("encode backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("compress backup: %w", err)
+	}
+
+	if passphrase == "" {
+		_, err := w.Write(compressed.Bytes())
+		return err
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+	aead, err := passphraseCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(encryptedMagic)+len(salt)+len(nonce)+compressed.Len()+aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, compressed.Bytes(), encryptedMagic)
+	_, err = w.Write(out)
+	return err
+}
+
+// Read читает архив, при необходимости расшифровывая его паролем
+func Read(r io.Reader, passphrase string) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read backup: %w", err)
+	}
+
+	if bytes.HasPrefix(data, encryptedMagic) {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		data = data[len(encryptedMagic):]
+		if len(data) < saltLen {
+			return nil, ErrWrongPassphrase
+		}
+		aead, err := passphraseCipher(passphrase, data[:saltLen])
+		if err != nil {
+			return nil, err
+		}
+		data = data[saltLen:]
+		if len(data) < aead.NonceSize() {
+			return nil, ErrWrongPassphrase
+		}
+		data, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], encryptedMagic)
+		if err != nil {
+			return nil, ErrWrongPassphrase
+		}
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("backup is not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	var archive Archive
+	if err := json.NewDecoder(bufio.NewReader(gz)).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("parse backup: %w", err)
+	}
+	if archive.Version < 1 || archive.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", archive.Version)
+	}
+	return &archive, nil
+}
+
+func passphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ValidationError ошибки содержимого архива
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid backup: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate проверяет целостность архива: ключи, принадлежность клиентов
+// серверам, уникальность идентификаторов, ключей, адресов и портов,
+// пользователей и значения настроек. Открытые ключи серверов
+// восстанавливаются из приватных.
+func Validate(archive *Archive) error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	servers := make(map[string]*models.Server, len(archive.Servers))
+	ports := make(map[int]string)
+	for i, server := range archive.Servers {
+		if server == nil || server.ID == "" {
+			fail("server #%d: id is required", i+1)
+			continue
+		}
+		if len(server.ID) > 15 || strings.ContainsAny(server.ID, "/ \t\n") {
+			fail("server %s: invalid interface name", server.ID)
+		}
+		if _, dup := servers[server.ID]; dup {
+			fail("server %s: duplicate id", server.ID)
+		}
+		servers[server.ID] = server
+
+		key, err := wgtypes.ParseKey(server.PrivateKey)
+		if err != nil {
+			fail("server %s: invalid private key", server.ID)
+		} else {
+			server.PublicKey = key.PublicKey().String()
+		}
+		if server.ListenPort < 0 || server.ListenPort > 65535 {
+			fail("server %s: invalid listen port %d", server.ID, server.ListenPort)
+		} else if server.ListenPort != 0 {
+			if other, dup := ports[server.ListenPort]; dup {
+				fail("server %s: listen port %d is already used by %s", server.ID, server.ListenPort, other)
+			}
+			ports[server.ListenPort] = server.ID
+		}
+		if server.Network != "" {
+			if _, _, err := net.ParseCIDR(server.Network); err != nil {
+				fail("server %s: invalid network %q", server.ID, server.Network)
+			}
+		}
+	}
+
+	clientIDs := make(map[string]bool, len(archive.Clients))
+	keys := make(map[string]string)
+	addresses := make(map[string]string)
+	for i, client := range archive.Clients {
+		if client == nil || client.ID == "" {
+			fail("client #%d: id is required", i+1)
+			continue
+		}
+		if clientIDs[client.ID] {
+			fail("client %s: duplicate id", client.ID)
+		}
+		clientIDs[client.ID] = true
+
+		if _, ok := servers[client.ServerID]; !ok {
+			fail("client %s: unknown server %q", client.ID, client.ServerID)
+		}
+
+		clientKeys := []string{client.PublicKey}
+		if client.PendingPublicKey != "" {
+			clientKeys = append(clientKeys, client.PendingPublicKey)
+		}
+		for _, key := range clientKeys {
+			if _, err := wgtypes.ParseKey(key); err != nil {
+				fail("client %s: invalid public key", client.ID)
+				continue
+			}
+			id := client.ServerID + "/" + key
+			if other, dup := keys[id]; dup {
+				fail("client %s: public key is already used by %s", client.ID, other)
+			}
+			keys[id] = client.ID
+		}
+		if client.PrivateKey != "" {
+			key, err := wgtypes.ParseKey(client.PrivateKey)
+			if err != nil || key.PublicKey().String() != client.PublicKey {
+				fail("client %s: private key does not match public key", client.ID)
+			}
+		}
+
+		if _, err := wireguard.ParseAllowedIPs(client.AllowedIPList()); err != nil {
+			fail("client %s: invalid allowed ips: %v", client.ID, err)
+			continue
+		}
+		for _, addr := range client.AllowedIPList() {
+			id := client.ServerID + "/" + addr
+			if other, dup := addresses[id]; dup {
+				fail("client %s: address %s is already used by %s", client.ID, addr, other)
+			}
+			addresses[id] = client.ID
+		}
+	}
+
+	groups := make(map[string]bool, len(archive.Groups))
+	for i, group := range archive.Groups {
+		if group == nil {
+			fail("group #%d: empty", i+1)
+			continue
+		}
+		if err := group.Validate(); err != nil {
+			fail("group %s: %v", group.Name, err)
+		}
+		if groups[group.Name] {
+			fail("group %s: duplicate name", group.Name)
+		}
+		groups[group.Name] = true
+	}
+
+	for i, sub := range archive.Webhooks {
+		if sub.ID == "" || sub.Secret == "" {
+			fail("webhook #%d: id and secret are required", i+1)
+			continue
+		}
+		if err := webhooks.ValidateSubscription(sub); err != nil {
+			fail("webhook %s: %v", sub.ID, err)
+		}
+	}
+
+	names := make(map[string]bool, len(archive.Users))
+	for i, entry := range archive.Users {
+		if err := users.ValidateEntry(entry); err != nil {
+			fail("user #%d: %v", i+1, err)
+			continue
+		}
+		if names[entry.Name] {
+			fail("user %s: duplicate name", entry.Name)
+		}
+		names[entry.Name] = true
+	}
+
+	if archive.Settings != "" {
+		settings, err := config.Parse([]byte(archive.Settings))
+		if err == nil {
+			err = settings.ValidateValues()
+		}
+		if err != nil {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fail("settings: %s", line)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+	"wireguard-web-manager/users"
+	"wireguard-web-manager/webhooks"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// ErrConflicts восстановление затрагивает существующие интерфейсы или
+// сохраненные серверы, а принудительное восстановление не запрошено
+var ErrConflicts = errors.New("backup conflicts with existing devices")
+
+// RestoreOptions параметры восстановления
+type RestoreOptions struct {
+	DryRun bool // только проверить архив и составить отчет
+	Force  bool // восстановить, несмотря на конфликты, заменив интерфейсы
+
+	// SettingsFile файл, в который записываются настройки из архива. Рабочие
+	// настройки задаются файлом, окружением и флагами, поэтому они не
+	// заменяются: файл подключается флагом -config. Пусто — не записывать.
+	SettingsFile string
+}
+
+// Report отчет о восстановлении
+type Report struct {
+	DryRun       bool           `json:"dry_run"`
+	Servers      []ServerReport `json:"servers"`
+	Groups       int            `json:"groups"`
+	Webhooks     int            `json:"webhooks"`
+	Users        int            `json:"users"`
+	SettingsFile string         `json:"settings_file,omitempty"`
+	Warnings     []string       `json:"warnings,omitempty"`
+}
+
+// ServerReport отчет о восстановлении одного сервера
+type ServerReport struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Clients   int      `json:"clients"`
+	Exists    bool     `json:"exists"` // интерфейс или сервер уже есть на этом хосте
+	Conflicts []string `json:"conflicts,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+	Restored  bool     `json:"restored"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// HasConflicts сообщает, найдены ли конфликты хотя бы по одному серверу
+func (r *Report) HasConflicts() bool {
+	for _, server := range r.Servers {
+		if len(server.Conflicts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore проверяет архив и восстанавливает из него интерфейсы, серверы,
+// клиентов, подписки и пользователей, а настройки записывает в
+// opts.SettingsFile. Интерфейсы создаются заново через ConfigureServer с
+// заменой всех пиров. При конфликтах с существующими интерфейсами без
+// opts.Force ничего не меняется и возвращается ErrConflicts вместе с отчетом.
+// Серверы и клиенты заменяются через сервис. dispatcher и userStore могут
+// быть nil. Пустой список пользователей в архиве не удаляет пользователей
+// этого хоста, иначе панель осталась бы без входа.
+func Restore(svc *service.Service, storage *models.Storage, dispatcher *webhooks.Dispatcher, userStore *users.Store, archive *Archive, opts RestoreOptions) (*Report, error) {
+	if err := Validate(archive); err != nil {
+		return nil, err
+	}
+
+	report, err := plan(svc, archive)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = opts.DryRun
+	if report.HasConflicts() && !opts.Force {
+		return report, ErrConflicts
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	storage.ReplaceGroups(archive.Groups)
+	report.Groups = len(archive.Groups)
+
+	clients := clientsByServer(archive)
+	var failed int
+	for i, server := range archive.Servers {
+		serverReport := &report.Servers[i]
+		if err := restoreServer(svc, server, clients[server.ID], serverReport); err != nil {
+			serverReport.Error = err.Error()
+			failed++
+			continue
+		}
+		serverReport.Restored = true
+	}
+
+	if dispatcher != nil {
+		for _, sub := range archive.Webhooks {
+			if err := dispatcher.RestoreSubscription(sub); err != nil {
+				return report, fmt.Errorf("restore webhook %s: %w", sub.ID, err)
+			}
+			report.Webhooks++
+		}
+	}
+
+	if len(archive.Users) > 0 {
+		if userStore == nil {
+			report.Warnings = append(report.Warnings, "users not restored: users file is not configured (paths.users)")
+		} else {
+			if err := userStore.Replace(archive.Users); err != nil {
+				return report, fmt.Errorf("restore users: %w", err)
+			}
+			report.Users = len(archive.Users)
+		}
+	}
+
+	if archive.Settings != "" {
+		if opts.SettingsFile == "" {
+			report.Warnings = append(report.Warnings, "settings not restored: no settings file given")
+		} else {
+			if err := writeSettings(opts.SettingsFile, []byte(archive.Settings)); err != nil {
+				return report, fmt.Errorf("restore settings: %w", err)
+			}
+			report.SettingsFile = opts.SettingsFile
+		}
+	}
+
+	if failed > 0 {
+		return report, fmt.Errorf("%d of %d servers were not restored", failed, len(archive.Servers))
+	}
+	return report, nil
+}
+
+// plan сравнивает архив с интерфейсами и хранилищем этого хоста
+func plan(svc *service.Service, archive *Archive) (*Report, error) {
+	list, err := svc.Devices()
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]*wgtypes.Device, len(list))
+	for _, device := range list {
+		devices[device.Name] = device
+	}
+
+	clients := clientsByServer(archive)
+	report := &Report{Servers: make([]ServerReport, 0, len(archive.Servers))}
+	for _, server := range archive.Servers {
+		serverReport := ServerReport{
+			ID:      server.ID,
+			Name:    server.Name,
+			Clients: len(clients[server.ID]),
+		}
+
+		if existing, err := svc.Server(server.ID); err == nil {
+			serverReport.Exists = true
+			if existing.PrivateKey != "" && existing.PrivateKey != server.PrivateKey {
+				serverReport.Conflicts = append(serverReport.Conflicts, "saved server has a different private key")
+			}
+		}
+
+		if device, ok := devices[server.ID]; ok {
+			serverReport.Exists = true
+			if device.PrivateKey.String() != server.PrivateKey {
+				serverReport.Conflicts = append(serverReport.Conflicts, "interface exists with a different private key")
+			}
+
+			known := make(map[string]bool)
+			for _, client := range clients[server.ID] {
+				known[client.PublicKey] = true
+				if client.PendingPublicKey != "" {
+					known[client.PendingPublicKey] = true
+				}
+			}
+			unknown := 0
+			for _, peer := range device.Peers {
+				if !known[peer.PublicKey.String()] {
+					unknown++
+				}
+			}
+			if unknown > 0 {
+				serverReport.Conflicts = append(serverReport.Conflicts, fmt.Sprintf("%d peers on the interface are not in the backup and will be removed", unknown))
+			}
+		}
+
+		if server.ListenPort != 0 {
+			for name, device := range devices {
+				if name != server.ID && device.ListenPort == server.ListenPort {
+					serverReport.Conflicts = append(serverReport.Conflicts, fmt.Sprintf("listen port %d is used by interface %s", server.ListenPort, name))
+				}
+			}
+		}
+
+		report.Servers = append(report.Servers, serverReport)
+	}
+	return report, nil
+}
+
+// restoreServer настраивает интерфейс сервера с пирами его клиентов и
+// сохраняет сервер и клиентов в хранилище
+func restoreServer(svc *service.Service, server *models.Server, clients []*models.Client, report *ServerReport) error {
+	restored := make([]models.Client, len(clients))
+	for i, client := range clients {
+		restored[i] = *client
+	}
+	warnings, err := svc.RestoreServer(*server, restored)
+	report.Warnings = append(report.Warnings, warnings...)
+	return err
+}
+
+func clientsByServer(archive *Archive) map[string][]*models.Client {
+	result := make(map[string][]*models.Client)
+	for _, client := range archive.Clients {
+		result[client.ServerID] = append(result[client.ServerID], client)
+	}
+	for _, clients := range result {
+		sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+	}
+	return result
+}
+
+// writeSettings атомарно записывает файл настроек
+func writeSettings(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
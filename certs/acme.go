@@ -0,0 +1,63 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEOptions параметры получения сертификатов по протоколу ACME
+type ACMEOptions struct {
+	Directory string   // адрес каталога ACME-сервера
+	Email     string   // контакт для уведомлений об истечении, необязателен
+	CacheDir  string   // каталог для ключа учетной записи и сертификатов
+	CARoot    string   // PEM с корнем ACME-сервера вне системного хранилища
+	Hosts     []string // домены, для которых разрешено запрашивать сертификаты
+}
+
+// NewACME создает менеджер сертификатов ACME. Сертификаты запрашиваются при
+// первом TLS-подключении к домену из Hosts и продлеваются автоматически.
+// Проверка владения доменом проходит через tls-alpn-01 на HTTPS-порту или
+// через http-01, если запросы на порт 80 обслуживает HTTPHandler менеджера.
+func NewACME(opts ACMEOptions) (*autocert.Manager, error) {
+	if len(opts.Hosts) == 0 {
+		return nil, errors.New("acme: at least one host is required")
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("acme cache dir: %w", err)
+	}
+
+	httpClient := &http.Client{Timeout: time.Minute}
+	if opts.CARoot != "" {
+		data, err := os.ReadFile(opts.CARoot)
+		if err != nil {
+			return nil, fmt.Errorf("acme ca root: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("acme ca root: no certificates in %s", opts.CARoot)
+		}
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(opts.CacheDir),
+		HostPolicy: autocert.HostWhitelist(opts.Hosts...),
+		Email:      opts.Email,
+		Client: &acme.Client{
+			DirectoryURL: opts.Directory,
+			HTTPClient:   httpClient,
+		},
+	}, nil
+}
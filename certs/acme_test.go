@@ -0,0 +1,465 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// idPeACMEIdentifier расширение сертификата с ответом на tls-alpn-01 (RFC 8737)
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// acmeStub ACME-сервер для тестов в духе Pebble: выдает сертификаты от
+// собственного корня и проверяет tls-alpn-01, подключаясь к validateAddr.
+// Подписи JWS не проверяются.
+type acmeStub struct {
+	server       *httptest.Server
+	validateAddr string
+
+	caKey  *ecdsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu         sync.Mutex
+	nonce      int
+	thumbprint string
+	orders     []*stubOrder
+	failed     error
+}
+
+type stubOrder struct {
+	domain     string
+	token      string
+	authzValid bool
+	chain      []byte
+}
+
+func newACMEStub(t *testing.T) *acmeStub {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acme stub root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &acmeStub{caKey: caKey, caCert: caCert}
+	stub.server = httptest.NewTLSServer(http.HandlerFunc(stub.serveHTTP))
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *acmeStub) url(path string) string {
+	return s.server.URL + path
+}
+
+// rootPEM корень TLS-сертификата самого ACME-сервера
+func (s *acmeStub) rootPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.server.Certificate().Raw})
+}
+
+// validationError причина последней неудачной проверки
+func (s *acmeStub) validationError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failed
+}
+
+func (s *acmeStub) orderCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.orders)
+}
+
+func (s *acmeStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", s.nonce))
+	if r.URL.Path == "/directory" {
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   s.url("/new-nonce"),
+			"newAccount": s.url("/new-account"),
+			"newOrder":   s.url("/new-order"),
+		})
+		return
+	}
+	if r.URL.Path == "/new-nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.problem(w, http.StatusMethodNotAllowed, "malformed", "POST required")
+		return
+	}
+
+	header, payload, err := decodeJWS(r)
+	if err != nil {
+		s.problem(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+
+	var kind string
+	var id int
+	fmt.Sscanf(strings.Replace(strings.TrimPrefix(r.URL.Path, "/"), "/", " ", 1), "%s %d", &kind, &id)
+	var order *stubOrder
+	if id > 0 && id <= len(s.orders) {
+		order = s.orders[id-1]
+	}
+
+	switch {
+	case kind == "new-account":
+		thumbprint, err := jwkThumbprint(header.JWK)
+		if err != nil {
+			s.problem(w, http.StatusBadRequest, "malformed", err.Error())
+			return
+		}
+		s.thumbprint = thumbprint
+		w.Header().Set("Location", s.url("/account/1"))
+		s.writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case kind == "new-order":
+		var req struct {
+			Identifiers []struct{ Type, Value string }
+		}
+		if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) != 1 {
+			s.problem(w, http.StatusBadRequest, "malformed", "one identifier expected")
+			return
+		}
+		s.orders = append(s.orders, &stubOrder{domain: req.Identifiers[0].Value, token: fmt.Sprintf("token%d", len(s.orders)+1)})
+		id = len(s.orders)
+		w.Header().Set("Location", s.url(fmt.Sprintf("/order/%d", id)))
+		s.writeJSON(w, http.StatusCreated, s.orderJSON(id))
+	case order == nil:
+		s.problem(w, http.StatusNotFound, "malformed", "unknown resource")
+	case kind == "order":
+		w.Header().Set("Location", s.url(fmt.Sprintf("/order/%d", id)))
+		s.writeJSON(w, http.StatusOK, s.orderJSON(id))
+	case kind == "authz":
+		s.writeJSON(w, http.StatusOK, s.authzJSON(id))
+	case kind == "chall":
+		if err := s.validate(order); err != nil {
+			s.failed = err
+		} else {
+			order.authzValid = true
+		}
+		s.writeJSON(w, http.StatusOK, s.authzJSON(id)["challenges"].([]interface{})[0])
+	case kind == "finalize":
+		var req struct{ CSR string }
+		if err := json.Unmarshal(payload, &req); err != nil {
+			s.problem(w, http.StatusBadRequest, "malformed", err.Error())
+			return
+		}
+		if err := s.issue(order, req.CSR); err != nil {
+			s.problem(w, http.StatusBadRequest, "badCSR", err.Error())
+			return
+		}
+		w.Header().Set("Location", s.url(fmt.Sprintf("/order/%d", id)))
+		s.writeJSON(w, http.StatusOK, s.orderJSON(id))
+	case kind == "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(order.chain)
+	default:
+		s.problem(w, http.StatusNotFound, "malformed", "unknown resource")
+	}
+}
+
+func (s *acmeStub) orderJSON(id int) map[string]interface{} {
+	order := s.orders[id-1]
+	status := "pending"
+	switch {
+	case s.failed != nil:
+		status = "invalid"
+	case order.chain != nil:
+		status = "valid"
+	case order.authzValid:
+		status = "ready"
+	}
+	result := map[string]interface{}{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": order.domain}},
+		"authorizations": []string{s.url(fmt.Sprintf("/authz/%d", id))},
+		"finalize":       s.url(fmt.Sprintf("/finalize/%d", id)),
+	}
+	if order.chain != nil {
+		result["certificate"] = s.url(fmt.Sprintf("/cert/%d", id))
+	}
+	return result
+}
+
+func (s *acmeStub) authzJSON(id int) map[string]interface{} {
+	order := s.orders[id-1]
+	status := "pending"
+	switch {
+	case order.authzValid:
+		status = "valid"
+	case s.failed != nil:
+		status = "invalid"
+	}
+	return map[string]interface{}{
+		"status":     status,
+		"identifier": map[string]string{"type": "dns", "value": order.domain},
+		"challenges": []interface{}{map[string]string{
+			"type":   "tls-alpn-01",
+			"url":    s.url(fmt.Sprintf("/chall/%d", id)),
+			"token":  order.token,
+			"status": status,
+		}},
+	}
+}
+
+// validate проверяет ответ на tls-alpn-01: сертификат, отданный по
+// протоколу acme-tls/1, должен содержать хеш авторизации ключа
+func (s *acmeStub) validate(order *stubOrder) error {
+	conn, err := tls.Dial("tcp", s.validateAddr, &tls.Config{
+		ServerName:         order.domain,
+		NextProtos:         []string{"acme-tls/1"},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != "acme-tls/1" {
+		return fmt.Errorf("negotiated %q", state.NegotiatedProtocol)
+	}
+
+	want := sha256.Sum256([]byte(order.token + "." + s.thumbprint))
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if !ext.Id.Equal(idPeACMEIdentifier) {
+			continue
+		}
+		var got []byte
+		if _, err := asn1.Unmarshal(ext.Value, &got); err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want[:]) {
+			return errors.New("key authorization mismatch")
+		}
+		return nil
+	}
+	return errors.New("acmeIdentifier extension missing")
+}
+
+func (s *acmeStub) issue(order *stubOrder, encoded string) error {
+	if !order.authzValid {
+		return errors.New("order is not ready")
+	}
+	der, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return err
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != order.domain {
+		return fmt.Errorf("csr names %v", csr.DNSNames)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(s.orders) + 1)),
+		Subject:      pkix.Name{CommonName: order.domain},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour), // дольше окна продления autocert
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		return err
+	}
+	order.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})...)
+	return nil
+}
+
+func (s *acmeStub) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *acmeStub) problem(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"type": "urn:ietf:params:acme:error:" + typ, "detail": detail})
+}
+
+type jwsHeader struct {
+	JWK map[string]string `json:"jwk"`
+}
+
+func decodeJWS(r *http.Request) (jwsHeader, []byte, error) {
+	var body struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	var header jwsHeader
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return header, nil, err
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(body.Protected)
+	if err != nil {
+		return header, nil, err
+	}
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return header, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body.Payload)
+	return header, payload, err
+}
+
+// jwkThumbprint отпечаток ключа учетной записи EC по RFC 7638
+func jwkThumbprint(jwk map[string]string) (string, error) {
+	if jwk["kty"] != "EC" {
+		return "", fmt.Errorf("unsupported account key type %q", jwk["kty"])
+	}
+	canonical := fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk["crv"], jwk["x"], jwk["y"])
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// serveTLS обслуживает TLS-подключения с настройками менеджера, как
+// HTTPS-порт сервера, и возвращает адрес
+func serveTLS(t *testing.T, manager *autocert.Manager) string {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", manager.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func newStubManager(t *testing.T, stub *acmeStub, cacheDir string) *autocert.Manager {
+	t.Helper()
+	caRoot := filepath.Join(t.TempDir(), "acme-root.pem")
+	if err := os.WriteFile(caRoot, stub.rootPEM(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := NewACME(ACMEOptions{
+		Directory: stub.url("/directory"),
+		Email:     "admin@example.com",
+		CacheDir:  cacheDir,
+		CARoot:    caRoot,
+		Hosts:     []string{"vpn.example.test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestACMEIssuesCertificate(t *testing.T) {
+	stub := newACMEStub(t)
+	cacheDir := filepath.Join(t.TempDir(), "acme")
+	manager := newStubManager(t, stub, cacheDir)
+	addr := serveTLS(t, manager)
+	stub.validateAddr = addr
+
+	roots := x509.NewCertPool()
+	roots.AddCert(stub.caCert)
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: "vpn.example.test", RootCAs: roots})
+	if err != nil {
+		t.Fatalf("handshake with issued certificate: %v (acme: %v)", err, stub.validationError())
+	}
+	conn.Close()
+	if stub.orderCount() != 1 {
+		t.Errorf("placed %d orders, want 1", stub.orderCount())
+	}
+
+	// После перезапуска сертификат берется из кеша без нового заказа
+	restarted := newStubManager(t, stub, cacheDir)
+	cert, err := restarted.GetCertificate(&tls.ClientHelloInfo{ServerName: "vpn.example.test", CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}})
+	if err != nil {
+		t.Fatalf("cached certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "vpn.example.test", Roots: roots}); err != nil {
+		t.Errorf("cached certificate: %v", err)
+	}
+	if stub.orderCount() != 1 {
+		t.Errorf("placed %d orders after restart, want 1", stub.orderCount())
+	}
+}
+
+func TestACMERejectsUnknownHost(t *testing.T) {
+	stub := newACMEStub(t)
+	manager := newStubManager(t, stub, t.TempDir())
+
+	if _, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.test"}); err == nil {
+		t.Fatal("certificate requested for a host outside Hosts")
+	}
+	if stub.orderCount() != 0 {
+		t.Errorf("placed %d orders, want 0", stub.orderCount())
+	}
+}
+
+func TestNewACMEOptions(t *testing.T) {
+	if _, err := NewACME(ACMEOptions{CacheDir: t.TempDir()}); err == nil {
+		t.Error("manager created without hosts")
+	}
+
+	badRoot := filepath.Join(t.TempDir(), "root.pem")
+	if err := os.WriteFile(badRoot, []byte("no certificates"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewACME(ACMEOptions{CacheDir: t.TempDir(), CARoot: badRoot, Hosts: []string{"vpn.example.test"}}); err == nil {
+		t.Error("manager created with an empty CA root")
+	}
+}
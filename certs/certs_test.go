@@ -0,0 +1,202 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert записывает самоподписанный сертификат для host со сроком
+// действия до notAfter
+func writeTestCert(t *testing.T, certFile, keyFile, host string, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestEnsureSelfSignedFirstRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	cert, created, err := EnsureSelfSigned(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if !created {
+		t.Error("certificate was not reported as created")
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("default certificate: %v", err)
+		}
+	}
+	if validity := cert.NotAfter.Sub(time.Now()); validity < selfSignedValidity-time.Hour || validity > selfSignedValidity {
+		t.Errorf("certificate valid for %v, want %v", validity, selfSignedValidity)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode %o, want 600", perm)
+	}
+	if _, err := os.Stat(certFile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Errorf("written files do not form a key pair: %v", err)
+	}
+
+	again, created, err := EnsureSelfSigned(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if created || Fingerprint(again) != Fingerprint(cert) {
+		t.Error("valid certificate was regenerated")
+	}
+}
+
+func TestEnsureSelfSignedHosts(t *testing.T) {
+	dir := t.TempDir()
+	cert, _, err := EnsureSelfSigned(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), []string{"vpn.example.com", "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "vpn.example.com" {
+		t.Errorf("common name %q", cert.Subject.CommonName)
+	}
+	for _, host := range []string{"vpn.example.com", "10.0.0.1"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := cert.VerifyHostname("localhost"); err == nil {
+		t.Error("certificate with explicit hosts also covers localhost")
+	}
+}
+
+func TestEnsureSelfSignedRenewsExpiring(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	old := writeTestCert(t, certFile, keyFile, "localhost", time.Now().Add(renewBefore-time.Hour))
+
+	cert, created, err := EnsureSelfSigned(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || Fingerprint(cert) == Fingerprint(old) {
+		t.Fatal("expiring certificate was not renewed")
+	}
+	if !cert.NotAfter.After(time.Now().Add(renewBefore)) {
+		t.Errorf("renewed certificate expires at %v", cert.NotAfter)
+	}
+}
+
+func TestEnsureSelfSignedKeepsBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := EnsureSelfSigned(certFile, keyFile, nil); err == nil {
+		t.Fatal("broken files were accepted")
+	}
+	if data, _ := os.ReadFile(certFile); string(data) != "not a certificate" {
+		t.Error("broken certificate file was overwritten")
+	}
+}
+
+func TestFileSourceReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first := writeTestCert(t, certFile, keyFile, "first.example.com", time.Now().Add(time.Hour))
+
+	source, err := NewFileSource(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := func() *x509.Certificate {
+		t.Helper()
+		cert, err := source.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf
+	}
+	if Fingerprint(served()) != Fingerprint(first) {
+		t.Fatal("source does not serve the loaded certificate")
+	}
+
+	second := writeTestCert(t, certFile, keyFile, "second.example.com", time.Now().Add(time.Hour))
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if Fingerprint(served()) != Fingerprint(second) {
+		t.Error("renewed certificate was not picked up")
+	}
+
+	// Пока файлы заменяются, отдается загруженный сертификат
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if Fingerprint(served()) != Fingerprint(second) {
+		t.Error("certificate lost while files are missing")
+	}
+}
+
+func TestNewFileSourceMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileSource(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")); err == nil {
+		t.Fatal("source created without files")
+	}
+}
@@ -0,0 +1,884 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/backup"
+	"wireguard-web-manager/config"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/users"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const serverUsage = `использование:
+  server list [-json]                          список серверов
+  server create NAME [-port N] [-network CIDR] [-dns IP] [-allowed-ips CIDR]
+                [-endpoint HOST:PORT] [-json]  создать сервер
+  server delete NAME                           удалить сервер вместе с клиентами`
+
+const clientUsage = `использование:
+  client list [-server NAME] [-search TEXT] [-status S] [-tag T] [-sort F] [-json]
+  client add NAME [-server NAME] [-email E] [-tags a,b] [-allowed-ips CIDR]
+             [-public-key KEY] [-expires 2006-01-02] [-json]
+  client add NAME -site -public-key KEY -endpoint HOST:PORT -subnets CIDR,...
+             [-local-subnets CIDR,...]   добавить площадку
+  client add NAME -from FILE             добавить площадку по описанию client link
+  client link CLIENT [-server NAME] [-o FILE]
+                                         описание встречной площадки для
+                                         сервера на другой стороне
+  client disable|enable CLIENT [-server NAME] [-json]
+  client delete CLIENT [-server NAME]
+  client config CLIENT [-server NAME] [-o FILE]
+  client qr CLIENT [-server NAME] [-png FILE]
+CLIENT — идентификатор или имя клиента`
+
+const userUsage = `использование:
+  user add NAME [-password-stdin]  добавить пользователя панели; без
+                                   -password-stdin пароль генерируется`
+
+// envBackupPassphrase пароль резервной копии для backup и restore
+const envBackupPassphrase = "WG_BACKUP_PASSPHRASE"
+
+// parseFlags разбирает флаги вперемешку с позиционными аргументами:
+// client disable alice -json
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// oneArg единственный позиционный аргумент команды
+func oneArg(args []string, usage string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", errors.New(usage)
+	}
+	return args[0], nil
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// formatBytes размер в двоичных единицах: 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for value := n / unit; value >= unit; value /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "да"
+	}
+	return "нет"
+}
+
+// writeOutput записывает data в файл path или в stdout, если path пустой или "-"
+func writeOutput(path string, data []byte) error {
+	if path == "" || path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// readInput содержимое файла path или stdin для "-"
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readPassphrase пароль резервной копии из файла или переменной окружения
+func readPassphrase(path string) (string, error) {
+	if path == "" {
+		return os.Getenv(envBackupPassphrase), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func runServer(cc *controlClient, args []string) error {
+	if len(args) == 0 {
+		return errors.New(serverUsage)
+	}
+
+	flags := flag.NewFlagSet("server "+args[0], flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "вывод в формате JSON")
+
+	switch args[0] {
+	case "list":
+		if rest, err := parseFlags(flags, args[1:]); err != nil {
+			return err
+		} else if len(rest) > 0 {
+			return errors.New(serverUsage)
+		}
+		var list apiv1.ServerList
+		if err := cc.call(http.MethodGet, apiv1.BasePath+"/servers", nil, &list); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(list.Items)
+		}
+		printServers(list.Items)
+		return nil
+
+	case "create":
+		var req apiv1.CreateServerRequest
+		flags.IntVar(&req.ListenPort, "port", 0, "порт; по умолчанию из настроек")
+		flags.StringVar(&req.Network, "network", "", "сеть клиентов; по умолчанию из настроек")
+		flags.StringVar(&req.DNS, "dns", "", "DNS для клиентов; по умолчанию из настроек")
+		flags.StringVar(&req.AllowedIPs, "allowed-ips", "", "AllowedIPs клиентов; по умолчанию из настроек")
+		flags.StringVar(&req.Endpoint, "endpoint", "", "внешний адрес сервера host:port")
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		if req.Name, err = oneArg(rest, serverUsage); err != nil {
+			return err
+		}
+		var created apiv1.Server
+		if err := cc.call(http.MethodPost, apiv1.BasePath+"/servers", req, &created); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(created)
+		}
+		printServers([]apiv1.Server{created})
+		return nil
+
+	case "delete":
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		name, err := oneArg(rest, serverUsage)
+		if err != nil {
+			return err
+		}
+		if err := cc.call(http.MethodDelete, apiv1.BasePath+"/servers/"+url.PathEscape(name), nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Сервер %s удален\n", name)
+		return nil
+
+	default:
+		return errors.New(serverUsage)
+	}
+}
+
+func printServers(servers []apiv1.Server) {
+	table := newTable()
+	fmt.Fprintln(table, "ИМЯ\tПОРТ\tСЕТЬ\tENDPOINT\tАКТИВЕН\tОТКРЫТЫЙ КЛЮЧ")
+	for _, server := range servers {
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s\t%s\n", server.Name, server.ListenPort, server.Network,
+			server.Endpoint, yesNo(server.IsActive), server.PublicKey)
+	}
+	table.Flush()
+}
+
+func runClient(cc *controlClient, args []string) error {
+	if len(args) == 0 {
+		return errors.New(clientUsage)
+	}
+
+	flags := flag.NewFlagSet("client "+args[0], flag.ContinueOnError)
+	serverID := flags.String("server", "", "сервер клиента")
+	asJSON := flags.Bool("json", false, "вывод в формате JSON")
+
+	switch args[0] {
+	case "list":
+		filter := url.Values{}
+		search := flags.String("search", "", "подстрока имени, email, адреса или ключа")
+		status := flags.String("status", "", "состояния через запятую: active, disabled, expired, quota_exceeded, outside_schedule")
+		tag := flags.String("tag", "", "тег")
+		sort := flags.String("sort", "", "name, email, address, created, last_handshake или traffic; - для обратного порядка")
+		if rest, err := parseFlags(flags, args[1:]); err != nil {
+			return err
+		} else if len(rest) > 0 {
+			return errors.New(clientUsage)
+		}
+		for key, value := range map[string]string{"server_id": *serverID, "search": *search, "status": *status, "tag": *tag, "sort": *sort} {
+			if value != "" {
+				filter.Set(key, value)
+			}
+		}
+		clients, err := listClients(cc, filter)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(clients)
+		}
+		printClients(clients)
+		return nil
+
+	case "add":
+		var req apiv1.CreateClientRequest
+		var tags, expires, subnets, localSubnets, from string
+		flags.StringVar(&req.Email, "email", "", "email клиента")
+		flags.StringVar(&tags, "tags", "", "теги через запятую")
+		flags.StringVar(&req.AllowedIPs, "allowed-ips", "", "адрес клиента; по умолчанию первый свободный")
+		flags.StringVar(&req.PublicKey, "public-key", "", "открытый ключ; приватный ключ тогда остается у клиента")
+		flags.StringVar(&expires, "expires", "", "срок доступа: дата 2006-01-02 или время RFC 3339")
+		site := flags.Bool("site", false, "площадка: шлюз другой сети с постоянным адресом")
+		flags.StringVar(&subnets, "subnets", "", "сети за площадкой через запятую")
+		flags.StringVar(&localSubnets, "local-subnets", "", "сети за сервером, доступные площадке, через запятую")
+		flags.StringVar(&req.Endpoint, "endpoint", "", "адрес шлюза площадки host:port")
+		flags.StringVar(&from, "from", "", "описание площадки от client link, \"-\" — stdin")
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		if req.Name, err = oneArg(rest, clientUsage); err != nil {
+			return err
+		}
+		if req.ServerID, err = defaultServer(cc, *serverID); err != nil {
+			return err
+		}
+		if tags != "" {
+			req.Tags = strings.Split(tags, ",")
+		}
+		// Флаги дополняют и уточняют описание площадки из файла
+		if from != "" {
+			data, err := readInput(from)
+			if err != nil {
+				return err
+			}
+			var link apiv1.CreateClientRequest
+			if err := json.Unmarshal(data, &link); err != nil {
+				return fmt.Errorf("%s: %w", from, err)
+			}
+			req.Kind, req.Subnets, req.LocalSubnets = link.Kind, link.Subnets, link.LocalSubnets
+			if req.PublicKey == "" {
+				req.PublicKey = link.PublicKey
+			}
+			if req.Endpoint == "" {
+				req.Endpoint = link.Endpoint
+			}
+		}
+		if *site {
+			req.Kind = models.PeerKindSite
+		}
+		if subnets != "" {
+			req.Subnets = strings.Split(subnets, ",")
+		}
+		if localSubnets != "" {
+			req.LocalSubnets = strings.Split(localSubnets, ",")
+		}
+		if expires != "" {
+			expiresAt, err := parseExpires(expires)
+			if err != nil {
+				return err
+			}
+			req.ExpiresAt = &expiresAt
+		}
+		var created apiv1.Client
+		if err := cc.call(http.MethodPost, apiv1.BasePath+"/clients", req, &created); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(created)
+		}
+		printClients([]apiv1.Client{created})
+		return nil
+
+	case "disable", "enable":
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		client, err := resolveClient(cc, *serverID, rest)
+		if err != nil {
+			return err
+		}
+		var updated apiv1.Client
+		if err := cc.call(http.MethodPost, clientPath(client.ID)+"/"+args[0], nil, &updated); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(updated)
+		}
+		printClients([]apiv1.Client{updated})
+		return nil
+
+	case "delete":
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		client, err := resolveClient(cc, *serverID, rest)
+		if err != nil {
+			return err
+		}
+		if err := cc.call(http.MethodDelete, clientPath(client.ID), nil, nil); err != nil {
+			return err
+		}
+		fmt.Printf("Клиент %s удален\n", client.Name)
+		return nil
+
+	case "link":
+		output := flags.String("o", "", "файл описания; по умолчанию stdout")
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		client, err := resolveClient(cc, *serverID, rest)
+		if err != nil {
+			return err
+		}
+		var link apiv1.CreateClientRequest
+		if err := cc.call(http.MethodGet, clientPath(client.ID)+"/site-link", nil, &link); err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(link, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeOutput(*output, append(data, '\n'))
+
+	case "config", "qr":
+		output := flags.String("o", "", "файл конфигурации; по умолчанию stdout")
+		pngFile := flags.String("png", "", "записать QR-код в PNG-файл вместо вывода в терминал")
+		rest, err := parseFlags(flags, args[1:])
+		if err != nil {
+			return err
+		}
+		client, err := resolveClient(cc, *serverID, rest)
+		if err != nil {
+			return err
+		}
+		resp, err := cc.do(http.MethodGet, clientPath(client.ID)+"/config", "", nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		config, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		if args[0] == "config" {
+			return writeOutput(*output, config)
+		}
+		if *pngFile != "" {
+			png, err := qrcode.Encode(string(config), qrcode.Medium, 512)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(*pngFile, png, 0o600)
+		}
+		code, err := qrcode.New(string(config), qrcode.Medium)
+		if err != nil {
+			return err
+		}
+		fmt.Print(code.ToSmallString(false))
+		return nil
+
+	default:
+		return errors.New(clientUsage)
+	}
+}
+
+func clientPath(id string) string {
+	return apiv1.BasePath + "/clients/" + url.PathEscape(id)
+}
+
+// listClients все клиенты по фильтру, страница за страницей
+func listClients(cc *controlClient, filter url.Values) ([]apiv1.Client, error) {
+	query := url.Values{}
+	for key, values := range filter {
+		query[key] = values
+	}
+	query.Set("limit", "1000")
+
+	clients := []apiv1.Client{}
+	for {
+		var page apiv1.ClientList
+		if err := cc.call(http.MethodGet, apiv1.BasePath+"/clients?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		clients = append(clients, page.Items...)
+		if page.NextCursor == "" {
+			return clients, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+// resolveClient клиент по идентификатору или имени. Одинаковые имена
+// различаются флагом -server.
+func resolveClient(cc *controlClient, serverID string, args []string) (apiv1.Client, error) {
+	ref, err := oneArg(args, clientUsage)
+	if err != nil {
+		return apiv1.Client{}, err
+	}
+
+	var client apiv1.Client
+	err = cc.call(http.MethodGet, clientPath(ref), nil, &client)
+	var apiErr *apiError
+	if err == nil && (serverID == "" || client.ServerID == serverID) {
+		return client, nil
+	}
+	if err != nil && (!errors.As(err, &apiErr) || apiErr.status != http.StatusNotFound) {
+		return apiv1.Client{}, err
+	}
+
+	filter := url.Values{"search": {ref}}
+	if serverID != "" {
+		filter.Set("server_id", serverID)
+	}
+	candidates, err := listClients(cc, filter)
+	if err != nil {
+		return apiv1.Client{}, err
+	}
+	var matches []apiv1.Client
+	for _, candidate := range candidates {
+		if candidate.Name == ref {
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return apiv1.Client{}, fmt.Errorf("клиент %q не найден", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return apiv1.Client{}, fmt.Errorf("клиентов с именем %q несколько: укажите идентификатор или -server", ref)
+	}
+}
+
+// defaultServer сервер для нового клиента: заданный или единственный
+func defaultServer(cc *controlClient, serverID string) (string, error) {
+	if serverID != "" {
+		return serverID, nil
+	}
+	var list apiv1.ServerList
+	if err := cc.call(http.MethodGet, apiv1.BasePath+"/servers", nil, &list); err != nil {
+		return "", err
+	}
+	if len(list.Items) != 1 {
+		return "", errors.New("укажите сервер флагом -server")
+	}
+	return list.Items[0].ID, nil
+}
+
+// parseExpires срок доступа: конец указанного дня по местному времени или
+// время RFC 3339
+func parseExpires(value string) (time.Time, error) {
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return day.AddDate(0, 0, 1), nil
+	}
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("неверный срок доступа %q: ожидается 2006-01-02 или RFC 3339", value)
+	}
+	return expires, nil
+}
+
+func printClients(clients []apiv1.Client) {
+	table := newTable()
+	fmt.Fprintln(table, "ИМЯ\tСЕРВЕР\tАДРЕС\tСОСТОЯНИЕ\tПОЛУЧЕНО\tОТПРАВЛЕНО\tID")
+	for _, client := range clients {
+		// У площадки за адресом в туннеле следуют ее сети
+		address := client.AllowedIPs
+		if len(client.Subnets) > 0 {
+			address += " + " + strings.Join(client.Subnets, ", ")
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", client.Name, client.ServerID, address,
+			client.Status, formatBytes(client.ReceiveBytes), formatBytes(client.TransmitBytes), client.ID)
+	}
+	table.Flush()
+}
+
+// importResult результат создания одного клиента при импорте
+type importResult struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// runImport создает клиентов из CSV или JSON, все вместе или ни одного
+func runImport(cc *controlClient, args []string) error {
+	const usage = `использование:
+  import FILE [-server NAME] [-json]  создать клиентов из CSV (name, email, server_id,
+                                      allowed_ips, public_key, quota_bytes, quota_period,
+                                      expires_at, tags) или JSON {"server_id", "clients"};
+                                      FILE "-" — stdin`
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	serverID := flags.String("server", "", "сервер для строк CSV без server_id")
+	format := flags.String("format", "", "csv или json; по умолчанию по расширению файла")
+	asJSON := flags.Bool("json", false, "вывод в формате JSON")
+	rest, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	path, err := oneArg(rest, usage)
+	if err != nil {
+		return err
+	}
+	data, err := readInput(path)
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = "csv"
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			*format = "json"
+		}
+	}
+	contentType := "text/csv"
+	switch *format {
+	case "csv":
+	case "json":
+		contentType = "application/json"
+	default:
+		return fmt.Errorf("неизвестный формат %q", *format)
+	}
+
+	query := ""
+	if *serverID != "" {
+		query = "?" + url.Values{"server_id": {*serverID}}.Encode()
+	}
+
+	var body struct {
+		Data struct {
+			Results []importResult `json:"results"`
+		} `json:"data"`
+	}
+	resp, err := cc.do(http.MethodPost, "/api/clients/bulk"+query, contentType, bytes.NewReader(data))
+	if err != nil {
+		// Отклоненный импорт возвращает результаты с ошибками по строкам
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && len(apiErr.data) > 0 && json.Unmarshal(apiErr.data, &body.Data) == nil && len(body.Data.Results) > 0 {
+			printImportResults(body.Data.Results, *asJSON)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	return printImportResults(body.Data.Results, *asJSON)
+}
+
+func printImportResults(results []importResult, asJSON bool) error {
+	if asJSON {
+		return printJSON(results)
+	}
+	table := newTable()
+	fmt.Fprintln(table, "№\tИМЯ\tРЕЗУЛЬТАТ")
+	for _, result := range results {
+		outcome := result.Error
+		switch {
+		case result.Success:
+			outcome = "создан " + result.ID
+		case outcome == "":
+			outcome = "не создан"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\n", result.Index+1, result.Name, outcome)
+	}
+	return table.Flush()
+}
+
+// runExport выгружает клиентов в CSV, JSON или XLSX
+func runExport(cc *controlClient, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	query := url.Values{}
+	params := []struct{ flag, query, usage string }{
+		{"format", "format", "csv, json или xlsx"},
+		{"columns", "columns", "колонки через запятую"},
+		{"server", "server_id", "сервер"},
+		{"search", "search", "подстрока имени, email, адреса или ключа"},
+		{"tag", "tag", "тег"},
+		{"status", "status", "состояние клиента"},
+	}
+	values := make([]*string, len(params))
+	for i, param := range params {
+		values[i] = flags.String(param.flag, "", param.usage)
+	}
+	includeKeys := flags.Bool("include-keys", false, "разрешить колонки public_key и private_key")
+	output := flags.String("o", "", "файл выгрузки; по умолчанию stdout")
+	if rest, err := parseFlags(flags, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New("использование: export [-format csv|json|xlsx] [-columns a,b] [-server NAME] [-search TEXT] [-tag T] [-status S] [-include-keys] [-o FILE]")
+	}
+	for i, param := range params {
+		if *values[i] != "" {
+			query.Set(param.query, *values[i])
+		}
+	}
+	if *includeKeys {
+		query.Set("include_keys", "true")
+	}
+
+	resp, err := cc.do(http.MethodGet, "/api/clients/export?"+query.Encode(), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*output, data)
+}
+
+// runBackup сохраняет резервную копию всего состояния
+func runBackup(cc *controlClient, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "", "файл резервной копии, \"-\" — stdout; по умолчанию имя от сервера")
+	passphraseFile := flags.String("passphrase-file", "", "файл с паролем для шифрования (или "+envBackupPassphrase+")")
+	if rest, err := parseFlags(flags, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New("использование: backup [-o FILE] [-passphrase-file FILE]")
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	req.Passphrase = passphrase
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := cc.do(http.MethodPost, "/api/backup", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		_, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		path = filepath.Base(params["filename"])
+		if path == "." || path == "/" {
+			path = "backup.wgbak"
+		}
+	}
+	if err := writeOutput(path, archive); err != nil {
+		return err
+	}
+	if path != "-" {
+		if passphrase == "" {
+			fmt.Fprintln(os.Stderr, "резервная копия не зашифрована и содержит приватные ключи")
+		}
+		fmt.Printf("Резервная копия сохранена в %s\n", path)
+	}
+	return nil
+}
+
+// runRestore восстанавливает состояние из резервной копии
+func runRestore(cc *controlClient, args []string) error {
+	const usage = "использование: restore FILE [-dry-run] [-force] [-passphrase-file FILE] [-json]"
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "только проверить архив")
+	force := flags.Bool("force", false, "восстановить поверх существующих интерфейсов")
+	passphraseFile := flags.String("passphrase-file", "", "файл с паролем (или "+envBackupPassphrase+")")
+	asJSON := flags.Bool("json", false, "вывод в формате JSON")
+	rest, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	path, err := oneArg(rest, usage)
+	if err != nil {
+		return err
+	}
+	archive, err := readInput(path)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("backup", filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(archive); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{
+		"passphrase": passphrase,
+		"dry_run":    fmt.Sprint(*dryRun),
+		"force":      fmt.Sprint(*force),
+	} {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	var result struct {
+		Data *backup.Report `json:"data"`
+	}
+	resp, err := cc.do(http.MethodPost, "/api/restore", form.FormDataContentType(), &body)
+	if err != nil {
+		// Конфликты и частичное восстановление возвращаются с отчетом
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && json.Unmarshal(apiErr.data, &result.Data) == nil && result.Data != nil {
+			printRestoreReport(result.Data, *asJSON)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	return printRestoreReport(result.Data, *asJSON)
+}
+
+func printRestoreReport(report *backup.Report, asJSON bool) error {
+	if asJSON {
+		return printJSON(report)
+	}
+	table := newTable()
+	fmt.Fprintln(table, "СЕРВЕР\tКЛИЕНТОВ\tРЕЗУЛЬТАТ")
+	for _, server := range report.Servers {
+		outcome := "не восстановлен"
+		switch {
+		case server.Error != "":
+			outcome = server.Error
+		case server.Restored:
+			outcome = "восстановлен"
+		case report.DryRun && len(server.Conflicts) == 0:
+			outcome = "можно восстановить"
+		case len(server.Conflicts) > 0:
+			outcome = "конфликт: " + strings.Join(server.Conflicts, "; ")
+		}
+		fmt.Fprintf(table, "%s\t%d\t%s\n", server.Name, server.Clients, outcome)
+		for _, warning := range server.Warnings {
+			fmt.Fprintf(table, "\t\tпредупреждение: %s\n", warning)
+		}
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if report.Users > 0 {
+		fmt.Printf("Пользователей восстановлено: %d\n", report.Users)
+	}
+	if report.SettingsFile != "" {
+		fmt.Printf("Настройки записаны в %s; чтобы применить их, перезапустите сервер с -config %s\n", report.SettingsFile, report.SettingsFile)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Printf("предупреждение: %s\n", warning)
+	}
+	return nil
+}
+
+// runUser управляет пользователями панели. Файл пользователей меняется
+// напрямую: сервер перечитывает его сам, поэтому команда работает и без
+// запущенного сервера.
+func runUser(cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "add" {
+		return errors.New(userUsage)
+	}
+	flags := flag.NewFlagSet("user add", flag.ContinueOnError)
+	passwordStdin := flags.Bool("password-stdin", false, "прочитать пароль из первой строки stdin")
+	rest, err := parseFlags(flags, args[1:])
+	if err != nil {
+		return err
+	}
+	name, err := oneArg(rest, userUsage)
+	if err != nil {
+		return err
+	}
+	if cfg.Paths.Users == "" {
+		return errors.New("файл пользователей не задан (paths.users)")
+	}
+
+	password, generated := "", false
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else {
+		random := make([]byte, 15)
+		if _, err := rand.Read(random); err != nil {
+			return err
+		}
+		password, generated = base64.RawURLEncoding.EncodeToString(random), true
+	}
+
+	store, err := users.Open(cfg.Paths.Users)
+	if err != nil {
+		return err
+	}
+	if err := store.Add(name, password); err != nil {
+		if errors.Is(err, users.ErrExists) {
+			return fmt.Errorf("пользователь %s уже существует", name)
+		}
+		return err
+	}
+	fmt.Printf("Пользователь %s добавлен\n", name)
+	if generated {
+		fmt.Printf("Пароль: %s\n", password)
+	}
+	return nil
+}
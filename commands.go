@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"wireguard-web-manager/config"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/secrets"
+)
+
+const commandsUsage = `команды:
+  serve                      запустить веб-сервер (по умолчанию)
+  server list|create|delete  серверы
+  client list|add|disable|enable|delete|config|qr
+                             клиенты
+  import FILE                создать клиентов из CSV или JSON
+  export                     выгрузить клиентов
+  backup                     сохранить резервную копию
+  restore FILE               восстановить из резервной копии
+  user add NAME              добавить пользователя панели
+  master-key generate|rotate мастер-ключ файла состояния
+Команды server, client, import, export, backup и restore выполняет
+запущенный сервер через управляющий сокет.`
+
+const masterKeyUsage = `использование:
+  master-key generate [-version N]  сгенерировать новый мастер-ключ
+  master-key rotate                 перешифровать ключи в файле состояния текущим мастер-ключом`
+
+// serverCommands команды, которые выполняет запущенный сервер
+var serverCommands = map[string]func(cc *controlClient, args []string) error{
+	"server":  runServer,
+	"client":  runClient,
+	"import":  runImport,
+	"export":  runExport,
+	"backup":  runBackup,
+	"restore": runRestore,
+}
+
+// runCommand выполняет команду вместо запуска веб-сервера
+func runCommand(cfg config.Config, args []string) error {
+	if run, ok := serverCommands[args[0]]; ok {
+		cc, err := newControlClient(cfg.Paths.ControlSocket)
+		if err != nil {
+			return err
+		}
+		return run(cc, args[1:])
+	}
+
+	switch args[0] {
+	case "user":
+		return runUser(cfg, args[1:])
+	case "master-key":
+		return runMasterKey(cfg, args[1:])
+	case "help":
+		fmt.Println(commandsUsage)
+		return nil
+	default:
+		return fmt.Errorf("неизвестная команда %q\n%s", args[0], commandsUsage)
+	}
+}
+
+func runMasterKey(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(masterKeyUsage)
+	}
+
+	switch args[0] {
+	case "generate":
+		flags := flag.NewFlagSet("master-key generate", flag.ContinueOnError)
+		version := flags.Int("version", 0, "версия ключа для записи в файл ключей")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if *version > 0 {
+			fmt.Printf("%d:%s\n", *version, key)
+		} else {
+			fmt.Println(key)
+		}
+		return nil
+
+	case "rotate":
+		if cfg.Storage.Backend != config.StorageFile {
+			return errors.New("хранилище без файла состояния: перешифровывать нечего")
+		}
+		// Запущенный сервер перезаписал бы файл ключами, зашифрованными
+		// прежним мастер-ключом
+		if controlAnswers(cfg.Paths.ControlSocket) {
+			return fmt.Errorf("сервер запущен (отвечает %s): остановите его перед сменой мастер-ключа", cfg.Paths.ControlSocket)
+		}
+		keyring, err := secrets.LoadKeyring()
+		if err != nil {
+			return fmt.Errorf("мастер-ключ: %w", err)
+		}
+		count, err := models.ResealStateFile(cfg.Storage.StateFile, keyring)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Перешифровано ключей: %d, версия мастер-ключа: %d\n", count, keyring.CurrentVersion())
+		return nil
+
+	default:
+		return errors.New(masterKeyUsage)
+	}
+}
@@ -0,0 +1,450 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigFile переменная окружения с путем к файлу настроек
+const EnvConfigFile = "WG_CONFIG"
+
+// Режимы HTTPS
+const (
+	TLSOff        = "off"         // только HTTP
+	TLSFile       = "file"        // сертификат и ключ из файлов
+	TLSSelfSigned = "self-signed" // самоподписанный сертификат, создается при первом запуске
+	TLSACME       = "acme"        // сертификат от ACME-сервера (Let's Encrypt и совместимые)
+)
+
+// Хранилища состояния
+const (
+	StorageFile   = "file"   // состояние сохраняется в файл и восстанавливается при запуске
+	StorageMemory = "memory" // состояние только в памяти, после перезапуска берется с интерфейсов
+)
+
+// Config настройки приложения
+type Config struct {
+	// Listen адрес HTTP-сервера, например :8080 или 127.0.0.1:8080
+	Listen string `yaml:"listen" toml:"listen"`
+
+	// ShutdownTimeout сколько ждать завершения текущих запросов при остановке
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	// TrustedProxies адреса и сети обратных прокси, которым доверяются
+	// заголовки X-Forwarded-For и X-Real-IP; пусто — IP берется из соединения
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+
+	Paths     Paths          `yaml:"paths" toml:"paths"`
+	TLS       TLS            `yaml:"tls" toml:"tls"`
+	Storage   Storage        `yaml:"storage" toml:"storage"`
+	Server    ServerDefaults `yaml:"server_defaults" toml:"server_defaults"`
+	Intervals Intervals      `yaml:"intervals" toml:"intervals"`
+	Features  Features       `yaml:"features" toml:"features"`
+}
+
+// Paths каталоги и файлы приложения
+type Paths struct {
+	Static    string `yaml:"static" toml:"static"`
+	CSS       string `yaml:"css" toml:"css"`
+	Templates string `yaml:"templates" toml:"templates"`
+	Uploads   string `yaml:"uploads" toml:"uploads"`
+	AuditLog  string `yaml:"audit_log" toml:"audit_log"`
+
+	// ControlSocket сокет, через который работают команды управления; пустой
+	// путь отключает сокет
+	ControlSocket string `yaml:"control_socket" toml:"control_socket"`
+	// Users файл пользователей панели; пока в нем нет пользователей, вход не
+	// требуется
+	Users string `yaml:"users" toml:"users"`
+}
+
+// TLS настройки HTTPS
+type TLS struct {
+	Mode string `yaml:"mode" toml:"mode"`
+
+	// CertFile и KeyFile — файлы сертификата и ключа в режиме file; в режиме
+	// self-signed сюда записывается созданный сертификат
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+
+	// Hosts имена и адреса в самоподписанном сертификате; в режиме acme —
+	// домены, для которых запрашиваются сертификаты
+	Hosts []string `yaml:"hosts" toml:"hosts"`
+
+	// RedirectListen адрес HTTP-сервера, перенаправляющего на HTTPS; пусто — не запускать
+	RedirectListen string `yaml:"redirect_listen" toml:"redirect_listen"`
+
+	// HSTSMaxAge срок заголовка Strict-Transport-Security; 0 — не отправлять
+	HSTSMaxAge Duration `yaml:"hsts_max_age" toml:"hsts_max_age"`
+
+	ACME ACME `yaml:"acme" toml:"acme"`
+}
+
+// ACME настройки получения сертификатов по протоколу ACME
+type ACME struct {
+	Directory string `yaml:"directory" toml:"directory"`
+	Email     string `yaml:"email" toml:"email"`
+	CacheDir  string `yaml:"cache_dir" toml:"cache_dir"`
+	// CARoot PEM-файл с корневым сертификатом ACME-сервера, если он не из
+	// системного хранилища (например, у локального Pebble)
+	CARoot string `yaml:"ca_root" toml:"ca_root"`
+}
+
+// Storage хранилище серверов и клиентов
+type Storage struct {
+	Backend   string `yaml:"backend" toml:"backend"`
+	StateFile string `yaml:"state_file" toml:"state_file"`
+}
+
+// ServerDefaults значения для полей, не заданных при создании сервера
+type ServerDefaults struct {
+	ListenPort int    `yaml:"listen_port" toml:"listen_port"`
+	Network    string `yaml:"network" toml:"network"`
+	DNS        string `yaml:"dns" toml:"dns"`
+	AllowedIPs string `yaml:"allowed_ips" toml:"allowed_ips"`
+}
+
+// Intervals периоды фоновых проверок
+type Intervals struct {
+	Quota     Duration `yaml:"quota" toml:"quota"`
+	Scheduler Duration `yaml:"scheduler" toml:"scheduler"`
+}
+
+// Features отключаемые возможности
+type Features struct {
+	Audit         bool `yaml:"audit" toml:"audit"`
+	Webhooks      bool `yaml:"webhooks" toml:"webhooks"`
+	DownloadLinks bool `yaml:"download_links" toml:"download_links"`
+	Mail          bool `yaml:"mail" toml:"mail"`
+	APIv1         bool `yaml:"api_v1" toml:"api_v1"`
+}
+
+// Duration длительность в виде строки 30s, 5m, 1h
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// Default настройки по умолчанию, совпадающие с прежним поведением
+func Default() Config {
+	return Config{
+		Listen:          ":8080",
+		ShutdownTimeout: Duration(30 * time.Second),
+		Paths: Paths{
+			Static:    "./static",
+			CSS:       "./css",
+			Templates: "./templates",
+			Uploads:   "./uploads",
+			AuditLog:  "./data/audit.jsonl",
+
+			ControlSocket: "./data/control.sock",
+			Users:         "./data/users",
+		},
+		TLS: TLS{
+			Mode:       TLSOff,
+			CertFile:   "./data/tls/cert.pem",
+			KeyFile:    "./data/tls/key.pem",
+			HSTSMaxAge: Duration(365 * 24 * time.Hour),
+			ACME: ACME{
+				Directory: "https://acme-v02.api.letsencrypt.org/directory",
+				CacheDir:  "./data/acme",
+			},
+		},
+		Storage: Storage{
+			Backend:   StorageFile,
+			StateFile: "./data/state.json",
+		},
+		Server: ServerDefaults{
+			ListenPort: 51820,
+			Network:    "10.0.0.0/24",
+			DNS:        "8.8.8.8",
+			AllowedIPs: "0.0.0.0/0",
+		},
+		Intervals: Intervals{
+			Quota:     Duration(time.Minute),
+			Scheduler: Duration(30 * time.Second),
+		},
+		Features: Features{
+			Audit:         true,
+			Webhooks:      true,
+			DownloadLinks: true,
+			Mail:          true,
+			APIv1:         true,
+		},
+	}
+}
+
+// Load собирает настройки: значения по умолчанию, затем файл (флаг -config
+// или WG_CONFIG), затем переменные окружения WG_*, затем флаги командной
+// строки. Возвращает аргументы, оставшиеся после флагов, — имя служебной
+// команды и ее параметры. Настройки не проверяются: командам управления не
+// нужны каталоги веб-сервера, поэтому Validate вызывает запуск сервера.
+func Load(args []string) (Config, []string, error) {
+	cfg := Default()
+
+	flags := newFlagSet()
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	path := os.Getenv(EnvConfigFile)
+	if flags.configFile != "" {
+		path = flags.configFile
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, nil, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := flags.apply(&cfg); err != nil {
+		return cfg, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// loadFile читает файл настроек в формате YAML или TOML по расширению.
+// Неизвестные ключи считаются ошибкой, чтобы опечатка не терялась молча.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := decodeYAML(data, cfg); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	return nil
+}
+
+func decodeYAML(data []byte, cfg *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// Marshal записывает настройки в формате файла настроек YAML
+func Marshal(cfg Config) ([]byte, error) {
+	return yaml.Marshal(cfg)
+}
+
+// Parse читает настройки в формате YAML поверх настроек по умолчанию
+func Parse(data []byte) (Config, error) {
+	cfg := Default()
+	if err := decodeYAML(data, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Validate проверяет настройки и возвращает все найденные ошибки сразу
+func (c Config) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateValues проверяет значения настроек без проверки каталогов и файлов
+// этого хоста. Так проверяются настройки из резервной копии другого хоста.
+func (c Config) ValidateValues() error {
+	return c.validate(false)
+}
+
+// validate проверяет настройки; с checkFiles — и наличие каталогов и файлов
+func (c Config) validate(checkFiles bool) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil || port == "" {
+		add("listen: invalid address %q, expected host:port or :port", c.Listen)
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		add("shutdown_timeout: must be positive")
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				add("trusted_proxies: invalid address %q, expected IP or CIDR", proxy)
+			}
+		}
+	}
+
+	for _, dir := range []struct{ name, path string }{
+		{"paths.static", c.Paths.Static},
+		{"paths.templates", c.Paths.Templates},
+	} {
+		if !checkFiles {
+			if dir.path == "" {
+				add("%s: path is required", dir.name)
+			}
+			continue
+		}
+		if info, err := os.Stat(dir.path); err != nil || !info.IsDir() {
+			add("%s: directory %q does not exist", dir.name, dir.path)
+		}
+	}
+	if c.Paths.CSS == "" {
+		add("paths.css: path is required")
+	}
+	if c.Paths.Uploads == "" {
+		add("paths.uploads: path is required")
+	}
+	if c.Features.Audit && c.Paths.AuditLog == "" {
+		add("paths.audit_log: path is required when the audit feature is enabled")
+	}
+
+	errs = append(errs, c.TLS.validate(c.Listen, checkFiles)...)
+
+	switch c.Storage.Backend {
+	case StorageFile:
+		if c.Storage.StateFile == "" {
+			add("storage.state_file: path is required for the %q backend", StorageFile)
+		}
+	case StorageMemory:
+	default:
+		add("storage.backend: unknown backend %q, expected %q or %q", c.Storage.Backend, StorageFile, StorageMemory)
+	}
+
+	if c.Server.ListenPort < 1 || c.Server.ListenPort > 65535 {
+		add("server_defaults.listen_port: %d is out of range 1-65535", c.Server.ListenPort)
+	}
+	if _, _, err := net.ParseCIDR(c.Server.Network); err != nil {
+		add("server_defaults.network: %v", err)
+	}
+	for _, value := range splitList(c.Server.DNS) {
+		if net.ParseIP(value) == nil {
+			add("server_defaults.dns: invalid IP address %q", value)
+		}
+	}
+	allowed := splitList(c.Server.AllowedIPs)
+	if len(allowed) == 0 {
+		add("server_defaults.allowed_ips: at least one network is required")
+	}
+	for _, value := range allowed {
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			add("server_defaults.allowed_ips: %v", err)
+		}
+	}
+
+	if c.Intervals.Quota < Duration(time.Second) {
+		add("intervals.quota: %s is shorter than 1s", c.Intervals.Quota)
+	}
+	if c.Intervals.Scheduler < Duration(time.Second) {
+		add("intervals.scheduler: %s is shorter than 1s", c.Intervals.Scheduler)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t TLS) validate(listen string, checkFiles bool) []error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch t.Mode {
+	case TLSOff:
+		return nil
+	case TLSFile:
+		for _, file := range []struct{ name, path string }{
+			{"tls.cert_file", t.CertFile},
+			{"tls.key_file", t.KeyFile},
+		} {
+			if !checkFiles {
+				if file.path == "" {
+					add("%s: path is required for the %q mode", file.name, TLSFile)
+				}
+				continue
+			}
+			if _, err := os.Stat(file.path); err != nil {
+				add("%s: %v", file.name, err)
+			}
+		}
+	case TLSSelfSigned:
+		if t.CertFile == "" || t.KeyFile == "" {
+			add("tls.cert_file, tls.key_file: paths are required for the %q mode", TLSSelfSigned)
+		}
+	case TLSACME:
+		if len(t.Hosts) == 0 {
+			add("tls.hosts: at least one domain is required for the %q mode", TLSACME)
+		}
+		if u, err := url.Parse(t.ACME.Directory); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			add("tls.acme.directory: invalid URL %q", t.ACME.Directory)
+		}
+		if t.ACME.CacheDir == "" {
+			add("tls.acme.cache_dir: path is required for the %q mode", TLSACME)
+		}
+		if t.ACME.CARoot != "" && checkFiles {
+			if _, err := os.Stat(t.ACME.CARoot); err != nil {
+				add("tls.acme.ca_root: %v", err)
+			}
+		}
+	default:
+		add("tls.mode: unknown mode %q, expected %q, %q, %q or %q", t.Mode, TLSOff, TLSFile, TLSSelfSigned, TLSACME)
+	}
+
+	if t.RedirectListen != "" {
+		if _, port, err := net.SplitHostPort(t.RedirectListen); err != nil || port == "" {
+			add("tls.redirect_listen: invalid address %q, expected host:port or :port", t.RedirectListen)
+		} else if t.RedirectListen == listen {
+			add("tls.redirect_listen: must differ from listen")
+		}
+	}
+	if t.HSTSMaxAge < 0 {
+		add("tls.hsts_max_age: must not be negative")
+	}
+	return errs
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// option параметр, который можно задать переменной окружения и флагом.
+// field возвращает указатель на поле настроек: *string, *[]string, *int, *bool
+// или *Duration. Списки задаются через запятую.
+type option struct {
+	flag  string
+	env   string
+	usage string
+	field func(*Config) interface{}
+}
+
+var options = []option{
+	{"listen", "WG_LISTEN", "адрес HTTP-сервера", func(c *Config) interface{} { return &c.Listen }},
+	{"shutdown-timeout", "WG_SHUTDOWN_TIMEOUT", "ожидание текущих запросов при остановке", func(c *Config) interface{} { return &c.ShutdownTimeout }},
+	{"trusted-proxies", "WG_TRUSTED_PROXIES", "адреса и сети доверенных прокси через запятую", func(c *Config) interface{} { return &c.TrustedProxies }},
+
+	{"static-dir", "WG_STATIC_DIR", "каталог статических файлов", func(c *Config) interface{} { return &c.Paths.Static }},
+	{"css-dir", "WG_CSS_DIR", "каталог стилей", func(c *Config) interface{} { return &c.Paths.CSS }},
+	{"templates-dir", "WG_TEMPLATES_DIR", "каталог HTML-шаблонов", func(c *Config) interface{} { return &c.Paths.Templates }},
+	{"uploads-dir", "WG_UPLOADS_DIR", "каталог загрузок", func(c *Config) interface{} { return &c.Paths.Uploads }},
+	{"audit-log", "WG_AUDIT_LOG", "файл журнала аудита", func(c *Config) interface{} { return &c.Paths.AuditLog }},
+	{"control-socket", "WG_CONTROL_SOCKET", "сокет для команд управления, пусто — без сокета", func(c *Config) interface{} { return &c.Paths.ControlSocket }},
+	{"users-file", "WG_USERS_FILE", "файл пользователей панели", func(c *Config) interface{} { return &c.Paths.Users }},
+
+	{"tls", "WG_TLS", "режим HTTPS: off, file, self-signed или acme", func(c *Config) interface{} { return &c.TLS.Mode }},
+	{"tls-cert", "WG_TLS_CERT", "файл сертификата HTTPS", func(c *Config) interface{} { return &c.TLS.CertFile }},
+	{"tls-key", "WG_TLS_KEY", "файл ключа HTTPS", func(c *Config) interface{} { return &c.TLS.KeyFile }},
+	{"tls-hosts", "WG_TLS_HOSTS", "имена хостов через запятую для сертификата", func(c *Config) interface{} { return &c.TLS.Hosts }},
+	{"http-redirect", "WG_HTTP_REDIRECT", "адрес HTTP-сервера с перенаправлением на HTTPS", func(c *Config) interface{} { return &c.TLS.RedirectListen }},
+	{"hsts-max-age", "WG_HSTS_MAX_AGE", "срок Strict-Transport-Security, 0 — без заголовка", func(c *Config) interface{} { return &c.TLS.HSTSMaxAge }},
+	{"acme-directory", "WG_ACME_DIRECTORY", "адрес каталога ACME-сервера", func(c *Config) interface{} { return &c.TLS.ACME.Directory }},
+	{"acme-email", "WG_ACME_EMAIL", "контактный email для ACME", func(c *Config) interface{} { return &c.TLS.ACME.Email }},
+	{"acme-cache-dir", "WG_ACME_CACHE_DIR", "каталог для сертификатов ACME", func(c *Config) interface{} { return &c.TLS.ACME.CacheDir }},
+	{"acme-ca-root", "WG_ACME_CA_ROOT", "корневой сертификат ACME-сервера (PEM)", func(c *Config) interface{} { return &c.TLS.ACME.CARoot }},
+
+	{"storage", "WG_STORAGE", "хранилище состояния: file или memory", func(c *Config) interface{} { return &c.Storage.Backend }},
+	{"state-file", "WG_STATE_FILE", "файл состояния для хранилища file", func(c *Config) interface{} { return &c.Storage.StateFile }},
+
+	{"default-port", "WG_DEFAULT_PORT", "порт нового сервера по умолчанию", func(c *Config) interface{} { return &c.Server.ListenPort }},
+	{"default-network", "WG_DEFAULT_NETWORK", "сеть нового сервера по умолчанию", func(c *Config) interface{} { return &c.Server.Network }},
+	{"default-dns", "WG_DEFAULT_DNS", "DNS нового сервера по умолчанию", func(c *Config) interface{} { return &c.Server.DNS }},
+	{"default-allowed-ips", "WG_DEFAULT_ALLOWED_IPS", "AllowedIPs нового сервера по умолчанию", func(c *Config) interface{} { return &c.Server.AllowedIPs }},
+
+	{"quota-interval", "WG_QUOTA_INTERVAL", "период опроса счетчиков трафика", func(c *Config) interface{} { return &c.Intervals.Quota }},
+	{"scheduler-interval", "WG_SCHEDULER_INTERVAL", "период проверки окон доступа", func(c *Config) interface{} { return &c.Intervals.Scheduler }},
+
+	{"audit", "WG_FEATURE_AUDIT", "вести журнал аудита", func(c *Config) interface{} { return &c.Features.Audit }},
+	{"webhooks", "WG_FEATURE_WEBHOOKS", "рассылать webhook-уведомления", func(c *Config) interface{} { return &c.Features.Webhooks }},
+	{"download-links", "WG_FEATURE_DOWNLOAD_LINKS", "разрешить одноразовые ссылки на конфигурацию", func(c *Config) interface{} { return &c.Features.DownloadLinks }},
+	{"mail", "WG_FEATURE_MAIL", "отправлять конфигурации по email, если задан SMTP_HOST", func(c *Config) interface{} { return &c.Features.Mail }},
+	{"api-v1", "WG_FEATURE_API_V1", "включить API /api/v1", func(c *Config) interface{} { return &c.Features.APIv1 }},
+}
+
+// setField записывает строковое значение в поле настроек нужного типа
+func setField(target interface{}, value string) error {
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *[]string:
+		*target = splitList(value)
+	case *int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+	case *bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+	case *Duration:
+		return target.UnmarshalText([]byte(value))
+	default:
+		return fmt.Errorf("unsupported option type %T", target)
+	}
+	return nil
+}
+
+// applyEnv применяет заданные переменные окружения
+func applyEnv(cfg *Config) error {
+	for _, opt := range options {
+		value, ok := os.LookupEnv(opt.env)
+		if !ok {
+			continue
+		}
+		if err := setField(opt.field(cfg), value); err != nil {
+			return fmt.Errorf("%s: %w", opt.env, err)
+		}
+	}
+	return nil
+}
+
+// flagValue запоминает значение флага до применения: флаги разбираются
+// раньше чтения файла, а применяются последними
+type flagValue struct {
+	value  string
+	isBool bool
+	set    bool
+}
+
+func (v *flagValue) String() string { return v.value }
+
+func (v *flagValue) Set(value string) error {
+	v.value, v.set = value, true
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+type flagSet struct {
+	*flag.FlagSet
+	configFile string
+	values     []*flagValue
+}
+
+func newFlagSet() *flagSet {
+	fs := &flagSet{FlagSet: flag.NewFlagSet(os.Args[0], flag.ContinueOnError)}
+	fs.StringVar(&fs.configFile, "config", "", "файл настроек .yaml или .toml (или "+EnvConfigFile+")")
+
+	defaults := Default()
+	for _, opt := range options {
+		_, isBool := opt.field(&defaults).(*bool)
+		value := &flagValue{isBool: isBool}
+		fs.values = append(fs.values, value)
+		fs.Var(value, opt.flag, fmt.Sprintf("%s (%s, по умолчанию %v)", opt.usage, opt.env, deref(opt.field(&defaults))))
+	}
+	return fs
+}
+
+// apply применяет флаги, заданные в командной строке
+func (fs *flagSet) apply(cfg *Config) error {
+	for i, opt := range options {
+		if !fs.values[i].set {
+			continue
+		}
+		if err := setField(opt.field(cfg), fs.values[i].value); err != nil {
+			return fmt.Errorf("-%s: %w", opt.flag, err)
+		}
+	}
+	return nil
+}
+
+func deref(field interface{}) interface{} {
+	switch field := field.(type) {
+	case *string:
+		return *field
+	case *[]string:
+		return strings.Join(*field, ",")
+	case *int:
+		return *field
+	case *bool:
+		return *field
+	case *Duration:
+		return *field
+	}
+	return field
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"wireguard-web-manager/apiv1"
+)
+
+// Команды управления выполняются запущенным сервером: сервер держит
+// состояние в памяти, и изменения, записанные в файл состояния другим
+// процессом, он перезаписал бы. Команды отправляют запросы к /api и /api/v1
+// через локальный сокет, доступный только владельцу, и проходят через те же
+// обработчики и сервис, что и запросы панели, с журналом аудита и
+// уведомлениями.
+
+// controlHost условное имя хоста в запросах через сокет
+const controlHost = "control"
+
+// listenControl создает управляющий сокет. Сокет, оставшийся после
+// аварийной остановки, удаляется; если на сокете отвечает другой процесс,
+// возвращается ошибка.
+func listenControl(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if controlAnswers(path) {
+			return nil, fmt.Errorf("сокет %s занят другим запущенным сервером", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Сокет сразу создается с правами 0600: с chmod после создания к нему
+	// успели бы подключиться другие пользователи. Маска действует на весь
+	// процесс, но сокет открывается при запуске, до создания других файлов.
+	mask := syscall.Umask(0o177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
+
+// controlAnswers сообщает, что на сокете path отвечает запущенный сервер
+func controlAnswers(path string) bool {
+	if path == "" {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// controlClient отправляет запросы серверу через управляющий сокет
+type controlClient struct {
+	socket string
+	actor  string
+	http   *http.Client
+}
+
+func newControlClient(socket string) (*controlClient, error) {
+	if socket == "" {
+		return nil, errors.New("управляющий сокет отключен (paths.control_socket)")
+	}
+	return &controlClient{
+		socket: socket,
+		actor:  commandActor(),
+		http: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}},
+	}, nil
+}
+
+// commandActor имя пользователя системы для журнала аудита. Под sudo
+// записывается пользователь, вызвавший sudo.
+func commandActor() string {
+	name := os.Getenv("SUDO_USER")
+	if name == "" {
+		if current, err := user.Current(); err == nil {
+			name = current.Username
+		}
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return name + " (cli)"
+}
+
+// do выполняет запрос и возвращает ответ с успешным статусом. Ошибка
+// сервера возвращается с его сообщением.
+func (cc *controlClient) do(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, "http://"+controlHost+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Remote-User", cc.actor)
+	if lang := commandLanguage(); lang != "" {
+		req.Header.Set("Accept-Language", lang)
+	}
+
+	resp, err := cc.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("нет связи с сервером через %s: %w (сервер запускается командой serve)", cc.socket, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// call отправляет in в формате JSON и разбирает ответ в out. in и out
+// могут быть nil.
+func (cc *controlClient) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	resp, err := cc.do(method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// apiError ответ /api с ошибкой; data содержит подробности, например
+// результаты массовой операции
+type apiError struct {
+	status  int
+	message string
+	data    json.RawMessage
+}
+
+func (e *apiError) Error() string { return e.message }
+
+// responseError ошибка из ответа в формате /api/v1 или /api
+func responseError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	var v1 apiv1.ErrorResponse
+	if json.Unmarshal(data, &v1) == nil && v1.Error.Message != "" {
+		return &apiError{status: resp.StatusCode, message: v1.Error.Message}
+	}
+	var legacy struct {
+		Error string          `json:"error"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(data, &legacy) == nil && legacy.Error != "" {
+		return &apiError{status: resp.StatusCode, message: legacy.Error, data: legacy.Data}
+	}
+	return fmt.Errorf("сервер ответил %s", resp.Status)
+}
+
+// commandLanguage язык сообщений сервера по переменным LC_ALL, LC_MESSAGES
+// и LANG: ru_RU.UTF-8 превращается в ru-RU
+func commandLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		value, _, _ = strings.Cut(value, ".")
+		if value == "C" || value == "POSIX" {
+			return ""
+		}
+		return strings.ReplaceAll(value, "_", "-")
+	}
+	return ""
+}
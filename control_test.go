@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenControlPermissions(t *testing.T) {
+	// Права сокета не должны зависеть от маски процесса
+	defer syscall.Umask(syscall.Umask(0))
+
+	path := filepath.Join(t.TempDir(), "run", "control.sock")
+	listener, err := listenControl(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode %o, want 600", perm)
+	}
+	if _, err := listenControl(path); err == nil {
+		t.Error("second server started on a busy socket")
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wireguard-web-manager/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+var auditLog *audit.Log
+
+func RegisterAuditLog(l *audit.Log) {
+	auditLog = l
+}
+
+// GetAuditLog выборка из журнала аудита. С параметром format=jsonl журнал
+// выгружается файлом в формате JSON Lines.
+func GetAuditLog(c *gin.Context) {
+	if auditLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   tr(c, "Журнал аудита недоступен"),
+		})
+		return
+	}
+
+	filter := audit.Filter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	var err error
+	if filter.Since, err = parseTimeQuery(c, "since"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверный параметр since: %v", err),
+		})
+		return
+	}
+	if filter.Until, err = parseTimeQuery(c, "until"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверный параметр until: %v", err),
+		})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверный параметр limit"),
+			})
+			return
+		}
+	}
+
+	entries := auditLog.Query(filter)
+
+	if c.Query("format") == "jsonl" {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", "attachment; filename=audit.jsonl")
+		c.Status(http.StatusOK)
+		if err := audit.WriteJSONLines(c.Writer, entries); err != nil {
+			log.Printf("не удалось выгрузить журнал аудита: %v", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+	})
+}
+
+// recordAudit записывает действие администратора в журнал аудита.
+// before и after — снимки объекта до и после изменения, любой из них может быть nil.
+func recordAudit(c *gin.Context, action, targetType, targetID, targetName string, before, after interface{}) {
+	if auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Actor:      auditActor(c),
+		SourceIP:   c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		TargetName: targetName,
+		Changes:    audit.Diff(before, after),
+	}
+	if err := auditLog.Record(entry); err != nil {
+		log.Printf("не удалось записать в журнал аудита: %v", err)
+	}
+}
+
+// withDetails дополняет поля объекта для журнала аудита полями details,
+// которых нет в самом объекте, например адресом получателя письма
+func withDetails(value interface{}, details gin.H) interface{} {
+	if len(details) == 0 {
+		return value
+	}
+	fields := make(gin.H)
+	if data, err := json.Marshal(value); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	for key, detail := range details {
+		fields[key] = detail
+	}
+	return fields
+}
+
+// auditActor определяет, от чьего имени выполняется запрос: вошедший
+// пользователь или автор команды управления (их записывают BasicAuth и
+// ControlActor), иначе anonymous
+func auditActor(c *gin.Context) string {
+	if user := c.GetString(gin.AuthUserKey); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+func parseTimeQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authRealm область Basic-аутентификации в окне входа браузера
+const authRealm = `Basic realm="WireGuard Web Manager", charset="UTF-8"`
+
+// BasicAuth требует вход пользователем из store. Пока пользователей нет,
+// панель открыта, как и раньше. Имя вошедшего пользователя попадает в
+// журнал аудита.
+func BasicAuth(store *users.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store.Empty() {
+			c.Next()
+			return
+		}
+		name, password, ok := c.Request.BasicAuth()
+		if !ok || !store.Authenticate(name, password) {
+			c.Header("WWW-Authenticate", authRealm)
+			reqErr := &requestError{status: http.StatusUnauthorized, code: apiv1.CodeUnauthorized, message: "Требуется вход"}
+			if strings.HasPrefix(c.Request.URL.Path, apiv1.BasePath+"/") {
+				writeV1Error(c, reqErr)
+			} else {
+				writeError(c, reqErr)
+			}
+			c.Abort()
+			return
+		}
+		c.Set(gin.AuthUserKey, name)
+		c.Next()
+	}
+}
+
+// ControlActor берет автора действия из заголовка X-Remote-User, который
+// передает команда управления. Подключается только к управляющему сокету:
+// доступ к нему ограничен правами на файл, а в панели заголовок мог бы
+// подставить любой клиент.
+func ControlActor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user := c.GetHeader("X-Remote-User"); user != "" {
+			c.Set(gin.AuthUserKey, user)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/backup"
+	"wireguard-web-manager/config"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBackupSize ограничивает размер загружаемой резервной копии
+const maxBackupSize = 64 << 20
+
+// restoredSettingsName файл рядом с файлом состояния, в который
+// записываются настройки из резервной копии
+const restoredSettingsName = "settings.restored.yaml"
+
+// userStore пользователи панели; nil, если файл пользователей не задан
+var userStore *users.Store
+
+func RegisterUsers(store *users.Store) {
+	userStore = store
+}
+
+// settings действующие настройки для резервной копии. Меняются при
+// перечитывании настроек, поэтому читаются под мьютексом.
+var (
+	settingsMu sync.RWMutex
+	settings   = config.Default()
+)
+
+func RegisterSettings(cfg config.Config) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	settings = cfg
+}
+
+func currentSettings() config.Config {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return settings
+}
+
+// CreateBackup выгрузка резервной копии всего состояния. Архив содержит
+// приватные ключи, поэтому его стоит шифровать паролем.
+func CreateBackup(c *gin.Context) {
+	var req struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверные данные: %v", err),
+			})
+			return
+		}
+	}
+
+	archive, err := backup.Collect(models.GlobalStorage, webhookDispatcher, userStore, currentSettings())
+	var buf bytes.Buffer
+	if err == nil {
+		err = backup.Write(&buf, archive, req.Passphrase)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   tr(c, "Не удалось создать резервную копию: %v", err),
+		})
+		return
+	}
+
+	recordAudit(c, audit.ActionBackupCreate, "backup", "", "", nil, gin.H{
+		"encrypted": req.Passphrase != "",
+		"servers":   len(archive.Servers),
+		"clients":   len(archive.Clients),
+		"webhooks":  len(archive.Webhooks),
+		"users":     len(archive.Users),
+	})
+
+	fileName := fmt.Sprintf("wg-manager-%s.wgbak", archive.CreatedAt.Format("20060102-150405"))
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+}
+
+// RestoreBackup восстановление из резервной копии, загруженной полем backup.
+// dry_run=true только проверяет архив, force=true восстанавливает поверх
+// существующих интерфейсов.
+func RestoreBackup(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBackupSize)
+
+	file, _, err := c.Request.FormFile("backup")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Не передан файл резервной копии: %v", err),
+		})
+		return
+	}
+	defer file.Close()
+
+	archive, err := backup.Read(file, c.PostForm("passphrase"))
+	if err != nil {
+		message := tr(c, "Не удалось прочитать резервную копию: %v", err)
+		switch {
+		case errors.Is(err, backup.ErrPassphraseRequired):
+			message = tr(c, "Резервная копия зашифрована: укажите пароль")
+		case errors.Is(err, backup.ErrWrongPassphrase):
+			message = tr(c, "Неверный пароль или поврежденная резервная копия")
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   message,
+		})
+		return
+	}
+
+	opts := backup.RestoreOptions{
+		DryRun:       c.PostForm("dry_run") == "true",
+		Force:        c.PostForm("force") == "true",
+		SettingsFile: filepath.Join(filepath.Dir(currentSettings().Storage.StateFile), restoredSettingsName),
+	}
+	report, err := backup.Restore(svc, models.GlobalStorage, webhookDispatcher, userStore, archive, opts)
+
+	var invalid *backup.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success":  false,
+			"error":    tr(c, "Резервная копия содержит ошибки"),
+			"problems": invalid.Problems,
+		})
+		return
+	case errors.Is(err, backup.ErrConflicts):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   tr(c, "Резервная копия конфликтует с интерфейсами этого хоста; для замены укажите force=true"),
+			"data":    report,
+		})
+		return
+	}
+
+	if !opts.DryRun && report != nil {
+		recordAudit(c, audit.ActionBackupRestore, "backup", "", "", nil, gin.H{
+			"created_at": archive.CreatedAt.Format(time.RFC3339),
+			"servers":    len(archive.Servers),
+			"clients":    len(archive.Clients),
+			"webhooks":   report.Webhooks,
+			"users":      report.Users,
+			"settings":   report.SettingsFile,
+			"forced":     opts.Force,
+		})
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   tr(c, "Восстановление выполнено не полностью: %v", err),
+			"data":    report,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+	"wireguard-web-manager/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Массовые действия над клиентами
+const (
+	bulkDisable = service.BulkDisable
+	bulkEnable  = service.BulkEnable
+	bulkDelete  = service.BulkDelete
+)
+
+// maxBulkItems ограничивает размер одной массовой операции
+const maxBulkItems = 1000
+
+// bulkResult результат массовой операции для одного клиента
+type bulkResult struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Success bool   `json:"success"`
+	Skipped bool   `json:"skipped,omitempty"` // клиент уже в нужном состоянии
+	Error   string `json:"error,omitempty"`
+}
+
+// bulkSelector выбор клиентов: по идентификаторам или по фильтру
+type bulkSelector struct {
+	IDs    []string    `json:"ids"`
+	Filter *bulkFilter `json:"filter"`
+}
+
+// bulkFilter условия отбора клиентов для массовой операции
+type bulkFilter struct {
+	ServerID string `json:"server_id"`
+	Search   string `json:"search"` // подстрока имени, email, адреса или ключа
+	Tag      string `json:"tag"`
+	Status   string `json:"status"` // active, disabled, quota_exceeded, outside_schedule, expired
+}
+
+// BulkCreateClients массовое создание клиентов из JSON или CSV. Клиенты
+// создаются все вместе или не создаются вовсе.
+func BulkCreateClients(c *gin.Context) {
+	if wgService == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   tr(c, "Сервис WireGuard недоступен"),
+		})
+		return
+	}
+
+	var req struct {
+		ServerID string          `json:"server_id"`
+		Clients  []models.Client `json:"clients"`
+	}
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		clients, err := parseClientsCSV(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверный CSV: %v", err),
+			})
+			return
+		}
+		req.ServerID = c.Query("server_id")
+		req.Clients = clients
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+
+	if len(req.Clients) == 0 || len(req.Clients) > maxBulkItems {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Количество клиентов должно быть от 1 до %d", maxBulkItems),
+		})
+		return
+	}
+
+	results, failed := prepareClients(c, req.ServerID, req.Clients, time.Now())
+	if failed {
+		bulkFailed(c, http.StatusUnprocessableEntity, results, "Клиенты не созданы: есть ошибки в данных")
+		return
+	}
+
+	created, err := svc.CreateClients(req.Clients)
+	if err != nil {
+		bulkServiceError(c, err, results, "Клиенты не созданы: есть ошибки в данных", "Не удалось добавить клиентов в WireGuard: %v")
+		return
+	}
+
+	data := make([]models.Client, 0, len(created))
+	for i := range created {
+		client := &created[i]
+		recordAudit(c, audit.ActionClientCreate, "client", client.ID, client.Name, nil, client)
+		publishClientEvent(webhooks.EventClientCreated, client)
+		sendConfigOnCreate(c, client)
+		results[i].Success = true
+		data = append(data, client.Public())
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"results": results,
+			"clients": data,
+		},
+	})
+}
+
+// prepareClients проверяет и готовит всех клиентов пакета до каких-либо
+// изменений. Клиенты без сервера создаются на сервере serverID. Возвращает
+// результаты по каждому клиенту и признак ошибки хотя бы в одном из них.
+func prepareClients(c *gin.Context, serverID string, clients []models.Client, now time.Time) ([]bulkResult, bool) {
+	used := make(map[string]map[string]struct{})
+	keys := make(map[string]int)
+	prepared := make(map[string][]*models.Client)
+	results := make([]bulkResult, len(clients))
+	failed := false
+	for i := range clients {
+		client := &clients[i]
+		results[i] = bulkResult{Index: i, Name: client.Name}
+		if client.ServerID == "" {
+			client.ServerID = serverID
+		}
+
+		server, ok := models.GlobalStorage.GetServer(client.ServerID)
+		if !ok {
+			results[i].Error = tr(c, "Сервер не найден")
+			failed = true
+			continue
+		}
+		if _, ok := used[server.ID]; !ok {
+			used[server.ID] = usedAddresses(server.ID)
+		}
+		if reqErr := prepareClient(client, server, used[server.ID], now); reqErr != nil {
+			results[i].Error = reqErr.text(c)
+			failed = true
+			continue
+		}
+
+		keyID := client.ServerID + "/" + client.PublicKey
+		if first, dup := keys[keyID]; dup {
+			results[i].Error = tr(c, "Открытый ключ совпадает с клиентом №%d", first+1)
+			failed = true
+			continue
+		}
+		keys[keyID] = i
+
+		// prepareSite сверяет сети площадки только с сохраненными пирами
+		if reqErr := checkSiteOverlap(client, prepared[server.ID]); reqErr != nil {
+			results[i].Error = reqErr.text(c)
+			failed = true
+			continue
+		}
+		prepared[server.ID] = append(prepared[server.ID], client)
+		results[i].ID = client.ID
+	}
+	return results, failed
+}
+
+// BulkClientAction массовое отключение, включение или удаление клиентов,
+// выбранных по идентификаторам или фильтру. Изменения применяются ко всем
+// клиентам или ни к одному.
+func BulkClientAction(c *gin.Context) {
+	action := c.Param("action")
+	if action != bulkDisable && action != bulkEnable && action != bulkDelete {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Неизвестное действие"),
+		})
+		return
+	}
+
+	var selector bulkSelector
+	if err := c.ShouldBindJSON(&selector); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+
+	clients, results, reqErr := selectBulkClients(selector)
+	if reqErr != nil {
+		c.JSON(reqErr.status, gin.H{
+			"success": false,
+			"error":   reqErr.text(c),
+		})
+		return
+	}
+	if len(clients) != len(results) {
+		bulkFailed(c, http.StatusUnprocessableEntity, results, "Действие не выполнено: не все клиенты найдены")
+		return
+	}
+	runBulkAction(c, action, clients, results)
+}
+
+// runBulkAction применяет действие к выбранным клиентам и отвечает на запрос.
+// results соответствуют clients по порядку. Клиенты, уже находящиеся в
+// нужном состоянии, пропускаются.
+func runBulkAction(c *gin.Context, action string, clients []models.Client, results []bulkResult) {
+	affected := make([]models.Client, 0, len(clients))
+	for i, client := range clients {
+		if action == bulkDisable && client.IsDisabled || action == bulkEnable && !client.IsDisabled {
+			results[i].Skipped = true
+			continue
+		}
+		affected = append(affected, client)
+	}
+
+	updated, err := svc.BulkClientAction(action, affected)
+	if err != nil {
+		bulkServiceError(c, err, results, "Действие не выполнено: есть ошибки в данных клиентов", "Не удалось применить изменения WireGuard: %v")
+		return
+	}
+
+	for i := range updated {
+		before, after := &affected[i], &updated[i]
+		switch action {
+		case bulkDisable:
+			recordAudit(c, audit.ActionClientDisable, "client", after.ID, after.Name, before, after)
+			publishClientEvent(webhooks.EventClientDisabled, after)
+		case bulkEnable:
+			recordAudit(c, audit.ActionClientEnable, "client", after.ID, after.Name, before, after)
+			publishClientEvent(webhooks.EventClientEnabled, after)
+		case bulkDelete:
+			revokeDeletedClientLinks(after.ID)
+			recordAudit(c, audit.ActionClientDelete, "client", after.ID, after.Name, after, nil)
+			publishClientEvent(webhooks.EventClientDeleted, after)
+		}
+	}
+	for i := range results {
+		results[i].Success = true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"results":  results,
+			"affected": len(updated),
+		},
+	})
+}
+
+// selectBulkClients выбирает клиентов по идентификаторам или фильтру. Для
+// ненайденных идентификаторов в результатах заполняется ошибка, и тогда
+// результатов больше, чем клиентов.
+func selectBulkClients(selector bulkSelector) ([]models.Client, []bulkResult, *requestError) {
+	if len(selector.IDs) > 0 && selector.Filter != nil {
+		return nil, nil, badRequest("Укажите либо ids, либо filter")
+	}
+
+	var clients []models.Client
+	var results []bulkResult
+	switch {
+	case len(selector.IDs) > 0:
+		if len(selector.IDs) > maxBulkItems {
+			return nil, nil, badRequest("Не более %d клиентов за раз", maxBulkItems)
+		}
+		seen := make(map[string]bool)
+		for i, id := range selector.IDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			client, err := svc.Client(id)
+			if err != nil {
+				results = append(results, bulkResult{Index: i, ID: id, Error: "Клиент не найден"})
+				continue
+			}
+			results = append(results, bulkResult{Index: i, ID: id, Name: client.Name})
+			clients = append(clients, client)
+		}
+	case selector.Filter != nil:
+		filter := selector.Filter
+		if filter.ServerID == "" && filter.Search == "" && filter.Tag == "" && filter.Status == "" {
+			return nil, nil, badRequest("Пустой фильтр: укажите хотя бы одно условие")
+		}
+		for _, client := range svc.Clients() {
+			if filter.matches(&client) {
+				clients = append(clients, client)
+			}
+		}
+		sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+		if len(clients) > maxBulkItems {
+			return nil, nil, badRequest("Фильтру соответствует больше %d клиентов", maxBulkItems)
+		}
+		for i, client := range clients {
+			results = append(results, bulkResult{Index: i, ID: client.ID, Name: client.Name})
+		}
+	default:
+		return nil, nil, badRequest("Укажите ids или filter")
+	}
+	return clients, results, nil
+}
+
+func (f *bulkFilter) matches(client *models.Client) bool {
+	filter := f.clientFilter()
+	return filter.Matches(client)
+}
+
+// clientFilter условия отбора в терминах хранилища
+func (f *bulkFilter) clientFilter() models.ClientFilter {
+	filter := models.ClientFilter{
+		ServerID: f.ServerID,
+		Search:   f.Search,
+		Tag:      f.Tag,
+	}
+	if f.Status != "" {
+		filter.Statuses = []string{f.Status}
+	}
+	return filter
+}
+
+// markBulkError отмечает в результатах клиента, на котором произошла ошибка
+func markBulkError(results []bulkResult, err error) {
+	var bulkErr *service.BulkError
+	if !errors.As(err, &bulkErr) || bulkErr.ClientID == "" {
+		return
+	}
+	message := bulkErr.Err.Error()
+	if reqErr := fromServiceError(bulkErr.Err, ""); reqErr.status != http.StatusInternalServerError {
+		message = reqErr.message
+	}
+	for i := range results {
+		if results[i].ID == bulkErr.ClientID {
+			results[i].Error = message
+		}
+	}
+}
+
+// bulkServiceError ответ на массовую операцию, отклоненную сервисом.
+// invalid описывает ошибку в данных клиентов, failure — ошибку изменения
+// интерфейса.
+func bulkServiceError(c *gin.Context, err error, results []bulkResult, invalid, failure string) {
+	markBulkError(results, err)
+
+	var bulkErr *service.BulkError
+	if !errors.As(err, &bulkErr) || bulkErr.ServerID != "" {
+		bulkFailed(c, http.StatusInternalServerError, results, failure, err)
+		return
+	}
+	status := fromServiceError(bulkErr.Err, "").status
+	switch status {
+	case http.StatusNotFound:
+		status = http.StatusUnprocessableEntity
+	case http.StatusInternalServerError:
+		status = http.StatusBadRequest
+	}
+	bulkFailed(c, status, results, invalid)
+}
+
+// bulkFailed ответ на отклоненную массовую операцию. Ошибки в результатах
+// переводятся на язык запроса.
+func bulkFailed(c *gin.Context, status int, results []bulkResult, message string, args ...interface{}) {
+	for i := range results {
+		if results[i].Error != "" {
+			results[i].Error = tr(c, results[i].Error)
+		}
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   tr(c, message, args...),
+		"data": gin.H{
+			"results": results,
+		},
+	})
+}
+
+// parseClientsCSV читает клиентов из CSV с заголовком. Поддерживаемые
+// столбцы: name, email, server_id, allowed_ips, public_key, quota_bytes,
+// quota_period, expires_at (RFC 3339), tags (через точку с запятой).
+func parseClientsCSV(r io.Reader) ([]models.Client, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("missing name column")
+	}
+
+	var clients []models.Client
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(clients) >= maxBulkItems {
+			return nil, fmt.Errorf("more than %d rows", maxBulkItems)
+		}
+
+		field := func(name string) string {
+			if idx, ok := columns[name]; ok && idx < len(record) {
+				return strings.TrimSpace(record[idx])
+			}
+			return ""
+		}
+
+		tags := strings.FieldsFunc(field("tags"), func(r rune) bool { return r == ';' || r == ' ' })
+		client := models.Client{
+			Tags:        tags,
+			Name:        field("name"),
+			Email:       field("email"),
+			ServerID:    field("server_id"),
+			AllowedIPs:  field("allowed_ips"),
+			PublicKey:   field("public_key"),
+			QuotaPeriod: field("quota_period"),
+		}
+		if value := field("quota_bytes"); value != "" {
+			if client.QuotaBytes, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: quota_bytes: %w", line, err)
+			}
+		}
+		if value := field("expires_at"); value != "" {
+			expires, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: expires_at: %w", line, err)
+			}
+			client.ExpiresAt = &expires
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
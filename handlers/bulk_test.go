@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrepareClientsRejectsOverlappingSites(t *testing.T) {
+	setupClientTest(t)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/clients/bulk", nil)
+
+	site := func(name string, subnets ...string) models.Client {
+		return models.Client{Name: name, Kind: models.PeerKindSite, Subnets: subnets, Endpoint: name + ".example.com:51820"}
+	}
+	clients := []models.Client{
+		site("berlin", "192.168.1.0/24"),
+		site("paris", "192.168.2.0/24"),
+		site("madrid", "192.168.1.128/25"),
+		{Name: "laptop"},
+	}
+	results, failed := prepareClients(c, "wg0", clients, time.Now())
+	if !failed {
+		t.Fatal("overlapping sites in one batch were accepted")
+	}
+	for i, result := range results {
+		if wantErr := i == 2; (result.Error != "") != wantErr {
+			t.Errorf("client %d (%s): error %q", i, result.Name, result.Error)
+		}
+	}
+
+	results, failed = prepareClients(c, "wg0", []models.Client{site("berlin", "192.168.1.0/24"), site("paris", "192.168.2.0/24")}, time.Now())
+	if failed {
+		t.Errorf("disjoint sites rejected: %+v", results)
+	}
+}
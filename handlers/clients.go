@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/wireguard"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClient получение клиента
+func GetClient(c *gin.Context) {
+	client, err := svc.Client(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+	if !checkIfMatch(c, client.Version) || notModified(c, client.Version) {
+		return
+	}
+	setETag(c, client.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    client.Public(),
+	})
+}
+
+// PatchClient частичное изменение клиента без смены ключей. Изменения пира
+// на интерфейсе выполняет сервис.
+func PatchClient(c *gin.Context) {
+	var patch apiv1.PatchClientRequest
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+
+	updated, reqErr := patchClient(c, c.Param("id"), patch)
+	if reqErr != nil {
+		writeError(c, reqErr)
+		return
+	}
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated.Public(),
+	})
+}
+
+// applyClientPatch проверяет изменения и применяет их к копии клиента
+func applyClientPatch(client *models.Client, patch apiv1.PatchClientRequest, now time.Time) *requestError {
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" {
+			return badRequest("Имя клиента не может быть пустым")
+		}
+		client.Name = name
+	}
+
+	if patch.Email != nil {
+		email := strings.TrimSpace(*patch.Email)
+		if email != "" {
+			if _, err := mail.ParseAddress(email); err != nil {
+				return badRequest("Неверный email: %v", err)
+			}
+		}
+		client.Email = email
+	}
+
+	if patch.Tags != nil {
+		tags, err := models.NormalizeTags(*patch.Tags)
+		if err != nil {
+			return badRequest("Неверные теги: %v", err)
+		}
+		client.Tags = tags
+	}
+
+	if patch.AllowedIPs != nil {
+		allowedInput := splitAllowedIPs(*patch.AllowedIPs)
+		if len(allowedInput) == 0 {
+			return badRequest("Адреса клиента не могут быть пустыми")
+		}
+		if _, err := wireguard.ParseAllowedIPs(allowedInput); err != nil {
+			return badRequest(err.Error())
+		}
+		server, ok := models.GlobalStorage.GetServer(client.ServerID)
+		if !ok {
+			return &requestError{status: http.StatusNotFound, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+		}
+		if err := wireguard.CheckAddressInNetwork(allowedInput[0], server.Network); err != nil {
+			return badRequest("Адрес клиента должен лежать в сети сервера: %v", err)
+		}
+		used := usedAddresses(client.ServerID)
+		delete(used, hostAddress(client.TunnelAddress()))
+		if _, taken := used[hostAddress(allowedInput[0])]; taken {
+			return &requestError{status: http.StatusConflict, code: apiv1.CodeAddressTaken, message: "Адрес %s уже занят другим клиентом", args: []interface{}{allowedInput[0]}}
+		}
+		client.AllowedIPs = strings.Join(allowedInput, ", ")
+	}
+
+	if patch.QuotaBytes != nil || patch.QuotaPeriod != nil {
+		if patch.QuotaBytes != nil {
+			client.QuotaBytes = *patch.QuotaBytes
+		}
+		if patch.QuotaPeriod != nil && *patch.QuotaPeriod != client.QuotaPeriod {
+			// Учет по новому периоду начинается заново
+			client.QuotaPeriod = *patch.QuotaPeriod
+			periodStart := models.QuotaPeriodStart(client.QuotaPeriod, now)
+			client.PeriodStart = &periodStart
+			client.PeriodUsage = 0
+		}
+		if client.QuotaBytes < 0 || !models.ValidQuotaPeriod(client.QuotaPeriod) {
+			return badRequest("Неверные параметры квоты трафика")
+		}
+		client.QuotaExceeded = client.QuotaBytes > 0 && client.PeriodUsage >= client.QuotaBytes
+	}
+
+	if patch.ExpiresAt.Set {
+		client.ExpiresAt = patch.ExpiresAt.Value
+		client.Expired = client.ExpiredAt(now)
+	}
+
+	if patch.IngressKbit != nil {
+		client.IngressKbit = *patch.IngressKbit
+	}
+	if patch.EgressKbit != nil {
+		client.EgressKbit = *patch.EgressKbit
+	}
+
+	if patch.Subnets != nil || patch.LocalSubnets != nil || patch.Endpoint != nil {
+		if patch.Subnets != nil {
+			client.Subnets = *patch.Subnets
+		}
+		if patch.LocalSubnets != nil {
+			client.LocalSubnets = *patch.LocalSubnets
+		}
+		if patch.Endpoint != nil {
+			client.Endpoint = *patch.Endpoint
+		}
+		server, ok := models.GlobalStorage.GetServer(client.ServerID)
+		if !ok {
+			return &requestError{status: http.StatusNotFound, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+		}
+		if reqErr := prepareSite(client, server); reqErr != nil {
+			return reqErr
+		}
+	}
+
+	if !client.RateLimit().IsZero() {
+		if _, err := wireguard.AddressMinor(client.TunnelAddress()); err != nil {
+			return badRequest("Ограничение скорости недоступно для адреса клиента: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupClientTest(t *testing.T) *models.Server {
+	t.Helper()
+	if err := models.InitStorage(nil); err != nil {
+		t.Fatal(err)
+	}
+	server := &models.Server{ID: "wg0", Name: "office", Network: "10.0.0.0/24"}
+	models.GlobalStorage.AddServer(server)
+	return server
+}
+
+func TestPrepareClientRejectsAddressOutsideNetwork(t *testing.T) {
+	server := setupClientTest(t)
+	now := time.Now()
+
+	outside := models.Client{Name: "laptop", AllowedIPs: "192.168.1.2/32"}
+	if reqErr := prepareClient(&outside, server, map[string]struct{}{}, now); reqErr == nil || reqErr.status != http.StatusBadRequest {
+		t.Fatalf("got %+v, want a bad request", reqErr)
+	}
+
+	inside := models.Client{Name: "laptop", AllowedIPs: "10.0.0.2/32, 192.168.1.0/24"}
+	if reqErr := prepareClient(&inside, server, map[string]struct{}{}, now); reqErr != nil {
+		t.Fatalf("address inside the network: %+v", reqErr)
+	}
+}
+
+func TestApplyClientPatchRejectsAddressOutsideNetwork(t *testing.T) {
+	setupClientTest(t)
+	client := models.Client{ID: "client-1", ServerID: "wg0", Name: "laptop", AllowedIPs: "10.0.0.2/32"}
+
+	outside := "172.16.0.2/32"
+	next := client
+	if reqErr := applyClientPatch(&next, apiv1.PatchClientRequest{AllowedIPs: &outside}, time.Now()); reqErr == nil || reqErr.status != http.StatusBadRequest {
+		t.Fatalf("got %+v, want a bad request", reqErr)
+	}
+
+	inside := "10.0.0.3/32"
+	next = client
+	if reqErr := applyClientPatch(&next, apiv1.PatchClientRequest{AllowedIPs: &inside}, time.Now()); reqErr != nil {
+		t.Fatalf("address inside the network: %+v", reqErr)
+	}
+	if next.AllowedIPs != inside {
+		t.Errorf("allowed IPs %q, want %q", next.AllowedIPs, inside)
+	}
+}
+
+func TestPatchClientIfMatchAfterUsagePass(t *testing.T) {
+	setupClientTest(t)
+	RegisterService(service.New(models.GlobalStorage, nil))
+	models.GlobalStorage.AddClient(&models.Client{ID: "client-1", ServerID: "wg0", Name: "laptop", AllowedIPs: "10.0.0.2/32"})
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/clients/:id", GetClient)
+	engine.PATCH("/clients/:id", PatchClient)
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/clients/client-1", nil))
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag == "" {
+		t.Fatalf("get: status %d, ETag %q", rec.Code, tag)
+	}
+
+	// Проход учета трафика между чтением и изменением
+	usage, _ := svc.Client("client-1")
+	usage.CounterRx, usage.ReceiveBytes, usage.PeriodUsage = 4096, 4096, 4096
+	if saved := svc.RecordUsage([]models.Client{usage}); len(saved) != 1 {
+		t.Fatalf("usage was not recorded")
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/clients/client-1", strings.NewReader(`{"name":"renamed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", tag)
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch after usage pass: status %d: %s", rec.Code, rec.Body)
+	}
+
+	stored, _ := svc.Client("client-1")
+	if stored.Name != "renamed" || stored.ReceiveBytes != 4096 {
+		t.Errorf("stored client %q with %d bytes received", stored.Name, stored.ReceiveBytes)
+	}
+}
+
+func TestGetServerWhileStorageChanges(t *testing.T) {
+	setupClientTest(t)
+	RegisterService(service.New(models.GlobalStorage, nil))
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/server", GetServer)
+
+	// Фоновые задачи меняют хранилище одновременно с запросами
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			models.GlobalStorage.AddServer(&models.Server{ID: "wg" + strconv.Itoa(i+1), Name: "extra"})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/server", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+	}
+	<-done
+}
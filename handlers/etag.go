@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// etag значение ETag для версии записи
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag выставляет заголовок ETag с версией записи
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", etag(version))
+}
+
+// ifMatch сверяет заголовок If-Match с версией записи. Без заголовка
+// проверка не выполняется.
+func ifMatch(c *gin.Context, version int64) *requestError {
+	header := c.GetHeader("If-Match")
+	if header == "" || etagListContains(header, version) {
+		return nil
+	}
+	return conflictError(version)
+}
+
+// checkIfMatch сверяет If-Match с версией записи. При несовпадении отвечает
+// 412 и возвращает false.
+func checkIfMatch(c *gin.Context, version int64) bool {
+	if reqErr := ifMatch(c, version); reqErr != nil {
+		writeError(c, reqErr)
+		return false
+	}
+	return true
+}
+
+// notModified отвечает 304 на GET, если If-None-Match совпадает с версией записи
+func notModified(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" || !etagListContains(header, version) {
+		return false
+	}
+	setETag(c, version)
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagListContains проверяет список ETag из заголовка условного запроса.
+// Слабые ETag сравниваются по значению: других версий записи, кроме
+// номера, не бывает.
+func etagListContains(header string, version int64) bool {
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/export"
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushRows через сколько строк выгрузка отправляется клиенту
+const exportFlushRows = 500
+
+// exportColumn колонка выгрузки клиентов
+type exportColumn struct {
+	key   bool // содержит ключ и выгружается только по явному запросу
+	value func(client *models.Client, server *models.Server) interface{}
+}
+
+// exportColumns доступные колонки выгрузки
+var exportColumns = map[string]exportColumn{
+	"id":        {value: func(c *models.Client, _ *models.Server) interface{} { return c.ID }},
+	"name":      {value: func(c *models.Client, _ *models.Server) interface{} { return c.Name }},
+	"email":     {value: func(c *models.Client, _ *models.Server) interface{} { return c.Email }},
+	"server_id": {value: func(c *models.Client, _ *models.Server) interface{} { return c.ServerID }},
+	"server": {value: func(c *models.Client, s *models.Server) interface{} {
+		if s == nil {
+			return c.ServerID
+		}
+		return s.Name
+	}},
+	"tags":           {value: func(c *models.Client, _ *models.Server) interface{} { return strings.Join(c.Tags, ";") }},
+	"address":        {value: func(c *models.Client, _ *models.Server) interface{} { return c.AllowedIPs }},
+	"status":         {value: func(c *models.Client, _ *models.Server) interface{} { return c.Status() }},
+	"created":        {value: func(c *models.Client, _ *models.Server) interface{} { return c.CreatedAt }},
+	"last_handshake": {value: func(c *models.Client, _ *models.Server) interface{} { return c.LastHandshake }},
+	"expires_at":     {value: func(c *models.Client, _ *models.Server) interface{} { return c.ExpiresAt }},
+	"downloaded":     {value: func(c *models.Client, _ *models.Server) interface{} { return fmt.Sprint(c.Downloaded) }},
+	"rx_bytes":       {value: func(c *models.Client, _ *models.Server) interface{} { return c.ReceiveBytes }},
+	"tx_bytes":       {value: func(c *models.Client, _ *models.Server) interface{} { return c.TransmitBytes }},
+	"total_bytes":    {value: func(c *models.Client, _ *models.Server) interface{} { return c.ReceiveBytes + c.TransmitBytes }},
+	"quota_bytes":    {value: func(c *models.Client, _ *models.Server) interface{} { return c.QuotaBytes }},
+	"period_usage":   {value: func(c *models.Client, _ *models.Server) interface{} { return c.PeriodUsage }},
+	"public_key":     {key: true, value: func(c *models.Client, _ *models.Server) interface{} { return c.PublicKey }},
+	"private_key":    {key: true, value: func(c *models.Client, _ *models.Server) interface{} { return c.PrivateKey }},
+}
+
+// defaultExportColumns колонки выгрузки по умолчанию, без ключей
+var defaultExportColumns = []string{
+	"name", "email", "server", "address", "status", "created",
+	"last_handshake", "rx_bytes", "tx_bytes", "total_bytes",
+}
+
+// ExportClients выгрузка клиентов и их трафика в CSV, JSON или XLSX.
+// Строки отправляются по мере формирования, поэтому размер выгрузки не
+// ограничен памятью. Ключи выгружаются только при include_keys=true и явном
+// указании колонок public_key или private_key.
+func ExportClients(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", export.FormatCSV))
+	if !export.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неизвестный формат выгрузки: %s", format),
+		})
+		return
+	}
+
+	columns := defaultExportColumns
+	if value := c.Query("columns"); value != "" {
+		columns = nil
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				columns = append(columns, name)
+			}
+		}
+	}
+	includeKeys := c.Query("include_keys") == "true"
+	for _, name := range columns {
+		column, ok := exportColumns[name]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неизвестная колонка: %s", name),
+			})
+			return
+		}
+		if column.key && !includeKeys {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Для выгрузки ключей укажите include_keys=true"),
+			})
+			return
+		}
+	}
+	if len(columns) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Не выбрано ни одной колонки"),
+		})
+		return
+	}
+
+	filter := bulkFilter{
+		ServerID: c.Query("server_id"),
+		Search:   c.Query("search"),
+		Tag:      c.Query("tag"),
+		Status:   c.Query("status"),
+	}
+	if filter.Status != "" && !models.ValidStatus(filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неизвестное состояние клиента: %s", filter.Status),
+		})
+		return
+	}
+	clients := make([]models.Client, 0)
+	for _, client := range models.GlobalStorage.GetAllClients() {
+		if filter.matches(client) {
+			clients = append(clients, *client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+
+	recordAudit(c, audit.ActionClientExport, "client", "", "", nil, gin.H{
+		"format":  format,
+		"columns": strings.Join(columns, ","),
+		"count":   len(clients),
+	})
+
+	fileName := fmt.Sprintf("clients-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", "attachment; filename="+fileName)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	writer, err := export.NewWriter(c.Writer, format, columns)
+	if err != nil {
+		log.Printf("не удалось начать выгрузку клиентов: %v", err)
+		return
+	}
+
+	servers := make(map[string]*models.Server)
+	values := make([]interface{}, len(columns))
+	for i := range clients {
+		client := &clients[i]
+		server, cached := servers[client.ServerID]
+		if !cached {
+			server, _ = models.GlobalStorage.GetServer(client.ServerID)
+			servers[client.ServerID] = server
+		}
+		for j, name := range columns {
+			values[j] = exportColumns[name].value(client, server)
+		}
+		if err := writer.WriteRow(values); err != nil {
+			log.Printf("выгрузка клиентов прервана: %v", err)
+			return
+		}
+		if (i+1)%exportFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				log.Printf("выгрузка клиентов прервана: %v", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("выгрузка клиентов прервана: %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupInfo группа с числом участников
+type groupInfo struct {
+	*models.Group
+	Members int `json:"members"`
+}
+
+// GetGroups список групп
+func GetGroups(c *gin.Context) {
+	groups := models.GlobalStorage.GetAllGroups()
+	result := make([]groupInfo, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, groupInfo{
+			Group:   group,
+			Members: len(models.GlobalStorage.GetClientsByTag(group.Name)),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// CreateGroup создание группы для тега
+func CreateGroup(c *gin.Context) {
+	var group models.Group
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+	group.Name = strings.ToLower(strings.TrimSpace(group.Name))
+	if err := group.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные параметры группы: %v", err),
+		})
+		return
+	}
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+
+	// У клиентов с этим тегом могут измениться маршруты и DNS
+	var added bool
+	outdated := updateGroupRoutes(group.Name, func() {
+		added = models.GlobalStorage.AddGroup(&group)
+	})
+	if !added {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   tr(c, "Группа уже существует"),
+		})
+		return
+	}
+	recordAudit(c, audit.ActionGroupCreate, "group", group.Name, group.Name, nil, &group)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    group,
+		"message": tr(c, "Конфигураций устарело: %d", outdated),
+	})
+}
+
+// UpdateGroup изменение политики группы. Срок действия и квота применяются
+// только к новым клиентам, маршруты и DNS — ко всем участникам.
+func UpdateGroup(c *gin.Context) {
+	existing, exists := models.GlobalStorage.GetGroup(c.Param("name"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Группа не найдена"),
+		})
+		return
+	}
+
+	var group models.Group
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+	group.Name = existing.Name
+	group.CreatedAt = existing.CreatedAt
+	if err := group.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные параметры группы: %v", err),
+		})
+		return
+	}
+
+	before := *existing
+	outdated := updateGroupRoutes(group.Name, func() {
+		models.GlobalStorage.UpdateGroup(&group)
+	})
+	recordAudit(c, audit.ActionGroupUpdate, "group", group.Name, group.Name, &before, &group)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    group,
+		"message": tr(c, "Конфигураций устарело: %d", outdated),
+	})
+}
+
+// DeleteGroup удаление группы. Теги клиентов сохраняются.
+func DeleteGroup(c *gin.Context) {
+	group, exists := models.GlobalStorage.GetGroup(c.Param("name"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Группа не найдена"),
+		})
+		return
+	}
+
+	outdated := updateGroupRoutes(group.Name, func() {
+		models.GlobalStorage.DeleteGroup(group.Name)
+	})
+	recordAudit(c, audit.ActionGroupDelete, "group", group.Name, group.Name, group, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, "Группа удалена, конфигураций устарело: %d", outdated),
+	})
+}
+
+// GroupAction отключение или включение всех клиентов с тегом группы
+func GroupAction(c *gin.Context) {
+	action := c.Param("action")
+	if action != bulkDisable && action != bulkEnable {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Неизвестное действие"),
+		})
+		return
+	}
+
+	members := models.GlobalStorage.GetClientsByTag(c.Param("name"))
+	if len(members) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "В группе нет клиентов"),
+		})
+		return
+	}
+	if len(members) > maxBulkItems {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "В группе больше %d клиентов", maxBulkItems),
+		})
+		return
+	}
+
+	clients := make([]models.Client, 0, len(members))
+	for id := range members {
+		if client, err := svc.Client(id); err == nil {
+			clients = append(clients, client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+	results := make([]bulkResult, len(clients))
+	for i, client := range clients {
+		results[i] = bulkResult{Index: i, ID: client.ID, Name: client.Name}
+	}
+
+	runBulkAction(c, action, clients, results)
+}
+
+// SetClientTags замена тегов клиента
+func SetClientTags(c *gin.Context) {
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+	tags, err := models.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные теги: %v", err),
+		})
+		return
+	}
+
+	client, err := svc.Client(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+	if !checkIfMatch(c, client.Version) {
+		return
+	}
+
+	next := client
+	next.Tags = tags
+	if clientRoutes(&next) != clientRoutes(&client) {
+		next.ConfigOutdated = true
+		next.Downloaded = false
+	}
+	updated, err := svc.UpdateClient(next, client.Version)
+	if err != nil {
+		serviceError(c, err, "Не удалось изменить клиента")
+		return
+	}
+	recordAudit(c, audit.ActionClientUpdate, "client", updated.ID, updated.Name, &client, &updated)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated.Public(),
+	})
+}
+
+// updateGroupRoutes выполняет изменение группы и помечает устаревшими
+// конфигурации участников, у которых поменялись маршруты или DNS.
+// Возвращает число таких клиентов.
+func updateGroupRoutes(name string, change func()) int {
+	members := models.GlobalStorage.GetClientsByTag(name)
+	before := make(map[string]string, len(members))
+	for id := range members {
+		if client, err := svc.Client(id); err == nil {
+			before[id] = clientRoutes(&client)
+		}
+	}
+
+	change()
+
+	outdated := 0
+	for id, routes := range before {
+		client, err := svc.Client(id)
+		if err != nil || clientRoutes(&client) == routes {
+			continue
+		}
+		if _, err := svc.MarkClientOutdated(id); err != nil {
+			log.Printf("не удалось пометить конфигурацию клиента %s устаревшей: %v", client.Name, err)
+			continue
+		}
+		outdated++
+	}
+	return outdated
+}
+
+// clientRoutes маршруты и DNS из конфигурации клиента одной строкой для
+// сравнения; у площадки — ее маршруты и адрес шлюза
+func clientRoutes(client *models.Client) string {
+	server, ok := models.GlobalStorage.GetServer(client.ServerID)
+	if !ok {
+		return ""
+	}
+	if client.IsSite() {
+		return strings.Join(siteAllowedIPs(server, client), ", ") + "|" + client.Endpoint
+	}
+	routes, dns := models.ConfigRoutes(server, models.GlobalStorage.ClientGroups(client))
+	return routes + "|" + dns
+}
@@ -5,9 +5,16 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/config"
+	"wireguard-web-manager/i18n"
 	"wireguard-web-manager/models"
+	"wireguard-web-manager/scheduler"
+	"wireguard-web-manager/service"
 	"wireguard-web-manager/wireguard"
 
 	"github.com/gin-gonic/gin"
@@ -20,29 +27,54 @@ func RegisterWireGuardService(service *wireguard.Service) {
 	wgService = service
 }
 
+// svc выполняет изменения серверов и клиентов вместе с интерфейсами WireGuard
+var svc *service.Service
+
+func RegisterService(s *service.Service) {
+	svc = s
+}
+
+// serverDefaults значения для полей, не заданных при создании сервера.
+// Меняются при перечитывании настроек, поэтому читаются под мьютексом.
+var (
+	serverDefaultsMu sync.RWMutex
+	serverDefaults   = config.Default().Server
+)
+
+func RegisterServerDefaults(defaults config.ServerDefaults) {
+	serverDefaultsMu.Lock()
+	defer serverDefaultsMu.Unlock()
+	serverDefaults = defaults
+}
+
+func currentServerDefaults() config.ServerDefaults {
+	serverDefaultsMu.RLock()
+	defer serverDefaultsMu.RUnlock()
+	return serverDefaults
+}
+
 // Index главная страница
 func Index(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"title": "WireGuard Web Manager",
-	})
+	c.HTML(http.StatusOK, "index.html", pageData(c, "WireGuard Web Manager"))
 }
 
 // Dashboard страница панели управления
 func Dashboard(c *gin.Context) {
-	c.HTML(http.StatusOK, "dashboard.html", gin.H{
-		"title": "Панель управления WireGuard",
-	})
+	data := pageData(c, "Панель управления WireGuard")
+	data["defaults"] = currentServerDefaults()
+	c.HTML(http.StatusOK, "dashboard.html", data)
 }
 
 // GetServer получение сервера
 func GetServer(c *gin.Context) {
-	// Для простоты возвращаем первый сервер или создаем пустой
-	server := &models.Server{}
-	if len(models.GlobalStorage.Servers) > 0 {
-		for _, s := range models.GlobalStorage.Servers {
-			server = s
-			break
-		}
+	// Для простоты возвращаем первый по ID сервер или пустой. Хранилище
+	// меняют фоновые задачи, поэтому читаются только копии.
+	server := models.Server{}
+	if servers := svc.Servers(); len(servers) > 0 {
+		server = servers[0]
+	}
+	if server.ID != "" {
+		setETag(c, server.Version)
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -50,192 +82,102 @@ func GetServer(c *gin.Context) {
 	})
 }
 
-// CreateServer создание сервера
-func CreateServer(c *gin.Context) {
-	var server models.Server
-	if err := c.ShouldBindJSON(&server); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+// GetServerByID получение сервера по ID
+func GetServerByID(c *gin.Context) {
+	server, err := svc.Server(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
-			"error":   "Неверные данные: " + err.Error(),
+			"error":   tr(c, "Сервер не найден"),
 		})
 		return
 	}
-
-	if server.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Имя интерфейса обязательно",
-		})
+	if !checkIfMatch(c, server.Version) || notModified(c, server.Version) {
 		return
 	}
-
-	server.ID = server.Name
-	server.CreatedAt = time.Now()
-	server.UpdatedAt = server.CreatedAt
-	server.IsActive = true
-
-	if server.PrivateKey == "" {
-		key, err := wireguard.GeneratePrivateKey()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "Не удалось сгенерировать ключ: " + err.Error(),
-			})
-			return
-		}
-		server.PrivateKey = key.String()
-		server.PublicKey = key.PublicKey().String()
-	} else {
-		key, err := wgtypes.ParseKey(server.PrivateKey)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"success": false,
-				"error":   "Неверный приватный ключ: " + err.Error(),
-			})
-			return
-		}
-		server.PrivateKey = key.String()
-		server.PublicKey = key.PublicKey().String()
-	}
-
-	if wgService != nil {
-		if err := wgService.ConfigureServer(server.ID, server.PrivateKey, server.ListenPort, true, nil); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "Не удалось настроить интерфейс WireGuard: " + err.Error(),
-			})
-			return
-		}
-	}
-
-	models.GlobalStorage.AddServer(&server)
-
-	c.JSON(http.StatusCreated, gin.H{
+	setETag(c, server.Version)
+	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    server,
 	})
 }
 
-// UpdateServer обновление сервера
-func UpdateServer(c *gin.Context) {
-	id := c.Param("id")
+// CreateServer создание сервера
+func CreateServer(c *gin.Context) {
 	var server models.Server
 	if err := c.ShouldBindJSON(&server); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Неверные данные: " + err.Error(),
+			"error":   tr(c, "Неверные данные: %v", err),
 		})
 		return
 	}
 
-	existing, ok := models.GlobalStorage.GetServer(id)
-	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Сервер не найден",
-		})
+	created, reqErr := createServer(c, server)
+	if reqErr != nil {
+		writeError(c, reqErr)
 		return
 	}
 
-	if server.Name == "" {
-		server.Name = existing.Name
-	}
+	setETag(c, created.Version)
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
 
-	if server.Name != existing.Name {
+// UpdateServer обновление сервера
+func UpdateServer(c *gin.Context) {
+	var server models.Server
+	if err := c.ShouldBindJSON(&server); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Переименование интерфейса не поддерживается",
+			"error":   tr(c, "Неверные данные: %v", err),
 		})
 		return
 	}
 
-	server.ID = existing.ID
-	server.CreatedAt = existing.CreatedAt
-
-	if server.PrivateKey == "" {
-		server.PrivateKey = existing.PrivateKey
-	}
-
-	key, err := wgtypes.ParseKey(server.PrivateKey)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Неверный приватный ключ: " + err.Error(),
-		})
+	updated, reqErr := updateServer(c, c.Param("id"), server)
+	if reqErr != nil {
+		writeError(c, reqErr)
 		return
 	}
-	server.PrivateKey = key.String()
-	server.PublicKey = key.PublicKey().String()
-
-	server.UpdatedAt = time.Now()
-
-	if wgService != nil {
-		if err := wgService.ConfigureServer(server.ID, server.PrivateKey, server.ListenPort, false, nil); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "Не удалось обновить конфигурацию WireGuard: " + err.Error(),
-			})
-			return
-		}
-	}
-
-	models.GlobalStorage.UpdateServer(&server)
 
+	setETag(c, updated.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    server,
+		"data":    updated,
 	})
 }
 
-// DeleteServer удаление сервера
+// DeleteServer удаление сервера. Удаление отсутствующего сервера не
+// считается ошибкой.
 func DeleteServer(c *gin.Context) {
-	id := c.Param("id")
-
-	if server, ok := models.GlobalStorage.GetServer(id); ok {
-		if wgService != nil {
-			if err := wgService.ConfigureServer(server.ID, "", 0, true, nil); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"success": false,
-					"error":   "Не удалось очистить конфигурацию WireGuard: " + err.Error(),
-				})
-				return
-			}
-		}
-
-		clients := models.GlobalStorage.GetClientsByServerID(id)
-		for clientID := range clients {
-			models.GlobalStorage.DeleteClient(clientID)
-		}
+	if reqErr := deleteServer(c, c.Param("id")); reqErr != nil && reqErr.code != apiv1.CodeNotFound {
+		writeError(c, reqErr)
+		return
 	}
 
-	models.GlobalStorage.DeleteServer(id)
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Сервер удален",
+		"message": tr(c, "Сервер удален"),
 	})
 }
 
-// GetClients получение списка клиентов
+// GetClients список клиентов с фильтрами, сортировкой и постраничным выводом.
+// Следующая страница запрашивается с курсором next_cursor предыдущей.
 func GetClients(c *gin.Context) {
-	serverID := c.Query("server_id")
-
-	var clients map[string]*models.Client
-	if serverID != "" {
-		clients = models.GlobalStorage.GetClientsByServerID(serverID)
-	} else {
-		clients = models.GlobalStorage.GetAllClients()
-	}
-
-	// Преобразование в слайс для JSON
-	clientsList := make([]*models.Client, 0, len(clients))
-	for _, client := range clients {
-		clientsList = append(clientsList, client)
+	page, reqErr := queryClients(c)
+	if reqErr != nil {
+		writeError(c, reqErr)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    clientsList,
+		"success":     true,
+		"data":        page.Items,
+		"total":       page.Total,
+		"next_cursor": page.NextCursor,
 	})
 }
 
@@ -245,158 +187,166 @@ func CreateClient(c *gin.Context) {
 	if err := c.ShouldBindJSON(&client); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Неверные данные: " + err.Error(),
+			"error":   tr(c, "Неверные данные: %v", err),
 		})
 		return
 	}
 
-	if wgService == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Сервис WireGuard недоступен",
-		})
+	created, reqErr := createClient(c, client)
+	if reqErr != nil {
+		writeError(c, reqErr)
 		return
 	}
 
-	server, ok := models.GlobalStorage.GetServer(client.ServerID)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   "Сервер не найден",
-		})
-		return
+	setETag(c, created.Version)
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created.Public(),
+	})
+}
+
+// prepareClient проверяет данные нового клиента сервера server и заполняет
+// ключи, адрес и служебные поля. Интерфейс и хранилище не изменяются. Занятые
+// адреса берутся из used и дополняются адресом клиента.
+func prepareClient(client *models.Client, server *models.Server, used map[string]struct{}, now time.Time) *requestError {
+	tags, err := models.NormalizeTags(client.Tags)
+	if err != nil {
+		return badRequest("Неверные теги: %v", err)
 	}
+	client.Tags = tags
+	models.ApplyGroupDefaults(client, models.GlobalStorage.ClientGroups(client), now)
 
-	var privateKey wgtypes.Key
-	if client.PrivateKey == "" {
-		key, err := wgtypes.GeneratePrivateKey()
+	if client.QuotaBytes < 0 || !models.ValidQuotaPeriod(client.QuotaPeriod) {
+		return badRequest("Неверные параметры квоты трафика")
+	}
+
+	if client.Schedule != nil {
+		if err := client.Schedule.Validate(); err != nil {
+			return badRequest("Неверное расписание доступа: %v", err)
+		}
+	}
+	client.IsDisabled = false
+	client.QuotaExceeded = false
+	client.OutsideSchedule = false
+	client.NextScheduleChange = nil
+	client.Expired = client.ExpiredAt(now)
+	scheduler.Apply(client, now)
+
+	// Если клиент передал только открытый ключ, приватный ключ остается у него
+	// и на сервер не попадает
+	var privateKey, publicKey wgtypes.Key
+	switch {
+	case client.PrivateKey == "" && client.PublicKey != "":
+		key, err := wireguard.ParsePublicKey(client.PublicKey)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "Не удалось сгенерировать ключ: " + err.Error(),
-			})
-			return
+			return badRequest("Неверный открытый ключ клиента: %v", err)
+		}
+		publicKey = key
+	case client.PrivateKey == "":
+		key, err := wireguard.GeneratePrivateKey()
+		if err != nil {
+			return &requestError{status: http.StatusInternalServerError, message: "Не удалось сгенерировать ключ: %v", args: []interface{}{err}}
 		}
-		privateKey = key
-	} else {
+		privateKey, publicKey = key, key.PublicKey()
+	default:
 		key, err := wgtypes.ParseKey(client.PrivateKey)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"success": false,
-				"error":   "Неверный приватный ключ клиента: " + err.Error(),
-			})
-			return
+			return badRequest("Неверный приватный ключ клиента: %v", err)
+		}
+		if client.PublicKey != "" && client.PublicKey != key.PublicKey().String() {
+			return badRequest("Открытый ключ не соответствует приватному")
 		}
-		privateKey = key
+		privateKey, publicKey = key, key.PublicKey()
+	}
+
+	if _, exists := models.GlobalStorage.FindClientByPublicKey(server.ID, publicKey.String()); exists {
+		return &requestError{status: http.StatusConflict, code: apiv1.CodeKeyTaken, message: "Клиент с таким открытым ключом уже существует"}
 	}
 
 	allowedInput := splitAllowedIPs(client.AllowedIPs)
 	if len(allowedInput) == 0 {
-		used := make(map[string]struct{})
-		existing := models.GlobalStorage.GetClientsByServerID(server.ID)
-		for _, item := range existing {
-			addr := strings.TrimSpace(item.AllowedIPs)
-			if addr == "" {
-				continue
-			}
-			if idx := strings.Index(addr, "/"); idx > 0 {
-				addr = addr[:idx]
-			}
-			used[addr] = struct{}{}
-		}
-
 		addr, err := wireguard.AllocateAddress(server.Network, used)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"success": false,
-				"error":   "Не удалось выделить IP для клиента: " + err.Error(),
-			})
-			return
+			return badRequest("Не удалось выделить IP для клиента: %v", err)
 		}
 		allowedInput = []string{addr}
+	} else if _, taken := used[hostAddress(allowedInput[0])]; taken {
+		return &requestError{status: http.StatusConflict, code: apiv1.CodeAddressTaken, message: "Адрес %s уже занят другим клиентом", args: []interface{}{allowedInput[0]}}
 	}
 
-	allowedNetworks, err := wireguard.ParseAllowedIPs(allowedInput)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"error":   err.Error(),
-		})
-		return
+	if _, err := wireguard.ParseAllowedIPs(allowedInput); err != nil {
+		return badRequest(err.Error())
 	}
-
-	keepalive := 25 * time.Second
-	peerCfg := wgtypes.PeerConfig{
-		PublicKey:                   privateKey.PublicKey(),
-		ReplaceAllowedIPs:           true,
-		AllowedIPs:                  allowedNetworks,
-		PersistentKeepaliveInterval: &keepalive,
+	if err := wireguard.CheckAddressInNetwork(allowedInput[0], server.Network); err != nil {
+		return badRequest("Адрес клиента должен лежать в сети сервера: %v", err)
 	}
 
-	if err := wgService.ConfigureServer(server.ID, "", 0, false, []wgtypes.PeerConfig{peerCfg}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Не удалось добавить клиента в WireGuard: " + err.Error(),
-		})
-		return
+	if !client.RateLimit().IsZero() {
+		if _, err := wireguard.AddressMinor(allowedInput[0]); err != nil {
+			return badRequest("Ограничение скорости недоступно для адреса клиента: %v", err)
+		}
 	}
-
 	client.ID = models.GenerateClientID()
+	if reqErr := prepareSite(client, server); reqErr != nil {
+		return reqErr
+	}
+	used[hostAddress(allowedInput[0])] = struct{}{}
+
 	client.ServerID = server.ID
-	client.CreatedAt = time.Now()
+	client.CreatedAt = now
 	client.UpdatedAt = client.CreatedAt
-	client.IsActive = true
-	client.IsDisabled = false
+	client.IsActive = client.ShouldBeConnected()
 	client.Downloaded = false
-	client.PrivateKey = privateKey.String()
-	client.PublicKey = privateKey.PublicKey().String()
+	client.PrivateKey = ""
+	if privateKey != (wgtypes.Key{}) {
+		client.PrivateKey = privateKey.String()
+	}
+	client.PublicKey = publicKey.String()
+	client.ClientKey = client.PrivateKey == ""
 	client.AllowedIPs = strings.Join(allowedInput, ", ")
 
-	models.GlobalStorage.AddClient(&client)
-
-	c.JSON(http.StatusCreated, gin.H{
-		"success": true,
-		"data":    client,
-	})
+	periodStart := models.QuotaPeriodStart(client.QuotaPeriod, client.CreatedAt)
+	client.PeriodStart = &periodStart
+	client.PeriodUsage = 0
+	client.ReceiveBytes = 0
+	client.TransmitBytes = 0
+	client.ResetCounters()
+	client.LastHandshake = nil
+	client.PendingPrivateKey = ""
+	client.PendingPublicKey = ""
+	client.RotationDeadline = nil
+	client.ConfigOutdated = false
+	return nil
 }
 
-// DownloadClientConfig скачивание конфигурации клиента
-func DownloadClientConfig(c *gin.Context) {
-	id := c.Param("id")
-	client, exists := models.GlobalStorage.GetClient(id)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Клиент не найден",
-		})
-		return
+// usedAddresses возвращает туннельные адреса клиентов сервера
+func usedAddresses(serverID string) map[string]struct{} {
+	used := make(map[string]struct{})
+	for _, item := range models.GlobalStorage.GetClientsByServerID(serverID) {
+		if addr := hostAddress(item.TunnelAddress()); addr != "" {
+			used[addr] = struct{}{}
+		}
 	}
+	return used
+}
 
-	server, exists := models.GlobalStorage.GetServer(client.ServerID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Сервер не найден",
-		})
-		return
+// hostAddress отбрасывает маску из адреса вида 10.0.0.2/32
+func hostAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if idx := strings.Index(addr, "/"); idx > 0 {
+		addr = addr[:idx]
 	}
+	return addr
+}
 
-	// Генерация конфигурации WireGuard
-	config, err := generateWireGuardConfig(server, client)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"error":   "Не удалось сформировать конфигурацию: " + err.Error(),
-		})
+// DownloadClientConfig скачивание конфигурации клиента
+func DownloadClientConfig(c *gin.Context) {
+	client, config, reqErr := clientConfig(c, c.Param("id"))
+	if reqErr != nil {
+		writeError(c, reqErr)
 		return
 	}
 
-	// Обновление статистики скачиваний
-	client.Downloaded = true
-	now := time.Now()
-	client.DownloadAt = &now
-	models.GlobalStorage.UpdateClient(client)
-
 	c.Header("Content-Type", "text/plain")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.conf", client.Name))
 	c.String(http.StatusOK, config)
@@ -404,123 +354,109 @@ func DownloadClientConfig(c *gin.Context) {
 
 // DisableClient отключение клиента
 func DisableClient(c *gin.Context) {
-	id := c.Param("id")
-	client, exists := models.GlobalStorage.GetClient(id)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Клиент не найден",
-		})
+	updated, reqErr := setClientDisabled(c, c.Param("id"), true)
+	if reqErr != nil {
+		writeError(c, reqErr)
 		return
 	}
 
-	if wgService != nil {
-		if err := wgService.RemovePeer(client.ServerID, client.PublicKey); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"error":   "Не удалось отключить клиента в WireGuard: " + err.Error(),
-			})
-			return
-		}
-	}
-
-	client.IsDisabled = true
-	client.IsActive = false
-	models.GlobalStorage.UpdateClient(client)
-
+	setETag(c, updated.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Клиент отключен",
+		"message": tr(c, "Клиент отключен"),
 	})
 }
 
 // EnableClient включение клиента
 func EnableClient(c *gin.Context) {
-	id := c.Param("id")
-	client, exists := models.GlobalStorage.GetClient(id)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Клиент не найден",
-		})
+	updated, reqErr := setClientDisabled(c, c.Param("id"), false)
+	if reqErr != nil {
+		writeError(c, reqErr)
 		return
 	}
 
-	server, exists := models.GlobalStorage.GetServer(client.ServerID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"error":   "Сервер не найден",
-		})
-		return
+	message := "Клиент включен"
+	if updated.QuotaExceeded {
+		message = "Клиент включен, но будет подключен только после сброса квоты трафика"
+	} else if updated.OutsideSchedule {
+		message = "Клиент включен, но будет подключен только в окне доступа"
+	} else if updated.Expired {
+		message = "Клиент включен, но срок его доступа истек"
 	}
 
-	allowedInput := splitAllowedIPs(client.AllowedIPs)
-	allowedNetworks, err := wireguard.ParseAllowedIPs(allowedInput)
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, message),
+	})
+}
+
+// UpdateClientSchedule установка или снятие расписания доступа клиента
+func UpdateClientSchedule(c *gin.Context) {
+	client, err := svc.Client(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
-			"error":   err.Error(),
+			"error":   tr(c, "Клиент не найден"),
 		})
 		return
 	}
+	if !checkIfMatch(c, client.Version) {
+		return
+	}
 
-	pubKey, err := wgtypes.ParseKey(client.PublicKey)
-	if err != nil {
+	// {"schedule": null} снимает расписание
+	var req struct {
+		Schedule *models.Schedule `json:"schedule"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"error":   "Некорректный публичный ключ клиента: " + err.Error(),
+			"error":   tr(c, "Неверные данные: %v", err),
 		})
 		return
 	}
+	schedule := req.Schedule
 
-	keepalive := 25 * time.Second
-	peerCfg := wgtypes.PeerConfig{
-		PublicKey:                   pubKey,
-		ReplaceAllowedIPs:           true,
-		AllowedIPs:                  allowedNetworks,
-		PersistentKeepaliveInterval: &keepalive,
-	}
-
-	if wgService != nil {
-		if err := wgService.ConfigureServer(server.ID, "", 0, false, []wgtypes.PeerConfig{peerCfg}); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
+	if schedule != nil {
+		if err := schedule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
-				"error":   "Не удалось включить клиента в WireGuard: " + err.Error(),
+				"error":   tr(c, "Неверное расписание доступа: %v", err),
 			})
 			return
 		}
 	}
 
-	client.IsDisabled = false
-	client.IsActive = true
-	models.GlobalStorage.UpdateClient(client)
+	// Планировщик только вычисляет состояние, пир переносит сервис
+	next := client
+	next.Schedule = schedule
+	scheduler.Apply(&next, time.Now())
+	updated, err := svc.UpdateClient(next, client.Version)
+	if err != nil {
+		serviceError(c, err, "Не удалось применить расписание")
+		return
+	}
+	recordAudit(c, audit.ActionClientSchedule, "client", updated.ID, updated.Name, &client, &updated)
 
+	setETag(c, updated.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Клиент включен",
+		"data":    updated.Public(),
 	})
 }
 
-// DeleteClient удаление клиента
+// DeleteClient удаление клиента. Удаление отсутствующего клиента не
+// считается ошибкой.
 func DeleteClient(c *gin.Context) {
-	id := c.Param("id")
-	if client, exists := models.GlobalStorage.GetClient(id); exists {
-		if wgService != nil {
-			if err := wgService.RemovePeer(client.ServerID, client.PublicKey); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"success": false,
-					"error":   "Не удалось удалить клиента из WireGuard: " + err.Error(),
-				})
-				return
-			}
-		}
+	if reqErr := deleteClient(c, c.Param("id")); reqErr != nil && reqErr.code != apiv1.CodeNotFound {
+		writeError(c, reqErr)
+		return
 	}
-	models.GlobalStorage.DeleteClient(id)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Клиент удален",
+		"message": tr(c, "Клиент удален"),
 	})
 }
 
@@ -536,11 +472,11 @@ func GetStats(c *gin.Context) {
 
 // Вспомогательные функции
 
-func generateWireGuardConfig(server *models.Server, client *models.Client) (string, error) {
-	if client.PrivateKey == "" {
-		return "", errors.New("у клиента отсутствует приватный ключ")
-	}
+// privateKeyPlaceholder подставляется в конфигурацию клиента, ключ которого
+// хранится только у него самого; переводится на язык конфигурации
+const privateKeyPlaceholder = "<ВСТАВЬТЕ_ПРИВАТНЫЙ_КЛЮЧ>"
 
+func generateWireGuardConfig(server *models.Server, client *models.Client, loc i18n.Locale) (string, error) {
 	allowed := splitAllowedIPs(client.AllowedIPs)
 	if len(allowed) == 0 {
 		return "", errors.New("у клиента не настроены адреса")
@@ -548,11 +484,23 @@ func generateWireGuardConfig(server *models.Server, client *models.Client) (stri
 
 	var config strings.Builder
 
+	privateKey := client.ConfigPrivateKey()
+	if privateKey == "" {
+		privateKey = loc.T(privateKeyPlaceholder)
+	}
+
+	if client.IsSite() {
+		return generateSiteConfig(server, client, privateKey), nil
+	}
+
+	// Маршруты и DNS группы клиента заменяют настройки сервера
+	routes, dns := models.ConfigRoutes(server, models.GlobalStorage.ClientGroups(client))
+
 	config.WriteString("[Interface]\n")
-	config.WriteString("PrivateKey = " + client.PrivateKey + "\n")
+	config.WriteString("PrivateKey = " + privateKey + "\n")
 	config.WriteString("Address = " + strings.Join(ensureCIDR(allowed), ", ") + "\n")
-	if server.DNS != "" {
-		config.WriteString("DNS = " + server.DNS + "\n")
+	if dns != "" {
+		config.WriteString("DNS = " + dns + "\n")
 	}
 	config.WriteString("\n")
 
@@ -561,8 +509,8 @@ func generateWireGuardConfig(server *models.Server, client *models.Client) (stri
 	if server.Endpoint != "" {
 		config.WriteString("Endpoint = " + server.Endpoint + "\n")
 	}
-	if server.AllowedIPs != "" {
-		config.WriteString("AllowedIPs = " + server.AllowedIPs + "\n")
+	if routes != "" {
+		config.WriteString("AllowedIPs = " + routes + "\n")
 	}
 	config.WriteString("PersistentKeepalive = 25\n")
 
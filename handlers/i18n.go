@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"wireguard-web-manager/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// localeKey ключ языка запроса в контексте gin
+const localeKey = "locale"
+
+// LocaleCookie cookie с выбранным пользователем языком
+const LocaleCookie = "lang"
+
+// Locale выбирает язык ответа: параметр lang запроса, затем cookie lang с
+// выбором пользователя, затем заголовок Accept-Language. Параметр lang
+// запоминается в cookie, чтобы выбор на странице сохранялся.
+func Locale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale, ok := i18n.Parse(c.Query("lang"))
+		if ok {
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     LocaleCookie,
+				Value:    string(locale),
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				Secure:   isHTTPS(c),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if cookie, err := c.Cookie(LocaleCookie); err == nil {
+			locale, ok = i18n.Parse(cookie)
+		}
+		if !ok {
+			locale = i18n.Match(c.GetHeader("Accept-Language"))
+		}
+
+		c.Set(localeKey, locale)
+		c.Header("Content-Language", string(locale))
+		c.Header("Vary", "Accept-Language, Cookie")
+		c.Next()
+	}
+}
+
+// locale язык запроса; вне middleware Locale — язык по умолчанию
+func locale(c *gin.Context) i18n.Locale {
+	if value, ok := c.Get(localeKey); ok {
+		if locale, ok := value.(i18n.Locale); ok {
+			return locale
+		}
+	}
+	return i18n.Default
+}
+
+// tr переводит сообщение на язык запроса и подставляет аргументы
+func tr(c *gin.Context, format string, args ...interface{}) string {
+	return locale(c).Tf(format, args...)
+}
+
+// pageData данные шаблона страницы с языком и каталогом для app.js
+func pageData(c *gin.Context, title string) gin.H {
+	loc := locale(c)
+	return gin.H{
+		"title":    loc.T(title),
+		"locale":   loc,
+		"messages": loc.Messages(),
+	}
+}
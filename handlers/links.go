@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/links"
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// LinkPathPrefix путь публичного скачивания по одноразовой ссылке
+const LinkPathPrefix = "/d/"
+
+var downloadLinks *links.Store
+
+func RegisterDownloadLinks(store *links.Store) {
+	downloadLinks = store
+}
+
+// CreateClientLink выдача одноразовой ссылки на конфигурацию или QR-код клиента
+func CreateClientLink(c *gin.Context) {
+	if !downloadLinksAvailable(c) {
+		return
+	}
+
+	var req struct {
+		Kind       string `json:"kind"`
+		TTLMinutes int    `json:"ttl_minutes"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверные данные: %v", err),
+			})
+			return
+		}
+	}
+	if req.Kind == "" {
+		req.Kind = links.KindConfig
+	}
+	if req.TTLMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверный срок действия ссылки"),
+		})
+		return
+	}
+
+	client, exists := models.GlobalStorage.GetClient(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+
+	link, token, err := downloadLinks.Create(client.ID, req.Kind, auditActor(c), time.Duration(req.TTLMinutes)*time.Minute)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Не удалось создать ссылку: %v", err),
+		})
+		return
+	}
+	recordAudit(c, audit.ActionLinkCreate, "client", client.ID, client.Name, nil, &link)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"link": link,
+			"url":  linkURL(c, token),
+		},
+	})
+}
+
+// GetClientLinks список выданных ссылок клиента. Токены не возвращаются.
+func GetClientLinks(c *gin.Context) {
+	if !downloadLinksAvailable(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    downloadLinks.ClientLinks(c.Param("id")),
+	})
+}
+
+// RevokeClientLink отзыв одной ссылки клиента
+func RevokeClientLink(c *gin.Context) {
+	if !downloadLinksAvailable(c) {
+		return
+	}
+
+	client, exists := models.GlobalStorage.GetClient(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+
+	link, ok := downloadLinks.Revoke(c.Param("link_id"))
+	if !ok || link.ClientID != client.ID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Ссылка не найдена"),
+		})
+		return
+	}
+	recordAudit(c, audit.ActionLinkRevoke, "client", client.ID, client.Name, nil, &link)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, "Ссылка отозвана"),
+	})
+}
+
+// RevokeClientLinks отзыв всех действующих ссылок клиента
+func RevokeClientLinks(c *gin.Context) {
+	if !downloadLinksAvailable(c) {
+		return
+	}
+
+	client, exists := models.GlobalStorage.GetClient(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+
+	count := downloadLinks.RevokeClient(client.ID)
+	if count > 0 {
+		recordAudit(c, audit.ActionLinkRevoke, "client", client.ID, client.Name, nil, gin.H{"revoked": count})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, "Отозвано ссылок: %d", count),
+	})
+}
+
+// DownloadByLink скачивание конфигурации или QR-кода по одноразовой ссылке.
+// Не требует входа администратора: доступ подтверждается подписью токена.
+func DownloadByLink(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+
+	if downloadLinks == nil {
+		c.String(http.StatusNotFound, tr(c, "Ссылка недействительна"))
+		return
+	}
+
+	link, err := downloadLinks.Consume(c.Param("token"), time.Now())
+	if err != nil {
+		c.String(linkErrorStatus(err), tr(c, linkErrorText(err)))
+		return
+	}
+
+	client, exists := models.GlobalStorage.GetClient(link.ClientID)
+	if !exists {
+		c.String(http.StatusGone, tr(c, "Клиент удален"))
+		return
+	}
+	server, exists := models.GlobalStorage.GetServer(client.ServerID)
+	if !exists {
+		downloadLinks.Release(link.ID)
+		c.String(http.StatusNotFound, tr(c, "Сервер не найден"))
+		return
+	}
+
+	config, err := generateWireGuardConfig(server, client, locale(c))
+	if err != nil {
+		downloadLinks.Release(link.ID)
+		c.String(http.StatusInternalServerError, tr(c, "Не удалось сформировать конфигурацию"))
+		return
+	}
+
+	var png []byte
+	if link.Kind == links.KindQR {
+		png, err = qrcode.Encode(config, qrcode.Medium, 256)
+		if err != nil {
+			downloadLinks.Release(link.ID)
+			c.String(http.StatusInternalServerError, tr(c, "Не удалось сформировать QR-код"))
+			return
+		}
+	}
+
+	markConfigDelivered(c, audit.ActionLinkDownload, client, nil)
+
+	if link.Kind == links.KindQR {
+		c.Data(http.StatusOK, "image/png", png)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.conf", client.Name))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(config))
+}
+
+// revokeDeletedClientLinks отзывает ссылки удаленного клиента
+func revokeDeletedClientLinks(clientID string) {
+	if downloadLinks != nil {
+		downloadLinks.RevokeClient(clientID)
+	}
+}
+
+func downloadLinksAvailable(c *gin.Context) bool {
+	if downloadLinks == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   tr(c, "Одноразовые ссылки недоступны"),
+		})
+		return false
+	}
+	return true
+}
+
+// linkURL строит абсолютный адрес ссылки по адресу текущего запроса
+func linkURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if isHTTPS(c) {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + LinkPathPrefix + token
+}
+
+func linkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, links.ErrExpired), errors.Is(err, links.ErrUsed), errors.Is(err, links.ErrRevoked):
+		return http.StatusGone
+	default:
+		return http.StatusNotFound
+	}
+}
+
+func linkErrorText(err error) string {
+	switch {
+	case errors.Is(err, links.ErrExpired):
+		return "Срок действия ссылки истек"
+	case errors.Is(err, links.ErrUsed):
+		return "Ссылка уже использована"
+	case errors.Is(err, links.ErrRevoked):
+		return "Ссылка отозвана"
+	default:
+		return "Ссылка недействительна"
+	}
+}
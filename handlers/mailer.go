@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"sync"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/i18n"
+	"wireguard-web-manager/mailer"
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+var configMailer mailer.Sender
+
+func RegisterMailer(m mailer.Sender) {
+	configMailer = m
+}
+
+// SendClientConfig отправка конфигурации клиента на email. Адрес из тела
+// запроса имеет приоритет над адресом клиента.
+func SendClientConfig(c *gin.Context) {
+	if configMailer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   tr(c, "Отправка почты не настроена"),
+		})
+		return
+	}
+
+	// locale задает язык письма и конфигурации, по умолчанию — язык из настроек почты
+	var req struct {
+		Email  string `json:"email"`
+		Locale string `json:"locale"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверные данные: %v", err),
+			})
+			return
+		}
+	}
+
+	id := c.Param("id")
+	client, exists := models.GlobalStorage.GetClient(id)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+
+	to := req.Email
+	if to == "" {
+		to = client.Email
+	}
+	if to == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "У клиента не указан email"),
+		})
+		return
+	}
+	if _, err := mail.ParseAddress(to); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверный email: %v", err),
+		})
+		return
+	}
+	mailLocale := configMailer.Locale()
+	if req.Locale != "" {
+		var ok bool
+		if mailLocale, ok = i18n.Parse(req.Locale); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неподдерживаемый язык: %s", req.Locale),
+			})
+			return
+		}
+	}
+
+	if err := sendConfigMail(client, to, mailLocale); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   tr(c, "Не удалось отправить письмо: %v", err),
+		})
+		return
+	}
+	markConfigDelivered(c, audit.ActionConfigEmail, client, gin.H{"recipient": to})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, "Конфигурация отправлена на %s", to),
+	})
+}
+
+// pendingMail письма, которые отправляются в фоне
+var pendingMail sync.WaitGroup
+
+// WaitMail дожидается отправки фоновых писем или отмены ctx
+func WaitMail(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		pendingMail.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendConfigOnCreate отправляет конфигурацию только что созданному клиенту,
+// если это включено в настройках почты. Письмо уходит в фоне: ошибка SMTP
+// не должна отменять создание клиента. Отправленное письмо записывается в
+// журнал аудита от имени автора запроса.
+func sendConfigOnCreate(c *gin.Context, client *models.Client) {
+	if configMailer == nil || !configMailer.SendOnCreate() || client.Email == "" {
+		return
+	}
+	snapshot := *client
+	request := c.Copy()
+	pendingMail.Add(1)
+	go func() {
+		defer pendingMail.Done()
+		if err := sendConfigMail(&snapshot, snapshot.Email, configMailer.Locale()); err != nil {
+			log.Printf("не удалось отправить конфигурацию клиента %s: %v", snapshot.Name, err)
+			return
+		}
+		recordAudit(request, audit.ActionConfigEmail, "client", snapshot.ID, snapshot.Name, nil, gin.H{"recipient": snapshot.Email})
+	}()
+}
+
+func sendConfigMail(client *models.Client, to string, loc i18n.Locale) error {
+	server, exists := models.GlobalStorage.GetServer(client.ServerID)
+	if !exists {
+		return fmt.Errorf("сервер %s не найден", client.ServerID)
+	}
+
+	config, err := generateWireGuardConfig(server, client, loc)
+	if err != nil {
+		return err
+	}
+
+	// QR-код с заглушкой вместо ключа бесполезен
+	var png []byte
+	if !client.ClientKey {
+		png, err = qrcode.Encode(config, qrcode.Medium, 256)
+		if err != nil {
+			return fmt.Errorf("сформировать QR-код: %w", err)
+		}
+	}
+
+	return configMailer.SendConfig(mailer.ConfigMessage{
+		To:         to,
+		ClientName: client.Name,
+		ServerName: server.Name,
+		Address:    client.AllowedIPs,
+		Endpoint:   server.Endpoint,
+		FileName:   client.Name + ".conf",
+		Config:     config,
+		QRCode:     png,
+		ClientKey:  client.ClientKey,
+		Locale:     loc,
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/i18n"
+	"wireguard-web-manager/mailer"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+
+	"github.com/gin-gonic/gin"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// fakeMailer запоминает письма вместо отправки
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mailer.ConfigMessage
+}
+
+func (m *fakeMailer) Locale() i18n.Locale { return i18n.RU }
+
+func (m *fakeMailer) SendOnCreate() bool { return false }
+
+func (m *fakeMailer) SendConfig(msg mailer.ConfigMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) messages() []mailer.ConfigMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.ConfigMessage(nil), m.sent...)
+}
+
+// setupMailTest готовит хранилище с сервером и клиентом, журнал аудита и
+// отправку почты, которая только запоминает письма
+func setupMailTest(t *testing.T) (*models.Client, *fakeMailer) {
+	t.Helper()
+	if err := models.InitStorage(nil); err != nil {
+		t.Fatal(err)
+	}
+	RegisterService(service.New(models.GlobalStorage, nil))
+
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterAuditLog(log)
+
+	m := &fakeMailer{}
+	RegisterMailer(m)
+
+	t.Cleanup(func() {
+		RegisterMailer(nil)
+		RegisterAuditLog(nil)
+		log.Close()
+	})
+
+	serverKey, _ := wgtypes.GeneratePrivateKey()
+	clientKey, _ := wgtypes.GeneratePrivateKey()
+	models.GlobalStorage.AddServer(&models.Server{
+		ID:         "wg0",
+		Name:       "office",
+		PrivateKey: serverKey.String(),
+		PublicKey:  serverKey.PublicKey().String(),
+		Network:    "10.0.0.0/24",
+		Endpoint:   "vpn.example.com:51820",
+	})
+	client := &models.Client{
+		ID:         "client-1",
+		ServerID:   "wg0",
+		Name:       "laptop",
+		Email:      "owner@example.com",
+		PrivateKey: clientKey.String(),
+		PublicKey:  clientKey.PublicKey().String(),
+		AllowedIPs: "10.0.0.2/32",
+	}
+	models.GlobalStorage.AddClient(client)
+	return client, m
+}
+
+// recipientOf возвращает адрес получателя из записи журнала
+func recipientOf(entry audit.Entry) interface{} {
+	for _, change := range entry.Changes {
+		if change.Field == "recipient" {
+			return change.After
+		}
+	}
+	return nil
+}
+
+func TestSendClientConfigAuditsRecipient(t *testing.T) {
+	client, m := setupMailTest(t)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/clients/:id/send-config", SendClientConfig)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/clients/"+client.ID+"/send-config", strings.NewReader(`{"email":"bob@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	sent := m.messages()
+	if len(sent) != 1 || sent[0].To != "bob@example.com" || sent[0].FileName != "laptop.conf" || !strings.Contains(sent[0].Config, client.PrivateKey) {
+		t.Fatalf("sent messages: %+v", sent)
+	}
+
+	entries := auditLog.Query(audit.Filter{Action: audit.ActionConfigEmail})
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	if got := recipientOf(entries[0]); got != "bob@example.com" {
+		t.Errorf("recipient %v, want bob@example.com", got)
+	}
+
+	stored, err := svc.Client(client.ID)
+	if err != nil || !stored.Downloaded {
+		t.Errorf("client not marked delivered: %+v, %v", stored, err)
+	}
+}
+
+func TestMarkConfigDeliveredAuditsWhenMarkFails(t *testing.T) {
+	setupMailTest(t)
+
+	// Клиент удален после отправки письма: отметить доставку нельзя, но
+	// выдача конфигурации все равно попадает в журнал
+	removed := &models.Client{ID: "removed", ServerID: "wg0", Name: "gone"}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	markConfigDelivered(c, audit.ActionConfigEmail, removed, gin.H{"recipient": "gone@example.com"})
+
+	entries := auditLog.Query(audit.Filter{Action: audit.ActionConfigEmail, TargetID: "removed"})
+	if len(entries) != 1 {
+		t.Fatalf("got %d audit entries, want 1", len(entries))
+	}
+	if got := recipientOf(entries[0]); got != "gone@example.com" {
+		t.Errorf("recipient %v, want gone@example.com", got)
+	}
+}
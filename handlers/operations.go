@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/i18n"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+	"wireguard-web-manager/webhooks"
+	"wireguard-web-manager/wireguard"
+
+	"github.com/gin-gonic/gin"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Операции над серверами и клиентами, общие для /api и /api/v1. Операция
+// проверяет запрос, выполняет изменение через сервис и пишет журнал аудита и
+// уведомления; ответ в формате своей версии API формирует обработчик.
+
+// requestError ошибка обработки запроса с HTTP-статусом ответа и кодом
+// ошибки API v1. Сообщение переводится на язык запроса при ответе.
+type requestError struct {
+	status  int
+	code    string
+	message string        // исходное сообщение или строка формата
+	args    []interface{} // аргументы строки формата
+	version int64         // текущая версия записи при конфликте версий
+}
+
+func (e *requestError) Error() string {
+	return i18n.Default.Tf(e.message, e.args...)
+}
+
+// text сообщение на языке запроса
+func (e *requestError) text(c *gin.Context) string {
+	return tr(c, e.message, e.args...)
+}
+
+// errorCode код ошибки; без явного кода выводится из статуса
+func (e *requestError) errorCode() string {
+	if e.code != "" {
+		return e.code
+	}
+	switch e.status {
+	case http.StatusBadRequest:
+		return apiv1.CodeInvalidRequest
+	case http.StatusNotFound:
+		return apiv1.CodeNotFound
+	case http.StatusConflict:
+		return apiv1.CodeConflict
+	case http.StatusPreconditionFailed:
+		return apiv1.CodeVersionConflict
+	}
+	return apiv1.CodeInternal
+}
+
+func badRequest(message string, args ...interface{}) *requestError {
+	return &requestError{status: http.StatusBadRequest, code: apiv1.CodeInvalidRequest, message: message, args: args}
+}
+
+func notFound(message string, args ...interface{}) *requestError {
+	return &requestError{status: http.StatusNotFound, code: apiv1.CodeNotFound, message: message, args: args}
+}
+
+// conflictError ответ на изменение записи другим запросом
+func conflictError(version int64) *requestError {
+	return &requestError{
+		status:  http.StatusPreconditionFailed,
+		code:    apiv1.CodeVersionConflict,
+		message: "Запись изменена другим пользователем, загрузите ее заново",
+		version: version,
+	}
+}
+
+// fromServiceError ошибка операции сервиса. failure описывает неудачу
+// изменения интерфейса, остальные ошибки имеют свои статусы.
+func fromServiceError(err error, failure string) *requestError {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return notFound("Запись не найдена")
+	case errors.Is(err, service.ErrConflict):
+		return conflictError(0)
+	case errors.Is(err, service.ErrServerNotFound):
+		return &requestError{status: http.StatusNotFound, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+	case errors.Is(err, service.ErrServerExists):
+		return &requestError{status: http.StatusConflict, code: apiv1.CodeServerExists, message: "Сервер уже существует"}
+	case errors.Is(err, service.ErrAddressTaken):
+		return &requestError{status: http.StatusConflict, code: apiv1.CodeAddressTaken, message: "Адрес уже занят другим клиентом"}
+	case errors.Is(err, service.ErrKeyTaken):
+		return &requestError{status: http.StatusConflict, code: apiv1.CodeKeyTaken, message: "Клиент с таким открытым ключом уже существует"}
+	case errors.Is(err, service.ErrNotSaved):
+		return &requestError{status: http.StatusInternalServerError, code: apiv1.CodeInternal, message: "Не удалось сохранить состояние, изменение отменено: %v", args: []interface{}{err}}
+	}
+	return &requestError{status: http.StatusInternalServerError, code: apiv1.CodeWireGuard, message: "%s: %v", args: []interface{}{i18n.Text(failure), err}}
+}
+
+// writeError ответ с ошибкой в формате /api
+func writeError(c *gin.Context, reqErr *requestError) {
+	body := gin.H{
+		"success": false,
+		"error":   reqErr.text(c),
+	}
+	if reqErr.version > 0 {
+		setETag(c, reqErr.version)
+		body["version"] = reqErr.version
+	}
+	c.JSON(reqErr.status, body)
+}
+
+// serviceError ответ на ошибку операции сервиса в формате /api
+func serviceError(c *gin.Context, err error, failure string) {
+	writeError(c, fromServiceError(err, failure))
+}
+
+// createServer создает сервер и поднимает его интерфейс. Без приватного
+// ключа ключ генерируется, незаданные порт, сеть, DNS и AllowedIPs берутся
+// из настроек.
+func createServer(c *gin.Context, server models.Server) (models.Server, *requestError) {
+	if server.Name == "" {
+		return models.Server{}, badRequest("Имя интерфейса обязательно")
+	}
+	defaults := currentServerDefaults()
+	if server.ListenPort == 0 {
+		server.ListenPort = defaults.ListenPort
+	}
+	if server.Network == "" {
+		server.Network = defaults.Network
+	}
+	if server.DNS == "" {
+		server.DNS = defaults.DNS
+	}
+	if server.AllowedIPs == "" {
+		server.AllowedIPs = defaults.AllowedIPs
+	}
+
+	server.ID = server.Name
+	server.CreatedAt = time.Now()
+	server.UpdatedAt = server.CreatedAt
+	server.IsActive = true
+	server.KeyRotatedAt = nil
+
+	if server.PrivateKey == "" {
+		key, err := wireguard.GeneratePrivateKey()
+		if err != nil {
+			return models.Server{}, &requestError{status: http.StatusInternalServerError, message: "Не удалось сгенерировать ключ: %v", args: []interface{}{err}}
+		}
+		server.PrivateKey = key.String()
+		server.PublicKey = key.PublicKey().String()
+	} else {
+		key, err := wgtypes.ParseKey(server.PrivateKey)
+		if err != nil {
+			return models.Server{}, badRequest("Неверный приватный ключ: %v", err)
+		}
+		server.PrivateKey = key.String()
+		server.PublicKey = key.PublicKey().String()
+	}
+
+	created, err := svc.CreateServer(server)
+	if err != nil {
+		return models.Server{}, fromServiceError(err, "Не удалось настроить интерфейс WireGuard")
+	}
+	recordAudit(c, audit.ActionServerCreate, "server", created.ID, created.Name, nil, &created)
+	return created, nil
+}
+
+// updateServer заменяет настройки сервера id. Пустое имя и пустой
+// приватный ключ оставляют текущие значения.
+func updateServer(c *gin.Context, id string, server models.Server) (models.Server, *requestError) {
+	existing, err := svc.Server(id)
+	if err != nil {
+		return models.Server{}, notFound("Сервер не найден")
+	}
+	if reqErr := ifMatch(c, existing.Version); reqErr != nil {
+		return models.Server{}, reqErr
+	}
+
+	if server.Name == "" {
+		server.Name = existing.Name
+	}
+	if server.Name != existing.Name {
+		return models.Server{}, badRequest("Переименование интерфейса не поддерживается")
+	}
+
+	server.ID = existing.ID
+	server.CreatedAt = existing.CreatedAt
+	server.IsActive = existing.IsActive
+	server.KeyRotatedAt = existing.KeyRotatedAt
+
+	if server.PrivateKey == "" {
+		server.PrivateKey = existing.PrivateKey
+	}
+
+	key, err := wgtypes.ParseKey(server.PrivateKey)
+	if err != nil {
+		return models.Server{}, badRequest("Неверный приватный ключ: %v", err)
+	}
+	server.PrivateKey = key.String()
+	server.PublicKey = key.PublicKey().String()
+
+	// Новый ключ сервера делает недействительными конфигурации всех клиентов
+	updated, err := svc.UpdateServer(server, existing.Version)
+	if err != nil {
+		return models.Server{}, fromServiceError(err, "Не удалось обновить конфигурацию WireGuard")
+	}
+	recordAudit(c, audit.ActionServerUpdate, "server", updated.ID, updated.Name, &existing, &updated)
+	return updated, nil
+}
+
+// deleteServer удаляет сервер вместе с его клиентами
+func deleteServer(c *gin.Context, id string) *requestError {
+	server, err := svc.Server(id)
+	if err != nil {
+		return notFound("Сервер не найден")
+	}
+	if reqErr := ifMatch(c, server.Version); reqErr != nil {
+		return reqErr
+	}
+	deleted, clients, err := svc.DeleteServer(id, server.Version)
+	if err != nil {
+		return fromServiceError(err, "Не удалось очистить конфигурацию WireGuard")
+	}
+
+	for i := range clients {
+		client := &clients[i]
+		revokeDeletedClientLinks(client.ID)
+		recordAudit(c, audit.ActionClientDelete, "client", client.ID, client.Name, client, nil)
+		publishClientEvent(webhooks.EventClientDeleted, client)
+	}
+	recordAudit(c, audit.ActionServerDelete, "server", deleted.ID, deleted.Name, &deleted, nil)
+	return nil
+}
+
+// parseClientQuery разбирает фильтры, сортировку и курсор списка клиентов
+func parseClientQuery(c *gin.Context) (models.ClientQuery, *requestError) {
+	query := models.ClientQuery{
+		Filter: models.ClientFilter{
+			ServerID: c.Query("server_id"),
+			Search:   c.Query("search"),
+			Tag:      c.Query("tag"),
+		},
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if !models.ValidStatus(status) {
+				return query, badRequest("Неизвестное состояние клиента: %s", status)
+			}
+			query.Filter.Statuses = append(query.Filter.Statuses, status)
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, badRequest("Неверный размер страницы")
+		}
+		query.Limit = limit
+	}
+	if !models.ValidSort(query.Sort) {
+		return query, badRequest("Неизвестное поле сортировки: %s", query.Sort)
+	}
+	return query, nil
+}
+
+// queryClients страница списка клиентов по параметрам запроса
+func queryClients(c *gin.Context) (models.ClientPage, *requestError) {
+	query, reqErr := parseClientQuery(c)
+	if reqErr != nil {
+		return models.ClientPage{}, reqErr
+	}
+	page, err := models.GlobalStorage.QueryClients(query)
+	if err != nil {
+		return models.ClientPage{}, badRequest("Неверный курсор: начните список заново")
+	}
+	return page, nil
+}
+
+// createClient создает клиента и добавляет его пир на интерфейс. Клиент вне
+// окна доступа будет добавлен на интерфейс планировщиком, а клиент с истекшим
+// сроком не добавляется вовсе.
+func createClient(c *gin.Context, client models.Client) (models.Client, *requestError) {
+	if wgService == nil {
+		return models.Client{}, &requestError{status: http.StatusInternalServerError, code: apiv1.CodeWireGuard, message: "Сервис WireGuard недоступен"}
+	}
+
+	server, ok := models.GlobalStorage.GetServer(client.ServerID)
+	if !ok {
+		return models.Client{}, &requestError{status: http.StatusBadRequest, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+	}
+
+	if reqErr := prepareClient(&client, server, usedAddresses(server.ID), time.Now()); reqErr != nil {
+		return models.Client{}, reqErr
+	}
+
+	created, err := svc.CreateClient(client)
+	if err != nil {
+		return models.Client{}, fromServiceError(err, "Не удалось добавить клиента в WireGuard")
+	}
+	recordAudit(c, audit.ActionClientCreate, "client", created.ID, created.Name, nil, &created)
+	publishClientEvent(webhooks.EventClientCreated, &created)
+	sendConfigOnCreate(c, &created)
+	return created, nil
+}
+
+// patchClient частично изменяет клиента id без смены ключей
+func patchClient(c *gin.Context, id string, patch apiv1.PatchClientRequest) (models.Client, *requestError) {
+	client, err := svc.Client(id)
+	if err != nil {
+		return models.Client{}, notFound("Клиент не найден")
+	}
+	if reqErr := ifMatch(c, client.Version); reqErr != nil {
+		return models.Client{}, reqErr
+	}
+
+	next := client
+	if reqErr := applyClientPatch(&next, patch, time.Now()); reqErr != nil {
+		return models.Client{}, reqErr
+	}
+	if next.AllowedIPs != client.AllowedIPs || clientRoutes(&next) != clientRoutes(&client) {
+		next.ConfigOutdated = true
+		next.Downloaded = false
+	}
+
+	updated, err := svc.UpdateClient(next, client.Version)
+	if err != nil {
+		return models.Client{}, fromServiceError(err, "Не удалось применить изменения WireGuard")
+	}
+	recordAudit(c, audit.ActionClientUpdate, "client", updated.ID, updated.Name, &client, &updated)
+	publishClientEvent(webhooks.EventClientUpdated, &updated)
+	return updated, nil
+}
+
+// setClientDisabled отключает или включает клиента id. Включенный клиент с
+// исчерпанной квотой или вне окна доступа вернется на интерфейс при сбросе
+// периода или в начале окна.
+func setClientDisabled(c *gin.Context, id string, disabled bool) (models.Client, *requestError) {
+	client, err := svc.Client(id)
+	if err != nil {
+		return models.Client{}, notFound("Клиент не найден")
+	}
+	if reqErr := ifMatch(c, client.Version); reqErr != nil {
+		return models.Client{}, reqErr
+	}
+
+	action, event, failure := audit.ActionClientDisable, webhooks.EventClientDisabled, "Не удалось отключить клиента в WireGuard"
+	if !disabled {
+		action, event, failure = audit.ActionClientEnable, webhooks.EventClientEnabled, "Не удалось включить клиента в WireGuard"
+		if _, err := svc.Server(client.ServerID); err != nil {
+			return models.Client{}, &requestError{status: http.StatusNotFound, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+		}
+	}
+
+	next := client
+	next.IsDisabled = disabled
+	updated, err := svc.UpdateClient(next, client.Version)
+	if err != nil {
+		return models.Client{}, fromServiceError(err, failure)
+	}
+	recordAudit(c, action, "client", updated.ID, updated.Name, &client, &updated)
+	publishClientEvent(event, &updated)
+	return updated, nil
+}
+
+// deleteClient снимает пир клиента id с интерфейса и удаляет клиента
+func deleteClient(c *gin.Context, id string) *requestError {
+	client, err := svc.Client(id)
+	if err != nil {
+		return notFound("Клиент не найден")
+	}
+	if reqErr := ifMatch(c, client.Version); reqErr != nil {
+		return reqErr
+	}
+	deleted, err := svc.DeleteClient(client.ID, client.Version)
+	if err != nil {
+		return fromServiceError(err, "Не удалось удалить клиента из WireGuard")
+	}
+	revokeDeletedClientLinks(deleted.ID)
+	recordAudit(c, audit.ActionClientDelete, "client", deleted.ID, deleted.Name, &deleted, nil)
+	publishClientEvent(webhooks.EventClientDeleted, &deleted)
+	return nil
+}
+
+// clientConfig конфигурация клиента id. Скачивание отмечается в статистике
+// клиента и журнале аудита.
+func clientConfig(c *gin.Context, id string) (*models.Client, string, *requestError) {
+	client, exists := models.GlobalStorage.GetClient(id)
+	if !exists {
+		return nil, "", notFound("Клиент не найден")
+	}
+
+	server, exists := models.GlobalStorage.GetServer(client.ServerID)
+	if !exists {
+		return nil, "", &requestError{status: http.StatusNotFound, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+	}
+
+	config, err := generateWireGuardConfig(server, client, locale(c))
+	if err != nil {
+		return nil, "", &requestError{status: http.StatusInternalServerError, message: "Не удалось сформировать конфигурацию: %v", args: []interface{}{err}}
+	}
+
+	markConfigDelivered(c, audit.ActionConfigDownload, client, nil)
+	return client, config, nil
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/wireguard"
+
+	"github.com/gin-gonic/gin"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// defaultRotationGrace время, в течение которого после смены ключей клиента
+// продолжает работать старая конфигурация
+const defaultRotationGrace = 24 * time.Hour
+
+// RotateClientKey смена ключей клиента. Старый пир остается на интерфейсе до
+// первого подключения с новой конфигурацией или до конца отведенного срока.
+func RotateClientKey(c *gin.Context) {
+	var req struct {
+		GraceMinutes *int   `json:"grace_minutes"`
+		PublicKey    string `json:"public_key"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверные данные: %v", err),
+			})
+			return
+		}
+	}
+
+	grace := defaultRotationGrace
+	if req.GraceMinutes != nil {
+		if *req.GraceMinutes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверный срок действия старого ключа"),
+			})
+			return
+		}
+		grace = time.Duration(*req.GraceMinutes) * time.Minute
+	}
+
+	client, err := svc.Client(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+	if !checkIfMatch(c, client.Version) {
+		return
+	}
+	if client.RotationPending() {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   tr(c, "Смена ключей клиента уже выполняется"),
+		})
+		return
+	}
+
+	// Клиент, хранящий приватный ключ у себя, присылает новый открытый ключ
+	var privateKey, publicKey string
+	if client.ClientKey || req.PublicKey != "" {
+		if req.PublicKey == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Для клиента со своим ключом нужен новый открытый ключ"),
+			})
+			return
+		}
+		key, err := wireguard.ParsePublicKey(req.PublicKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверный открытый ключ клиента: %v", err),
+			})
+			return
+		}
+		publicKey = key.String()
+	} else {
+		key, err := wireguard.GeneratePrivateKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   tr(c, "Не удалось сгенерировать ключ: %v", err),
+			})
+			return
+		}
+		privateKey, publicKey = key.String(), key.PublicKey().String()
+	}
+
+	if publicKey == client.PublicKey {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Новый ключ совпадает с текущим"),
+		})
+		return
+	}
+
+	// Без срока действия старого ключа адреса сразу переходят на новый пир
+	rotated, err := svc.RotateClientKey(client.ID, client.Version, privateKey, publicKey, time.Now().Add(grace), grace == 0)
+	if err != nil {
+		serviceError(c, err, "Не удалось сменить ключи")
+		return
+	}
+	recordAudit(c, audit.ActionClientRotate, "client", rotated.ID, rotated.Name, &client, &rotated)
+
+	setETag(c, rotated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rotated.Public(),
+	})
+}
+
+// CancelClientKeyRotation отмена незавершенной смены ключей клиента
+func CancelClientKeyRotation(c *gin.Context) {
+	client, err := svc.Client(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Клиент не найден"),
+		})
+		return
+	}
+	if !checkIfMatch(c, client.Version) {
+		return
+	}
+	if !client.RotationPending() {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   tr(c, "Смена ключей клиента не выполняется"),
+		})
+		return
+	}
+
+	cancelled, err := svc.CancelClientKeyRotation(client.ID, client.Version)
+	if err != nil {
+		serviceError(c, err, "Не удалось отменить смену ключей")
+		return
+	}
+	recordAudit(c, audit.ActionRotateCancel, "client", cancelled.ID, cancelled.Name, &client, &cancelled)
+
+	setETag(c, cancelled.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, "Смена ключей отменена"),
+	})
+}
+
+// RotateServerKey смена ключа сервера. Старые конфигурации всех клиентов
+// перестают работать сразу: интерфейс может иметь только один ключ.
+func RotateServerKey(c *gin.Context) {
+	var req struct {
+		PrivateKey string `json:"private_key"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверные данные: %v", err),
+			})
+			return
+		}
+	}
+
+	server, err := svc.Server(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Сервер не найден"),
+		})
+		return
+	}
+	if !checkIfMatch(c, server.Version) {
+		return
+	}
+
+	var key wgtypes.Key
+	if req.PrivateKey == "" {
+		key, err = wireguard.GeneratePrivateKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   tr(c, "Не удалось сгенерировать ключ: %v", err),
+			})
+			return
+		}
+	} else {
+		key, err = wgtypes.ParseKey(req.PrivateKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверный приватный ключ: %v", err),
+			})
+			return
+		}
+	}
+	if key.String() == server.PrivateKey {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Новый ключ совпадает с текущим"),
+		})
+		return
+	}
+
+	// Сервис помечает конфигурации всех клиентов сервера устаревшими
+	next := server
+	next.PrivateKey = key.String()
+	next.PublicKey = key.PublicKey().String()
+	rotated, err := svc.UpdateServer(next, server.Version)
+	if err != nil {
+		serviceError(c, err, "Не удалось обновить ключ WireGuard")
+		return
+	}
+	recordAudit(c, audit.ActionServerRotate, "server", rotated.ID, rotated.Name, &server, &rotated)
+
+	setETag(c, rotated.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    serverRotationProgress(&rotated),
+	})
+}
+
+// GetServerRotation ход перехода клиентов на конфигурации с новым ключом сервера
+func GetServerRotation(c *gin.Context) {
+	server, exists := models.GlobalStorage.GetServer(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Сервер не найден"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    serverRotationProgress(server),
+	})
+}
+
+// rotationClient клиент, еще не получивший актуальную конфигурацию
+type rotationClient struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `json:"email,omitempty"`
+	RotationDeadline *time.Time `json:"rotation_deadline,omitempty"`
+}
+
+func serverRotationProgress(server *models.Server) gin.H {
+	clients := models.GlobalStorage.GetClientsByServerID(server.ID)
+
+	outdated := make([]rotationClient, 0)
+	for _, client := range clients {
+		if client.ConfigOutdated {
+			outdated = append(outdated, rotationClient{
+				ID:               client.ID,
+				Name:             client.Name,
+				Email:            client.Email,
+				RotationDeadline: client.RotationDeadline,
+			})
+		}
+	}
+	sort.Slice(outdated, func(i, j int) bool { return outdated[i].Name < outdated[j].Name })
+
+	return gin.H{
+		"server_id":        server.ID,
+		"key_rotated_at":   server.KeyRotatedAt,
+		"total":            len(clients),
+		"updated":          len(clients) - len(outdated),
+		"outdated":         len(outdated),
+		"outdated_clients": outdated,
+	}
+}
+
+// markConfigDelivered отмечает, что клиент получил актуальную конфигурацию,
+// и записывает выдачу в журнал аудита вместе с details. Конфигурация к
+// этому моменту уже выдана, поэтому выдача записывается, даже если
+// отметить доставку не удалось.
+func markConfigDelivered(c *gin.Context, action string, client *models.Client, details gin.H) {
+	before, delivered, err := svc.MarkConfigDelivered(client.ID)
+	if err != nil {
+		log.Printf("не удалось отметить доставку конфигурации клиента %s: %v", client.Name, err)
+		before, delivered = *client, *client
+	}
+	recordAudit(c, action, "client", delivered.ID, delivered.Name, &before, withDetails(&delivered, details))
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Площадка — шлюз сети филиала. Сервер маршрутизирует ее сети в туннель,
+// а она получает конфигурацию с сетью сервера и локальными сетями за ним.
+// Если на другой стороне тоже работает это приложение, встречная площадка
+// создается там по описанию site-link.
+
+// prepareSite проверяет поля площадки и приводит сети к каноническому виду.
+// Сети площадки не должны пересекаться с сетью сервера и адресами других
+// пиров: иначе маршрут увел бы в туннель чужой трафик.
+func prepareSite(client *models.Client, server *models.Server) *requestError {
+	if !client.IsSite() {
+		if client.Kind != "" {
+			return badRequest("Неизвестный вид пира: %s", client.Kind)
+		}
+		if len(client.Subnets) > 0 || len(client.LocalSubnets) > 0 || client.Endpoint != "" {
+			return badRequest("Сети и адрес шлюза задаются только для площадки")
+		}
+		return nil
+	}
+
+	subnets, err := parseSubnets(client.Subnets)
+	if err != nil {
+		return badRequest("Неверные сети площадки: %v", err)
+	}
+	if len(subnets) == 0 {
+		return badRequest("Укажите сети площадки")
+	}
+	localSubnets, err := parseSubnets(client.LocalSubnets)
+	if err != nil {
+		return badRequest("Неверные локальные сети: %v", err)
+	}
+	endpoint, err := parseEndpoint(client.Endpoint)
+	if err != nil {
+		return badRequest("Неверный адрес шлюза площадки: %v", err)
+	}
+
+	for i, subnet := range subnets {
+		for _, other := range subnets[:i] {
+			if overlaps(subnet, other) {
+				return badRequest("Сети площадки %s и %s пересекаются", other.String(), subnet.String())
+			}
+		}
+		for _, local := range localSubnets {
+			if overlaps(subnet, local) {
+				return badRequest("Сеть площадки %s пересекается с локальной сетью %s", subnet.String(), local.String())
+			}
+		}
+		if _, network, err := net.ParseCIDR(server.Network); err == nil && overlaps(subnet, network) {
+			return badRequest("Сеть площадки %s пересекается с сетью сервера %s", subnet.String(), server.Network)
+		}
+	}
+
+	stored := models.GlobalStorage.GetClientsByServerID(server.ID)
+	others := make([]*models.Client, 0, len(stored))
+	for _, other := range stored {
+		others = append(others, other)
+	}
+	if reqErr := siteOverlap(client.ID, subnets, others); reqErr != nil {
+		return reqErr
+	}
+
+	client.Subnets = subnetStrings(subnets)
+	client.LocalSubnets = subnetStrings(localSubnets)
+	client.Endpoint = endpoint
+	return nil
+}
+
+// checkSiteOverlap проверяет, что сети подготовленной площадки не
+// пересекаются с адресами и сетями пиров others. Нужна при создании
+// нескольких пиров сразу: prepareSite не видит еще не сохраненных.
+func checkSiteOverlap(client *models.Client, others []*models.Client) *requestError {
+	if !client.IsSite() {
+		return nil
+	}
+	subnets, err := parseSubnets(client.Subnets)
+	if err != nil {
+		return badRequest("Неверные сети площадки: %v", err)
+	}
+	return siteOverlap(client.ID, subnets, others)
+}
+
+// siteOverlap ищет пира из others, кроме самого пира id, адреса или сети
+// которого пересекаются с сетями площадки subnets
+func siteOverlap(id string, subnets []*net.IPNet, others []*models.Client) *requestError {
+	for _, other := range others {
+		if other.ID == id {
+			continue
+		}
+		for _, value := range append(other.AllowedIPList(), other.Subnets...) {
+			used, err := parseSubnets([]string{value})
+			if err != nil {
+				continue
+			}
+			for _, subnet := range subnets {
+				if overlaps(subnet, used[0]) {
+					return &requestError{status: http.StatusConflict, code: apiv1.CodeAddressTaken,
+						message: "Сеть площадки %s пересекается с адресами %s", args: []interface{}{subnet.String(), other.Name}}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseSubnets разбирает сети; адрес без маски считается сетью из одного
+// адреса, биты адреса за маской отбрасываются
+func parseSubnets(values []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() == nil {
+				value += "/128"
+			} else {
+				value += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[network.String()] {
+			seen[network.String()] = true
+			result = append(result, network)
+		}
+	}
+	return result, nil
+}
+
+func subnetStrings(networks []*net.IPNet) []string {
+	if len(networks) == 0 {
+		return nil
+	}
+	result := make([]string, len(networks))
+	for i, network := range networks {
+		result[i] = network.String()
+	}
+	return result
+}
+
+// overlaps сообщает, что сети пересекаются: одна из них содержит другую
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// parseEndpoint проверяет адрес вида host:port
+func parseEndpoint(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("address is required")
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		return "", errors.New("host is required")
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return "", errors.New("invalid port")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// siteAllowedIPs сети, которые площадка направляет в туннель: сеть сервера
+// и локальные сети за ним
+func siteAllowedIPs(server *models.Server, client *models.Client) []string {
+	var routes []string
+	if _, network, err := net.ParseCIDR(server.Network); err == nil {
+		routes = append(routes, network.String())
+	}
+	return append(routes, client.LocalSubnets...)
+}
+
+// generateSiteConfig конфигурация шлюза площадки для wg-quick. Шлюз
+// принимает соединения на порту своего адреса, а wg-quick сам добавит
+// маршруты в сети из AllowedIPs.
+func generateSiteConfig(server *models.Server, client *models.Client, privateKey string) string {
+	var config strings.Builder
+	config.WriteString("[Interface]\n")
+	config.WriteString("PrivateKey = " + privateKey + "\n")
+	config.WriteString("Address = " + strings.Join(ensureCIDR(splitAllowedIPs(client.TunnelAddress())), ", ") + "\n")
+	if _, port, err := net.SplitHostPort(client.Endpoint); err == nil {
+		config.WriteString("ListenPort = " + port + "\n")
+	}
+	config.WriteString("\n")
+
+	config.WriteString("[Peer]\n")
+	config.WriteString("PublicKey = " + server.PublicKey + "\n")
+	if server.Endpoint != "" {
+		config.WriteString("Endpoint = " + server.Endpoint + "\n")
+	}
+	config.WriteString("AllowedIPs = " + strings.Join(siteAllowedIPs(server, client), ", ") + "\n")
+	config.WriteString("PersistentKeepalive = 25\n")
+	return config.String()
+}
+
+// siteLink описание встречной площадки для сервера на другой стороне,
+// которым тоже управляет это приложение: там площадкой становится этот
+// сервер, сети меняются местами
+func siteLink(id string) (apiv1.CreateClientRequest, *requestError) {
+	client, exists := models.GlobalStorage.GetClient(id)
+	if !exists {
+		return apiv1.CreateClientRequest{}, notFound("Клиент не найден")
+	}
+	if !client.IsSite() {
+		return apiv1.CreateClientRequest{}, badRequest("Клиент не является площадкой")
+	}
+	server, exists := models.GlobalStorage.GetServer(client.ServerID)
+	if !exists {
+		return apiv1.CreateClientRequest{}, &requestError{status: http.StatusNotFound, code: apiv1.CodeServerNotFound, message: "Сервер не найден"}
+	}
+	if server.Endpoint == "" {
+		return apiv1.CreateClientRequest{}, badRequest("У сервера не задан внешний адрес")
+	}
+	if len(client.LocalSubnets) == 0 {
+		return apiv1.CreateClientRequest{}, badRequest("У площадки не заданы локальные сети")
+	}
+
+	return apiv1.CreateClientRequest{
+		Kind:         models.PeerKindSite,
+		PublicKey:    server.PublicKey,
+		Endpoint:     server.Endpoint,
+		Subnets:      client.LocalSubnets,
+		LocalSubnets: client.Subnets,
+	}, nil
+}
+
+// GetClientSiteLink описание встречной площадки для другого сервера
+func GetClientSiteLink(c *gin.Context) {
+	link, reqErr := siteLink(c.Param("id"))
+	if reqErr != nil {
+		writeError(c, reqErr)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    link,
+	})
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HSTS добавляет заголовок Strict-Transport-Security к ответам по HTTPS:
+// браузер, открывший панель по HTTPS, не перейдет на HTTP до истечения maxAge
+func HSTS(maxAge time.Duration) gin.HandlerFunc {
+	value := fmt.Sprintf("max-age=%d", int64(maxAge/time.Second))
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", value)
+		}
+		c.Next()
+	}
+}
+
+// isHTTPS запрос пришел по HTTPS; cookie таких ответов помечаются Secure
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIDocument документ OpenAPI, строится один раз при регистрации маршрутов
+var openAPIDocument map[string]interface{}
+
+// RegisterV1 регистрирует маршруты API v1 в группе с префиксом apiv1.BasePath.
+// Каждый маршрут должен быть описан в apiv1.Operations, это проверяет CheckV1Routes.
+func RegisterV1(v1 *gin.RouterGroup) {
+	openAPIDocument = apiv1.Document(apiv1.Operations)
+
+	v1.GET("/servers", V1ListServers)
+	v1.POST("/servers", V1CreateServer)
+	v1.GET("/servers/:id", V1GetServer)
+	v1.PUT("/servers/:id", V1UpdateServer)
+	v1.DELETE("/servers/:id", V1DeleteServer)
+
+	v1.GET("/clients", V1ListClients)
+	v1.POST("/clients", V1CreateClient)
+	v1.GET("/clients/:id", V1GetClient)
+	v1.PATCH("/clients/:id", V1PatchClient)
+	v1.DELETE("/clients/:id", V1DeleteClient)
+	v1.POST("/clients/:id/disable", V1DisableClient)
+	v1.POST("/clients/:id/enable", V1EnableClient)
+	v1.GET("/clients/:id/config", V1GetClientConfig)
+	v1.GET("/clients/:id/site-link", V1GetClientSiteLink)
+
+	v1.GET("/stats", V1GetStats)
+	v1.GET("/openapi.json", V1OpenAPI)
+}
+
+// CheckV1Routes сверяет зарегистрированные маршруты API v1 с документом OpenAPI
+func CheckV1Routes(routes gin.RoutesInfo) error {
+	registered := make([]apiv1.Route, 0, len(routes))
+	for _, route := range routes {
+		registered = append(registered, apiv1.Route{Method: route.Method, Path: route.Path})
+	}
+	return apiv1.CheckRoutes(apiv1.Operations, registered)
+}
+
+// writeV1Error ответ с ошибкой в формате API v1
+func writeV1Error(c *gin.Context, reqErr *requestError) {
+	if reqErr.version > 0 {
+		setETag(c, reqErr.version)
+	}
+	c.JSON(reqErr.status, apiv1.ErrorResponse{Error: apiv1.Error{
+		Code:    reqErr.errorCode(),
+		Message: reqErr.text(c),
+	}})
+}
+
+// bindV1 разбирает тело запроса API v1; при ошибке отвечает 400
+func bindV1(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		writeV1Error(c, badRequest("Неверные данные: %v", err))
+		return false
+	}
+	return true
+}
+
+// V1OpenAPI документ OpenAPI 3 для API v1
+func V1OpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPIDocument)
+}
+
+// V1ListServers список серверов
+func V1ListServers(c *gin.Context) {
+	servers := svc.Servers()
+	list := apiv1.ServerList{Items: make([]apiv1.Server, 0, len(servers))}
+	for i := range servers {
+		list.Items = append(list.Items, apiv1.FromServer(&servers[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// V1GetServer получение сервера
+func V1GetServer(c *gin.Context) {
+	server, err := svc.Server(c.Param("id"))
+	if err != nil {
+		writeV1Error(c, notFound("Сервер не найден"))
+		return
+	}
+	if reqErr := ifMatch(c, server.Version); reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	if notModified(c, server.Version) {
+		return
+	}
+	setETag(c, server.Version)
+	c.JSON(http.StatusOK, apiv1.FromServer(&server))
+}
+
+// V1CreateServer создание сервера
+func V1CreateServer(c *gin.Context) {
+	var req apiv1.CreateServerRequest
+	if !bindV1(c, &req) {
+		return
+	}
+	created, reqErr := createServer(c, req.ToServer())
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	setETag(c, created.Version)
+	c.JSON(http.StatusCreated, apiv1.FromServer(&created))
+}
+
+// V1UpdateServer изменение сервера
+func V1UpdateServer(c *gin.Context) {
+	var req apiv1.UpdateServerRequest
+	if !bindV1(c, &req) {
+		return
+	}
+	updated, reqErr := updateServer(c, c.Param("id"), models.Server{
+		ListenPort: req.ListenPort,
+		PrivateKey: req.PrivateKey,
+		Network:    req.Network,
+		DNS:        req.DNS,
+		AllowedIPs: req.AllowedIPs,
+		Endpoint:   req.Endpoint,
+	})
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, apiv1.FromServer(&updated))
+}
+
+// V1DeleteServer удаление сервера вместе с клиентами
+func V1DeleteServer(c *gin.Context) {
+	if reqErr := deleteServer(c, c.Param("id")); reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// V1ListClients список клиентов
+func V1ListClients(c *gin.Context) {
+	page, reqErr := queryClients(c)
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	list := apiv1.ClientList{
+		Items:      make([]apiv1.Client, 0, len(page.Items)),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	}
+	for i := range page.Items {
+		list.Items = append(list.Items, apiv1.FromClient(&page.Items[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// V1GetClient получение клиента
+func V1GetClient(c *gin.Context) {
+	client, err := svc.Client(c.Param("id"))
+	if err != nil {
+		writeV1Error(c, notFound("Клиент не найден"))
+		return
+	}
+	if reqErr := ifMatch(c, client.Version); reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	if notModified(c, client.Version) {
+		return
+	}
+	setETag(c, client.Version)
+	c.JSON(http.StatusOK, apiv1.FromClient(&client))
+}
+
+// V1CreateClient создание клиента
+func V1CreateClient(c *gin.Context) {
+	var req apiv1.CreateClientRequest
+	if !bindV1(c, &req) {
+		return
+	}
+	created, reqErr := createClient(c, req.ToClient())
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	setETag(c, created.Version)
+	c.JSON(http.StatusCreated, apiv1.FromClient(&created))
+}
+
+// V1PatchClient частичное изменение клиента
+func V1PatchClient(c *gin.Context) {
+	var req apiv1.PatchClientRequest
+	if !bindV1(c, &req) {
+		return
+	}
+	updated, reqErr := patchClient(c, c.Param("id"), req)
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, apiv1.FromClient(&updated))
+}
+
+// V1DeleteClient удаление клиента
+func V1DeleteClient(c *gin.Context) {
+	if reqErr := deleteClient(c, c.Param("id")); reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// V1DisableClient отключение клиента
+func V1DisableClient(c *gin.Context) {
+	v1SetClientDisabled(c, true)
+}
+
+// V1EnableClient включение клиента. Состояние в ответе показывает, подключен
+// ли клиент: квота, расписание и срок действия могут удерживать его снятым.
+func V1EnableClient(c *gin.Context) {
+	v1SetClientDisabled(c, false)
+}
+
+func v1SetClientDisabled(c *gin.Context, disabled bool) {
+	updated, reqErr := setClientDisabled(c, c.Param("id"), disabled)
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, apiv1.FromClient(&updated))
+}
+
+// V1GetClientConfig скачивание конфигурации клиента
+func V1GetClientConfig(c *gin.Context) {
+	client, config, reqErr := clientConfig(c, c.Param("id"))
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.conf", client.Name))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(config))
+}
+
+// V1GetClientSiteLink описание встречной площадки для другого сервера
+func V1GetClientSiteLink(c *gin.Context) {
+	link, reqErr := siteLink(c.Param("id"))
+	if reqErr != nil {
+		writeV1Error(c, reqErr)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// V1GetStats сводка по клиентам
+func V1GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, models.GlobalStorage.GetStats())
+}
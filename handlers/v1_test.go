@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"wireguard-web-manager/apiv1"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newV1Engine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	RegisterV1(engine.Group(apiv1.BasePath))
+	return engine
+}
+
+func TestV1RoutesMatchOperations(t *testing.T) {
+	engine := newV1Engine()
+	if err := CheckV1Routes(engine.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestV1OpenAPIDescribesOperations(t *testing.T) {
+	engine := newV1Engine()
+
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, apiv1.BasePath+"/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+
+	for _, op := range apiv1.Operations {
+		path := openAPITestPath(op.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			t.Errorf("%s %s: path %s missing from document", op.Method, op.Path, path)
+			continue
+		}
+		if _, ok := item[strings.ToLower(op.Method)]; !ok {
+			t.Errorf("%s %s: method missing from document", op.Method, op.Path)
+		}
+	}
+}
+
+// openAPITestPath переводит параметры пути gin (:id) в вид OpenAPI ({id})
+func openAPITestPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+var webhookDispatcher *webhooks.Dispatcher
+
+func RegisterWebhooks(dispatcher *webhooks.Dispatcher) {
+	webhookDispatcher = dispatcher
+}
+
+// GetWebhooks список подписок на события
+func GetWebhooks(c *gin.Context) {
+	if !webhooksAvailable(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    webhookDispatcher.Subscriptions(),
+	})
+}
+
+// CreateWebhook создание подписки. Секрет подписи возвращается только в ответе
+// на создание.
+func CreateWebhook(c *gin.Context) {
+	if !webhooksAvailable(c) {
+		return
+	}
+
+	var sub webhooks.Subscription
+	if err := c.ShouldBindJSON(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверные данные: %v", err),
+		})
+		return
+	}
+
+	created, err := webhookDispatcher.AddSubscription(sub)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   tr(c, "Неверная подписка: %v", err),
+		})
+		return
+	}
+	recordAudit(c, audit.ActionWebhookCreate, "webhook", created.ID, created.URL, nil, &created)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    created,
+	})
+}
+
+// DeleteWebhook удаление подписки
+func DeleteWebhook(c *gin.Context) {
+	if !webhooksAvailable(c) {
+		return
+	}
+
+	id := c.Param("id")
+	if !webhookDispatcher.RemoveSubscription(id) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Подписка не найдена"),
+		})
+		return
+	}
+	recordAudit(c, audit.ActionWebhookDelete, "webhook", id, "", nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": tr(c, "Подписка удалена"),
+	})
+}
+
+// GetWebhookDeliveries журнал доставки событий
+func GetWebhookDeliveries(c *gin.Context) {
+	if !webhooksAvailable(c) {
+		return
+	}
+
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   tr(c, "Неверный параметр limit"),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    webhookDispatcher.Deliveries(limit),
+	})
+}
+
+// GetWebhookDeadLetters список недоставленных событий
+func GetWebhookDeadLetters(c *gin.Context) {
+	if !webhooksAvailable(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    webhookDispatcher.DeadLetters(),
+	})
+}
+
+// RetryWebhookDeadLetter повторная отправка недоставленного события
+func RetryWebhookDeadLetter(c *gin.Context) {
+	if !webhooksAvailable(c) {
+		return
+	}
+	if !webhookDispatcher.RetryDeadLetter(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   tr(c, "Событие не найдено или его подписка удалена"),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": tr(c, "Событие поставлено на повторную отправку"),
+	})
+}
+
+// publishClientEvent отправляет подписчикам событие по клиенту
+func publishClientEvent(eventType string, client *models.Client) {
+	if webhookDispatcher == nil {
+		return
+	}
+	webhookDispatcher.Publish(eventType, webhooks.ClientPayload(client))
+}
+
+func webhooksAvailable(c *gin.Context) bool {
+	if webhookDispatcher != nil {
+		return true
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"success": false,
+		"error":   tr(c, "Webhook-уведомления недоступны"),
+	})
+	return false
+}
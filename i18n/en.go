@@ -0,0 +1,277 @@
+package i18n
+
+// en каталог английского языка. Глаголы формата (%s, %d, %v) сохраняются в
+// переводе в том же порядке, что и в исходном сообщении.
+var en = map[string]string{
+	// Общие ошибки API
+	"Неверные данные: %v": "Invalid data: %v",
+	"Запись изменена другим пользователем, загрузите ее заново": "The record was changed by another user, reload it",
+	"Запись не найдена":                      "Record not found",
+	"Сервис WireGuard недоступен":            "WireGuard service is unavailable",
+	"Неверный размер страницы":               "Invalid page size",
+	"Неизвестное поле сортировки: %s":        "Unknown sort field: %s",
+	"Неверный курсор: начните список заново": "Invalid cursor: start the listing over",
+	"Неподдерживаемый язык: %s":              "Unsupported language: %s",
+	"Требуется вход":                         "Sign-in required",
+
+	// Серверы
+	"Сервер не найден":                             "Server not found",
+	"Сервер уже существует":                        "Server already exists",
+	"Сервер удален":                                "Server deleted",
+	"Имя интерфейса обязательно":                   "Interface name is required",
+	"Неверный приватный ключ: %v":                  "Invalid private key: %v",
+	"Не удалось настроить интерфейс WireGuard":     "Failed to configure the WireGuard interface",
+	"Переименование интерфейса не поддерживается":  "Renaming the interface is not supported",
+	"Не удалось обновить конфигурацию WireGuard":   "Failed to update the WireGuard configuration",
+	"Не удалось очистить конфигурацию WireGuard":   "Failed to clear the WireGuard configuration",
+	"Не удалось применить изменения WireGuard":     "Failed to apply WireGuard changes",
+	"Не удалось применить изменения WireGuard: %v": "Failed to apply WireGuard changes: %v",
+	"Панель управления WireGuard":                  "WireGuard dashboard",
+
+	// Клиенты
+	"Клиент не найден": "Client not found",
+	"Клиент удален":    "Client deleted",
+	"Клиент отключен":  "Client disabled",
+	"Клиент включен":   "Client enabled",
+	"Клиент включен, но будет подключен только после сброса квоты трафика": "Client enabled, but it will be connected only after the traffic quota resets",
+	"Клиент включен, но будет подключен только в окне доступа":             "Client enabled, but it will be connected only within its access window",
+	"Клиент включен, но срок его доступа истек":                            "Client enabled, but its access has expired",
+	"Имя клиента не может быть пустым":                                     "Client name cannot be empty",
+	"Неверный email: %v":                                     "Invalid email: %v",
+	"Неверные теги: %v":                                      "Invalid tags: %v",
+	"Адреса клиента не могут быть пустыми":                   "Client addresses cannot be empty",
+	"Адрес %s уже занят другим клиентом":                     "Address %s is already used by another client",
+	"Адрес клиента должен лежать в сети сервера: %v":         "Client address must be inside the server network: %v",
+	"Адрес уже занят другим клиентом":                        "The address is already used by another client",
+	"Неверные параметры квоты трафика":                       "Invalid traffic quota settings",
+	"Ограничение скорости недоступно для адреса клиента: %v": "Rate limiting is unavailable for the client address: %v",
+	"Неверное расписание доступа: %v":                        "Invalid access schedule: %v",
+	"Неверный открытый ключ клиента: %v":                     "Invalid client public key: %v",
+	"Не удалось сгенерировать ключ: %v":                      "Failed to generate a key: %v",
+	"Неверный приватный ключ клиента: %v":                    "Invalid client private key: %v",
+	"Открытый ключ не соответствует приватному":              "The public key does not match the private key",
+	"Клиент с таким открытым ключом уже существует":          "A client with this public key already exists",
+	"Не удалось сохранить состояние, изменение отменено: %v": "Failed to save state, the change was rolled back: %v",
+	"Не удалось выделить IP для клиента: %v":                 "Failed to allocate an IP for the client: %v",
+	"Не удалось применить расписание":                        "Failed to apply the schedule",
+	"Не удалось добавить клиента в WireGuard":                "Failed to add the client to WireGuard",
+	"Не удалось отключить клиента в WireGuard":               "Failed to disable the client in WireGuard",
+	"Не удалось включить клиента в WireGuard":                "Failed to enable the client in WireGuard",
+	"Не удалось удалить клиента из WireGuard":                "Failed to remove the client from WireGuard",
+	"Не удалось изменить клиента":                            "Failed to update the client",
+	"Не удалось сформировать конфигурацию":                   "Failed to build the configuration",
+	"Не удалось сформировать конфигурацию: %v":               "Failed to build the configuration: %v",
+	"<ВСТАВЬТЕ_ПРИВАТНЫЙ_КЛЮЧ>":                              "<INSERT_PRIVATE_KEY>",
+
+	// Массовые операции
+	"Неверный CSV: %v": "Invalid CSV: %v",
+	"Количество клиентов должно быть от 1 до %d":           "The number of clients must be between 1 and %d",
+	"Открытый ключ совпадает с клиентом №%d":               "The public key matches client #%d",
+	"Клиенты не созданы: есть ошибки в данных":             "No clients created: the data contains errors",
+	"Не удалось добавить клиентов в WireGuard: %v":         "Failed to add the clients to WireGuard: %v",
+	"Неизвестное действие":                                 "Unknown action",
+	"Действие не выполнено: не все клиенты найдены":        "Action not performed: not all clients were found",
+	"Действие не выполнено: есть ошибки в данных клиентов": "Action not performed: the client data contains errors",
+	"Укажите либо ids, либо filter":                        "Specify either ids or filter",
+	"Укажите ids или filter":                               "Specify ids or filter",
+	"Не более %d клиентов за раз":                          "No more than %d clients at a time",
+	"Пустой фильтр: укажите хотя бы одно условие":          "Empty filter: specify at least one condition",
+	"Фильтру соответствует больше %d клиентов":             "More than %d clients match the filter",
+
+	// Выгрузка
+	"Неизвестный формат выгрузки: %s":               "Unknown export format: %s",
+	"Неизвестная колонка: %s":                       "Unknown column: %s",
+	"Для выгрузки ключей укажите include_keys=true": "Set include_keys=true to export keys",
+	"Не выбрано ни одной колонки":                   "No columns selected",
+	"Неизвестное состояние клиента: %s":             "Unknown client state: %s",
+
+	// Группы
+	"Неверные параметры группы: %v":             "Invalid group settings: %v",
+	"Группа уже существует":                     "Group already exists",
+	"Группа не найдена":                         "Group not found",
+	"Конфигураций устарело: %d":                 "Outdated configurations: %d",
+	"Группа удалена, конфигураций устарело: %d": "Group deleted, outdated configurations: %d",
+	"В группе нет клиентов":                     "The group has no clients",
+	"В группе больше %d клиентов":               "The group has more than %d clients",
+
+	// Смена ключей
+	"Неверный срок действия старого ключа":                  "Invalid lifetime for the old key",
+	"Смена ключей клиента уже выполняется":                  "Key rotation for the client is already in progress",
+	"Для клиента со своим ключом нужен новый открытый ключ": "A client with its own key requires a new public key",
+	"Новый ключ совпадает с текущим":                        "The new key matches the current one",
+	"Не удалось сменить ключи":                              "Failed to rotate the keys",
+	"Смена ключей клиента не выполняется":                   "No key rotation is in progress for the client",
+	"Не удалось отменить смену ключей":                      "Failed to cancel the key rotation",
+	"Смена ключей отменена":                                 "Key rotation cancelled",
+	"Не удалось обновить ключ WireGuard":                    "Failed to update the WireGuard key",
+
+	// Площадки
+	"Неизвестный вид пира: %s":                           "Unknown peer kind: %s",
+	"Сети и адрес шлюза задаются только для площадки":    "Subnets and the gateway address apply only to sites",
+	"Неверные сети площадки: %v":                         "Invalid site subnets: %v",
+	"Укажите сети площадки":                              "Specify the site subnets",
+	"Неверные локальные сети: %v":                        "Invalid local subnets: %v",
+	"Неверный адрес шлюза площадки: %v":                  "Invalid site gateway address: %v",
+	"Сети площадки %s и %s пересекаются":                 "Site subnets %s and %s overlap",
+	"Сеть площадки %s пересекается с локальной сетью %s": "Site subnet %s overlaps local subnet %s",
+	"Сеть площадки %s пересекается с сетью сервера %s":   "Site subnet %s overlaps the server network %s",
+	"Сеть площадки %s пересекается с адресами %s":        "Site subnet %s overlaps the addresses of %s",
+	"Клиент не является площадкой":                       "The client is not a site",
+	"У сервера не задан внешний адрес":                   "The server has no external endpoint",
+	"У площадки не заданы локальные сети":                "The site has no local subnets",
+
+	// Одноразовые ссылки
+	"Неверный срок действия ссылки":  "Invalid link lifetime",
+	"Не удалось создать ссылку: %v":  "Failed to create the link: %v",
+	"Ссылка не найдена":              "Link not found",
+	"Ссылка отозвана":                "Link revoked",
+	"Отозвано ссылок: %d":            "Links revoked: %d",
+	"Ссылка недействительна":         "The link is invalid",
+	"Не удалось сформировать QR-код": "Failed to build the QR code",
+	"Одноразовые ссылки недоступны":  "One-time links are unavailable",
+	"Срок действия ссылки истек":     "The link has expired",
+	"Ссылка уже использована":        "The link has already been used",
+
+	// Почта
+	"Отправка почты не настроена":     "Email delivery is not configured",
+	"У клиента не указан email":       "The client has no email",
+	"Не удалось отправить письмо: %v": "Failed to send the email: %v",
+	"Конфигурация отправлена на %s":   "Configuration sent to %s",
+
+	// Резервные копии
+	"Не удалось создать резервную копию: %v":                                                "Failed to create a backup: %v",
+	"Не передан файл резервной копии: %v":                                                   "No backup file provided: %v",
+	"Не удалось прочитать резервную копию: %v":                                              "Failed to read the backup: %v",
+	"Резервная копия зашифрована: укажите пароль":                                           "The backup is encrypted: provide the password",
+	"Неверный пароль или поврежденная резервная копия":                                      "Wrong password or corrupted backup",
+	"Резервная копия содержит ошибки":                                                       "The backup contains errors",
+	"Резервная копия конфликтует с интерфейсами этого хоста; для замены укажите force=true": "The backup conflicts with this host's interfaces; set force=true to replace them",
+	"Восстановление выполнено не полностью: %v":                                             "Restore completed only partially: %v",
+
+	// Журнал аудита и webhook-уведомления
+	"Журнал аудита недоступен":                    "The audit log is unavailable",
+	"Неверный параметр since: %v":                 "Invalid since parameter: %v",
+	"Неверный параметр until: %v":                 "Invalid until parameter: %v",
+	"Неверный параметр limit":                     "Invalid limit parameter",
+	"Неверная подписка: %v":                       "Invalid subscription: %v",
+	"Подписка не найдена":                         "Subscription not found",
+	"Подписка удалена":                            "Subscription deleted",
+	"Событие не найдено или его подписка удалена": "The event was not found or its subscription was deleted",
+	"Событие поставлено на повторную отправку":    "The event has been queued for redelivery",
+	"Webhook-уведомления недоступны":              "Webhook notifications are unavailable",
+
+	// Страницы
+	"Главная":           "Home",
+	"Панель управления": "Dashboard",
+	"Простое веб-приложение для управления серверами и клиентами WireGuard":                                                   "A simple web application for managing WireGuard servers and clients",
+	"Управляйте конфигурациями серверов, добавляйте клиентов, скачивайте конфигурации и отслеживайте статистику подключений.": "Manage server configurations, add clients, download configurations and track connection statistics.",
+	"Перейти в панель управления": "Go to the dashboard",
+	"Управление серверами":        "Server management",
+	"Создавайте и настраивайте серверы WireGuard с простым веб-интерфейсом": "Create and configure WireGuard servers with a simple web interface",
+	"Управление клиентами": "Client management",
+	"Добавляйте клиентов, включайте/отключайте их и скачивайте готовые конфигурации": "Add clients, enable or disable them and download ready-made configurations",
+	"Статистика": "Statistics",
+	"Отслеживайте активные подключения, статистику скачиваний и состояние клиентов": "Track active connections, download statistics and client status",
+	"Возможности системы":              "Features",
+	"Добавление конфигурации сервера":  "Adding a server configuration",
+	"Скачивание конфигураций клиентов": "Downloading client configurations",
+	"Включение/отключение клиентов":    "Enabling and disabling clients",
+	"Статистика по клиентам":           "Client statistics",
+	"Простой веб-интерфейс":            "Simple web interface",
+	"Управление в реальном времени":    "Real-time management",
+
+	// Панель управления
+	"Обновить":              "Refresh",
+	"Всего клиентов":        "Total clients",
+	"Активных":              "Active",
+	"Отключено":             "Disabled",
+	"Скачали конфиг":        "Downloaded config",
+	"Превысили квоту":       "Over quota",
+	"Конфигурация сервера":  "Server configuration",
+	"Создать сервер":        "Create server",
+	"Название сервера":      "Server name",
+	"Порт":                  "Port",
+	"Сеть":                  "Network",
+	"Endpoint (IP:порт)":    "Endpoint (IP:port)",
+	"Сохранить сервер":      "Save server",
+	"Текущая конфигурация:": "Current configuration:",
+	"Порт:":                 "Port:",
+	"Сеть:":                 "Network:",
+	"Добавить клиента":      "Add client",
+	"Имя клиента":           "Client name",
+	"Email (опционально)":   "Email (optional)",
+	"Теги через запятую (опционально — группы задают маршруты, DNS, срок и квоту)": "Comma-separated tags (optional; groups set routes, DNS, expiry and quota)",
+	"Открытый ключ клиента (опционально — приватный ключ не передается на сервер)": "Client public key (optional; the private key is never sent to the server)",
+	"Сгенерировать на сервере":                "Generate on the server",
+	"Квота трафика, ГБ (0 — без ограничений)": "Traffic quota, GB (0 for unlimited)",
+	"Период квоты":                            "Quota period",
+	"Месяц":                                   "Month",
+	"Неделя":                                  "Week",
+	"День":                                    "Day",
+	"Скорость к клиенту, кбит/с (0 — без ограничений)":  "Rate to the client, kbit/s (0 for unlimited)",
+	"Скорость от клиента, кбит/с (0 — без ограничений)": "Rate from the client, kbit/s (0 for unlimited)",
+	"Доступ до (опционально)":                           "Access until (optional)",
+
+	"Сети площадки через запятую (опционально — пир станет шлюзом другой сети)": "Comma-separated site subnets (optional; the peer becomes a gateway to another network)",
+	"Адрес шлюза площадки":                              "Site gateway address",
+	"Локальные сети, доступные площадке, через запятую": "Comma-separated local subnets reachable from the site",
+
+	"Клиенты":              "Clients",
+	"Имя":                  "Name",
+	"IP адрес":             "IP address",
+	"Статус":               "Status",
+	"Трафик":               "Traffic",
+	"Конфиг":               "Config",
+	"Действия":             "Actions",
+	"Загрузка клиентов...": "Loading clients...",
+
+	// Сообщения app.js
+	"Функция доступна только на странице dashboard":  "This function is only available on the dashboard page",
+	"Форма сервера не найдена":                       "Server form not found",
+	"Форма очищена. Готов к созданию нового сервера": "Form cleared. Ready to create a new server",
+	"Не задан":                     "Not set",
+	"Не задана":                    "Not set",
+	"Сервер успешно создан":        "Server created",
+	"Сервер успешно обновлен":      "Server updated",
+	"Ошибка: %s":                   "Error: %s",
+	"Ошибка сохранения сервера":    "Failed to save the server",
+	"Сначала настройте сервер":     "Configure the server first",
+	"Клиент добавлен":              "Client added",
+	"Ошибка добавления клиента":    "Failed to add the client",
+	"Клиенты не найдены":           "No clients found",
+	"Нужна новая конфигурация":     "A new configuration is required",
+	"Сети площадки: %s":            "Site subnets: %s",
+	"Скачать конфиг":               "Download config",
+	"Скачать":                      "Download",
+	"Одноразовая ссылка на конфиг": "One-time config link",
+	"Ссылка":                       "Link",
+	"Отправить конфиг на %s":       "Send config to %s",
+	"На email": "Email",
+	"Сменить ключи клиента": "Rotate client keys",
+	"Ключ":             "Keys",
+	"Включить":         "Enable",
+	"Отключить":        "Disable",
+	"Удалить":          "Delete",
+	"Отключен":         "Disabled",
+	"Срок истек":       "Expired",
+	"Квота исчерпана":  "Quota exhausted",
+	"Вне окна доступа": "Outside access window",
+	"Активен (скачал)": "Active (downloaded)",
+	"Активен":          "Active",
+	"Б":                "B",
+	"КБ":               "KB",
+	"МБ":               "MB",
+	"ГБ":               "GB",
+	"ТБ":               "TB",
+	"Ссылка действует 1 час и открывается один раз:": "The link is valid for 1 hour and opens only once:",
+	"Ошибка создания ссылки":                         "Failed to create the link",
+	"Ошибка отправки конфигурации":                   "Failed to send the configuration",
+	"Сгенерировать клиенту новые ключи? Старая конфигурация перестанет работать после подключения с новой или через 24 часа.": "Generate new keys for the client? The old configuration will stop working once the new one connects or after 24 hours.",
+	"Ключи сменены, передайте клиенту новую конфигурацию":                                                                     "Keys rotated, send the new configuration to the client",
+	"Ошибка смены ключей":                              "Failed to rotate the keys",
+	"Ошибка изменения статуса клиента":                 "Failed to change the client status",
+	"Вы уверены, что хотите удалить этого клиента?":    "Are you sure you want to delete this client?",
+	"Ошибка удаления клиента":                          "Failed to delete the client",
+	"Данные обновлены":                                 "Data refreshed",
+	"Обновление доступно только на странице dashboard": "Refreshing is only available on the dashboard page",
+}
@@ -0,0 +1,117 @@
+package i18n
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// Locale язык интерфейса и сообщений
+type Locale string
+
+const (
+	RU Locale = "ru"
+	EN Locale = "en"
+)
+
+// Default язык исходных сообщений; сообщения без перевода выводятся на нем
+const Default = RU
+
+// Supported поддерживаемые языки в порядке предпочтения
+var Supported = []Locale{RU, EN}
+
+// Каталоги переводов. Ключ — исходное сообщение на русском, как оно записано
+// в коде: так сообщение остается читаемым в месте вызова, а непереведенное
+// выводится по-русски. Каталог русского языка пуст.
+var catalogs = map[Locale]map[string]string{
+	RU: {},
+	EN: en,
+}
+
+// Text сообщение, которое подставляется в другое сообщение и переводится
+// вместе с ним
+type Text string
+
+// Parse разбирает код языка вида en, en-US или EN_us
+func Parse(value string) (Locale, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if idx := strings.IndexAny(value, "-_"); idx > 0 {
+		value = value[:idx]
+	}
+	for _, locale := range Supported {
+		if string(locale) == value {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// Match выбирает язык по заголовку Accept-Language с учетом весов q.
+// Без подходящего языка возвращает Default.
+func Match(acceptLanguage string) Locale {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, q := part, 1.0
+		if idx := strings.Index(part, ";"); idx >= 0 {
+			tag = part[:idx]
+			param := strings.TrimSpace(part[idx+1:])
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					continue
+				}
+				q = value
+			}
+		}
+		locale, ok := Parse(tag)
+		if !ok || q <= bestQ {
+			continue
+		}
+		best, bestQ = locale, q
+	}
+	return best
+}
+
+// T переводит сообщение. Сообщение без перевода возвращается как есть.
+func (l Locale) T(message string) string {
+	if text, ok := catalogs[l][message]; ok {
+		return text
+	}
+	return message
+}
+
+// Tf переводит строку формата и подставляет в нее аргументы. Аргументы типа
+// Text переводятся. Без аргументов строка не форматируется и может содержать %.
+func (l Locale) Tf(format string, args ...interface{}) string {
+	format = l.T(format)
+	if len(args) == 0 {
+		return format
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if text, ok := arg.(Text); ok {
+			arg = l.T(string(text))
+		}
+		values[i] = arg
+	}
+	return fmt.Sprintf(format, values...)
+}
+
+// Messages каталог языка для перевода в браузере
+func (l Locale) Messages() map[string]string {
+	messages := make(map[string]string, len(catalogs[l]))
+	for key, text := range catalogs[l] {
+		messages[key] = text
+	}
+	return messages
+}
+
+// FuncMap функции шаблонов: {{t .locale "Текст"}} переводит текст
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"t": func(l Locale, message string, args ...interface{}) string {
+			return l.Tf(message, args...)
+		},
+	}
+}
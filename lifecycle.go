@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"wireguard-web-manager/config"
+	"wireguard-web-manager/handlers"
+	"wireguard-web-manager/quota"
+	"wireguard-web-manager/scheduler"
+)
+
+// shutdownStep действие при остановке приложения
+type shutdownStep struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// lifecycle запускает HTTP-серверы и ждет сигналов: SIGINT и SIGTERM
+// останавливают приложение, SIGHUP перечитывает настройки
+type lifecycle struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	steps   []shutdownStep
+	errors  chan error
+}
+
+func newLifecycle(timeout time.Duration) *lifecycle {
+	return &lifecycle{timeout: timeout, errors: make(chan error, 1)}
+}
+
+// onShutdown добавляет действие при остановке. Действия выполняются в
+// обратном порядке, как defer: HTTP-серверы, запущенные последними,
+// останавливаются первыми, клиент WireGuard закрывается последним.
+func (l *lifecycle) onShutdown(name string, fn func(ctx context.Context) error) {
+	l.steps = append(l.steps, shutdownStep{name: name, fn: fn})
+}
+
+// setTimeout меняет ожидание текущих запросов при остановке
+func (l *lifecycle) setTimeout(timeout time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeout = timeout
+}
+
+// serve запускает сервер в фоне; при остановке он перестает принимать
+// соединения и дожидается текущих запросов
+func (l *lifecycle) serve(name string, server *http.Server) {
+	l.start(name, server, func() error {
+		if server.TLSConfig != nil {
+			return server.ListenAndServeTLS("", "")
+		}
+		return server.ListenAndServe()
+	})
+}
+
+// serveListener как serve, но принимает соединения из готового listener
+func (l *lifecycle) serveListener(name string, server *http.Server, listener net.Listener) {
+	l.start(name, server, func() error { return server.Serve(listener) })
+}
+
+func (l *lifecycle) start(name string, server *http.Server, run func() error) {
+	go func() {
+		if err := run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case l.errors <- err:
+			default:
+			}
+		}
+	}()
+
+	l.onShutdown(name, func(ctx context.Context) error {
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+			return err
+		}
+		return nil
+	})
+}
+
+// run ждет сигнала остановки или ошибки сервера и выполняет действия
+// остановки. reload вызывается по SIGHUP.
+func (l *lifecycle) run(reload func()) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var serveErr error
+wait:
+	for {
+		select {
+		case serveErr = <-l.errors:
+			log.Printf("ошибка HTTP-сервера: %v", serveErr)
+			break wait
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reload()
+				continue
+			}
+			log.Printf("получен сигнал %v, остановка", sig)
+			break wait
+		}
+	}
+
+	// Повторный сигнал завершит процесс сразу, не дожидаясь запросов
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+
+	l.mu.Lock()
+	timeout := l.timeout
+	l.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i := len(l.steps) - 1; i >= 0; i-- {
+		step := l.steps[i]
+		if err := step.fn(ctx); err != nil {
+			log.Printf("остановка (%s): %v", step.name, err)
+		}
+	}
+	log.Printf("приложение остановлено")
+	return serveErr
+}
+
+// applyConfig применяет перечитанные настройки. Без перезапуска меняются
+// значения по умолчанию для серверов, периоды фоновых проверок и ожидание при
+// остановке; об остальных изменениях выводится предупреждение.
+func applyConfig(l *lifecycle, current, next config.Config, enforcer *quota.Enforcer, sched *scheduler.Scheduler) {
+	handlers.RegisterServerDefaults(next.Server)
+	handlers.RegisterSettings(next)
+	enforcer.SetInterval(time.Duration(next.Intervals.Quota))
+	sched.SetInterval(time.Duration(next.Intervals.Scheduler))
+	l.setTimeout(time.Duration(next.ShutdownTimeout))
+
+	for _, section := range []struct {
+		name    string
+		changed bool
+	}{
+		{"listen", current.Listen != next.Listen},
+		{"trusted_proxies", !reflect.DeepEqual(current.TrustedProxies, next.TrustedProxies)},
+		{"paths", current.Paths != next.Paths},
+		{"tls", !reflect.DeepEqual(current.TLS, next.TLS)},
+		{"storage", current.Storage != next.Storage},
+		{"features", current.Features != next.Features},
+	} {
+		if section.changed {
+			log.Printf("изменение %s вступит в силу после перезапуска", section.name)
+		}
+	}
+	log.Printf("настройки перечитаны")
+}
@@ -0,0 +1,232 @@
+package links
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Виды содержимого, выдаваемого по ссылке
+const (
+	KindConfig = "config"
+	KindQR     = "qr"
+)
+
+// DefaultTTL и MaxTTL время жизни ссылки по умолчанию и максимальное
+const (
+	DefaultTTL = time.Hour
+	MaxTTL     = 7 * 24 * time.Hour
+)
+
+// Ошибки проверки ссылки
+var (
+	ErrInvalid = errors.New("invalid download link")
+	ErrExpired = errors.New("download link expired")
+	ErrUsed    = errors.New("download link already used")
+	ErrRevoked = errors.New("download link revoked")
+	ErrUnknown = errors.New("unknown download link")
+)
+
+// Link одноразовая ссылка на скачивание конфигурации клиента
+type Link struct {
+	ID        string     `json:"id"`
+	ClientID  string     `json:"client_id"`
+	Kind      string     `json:"kind"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active сообщает, можно ли еще воспользоваться ссылкой в момент now
+func (l Link) Active(now time.Time) bool {
+	return l.UsedAt == nil && l.RevokedAt == nil && now.Before(l.ExpiresAt)
+}
+
+// Store выдает и проверяет ссылки. Токен ссылки подписан HMAC-SHA256 и
+// содержит идентификатор и срок действия; факт использования и отзыв хранятся
+// в памяти, поэтому после перезапуска все выданные ссылки становятся недействительными.
+type Store struct {
+	mu     sync.Mutex
+	secret []byte
+	links  map[string]*Link
+}
+
+// NewStore создает хранилище ссылок. Пустой secret заменяется случайным.
+func NewStore(secret []byte) (*Store, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("generate link secret: %w", err)
+		}
+	}
+	return &Store{secret: secret, links: make(map[string]*Link)}, nil
+}
+
+// Create выдает ссылку на содержимое kind клиента clientID и возвращает ее токен
+func (s *Store) Create(clientID, kind, createdBy string, ttl time.Duration) (Link, string, error) {
+	if kind != KindConfig && kind != KindQR {
+		return Link{}, "", fmt.Errorf("unsupported link kind %q", kind)
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if ttl > MaxTTL {
+		return Link{}, "", fmt.Errorf("link lifetime exceeds %s", MaxTTL)
+	}
+
+	now := time.Now()
+	link := &Link{
+		ID:        uuid.New().String(),
+		ClientID:  clientID,
+		Kind:      kind,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl).Truncate(time.Second),
+	}
+
+	s.mu.Lock()
+	s.pruneLocked(now)
+	s.links[link.ID] = link
+	s.mu.Unlock()
+
+	return *link, s.token(link), nil
+}
+
+// Consume проверяет токен и помечает ссылку использованной. Повторный вызов
+// с тем же токеном возвращает ErrUsed.
+func (s *Store) Consume(token string, now time.Time) (Link, error) {
+	id, expires, err := s.verify(token)
+	if err != nil {
+		return Link{}, err
+	}
+	if !now.Before(expires) {
+		return Link{}, ErrExpired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[id]
+	if !ok {
+		return Link{}, ErrUnknown
+	}
+	switch {
+	case link.RevokedAt != nil:
+		return *link, ErrRevoked
+	case link.UsedAt != nil:
+		return *link, ErrUsed
+	case !now.Before(link.ExpiresAt):
+		return *link, ErrExpired
+	}
+
+	used := now
+	link.UsedAt = &used
+	return *link, nil
+}
+
+// Release возвращает ссылке возможность использования, если выдать
+// содержимое по ней не удалось
+func (s *Store) Release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if link, ok := s.links[id]; ok {
+		link.UsedAt = nil
+	}
+}
+
+// Revoke отзывает ссылку. Возвращает false, если ссылка не найдена.
+func (s *Store) Revoke(id string) (Link, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[id]
+	if !ok {
+		return Link{}, false
+	}
+	if link.RevokedAt == nil && link.UsedAt == nil {
+		now := time.Now()
+		link.RevokedAt = &now
+	}
+	return *link, true
+}
+
+// RevokeClient отзывает все действующие ссылки клиента и возвращает их количество
+func (s *Store) RevokeClient(clientID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, link := range s.links {
+		if link.ClientID == clientID && link.Active(now) {
+			revoked := now
+			link.RevokedAt = &revoked
+			count++
+		}
+	}
+	return count
+}
+
+// ClientLinks возвращает ссылки клиента, от новых к старым
+func (s *Store) ClientLinks(clientID string) []Link {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Link, 0)
+	for _, link := range s.links {
+		if link.ClientID == clientID {
+			result = append(result, *link)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result
+}
+
+// pruneLocked удаляет записи о ссылках, срок которых истек более суток назад
+func (s *Store) pruneLocked(now time.Time) {
+	for id, link := range s.links {
+		if now.Sub(link.ExpiresAt) > 24*time.Hour {
+			delete(s.links, id)
+		}
+	}
+}
+
+// token формирует строку вида <id>.<unix-срок>.<подпись>
+func (s *Store) token(link *Link) string {
+	payload := link.ID + "." + strconv.FormatInt(link.ExpiresAt.Unix(), 10)
+	return payload + "." + s.sign(payload)
+}
+
+func (s *Store) verify(token string) (string, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, ErrInvalid
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(payload))) {
+		return "", time.Time{}, ErrInvalid
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, ErrInvalid
+	}
+	return parts[0], time.Unix(unix, 0), nil
+}
+
+func (s *Store) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package links
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore([]byte("test secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func createLink(t *testing.T, store *Store, ttl time.Duration) (Link, string) {
+	t.Helper()
+	link, token, err := store.Create("client-1", KindConfig, "admin", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link, token
+}
+
+func TestConsumeOnce(t *testing.T) {
+	store := newTestStore(t)
+	link, token := createLink(t, store, time.Hour)
+
+	used, err := store.Consume(token, time.Now())
+	if err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if used.ID != link.ID || used.ClientID != "client-1" || used.UsedAt == nil {
+		t.Errorf("consumed link %+v", used)
+	}
+	if _, err := store.Consume(token, time.Now()); !errors.Is(err, ErrUsed) {
+		t.Errorf("second use: got %v, want ErrUsed", err)
+	}
+}
+
+func TestConsumeExpired(t *testing.T) {
+	store := newTestStore(t)
+	link, token := createLink(t, store, time.Minute)
+
+	if _, err := store.Consume(token, link.ExpiresAt); !errors.Is(err, ErrExpired) {
+		t.Errorf("at expiry: got %v, want ErrExpired", err)
+	}
+	if _, err := store.Consume(token, link.ExpiresAt.Add(-time.Second)); err != nil {
+		t.Errorf("before expiry: %v", err)
+	}
+}
+
+func TestConsumeBadToken(t *testing.T) {
+	store := newTestStore(t)
+	_, token := createLink(t, store, time.Hour)
+	parts := strings.Split(token, ".")
+
+	other, err := NewStore([]byte("other secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, foreign, _ := other.Create("client-1", KindConfig, "", time.Hour)
+
+	for name, bad := range map[string]string{
+		"empty":         "",
+		"truncated":     token[:len(token)-4],
+		"no signature":  parts[0] + "." + parts[1],
+		"bad signature": parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])),
+		"extended":      parts[0] + "." + parts[1] + "." + parts[2] + "." + parts[2],
+		"other secret":  foreign,
+		"longer expiry": parts[0] + "." + "9999999999" + "." + parts[2],
+		"other link id": "other" + "." + parts[1] + "." + parts[2],
+	} {
+		if _, err := store.Consume(bad, time.Now()); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: got %v, want ErrInvalid", name, err)
+		}
+	}
+
+	// Подделки не расходуют ссылку
+	if _, err := store.Consume(token, time.Now()); err != nil {
+		t.Errorf("valid token after forgeries: %v", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	store := newTestStore(t)
+	link, token := createLink(t, store, time.Hour)
+
+	revoked, ok := store.Revoke(link.ID)
+	if !ok || revoked.RevokedAt == nil || revoked.Active(time.Now()) {
+		t.Fatalf("revoke: %+v, %v", revoked, ok)
+	}
+	if _, err := store.Consume(token, time.Now()); !errors.Is(err, ErrRevoked) {
+		t.Errorf("revoked link: got %v, want ErrRevoked", err)
+	}
+	if _, ok := store.Revoke("missing"); ok {
+		t.Error("revoked an unknown link")
+	}
+
+	_, first := createLink(t, store, time.Hour)
+	createLink(t, store, time.Hour)
+	if _, err := store.Consume(first, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if count := store.RevokeClient("client-1"); count != 1 {
+		t.Errorf("revoked %d active client links, want 1", count)
+	}
+}
+
+func TestReleaseAfterFailedSend(t *testing.T) {
+	store := newTestStore(t)
+	link, token := createLink(t, store, time.Hour)
+
+	if _, err := store.Consume(token, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	store.Release(link.ID)
+	if links := store.ClientLinks("client-1"); len(links) != 1 || !links[0].Active(time.Now()) {
+		t.Fatalf("released link is not active: %+v", links)
+	}
+	if _, err := store.Consume(token, time.Now()); err != nil {
+		t.Errorf("use after release: %v", err)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	store := newTestStore(t)
+	if _, _, err := store.Create("client-1", "archive", "", time.Hour); err == nil {
+		t.Error("unsupported kind accepted")
+	}
+	if _, _, err := store.Create("client-1", KindQR, "", MaxTTL+time.Second); err == nil {
+		t.Error("lifetime above MaxTTL accepted")
+	}
+	link, _, err := store.Create("client-1", KindQR, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := link.ExpiresAt.Sub(link.CreatedAt); ttl > DefaultTTL || ttl < DefaultTTL-time.Second {
+		t.Errorf("default lifetime %v, want %v", ttl, DefaultTTL)
+	}
+}
@@ -0,0 +1,355 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"wireguard-web-manager/i18n"
+)
+
+// Config параметры SMTP-сервера
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	// StartTLS требует переключения соединения на TLS командой STARTTLS.
+	// Отключать имеет смысл только для локального SMTP-сервера.
+	StartTLS           bool
+	InsecureSkipVerify bool
+
+	// SendOnCreate отправлять конфигурацию при создании клиента с email
+	SendOnCreate bool
+
+	// Locale язык писем, для которых язык не выбран явно
+	Locale i18n.Locale
+}
+
+// ConfigFromEnv читает параметры из переменных окружения SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM, SMTP_STARTTLS, SMTP_INSECURE_SKIP_VERIFY,
+// MAIL_ON_CREATE и MAIL_LOCALE. Возвращает ok=false, если SMTP_HOST не задан.
+func ConfigFromEnv() (Config, bool, error) {
+	cfg := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		StartTLS: true,
+		Locale:   i18n.Default,
+	}
+	if cfg.Host == "" {
+		return cfg, false, nil
+	}
+
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return cfg, false, fmt.Errorf("SMTP_PORT: %w", err)
+		}
+		cfg.Port = port
+	}
+
+	for name, target := range map[string]*bool{
+		"SMTP_STARTTLS":             &cfg.StartTLS,
+		"SMTP_INSECURE_SKIP_VERIFY": &cfg.InsecureSkipVerify,
+		"MAIL_ON_CREATE":            &cfg.SendOnCreate,
+	} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return cfg, false, fmt.Errorf("%s: %w", name, err)
+			}
+			*target = parsed
+		}
+	}
+
+	if value := os.Getenv("MAIL_LOCALE"); value != "" {
+		locale, ok := i18n.Parse(value)
+		if !ok {
+			return cfg, false, fmt.Errorf("MAIL_LOCALE: unsupported locale %q", value)
+		}
+		cfg.Locale = locale
+	}
+
+	return cfg, true, nil
+}
+
+// Validate проверяет параметры
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return errors.New("smtp host is required")
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid smtp port %d", c.Port)
+	}
+	if c.From == "" {
+		return errors.New("sender address is required")
+	}
+	if _, ok := mailTemplates[c.Locale]; !ok {
+		return fmt.Errorf("no mail templates for locale %q", c.Locale)
+	}
+	return nil
+}
+
+// ConfigMessage данные письма с конфигурацией клиента
+type ConfigMessage struct {
+	To         string
+	ClientName string
+	ServerName string
+	Address    string
+	Endpoint   string
+	FileName   string      // имя вложения, например office.conf
+	Config     string      // содержимое конфигурации WireGuard
+	QRCode     []byte      // PNG с QR-кодом конфигурации
+	ClientKey  bool        // приватный ключ хранится у клиента, в файле вместо него заглушка
+	Locale     i18n.Locale // язык письма; пусто — язык из настроек
+}
+
+// Sender отправляет письма с конфигурациями клиентов
+type Sender interface {
+	Locale() i18n.Locale
+	SendOnCreate() bool
+	SendConfig(msg ConfigMessage) error
+}
+
+// Mailer отправляет письма через SMTP
+type Mailer struct {
+	cfg       Config
+	templates map[i18n.Locale]*messageTemplates
+}
+
+// messageTemplates шаблоны письма с конфигурацией на одном языке
+type messageTemplates struct {
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+func New(cfg Config) (*Mailer, error) {
+	if cfg.Locale == "" {
+		cfg.Locale = i18n.Default
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Mailer{cfg: cfg, templates: make(map[i18n.Locale]*messageTemplates)}
+	for locale, source := range mailTemplates {
+		m.templates[locale] = &messageTemplates{
+			subject: template.Must(template.New("subject").Parse(source.subject)),
+			text:    template.Must(template.New("text").Parse(source.text)),
+			html:    htmltemplate.Must(htmltemplate.New("html").Parse(source.html)),
+		}
+	}
+	return m, nil
+}
+
+// Locale язык писем по умолчанию
+func (m *Mailer) Locale() i18n.Locale {
+	return m.cfg.Locale
+}
+
+// SendOnCreate сообщает, нужно ли отправлять конфигурацию при создании клиента
+func (m *Mailer) SendOnCreate() bool {
+	return m.cfg.SendOnCreate
+}
+
+// SendConfig отправляет клиенту письмо с конфигурацией во вложении и QR-кодом в теле
+func (m *Mailer) SendConfig(msg ConfigMessage) error {
+	if msg.To == "" {
+		return errors.New("recipient address is required")
+	}
+	body, err := m.buildConfigMessage(msg)
+	if err != nil {
+		return err
+	}
+	return m.send(msg.To, body)
+}
+
+func (m *Mailer) buildConfigMessage(msg ConfigMessage) ([]byte, error) {
+	tmpl, ok := m.templates[msg.Locale]
+	if !ok {
+		tmpl = m.templates[m.cfg.Locale]
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, msg); err != nil {
+		return nil, fmt.Errorf("render subject: %w", err)
+	}
+	if err := tmpl.text.Execute(&text, msg); err != nil {
+		return nil, fmt.Errorf("render text body: %w", err)
+	}
+	if err := tmpl.html.Execute(&html, msg); err != nil {
+		return nil, fmt.Errorf("render html body: %w", err)
+	}
+
+	var buf bytes.Buffer
+	mixed := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", randomToken(), m.cfg.Host)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	// Текст и HTML с встроенным QR-кодом
+	altHeader := textproto.MIMEHeader{}
+	alternative := multipart.NewWriter(io.Discard)
+	altHeader.Set("Content-Type", "multipart/alternative; boundary="+alternative.Boundary())
+	altPart, err := mixed.CreatePart(altHeader)
+	if err != nil {
+		return nil, err
+	}
+	alternative = newWriterWithBoundary(altPart, alternative.Boundary())
+
+	if err := writeBase64Part(alternative, textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	}, text.Bytes()); err != nil {
+		return nil, err
+	}
+
+	related := multipart.NewWriter(io.Discard)
+	relPart, err := alternative.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/related; boundary=" + related.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	related = newWriterWithBoundary(relPart, related.Boundary())
+
+	if err := writeBase64Part(related, textproto.MIMEHeader{
+		"Content-Type": {"text/html; charset=utf-8"},
+	}, html.Bytes()); err != nil {
+		return nil, err
+	}
+	if len(msg.QRCode) > 0 {
+		if err := writeBase64Part(related, textproto.MIMEHeader{
+			"Content-Type":        {"image/png"},
+			"Content-ID":          {"<" + qrContentID + ">"},
+			"Content-Disposition": {`inline; filename="qr.png"`},
+		}, msg.QRCode); err != nil {
+			return nil, err
+		}
+	}
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	// Файл конфигурации
+	if err := writeBase64Part(mixed, textproto.MIMEHeader{
+		"Content-Type":        {"application/octet-stream"},
+		"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": msg.FileName})},
+	}, []byte(msg.Config)); err != nil {
+		return nil, err
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (m *Mailer) send(to string, body []byte) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if m.cfg.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		tlsConfig := &tls.Config{
+			ServerName:         m.cfg.Host,
+			InsecureSkipVerify: m.cfg.InsecureSkipVerify,
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.cfg.From); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("rcpt to: %w", err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := writer.Write(body); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("finish message: %w", err)
+	}
+	return client.Quit()
+}
+
+// newWriterWithBoundary создает вложенный multipart-писатель с заранее
+// выбранной границей, уже указанной в заголовке родительской части
+func newWriterWithBoundary(w io.Writer, boundary string) *multipart.Writer {
+	writer := multipart.NewWriter(w)
+	writer.SetBoundary(boundary)
+	return writer
+}
+
+func writeBase64Part(writer *multipart.Writer, header textproto.MIMEHeader, data []byte) error {
+	header.Set("Content-Transfer-Encoding", "base64")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+func randomToken() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+const qrContentID = "qr@wireguard-web-manager"
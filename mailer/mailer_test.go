@@ -0,0 +1,264 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	"wireguard-web-manager/i18n"
+)
+
+// smtpMessage письмо, принятое SMTP-заглушкой
+type smtpMessage struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// smtpStub локальный SMTP-сервер для тестов: принимает одно соединение за
+// раз и сохраняет письма. STARTTLS и AUTH не объявляет.
+type smtpStub struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &smtpStub{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go stub.serve()
+	return stub
+}
+
+func (s *smtpStub) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.session(conn)
+	}
+}
+
+func (s *smtpStub) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP stub")
+	var msg smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			msg = smtpMessage{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = data.Bytes()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func newTestMailer(t *testing.T, stub *smtpStub) *Mailer {
+	t.Helper()
+	m, err := New(Config{
+		Host:   "127.0.0.1",
+		Port:   stub.port(),
+		From:   "vpn@example.com",
+		Locale: i18n.EN,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// attachments возвращает вложения письма по имени файла
+func attachments(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	result := make(map[string][]byte)
+	var walk func(contentType string, body io.Reader)
+	walk = func(contentType string, body io.Reader) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+			return
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return
+			}
+			if name := part.FileName(); name != "" {
+				var content io.Reader = part
+				if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+					content = base64.NewDecoder(base64.StdEncoding, part)
+				}
+				data, err := io.ReadAll(content)
+				if err != nil {
+					t.Errorf("read attachment %s: %v", name, err)
+				}
+				result[name] = data
+				continue
+			}
+			walk(part.Header.Get("Content-Type"), part)
+		}
+	}
+	walk(msg.Header.Get("Content-Type"), msg.Body)
+	return result
+}
+
+func TestSendConfig(t *testing.T) {
+	stub := newSMTPStub(t)
+	m := newTestMailer(t, stub)
+
+	err := m.SendConfig(ConfigMessage{
+		To:         "alice@example.com",
+		ClientName: "alice-laptop",
+		ServerName: "office",
+		FileName:   "alice-laptop.conf",
+		Config:     "[Interface]\nPrivateKey = test\n",
+		QRCode:     []byte("\x89PNG test"),
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	messages := stub.received()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.from != "vpn@example.com" || len(msg.to) != 1 || msg.to[0] != "alice@example.com" {
+		t.Errorf("envelope from %q to %v", msg.from, msg.to)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || !strings.Contains(subject, "alice-laptop") {
+		t.Errorf("subject %q (%v)", subject, err)
+	}
+	if got := parsed.Header.Get("To"); got != "alice@example.com" {
+		t.Errorf("To header %q", got)
+	}
+
+	files := attachments(t, msg.data)
+	if got := string(files["alice-laptop.conf"]); got != "[Interface]\nPrivateKey = test\n" {
+		t.Errorf("config attachment %q", got)
+	}
+	if got := string(files["qr.png"]); got != "\x89PNG test" {
+		t.Errorf("qr attachment %q", got)
+	}
+}
+
+func TestSendConfigRequiresRecipient(t *testing.T) {
+	stub := newSMTPStub(t)
+	m := newTestMailer(t, stub)
+
+	if err := m.SendConfig(ConfigMessage{FileName: "x.conf"}); err == nil {
+		t.Fatal("sent a message without a recipient")
+	}
+	if len(stub.received()) != 0 {
+		t.Error("stub received a message")
+	}
+}
+
+func TestSendConfigRequiresStartTLS(t *testing.T) {
+	stub := newSMTPStub(t)
+	m, err := New(Config{
+		Host:     "127.0.0.1",
+		Port:     stub.port(),
+		From:     "vpn@example.com",
+		StartTLS: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.SendConfig(ConfigMessage{To: "alice@example.com", FileName: "alice.conf"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("got %v, want a STARTTLS error", err)
+	}
+	if len(stub.received()) != 0 {
+		t.Error("message was sent without TLS")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{Host: "smtp.example.com", Port: 587, From: "vpn@example.com", Locale: i18n.RU}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	for name, cfg := range map[string]Config{
+		"no host":   {Port: 587, From: "vpn@example.com", Locale: i18n.RU},
+		"bad port":  {Host: "smtp.example.com", Port: 70000, From: "vpn@example.com", Locale: i18n.RU},
+		"no sender": {Host: "smtp.example.com", Port: 587, Locale: i18n.RU},
+		"no locale": {Host: "smtp.example.com", Port: 587, From: "vpn@example.com", Locale: "xx"},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package mailer
+
+import "wireguard-web-manager/i18n"
+
+// mailTemplateSource исходные тексты шаблонов письма на одном языке
+type mailTemplateSource struct {
+	subject string
+	text    string
+	html    string
+}
+
+// mailTemplates шаблоны письма с конфигурацией для каждого языка
+var mailTemplates = map[i18n.Locale]mailTemplateSource{
+	i18n.RU: {
+		subject: `Конфигурация WireGuard: {{.ClientName}}`,
+		text: `Здравствуйте!
+
+Для клиента «{{.ClientName}}» подготовлена конфигурация WireGuard{{if .ServerName}} сервера {{.ServerName}}{{end}}.
+{{if .Address}}Адрес в VPN: {{.Address}}
+{{end}}{{if .Endpoint}}Сервер: {{.Endpoint}}
+{{end}}
+Файл {{.FileName}} во вложении импортируйте в приложение WireGuard{{if .QRCode}}
+или отсканируйте QR-код из HTML-версии письма в мобильном приложении{{end}}.
+
+{{if .ClientKey}}Перед импортом замените в файле строку-заглушку в PrivateKey своим приватным ключом.{{else}}Файл содержит приватный ключ — не пересылайте его и удалите письмо после импорта.{{end}}
+`,
+		html: `<!DOCTYPE html>
+<html lang="ru">
+<body style="font-family: sans-serif;">
+<p>Здравствуйте!</p>
+<p>Для клиента «{{.ClientName}}» подготовлена конфигурация WireGuard{{if .ServerName}} сервера <strong>{{.ServerName}}</strong>{{end}}.</p>
+<ul>
+{{if .Address}}<li>Адрес в VPN: {{.Address}}</li>{{end}}
+{{if .Endpoint}}<li>Сервер: {{.Endpoint}}</li>{{end}}
+</ul>
+<p>Импортируйте файл <code>{{.FileName}}</code> из вложения в приложение WireGuard{{if .QRCode}} или отсканируйте QR-код в мобильном приложении:{{else}}.{{end}}</p>
+{{if .QRCode}}<p><img src="cid:` + qrContentID + `" alt="QR-код конфигурации" width="256" height="256"></p>{{end}}
+<p><small>{{if .ClientKey}}Перед импортом замените в файле строку-заглушку в PrivateKey своим приватным ключом.{{else}}Файл содержит приватный ключ — не пересылайте его и удалите письмо после импорта.{{end}}</small></p>
+</body>
+</html>
+`,
+	},
+	i18n.EN: {
+		subject: `WireGuard configuration: {{.ClientName}}`,
+		text: `Hello!
+
+A WireGuard configuration has been prepared for "{{.ClientName}}"{{if .ServerName}} on server {{.ServerName}}{{end}}.
+{{if .Address}}VPN address: {{.Address}}
+{{end}}{{if .Endpoint}}Server: {{.Endpoint}}
+{{end}}
+Import the attached file {{.FileName}} into the WireGuard app{{if .QRCode}}
+or scan the QR code from the HTML version of this email with the mobile app{{end}}.
+
+{{if .ClientKey}}Before importing, replace the placeholder in the PrivateKey line with your own private key.{{else}}The file contains a private key: do not forward it, and delete this email after importing.{{end}}
+`,
+		html: `<!DOCTYPE html>
+<html lang="en">
+<body style="font-family: sans-serif;">
+<p>Hello!</p>
+<p>A WireGuard configuration has been prepared for “{{.ClientName}}”{{if .ServerName}} on server <strong>{{.ServerName}}</strong>{{end}}.</p>
+<ul>
+{{if .Address}}<li>VPN address: {{.Address}}</li>{{end}}
+{{if .Endpoint}}<li>Server: {{.Endpoint}}</li>{{end}}
+</ul>
+<p>Import the attached file <code>{{.FileName}}</code> into the WireGuard app{{if .QRCode}} or scan the QR code with the mobile app:{{else}}.{{end}}</p>
+{{if .QRCode}}<p><img src="cid:` + qrContentID + `" alt="Configuration QR code" width="256" height="256"></p>{{end}}
+<p><small>{{if .ClientKey}}Before importing, replace the placeholder in the PrivateKey line with your own private key.{{else}}The file contains a private key: do not forward it, and delete this email after importing.{{end}}</small></p>
+</body>
+</html>
+`,
+	},
+}
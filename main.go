@@ -1,64 +1,330 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
+	"wireguard-web-manager/apiv1"
+	"wireguard-web-manager/audit"
+	"wireguard-web-manager/config"
 	"wireguard-web-manager/handlers"
+	"wireguard-web-manager/i18n"
+	"wireguard-web-manager/links"
+	"wireguard-web-manager/mailer"
 	"wireguard-web-manager/models"
+	"wireguard-web-manager/quota"
+	"wireguard-web-manager/scheduler"
+	"wireguard-web-manager/secrets"
+	"wireguard-web-manager/service"
+	"wireguard-web-manager/users"
+	"wireguard-web-manager/webhooks"
 	"wireguard-web-manager/wireguard"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("неверные настройки: %v", err)
+	}
+
+	if len(args) > 0 && args[0] != "serve" {
+		if err := runCommand(cfg, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 1 {
+		log.Fatalf("лишние аргументы команды serve: %v", args[1:])
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("неверные настройки: %v", err)
+	}
+
+	// Сокет открывается до WireGuard и состояния: второй экземпляр сервера
+	// остановится, ничего не изменив
+	var controlListener net.Listener
+	if cfg.Paths.ControlSocket != "" {
+		controlListener, err = listenControl(cfg.Paths.ControlSocket)
+		if err != nil {
+			log.Fatalf("не удалось открыть управляющий сокет: %v", err)
+		}
+	}
+
+	app := newLifecycle(time.Duration(cfg.ShutdownTimeout))
+
 	wgService, err := wireguard.NewService()
 	if err != nil {
 		log.Fatalf("не удалось создать клиент WireGuard: %v", err)
 	}
-	defer wgService.Close()
+	app.onShutdown("WireGuard", func(context.Context) error { return wgService.Close() })
 
 	if err := models.InitStorage(wgService); err != nil {
 		log.Fatalf("не удалось инициализировать хранилище: %v", err)
 	}
+	switch cfg.Storage.Backend {
+	case config.StorageFile:
+		// Приватные ключи в файле состояния шифруются мастер-ключом
+		var sealer models.Sealer
+		keyring, err := secrets.LoadKeyring()
+		switch {
+		case err == nil:
+			sealer = keyring
+		case errors.Is(err, secrets.ErrNoKey):
+			log.Printf("мастер-ключ не задан (%s или %s): приватные ключи сохраняются без шифрования", secrets.EnvMasterKeyFile, secrets.EnvMasterKey)
+		default:
+			log.Fatalf("не удалось загрузить мастер-ключ: %v", err)
+		}
+		if err := models.GlobalStorage.EnablePersistence(cfg.Storage.StateFile, sealer); err != nil {
+			log.Fatalf("не удалось загрузить состояние: %v", err)
+		}
+		// Сохраняется после остановки фоновых проверок, которые меняют состояние
+		app.onShutdown("состояние", func(context.Context) error { return models.GlobalStorage.Flush() })
+	case config.StorageMemory:
+		log.Printf("состояние хранится только в памяти и не сохранится после перезапуска")
+	}
 	handlers.RegisterWireGuardService(wgService)
+	svc := service.New(models.GlobalStorage, wgService)
+	svc.SyncRoutes()
+	svc.SyncRateLimits()
+	handlers.RegisterService(svc)
+	handlers.RegisterServerDefaults(cfg.Server)
+	handlers.RegisterSettings(cfg)
+
+	if cfg.Features.Audit {
+		auditLog, err := audit.Open(cfg.Paths.AuditLog)
+		if err != nil {
+			log.Fatalf("не удалось открыть журнал аудита: %v", err)
+		}
+		app.onShutdown("журнал аудита", func(context.Context) error { return auditLog.Close() })
+		handlers.RegisterAuditLog(auditLog)
+	}
+
+	// events остается nil, если уведомления отключены
+	var events webhooks.Publisher
+	if cfg.Features.Webhooks {
+		dispatcher := webhooks.NewDispatcher(webhooks.Options{Store: models.GlobalStorage})
+		app.onShutdown("webhook-уведомления", func(context.Context) error {
+			dispatcher.Close()
+			return nil
+		})
+		handlers.RegisterWebhooks(dispatcher)
+		events = dispatcher
+	}
+
+	if cfg.Features.Mail {
+		mailConfig, mailEnabled, err := mailer.ConfigFromEnv()
+		if err != nil {
+			log.Fatalf("неверные настройки почты: %v", err)
+		}
+		if mailEnabled {
+			configMailer, err := mailer.New(mailConfig)
+			if err != nil {
+				log.Fatalf("не удалось настроить отправку почты: %v", err)
+			}
+			handlers.RegisterMailer(configMailer)
+			app.onShutdown("почта", handlers.WaitMail)
+		}
+	}
+
+	if cfg.Features.DownloadLinks {
+		linkStore, err := links.NewStore(nil)
+		if err != nil {
+			log.Fatalf("не удалось создать хранилище ссылок: %v", err)
+		}
+		handlers.RegisterDownloadLinks(linkStore)
+	}
+
+	quotaEnforcer := quota.NewEnforcer(wgService, svc, events, time.Duration(cfg.Intervals.Quota))
+	quotaEnforcer.Start()
+	app.onShutdown("учет трафика", func(context.Context) error {
+		quotaEnforcer.Stop()
+		return nil
+	})
+
+	accessScheduler := scheduler.New(wgService, svc, events, time.Duration(cfg.Intervals.Scheduler))
+	accessScheduler.Start()
+	app.onShutdown("расписания", func(context.Context) error {
+		accessScheduler.Stop()
+		return nil
+	})
+
+	tlsConfig, challenge, err := setupTLS(cfg.TLS)
+	if err != nil {
+		log.Fatalf("не удалось настроить HTTPS: %v", err)
+	}
 
 	// Настройка Gin
 	r := gin.Default()
+	// Без доверенных прокси IP в журнале аудита берется из соединения:
+	// X-Forwarded-For может подставить любой клиент
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("неверный список доверенных прокси: %v", err)
+	}
+	r.Use(handlers.Locale())
+	if tlsConfig != nil && cfg.TLS.HSTSMaxAge > 0 {
+		r.Use(handlers.HSTS(time.Duration(cfg.TLS.HSTSMaxAge)))
+	}
 
 	// Загрузка статических файлов
-	r.Static("/static", "./static")
-	r.Static("/css", "./css")
-	r.StaticFS("/uploads", http.Dir("./uploads"))
+	r.Static("/static", cfg.Paths.Static)
+	r.Static("/css", cfg.Paths.CSS)
+	r.StaticFS("/uploads", http.Dir(cfg.Paths.Uploads))
 
 	// Загрузка HTML шаблонов
-	r.LoadHTMLGlob("templates/*")
+	r.SetFuncMap(i18n.FuncMap())
+	r.LoadHTMLGlob(filepath.Join(cfg.Paths.Templates, "*"))
+
+	// Вход в панель, если в файле пользователей есть пользователи
+	var auth gin.HandlersChain
+	if cfg.Paths.Users != "" {
+		userStore, err := users.Open(cfg.Paths.Users)
+		if err != nil {
+			log.Fatalf("не удалось загрузить пользователей: %v", err)
+		}
+		auth = gin.HandlersChain{handlers.BasicAuth(userStore)}
+		handlers.RegisterUsers(userStore)
+	}
 
 	// API маршруты
-	api := r.Group("/api")
-	{
-		// Сервер
-		api.GET("/server", handlers.GetServer)
-		api.POST("/server", handlers.CreateServer)
-		api.PUT("/server/:id", handlers.UpdateServer)
-		api.DELETE("/server/:id", handlers.DeleteServer)
-
-		// Клиенты
-		api.GET("/clients", handlers.GetClients)
-		api.POST("/clients", handlers.CreateClient)
-		api.GET("/clients/:id/config", handlers.DownloadClientConfig)
-		api.PUT("/clients/:id/disable", handlers.DisableClient)
-		api.PUT("/clients/:id/enable", handlers.EnableClient)
-		api.DELETE("/clients/:id", handlers.DeleteClient)
-
-		// Статистика
-		api.GET("/stats", handlers.GetStats)
+	registerAPI(r.Group("/api", auth...))
+
+	// Версионированный API с документом OpenAPI
+	if cfg.Features.APIv1 {
+		handlers.RegisterV1(r.Group(apiv1.BasePath, auth...))
 	}
 
 	// Веб-интерфейс маршруты
-	r.GET("/", handlers.Index)
-	r.GET("/dashboard", handlers.Dashboard)
+	pages := r.Group("/", auth...)
+	pages.GET("/", handlers.Index)
+	pages.GET("/dashboard", handlers.Dashboard)
+
+	// Одноразовые ссылки на скачивание конфигурации
+	r.GET(handlers.LinkPathPrefix+":token", handlers.DownloadByLink)
+
+	// Документ OpenAPI должен описывать ровно зарегистрированные маршруты v1
+	if cfg.Features.APIv1 {
+		if err := handlers.CheckV1Routes(r.Routes()); err != nil {
+			log.Fatalf("документ OpenAPI не совпадает с маршрутами: %v", err)
+		}
+	}
+
+	server := &http.Server{Addr: cfg.Listen, Handler: r, TLSConfig: tlsConfig}
+	if tlsConfig == nil {
+		log.Printf("HTTPS выключен: конфигурации с приватными ключами передаются без шифрования")
+		log.Printf("Сервер запущен на %s (HTTP)", cfg.Listen)
+	} else {
+		log.Printf("Сервер запущен на %s (HTTPS)", cfg.Listen)
+	}
+	app.serve("HTTP-сервер", server)
+
+	if tlsConfig != nil && cfg.TLS.RedirectListen != "" {
+		redirect := redirectToHTTPS(cfg.Listen)
+		if challenge != nil {
+			redirect = challenge(redirect)
+		}
+		log.Printf("Перенаправление на HTTPS запущено на %s", cfg.TLS.RedirectListen)
+		app.serve("перенаправление на HTTPS", &http.Server{Addr: cfg.TLS.RedirectListen, Handler: redirect})
+	}
+
+	// Управляющий сокет для команд: те же маршруты без входа, доступ
+	// ограничен правами на файл сокета. API v1 нужен командам, поэтому
+	// регистрируется здесь и при отключенной возможности api_v1.
+	if controlListener != nil {
+		control := gin.New()
+		control.Use(gin.Recovery(), handlers.Locale(), handlers.ControlActor())
+		registerAPI(control.Group("/api"))
+		handlers.RegisterV1(control.Group(apiv1.BasePath))
+
+		log.Printf("Управляющий сокет: %s", cfg.Paths.ControlSocket)
+		app.serveListener("управляющий сокет", &http.Server{Handler: control}, controlListener)
+	}
+
+	// SIGHUP перечитывает настройки из тех же источников: файла, окружения и флагов
+	reload := func() {
+		next, _, err := config.Load(os.Args[1:])
+		if err == nil {
+			err = next.Validate()
+		}
+		if err != nil {
+			log.Printf("настройки не перечитаны: %v", err)
+			return
+		}
+		applyConfig(app, cfg, next, quotaEnforcer, accessScheduler)
+		cfg = next
+	}
+	if err := app.run(reload); err != nil {
+		os.Exit(1)
+	}
+}
+
+// registerAPI регистрирует маршруты /api панели и управляющего сокета
+func registerAPI(api *gin.RouterGroup) {
+	// Сервер
+	api.GET("/server", handlers.GetServer)
+	api.GET("/server/:id", handlers.GetServerByID)
+	api.POST("/server", handlers.CreateServer)
+	api.PUT("/server/:id", handlers.UpdateServer)
+	api.DELETE("/server/:id", handlers.DeleteServer)
+	api.POST("/server/:id/rotate-key", handlers.RotateServerKey)
+	api.GET("/server/:id/rotation", handlers.GetServerRotation)
+
+	// Клиенты
+	api.GET("/clients", handlers.GetClients)
+	api.GET("/clients/export", handlers.ExportClients)
+	api.POST("/clients", handlers.CreateClient)
+	api.POST("/clients/bulk", handlers.BulkCreateClients)
+	api.POST("/clients/bulk/:action", handlers.BulkClientAction)
+	api.GET("/clients/:id/config", handlers.DownloadClientConfig)
+	api.GET("/clients/:id/site-link", handlers.GetClientSiteLink)
+	api.POST("/clients/:id/send-config", handlers.SendClientConfig)
+	api.GET("/clients/:id/links", handlers.GetClientLinks)
+	api.POST("/clients/:id/links", handlers.CreateClientLink)
+	api.DELETE("/clients/:id/links", handlers.RevokeClientLinks)
+	api.DELETE("/clients/:id/links/:link_id", handlers.RevokeClientLink)
+	api.PUT("/clients/:id/disable", handlers.DisableClient)
+	api.PUT("/clients/:id/enable", handlers.EnableClient)
+	api.PUT("/clients/:id/schedule", handlers.UpdateClientSchedule)
+	api.PUT("/clients/:id/tags", handlers.SetClientTags)
+	api.POST("/clients/:id/rotate-key", handlers.RotateClientKey)
+	api.DELETE("/clients/:id/rotate-key", handlers.CancelClientKeyRotation)
+	api.GET("/clients/:id", handlers.GetClient)
+	api.PATCH("/clients/:id", handlers.PatchClient)
+	api.DELETE("/clients/:id", handlers.DeleteClient)
+
+	// Группы
+	api.GET("/groups", handlers.GetGroups)
+	api.POST("/groups", handlers.CreateGroup)
+	api.PUT("/groups/:name", handlers.UpdateGroup)
+	api.DELETE("/groups/:name", handlers.DeleteGroup)
+	api.POST("/groups/:name/:action", handlers.GroupAction)
+
+	// Статистика
+	api.GET("/stats", handlers.GetStats)
+
+	// Резервное копирование
+	api.POST("/backup", handlers.CreateBackup)
+	api.POST("/restore", handlers.RestoreBackup)
+
+	// Журнал аудита
+	api.GET("/audit", handlers.GetAuditLog)
 
-	log.Println("Сервер запущен на порту :8080")
-	r.Run(":8080")
+	// Webhook-уведомления
+	api.GET("/webhooks", handlers.GetWebhooks)
+	api.POST("/webhooks", handlers.CreateWebhook)
+	api.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+	api.GET("/webhooks/deliveries", handlers.GetWebhookDeliveries)
+	api.GET("/webhooks/dead-letters", handlers.GetWebhookDeadLetters)
+	api.POST("/webhooks/dead-letters/:id/retry", handlers.RetryWebhookDeadLetter)
 }
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Group политика для клиентов с одноименным тегом. Маршруты и DNS действуют
+// на все конфигурации участников, срок действия и квота подставляются при
+// создании клиента, если не заданы явно.
+type Group struct {
+	Name        string    `json:"name"` // совпадает с тегом клиентов
+	Description string    `json:"description,omitempty"`
+	AllowedIPs  string    `json:"allowed_ips,omitempty"` // маршруты в конфигурации клиента вместо маршрутов сервера
+	DNS         string    `json:"dns,omitempty"`         // DNS в конфигурации клиента вместо DNS сервера
+	ExpiryDays  int       `json:"expiry_days,omitempty"` // срок действия доступа новых клиентов, дней
+	QuotaBytes  int64     `json:"quota_bytes,omitempty"`
+	QuotaPeriod string    `json:"quota_period,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// maxClientTags ограничивает число тегов клиента
+const maxClientTags = 20
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// NormalizeTags приводит теги к нижнему регистру, убирает повторы и проверяет
+// допустимые символы
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxClientTags {
+		return nil, fmt.Errorf("too many tags, at most %d", maxClientTags)
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// HasTag сообщает, отмечен ли клиент тегом
+func (c *Client) HasTag(tag string) bool {
+	for _, item := range c.Tags {
+		if item == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate проверяет имя и параметры группы
+func (g *Group) Validate() error {
+	if !tagPattern.MatchString(g.Name) {
+		return errors.New("group name must be a lowercase tag: letters, digits, '-' and '_'")
+	}
+	for _, route := range strings.Split(g.AllowedIPs, ",") {
+		if route = strings.TrimSpace(route); route == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(route); err != nil {
+			return fmt.Errorf("invalid allowed ip %q", route)
+		}
+	}
+	for _, dns := range strings.Split(g.DNS, ",") {
+		if dns = strings.TrimSpace(dns); dns != "" && net.ParseIP(dns) == nil {
+			return fmt.Errorf("invalid dns %q", dns)
+		}
+	}
+	if g.ExpiryDays < 0 {
+		return errors.New("expiry days must not be negative")
+	}
+	if g.QuotaBytes < 0 || !ValidQuotaPeriod(g.QuotaPeriod) {
+		return errors.New("invalid quota")
+	}
+	return nil
+}
+
+// ApplyGroupDefaults подставляет клиенту срок действия и квоту из его групп,
+// если они не заданы. Используется первая по порядку тегов группа, где
+// параметр задан.
+func ApplyGroupDefaults(client *Client, groups []*Group, now time.Time) {
+	for _, group := range groups {
+		if client.ExpiresAt == nil && group.ExpiryDays > 0 {
+			expires := now.AddDate(0, 0, group.ExpiryDays)
+			client.ExpiresAt = &expires
+		}
+		if client.QuotaBytes == 0 && group.QuotaBytes > 0 {
+			client.QuotaBytes = group.QuotaBytes
+			client.QuotaPeriod = group.QuotaPeriod
+		}
+	}
+}
+
+// ConfigRoutes возвращает маршруты и DNS для конфигурации клиента: из первой
+// группы клиента, где они заданы, иначе из настроек сервера
+func ConfigRoutes(server *Server, groups []*Group) (allowedIPs, dns string) {
+	allowedIPs, dns = server.AllowedIPs, server.DNS
+	routesSet, dnsSet := false, false
+	for _, group := range groups {
+		if !routesSet && group.AllowedIPs != "" {
+			allowedIPs, routesSet = group.AllowedIPs, true
+		}
+		if !dnsSet && group.DNS != "" {
+			dns, dnsSet = group.DNS, true
+		}
+	}
+	return allowedIPs, dns
+}
+
+// AddGroup добавляет группу; возвращает false, если группа уже существует
+func (s *Storage) AddGroup(group *Group) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.Groups[group.Name]; exists {
+		return false
+	}
+	s.Groups[group.Name] = group
+	s.changed()
+	return true
+}
+
+// GetGroup получает группу по имени
+func (s *Storage) GetGroup(name string) (*Group, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	group, exists := s.Groups[name]
+	return group, exists
+}
+
+// UpdateGroup обновляет группу
+func (s *Storage) UpdateGroup(group *Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	group.UpdatedAt = time.Now()
+	s.Groups[group.Name] = group
+	s.changed()
+}
+
+// DeleteGroup удаляет группу. Теги клиентов остаются.
+func (s *Storage) DeleteGroup(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Groups, name)
+	s.changed()
+}
+
+// GetAllGroups возвращает группы, упорядоченные по имени
+func (s *Storage) GetAllGroups() []*Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*Group, 0, len(s.Groups))
+	for _, group := range s.Groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// ClientGroups возвращает группы клиента в порядке его тегов. Теги без
+// группы пропускаются.
+func (s *Storage) ClientGroups(client *Client) []*Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*Group, 0, len(client.Tags))
+	for _, tag := range client.Tags {
+		if group, ok := s.Groups[tag]; ok {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+// GetClientsByTag возвращает клиентов с тегом
+func (s *Storage) GetClientsByTag(tag string) map[string]*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]*Client)
+	for id, client := range s.Clients {
+		if client.HasTag(tag) {
+			result[id] = client
+		}
+	}
+	return result
+}
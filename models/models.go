@@ -1,6 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +29,9 @@ type Server struct {
 	IsActive   bool      `json:"is_active"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+	Version    int64     `json:"version"` // растет при каждом изменении, основа ETag
+
+	KeyRotatedAt *time.Time `json:"key_rotated_at,omitempty"` // последняя смена ключа сервера
 }
 
 // Client представляет клиента WireGuard
@@ -33,8 +40,10 @@ type Client struct {
 	ServerID   string     `json:"server_id"`
 	Name       string     `json:"name"`
 	Email      string     `json:"email"`
-	PrivateKey string     `json:"private_key"`
+	Tags       []string   `json:"tags,omitempty"`        // теги; тег с политикой — группа
+	PrivateKey string     `json:"private_key,omitempty"` // пусто, если ключ сгенерировал сам клиент
 	PublicKey  string     `json:"public_key"`
+	ClientKey  bool       `json:"client_key"`  // ключевая пара сгенерирована клиентом, сервер знает только открытый ключ
 	AllowedIPs string     `json:"allowed_ips"` // IP адрес клиента в сети сервера
 	IsActive   bool       `json:"is_active"`
 	IsDisabled bool       `json:"is_disabled"`
@@ -42,6 +51,287 @@ type Client struct {
 	DownloadAt *time.Time `json:"download_at,omitempty"`
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
+	Version    int64      `json:"version"` // растет при каждом изменении, основа ETag
+
+	// Трафик клиента за все время и последние снятые с ядра счетчики пира
+	ReceiveBytes  int64      `json:"receive_bytes"`
+	TransmitBytes int64      `json:"transmit_bytes"`
+	CounterRx     int64      `json:"counter_rx"`
+	CounterTx     int64      `json:"counter_tx"`
+	LastHandshake *time.Time `json:"last_handshake,omitempty"`
+
+	// Квота трафика
+	QuotaBytes    int64      `json:"quota_bytes"`            // лимит трафика за период, 0 — без ограничений
+	QuotaPeriod   string     `json:"quota_period,omitempty"` // day, week или month
+	PeriodUsage   int64      `json:"period_usage"`           // трафик за текущий период
+	PeriodStart   *time.Time `json:"period_start,omitempty"`
+	QuotaExceeded bool       `json:"quota_exceeded"` // пир снят с интерфейса из-за превышения квоты
+
+	// Ограничение скорости, кбит/с; 0 — без ограничения
+	IngressKbit uint64 `json:"ingress_kbit"` // от клиента к серверу
+	EgressKbit  uint64 `json:"egress_kbit"`  // от сервера к клиенту
+
+	// Расписание доступа; nil — доступ без ограничений по времени
+	Schedule           *Schedule  `json:"schedule,omitempty"`
+	OutsideSchedule    bool       `json:"outside_schedule"` // пир снят с интерфейса вне окна доступа
+	NextScheduleChange *time.Time `json:"next_schedule_change,omitempty"`
+
+	// Срок действия доступа; nil — бессрочно
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"` // пир снят с интерфейса по истечении срока
+
+	// Смена ключей: новый пир добавляется на интерфейс без адресов и получает
+	// адреса клиента при первом рукопожатии или по истечении RotationDeadline
+	PendingPrivateKey string     `json:"pending_private_key,omitempty"`
+	PendingPublicKey  string     `json:"pending_public_key,omitempty"`
+	RotationDeadline  *time.Time `json:"rotation_deadline,omitempty"`
+	ConfigOutdated    bool       `json:"config_outdated"` // у клиента устаревшая конфигурация после смены ключей
+
+	// Площадка: сеть филиала за шлюзом с постоянным адресом. Сети площадки
+	// маршрутизируются на сервере в туннель, локальные сети сервера
+	// передаются площадке в ее конфигурации.
+	Kind         string   `json:"kind,omitempty"`          // вид пира: пусто — клиент, PeerKindSite — площадка
+	Subnets      []string `json:"subnets,omitempty"`       // сети за площадкой
+	LocalSubnets []string `json:"local_subnets,omitempty"` // сети за сервером, доступные площадке
+	Endpoint     string   `json:"endpoint,omitempty"`      // адрес шлюза площадки host:port
+}
+
+// PeerKindSite вид пира площадки: шлюза другой сети с постоянным адресом
+const PeerKindSite = "site"
+
+// IsSite сообщает, что пир — площадка
+func (c *Client) IsSite() bool {
+	return c.Kind == PeerKindSite
+}
+
+// SiteNetworks разбирает сети площадки
+func (c *Client) SiteNetworks() ([]net.IPNet, error) {
+	return wireguard.ParseAllowedIPs(c.Subnets)
+}
+
+// Периоды учета квоты трафика
+const (
+	QuotaPeriodDay   = "day"
+	QuotaPeriodWeek  = "week"
+	QuotaPeriodMonth = "month"
+)
+
+// ValidQuotaPeriod проверяет, поддерживается ли период учета квоты
+func ValidQuotaPeriod(period string) bool {
+	switch period {
+	case "", QuotaPeriodDay, QuotaPeriodWeek, QuotaPeriodMonth:
+		return true
+	}
+	return false
+}
+
+// QuotaPeriodStart возвращает начало периода учета, в который попадает момент now.
+// Пустой период считается месячным.
+func QuotaPeriodStart(period string, now time.Time) time.Time {
+	year, month, day := now.Date()
+	switch period {
+	case QuotaPeriodDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	case QuotaPeriodWeek:
+		offset := (int(now.Weekday()) + 6) % 7 // неделя начинается с понедельника
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, now.Location())
+	default:
+		return time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	}
+}
+
+// Public возвращает копию клиента без приватного ключа для ответов API
+func (c *Client) Public() Client {
+	public := *c
+	public.PrivateKey = ""
+	public.PendingPrivateKey = ""
+	return public
+}
+
+// AllowedIPList возвращает адреса клиента списком
+func (c *Client) AllowedIPList() []string {
+	parts := strings.Split(c.AllowedIPs, ",")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// PeerConfig формирует конфигурацию пира клиента для интерфейса сервера.
+// Площадке разрешаются и ее сети, а ее адрес задается как endpoint пира.
+func (c *Client) PeerConfig() (wgtypes.PeerConfig, error) {
+	pubKey, err := wgtypes.ParseKey(c.PublicKey)
+	if err != nil {
+		return wgtypes.PeerConfig{}, fmt.Errorf("parse public key: %w", err)
+	}
+
+	allowedNetworks, err := wireguard.ParseAllowedIPs(append(c.AllowedIPList(), c.Subnets...))
+	if err != nil {
+		return wgtypes.PeerConfig{}, err
+	}
+
+	var endpoint *net.UDPAddr
+	if c.Endpoint != "" {
+		endpoint, err = net.ResolveUDPAddr("udp", c.Endpoint)
+		if err != nil {
+			return wgtypes.PeerConfig{}, fmt.Errorf("resolve endpoint: %w", err)
+		}
+	}
+
+	keepalive := 25 * time.Second
+	return wgtypes.PeerConfig{
+		PublicKey:                   pubKey,
+		Endpoint:                    endpoint,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  allowedNetworks,
+		PersistentKeepaliveInterval: &keepalive,
+	}, nil
+}
+
+// TunnelAddress возвращает туннельный адрес клиента — первый из его AllowedIPs
+func (c *Client) TunnelAddress() string {
+	allowed := c.AllowedIPList()
+	if len(allowed) == 0 {
+		return ""
+	}
+	return allowed[0]
+}
+
+// RateLimit возвращает ограничения скорости клиента
+func (c *Client) RateLimit() wireguard.RateLimit {
+	return wireguard.RateLimit{
+		IngressKbit: c.IngressKbit,
+		EgressKbit:  c.EgressKbit,
+	}
+}
+
+// ShouldBeConnected сообщает, должен ли пир клиента сейчас находиться на интерфейсе
+func (c *Client) ShouldBeConnected() bool {
+	return !c.IsDisabled && !c.QuotaExceeded && !c.OutsideSchedule && !c.Expired
+}
+
+// Состояния клиента
+const (
+	StatusActive          = "active"
+	StatusDisabled        = "disabled"
+	StatusExpired         = "expired"
+	StatusQuotaExceeded   = "quota_exceeded"
+	StatusOutsideSchedule = "outside_schedule"
+)
+
+// Status возвращает состояние клиента; если причин отключения несколько,
+// выбирается наиболее важная
+func (c *Client) Status() string {
+	switch {
+	case c.IsDisabled:
+		return StatusDisabled
+	case c.Expired:
+		return StatusExpired
+	case c.QuotaExceeded:
+		return StatusQuotaExceeded
+	case c.OutsideSchedule:
+		return StatusOutsideSchedule
+	}
+	return StatusActive
+}
+
+// ExpiredAt сообщает, истек ли срок действия доступа клиента к моменту now
+func (c *Client) ExpiredAt(now time.Time) bool {
+	return c.ExpiresAt != nil && !c.ExpiresAt.After(now)
+}
+
+// AttachPeer добавляет пир клиента на интерфейс сервера, маршруты сетей
+// площадки и ограничения скорости
+func AttachPeer(wg *wireguard.Service, client *Client) error {
+	peerCfg, err := client.PeerConfig()
+	if err != nil {
+		return err
+	}
+	if err := wg.ConfigureServer(client.ServerID, "", 0, false, []wgtypes.PeerConfig{peerCfg}); err != nil {
+		return err
+	}
+	if err := AddSiteRoutes(wg, client); err != nil {
+		return err
+	}
+	if !client.RateLimit().IsZero() {
+		if err := wg.SetRateLimit(client.ServerID, client.TunnelAddress(), client.RateLimit()); err != nil {
+			return fmt.Errorf("apply rate limit: %w", err)
+		}
+	}
+	if err := AttachPendingPeer(wg, client); err != nil {
+		return err
+	}
+	client.IsActive = true
+	return nil
+}
+
+// DetachPeer снимает пир клиента с интерфейса сервера вместе с маршрутами и
+// ограничениями скорости
+func DetachPeer(wg *wireguard.Service, client *Client) error {
+	if err := wg.RemovePeer(client.ServerID, client.PublicKey); err != nil {
+		return err
+	}
+	if err := RemovePendingPeer(wg, client); err != nil {
+		log.Printf("не удалось снять новый пир клиента %s: %v", client.Name, err)
+	}
+	if err := RemoveSiteRoutes(wg, client); err != nil {
+		log.Printf("не удалось удалить маршруты площадки %s: %v", client.Name, err)
+	}
+	if !client.RateLimit().IsZero() {
+		if err := wg.ClearRateLimit(client.ServerID, client.TunnelAddress()); err != nil {
+			log.Printf("не удалось снять ограничение скорости клиента %s: %v", client.Name, err)
+		}
+	}
+	client.IsActive = false
+	client.ResetCounters()
+	return nil
+}
+
+// AddSiteRoutes направляет сети площадки в интерфейс ее сервера
+func AddSiteRoutes(wg *wireguard.Service, client *Client) error {
+	networks, err := client.SiteNetworks()
+	if err != nil {
+		return err
+	}
+	if err := wg.AddRoutes(client.ServerID, networks); err != nil {
+		return fmt.Errorf("add site routes: %w", err)
+	}
+	return nil
+}
+
+// RemoveSiteRoutes удаляет маршруты сетей площадки
+func RemoveSiteRoutes(wg *wireguard.Service, client *Client) error {
+	networks, err := client.SiteNetworks()
+	if err != nil {
+		return err
+	}
+	return wg.RemoveRoutes(client.ServerID, networks)
+}
+
+// SiteRoutes сети подключенных площадок из clients — маршруты, которые
+// должны быть на интерфейсе сервера
+func SiteRoutes(clients []*Client) ([]net.IPNet, error) {
+	var networks []net.IPNet
+	for _, client := range clients {
+		if !client.ShouldBeConnected() {
+			continue
+		}
+		siteNetworks, err := client.SiteNetworks()
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		networks = append(networks, siteNetworks...)
+	}
+	return networks, nil
+}
+
+// ResetCounters сбрасывает снимок счетчиков пира после его удаления с интерфейса
+func (c *Client) ResetCounters() {
+	c.CounterRx = 0
+	c.CounterTx = 0
 }
 
 // Stats представляет статистику по клиентам
@@ -50,13 +340,20 @@ type Stats struct {
 	ActiveClients   int `json:"active_clients"`
 	DisabledClients int `json:"disabled_clients"`
 	DownloadedCount int `json:"downloaded_count"`
+	OverQuotaCount  int `json:"over_quota_count"`
+	OutdatedCount   int `json:"outdated_config_count"`
 }
 
 // Storage представляет хранилище данных
 type Storage struct {
-	Servers map[string]*Server
-	Clients map[string]*Client
-	mu      sync.RWMutex
+	Servers  map[string]*Server
+	Clients  map[string]*Client
+	Groups   map[string]*Group
+	Webhooks map[string]*WebhookSubscription
+	mu       sync.RWMutex
+	persist  *persistence
+
+	deadLetters []WebhookDeadLetter
 }
 
 // Глобальное хранилище данных
@@ -65,8 +362,10 @@ var GlobalStorage *Storage
 // InitStorage инициализирует глобальное хранилище, синхронизируя его с состоянием системы
 func InitStorage(wgService *wireguard.Service) error {
 	GlobalStorage = &Storage{
-		Servers: make(map[string]*Server),
-		Clients: make(map[string]*Client),
+		Servers:  make(map[string]*Server),
+		Clients:  make(map[string]*Client),
+		Groups:   make(map[string]*Group),
+		Webhooks: make(map[string]*WebhookSubscription),
 	}
 
 	if wgService == nil {
@@ -83,8 +382,18 @@ func InitStorage(wgService *wireguard.Service) error {
 		server := convertDeviceToServer(device, now)
 		GlobalStorage.Servers[server.ID] = server
 
+		limits, err := wgService.RateLimits(device.Name)
+		if err != nil {
+			log.Printf("не удалось прочитать ограничения скорости %s: %v", device.Name, err)
+		}
+
 		for _, peer := range device.Peers {
 			client := convertPeerToClient(server.ID, &peer, now)
+			if minor, err := wireguard.AddressMinor(client.TunnelAddress()); err == nil {
+				limit := limits[minor]
+				client.IngressKbit = limit.IngressKbit
+				client.EgressKbit = limit.EgressKbit
+			}
 			GlobalStorage.Clients[client.ID] = client
 		}
 	}
@@ -103,10 +412,12 @@ func GenerateClientID() string {
 }
 
 // AddServer добавляет сервер в хранилище
-func (s *Storage) AddServer(server *Server) {
+func (s *Storage) AddServer(server *Server) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	server.Version = 1
 	s.Servers[server.ID] = server
+	return s.commit(func() { delete(s.Servers, server.ID) })
 }
 
 // GetServer получает сервер по ID
@@ -117,12 +428,37 @@ func (s *Storage) GetServer(id string) (*Server, bool) {
 	return server, exists
 }
 
+// CopyServer возвращает копию сервера, которую можно менять без влияния на хранилище
+func (s *Storage) CopyServer(id string) (Server, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	server, exists := s.Servers[id]
+	if !exists {
+		return Server{}, false
+	}
+	return *server, true
+}
+
+// CopyServers возвращает копии всех серверов, упорядоченные по ID
+func (s *Storage) CopyServers() []Server {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	servers := make([]Server, 0, len(s.Servers))
+	for _, server := range s.Servers {
+		servers = append(servers, *server)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+	return servers
+}
+
 // UpdateServer обновляет сервер
 func (s *Storage) UpdateServer(server *Server) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	server.UpdatedAt = time.Now()
+	server.Version = s.nextServerVersion(server)
 	s.Servers[server.ID] = server
+	s.changed()
 }
 
 // DeleteServer удаляет сервер
@@ -130,13 +466,28 @@ func (s *Storage) DeleteServer(id string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.Servers, id)
+	s.changed()
 }
 
 // AddClient добавляет клиента в хранилище
-func (s *Storage) AddClient(client *Client) {
+func (s *Storage) AddClient(client *Client) error {
+	return s.AddClients([]*Client{client})
+}
+
+// AddClients добавляет клиентов одной записью файла состояния: все вместе
+// или ни одного
+func (s *Storage) AddClients(clients []*Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.Clients[client.ID] = client
+	for _, client := range clients {
+		client.Version = 1
+		s.Clients[client.ID] = client
+	}
+	return s.commit(func() {
+		for _, client := range clients {
+			delete(s.Clients, client.ID)
+		}
+	})
 }
 
 // GetClient получает клиента по ID
@@ -147,12 +498,30 @@ func (s *Storage) GetClient(id string) (*Client, bool) {
 	return client, exists
 }
 
-// UpdateClient обновляет клиента
-func (s *Storage) UpdateClient(client *Client) {
+// CopyClient возвращает копию клиента, которую можно менять без влияния на хранилище
+func (s *Storage) CopyClient(id string) (Client, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	client, exists := s.Clients[id]
+	if !exists {
+		return Client{}, false
+	}
+	return *client, true
+}
+
+// UpdateClient обновляет клиента. Удаленный клиент не возвращается:
+// возвращается ErrRecordNotFound.
+func (s *Storage) UpdateClient(client *Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if _, ok := s.Clients[client.ID]; !ok {
+		return ErrRecordNotFound
+	}
 	client.UpdatedAt = time.Now()
+	client.Version = s.nextClientVersion(client)
 	s.Clients[client.ID] = client
+	s.changed()
+	return nil
 }
 
 // DeleteClient удаляет клиента
@@ -160,13 +529,30 @@ func (s *Storage) DeleteClient(id string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.Clients, id)
+	s.changed()
+}
+
+// CopyClients возвращает копии всех клиентов, упорядоченные по ID
+func (s *Storage) CopyClients() []Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clients := make([]Client, 0, len(s.Clients))
+	for _, client := range s.Clients {
+		clients = append(clients, *client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
 }
 
 // GetAllClients получает всех клиентов
 func (s *Storage) GetAllClients() map[string]*Client {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.Clients
+	result := make(map[string]*Client, len(s.Clients))
+	for id, client := range s.Clients {
+		result[id] = client
+	}
+	return result
 }
 
 // GetClientsByServerID получает клиентов по ID сервера
@@ -182,6 +568,18 @@ func (s *Storage) GetClientsByServerID(serverID string) map[string]*Client {
 	return result
 }
 
+// FindClientByPublicKey ищет клиента сервера по публичному ключу пира
+func (s *Storage) FindClientByPublicKey(serverID, publicKey string) (*Client, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, client := range s.Clients {
+		if client.ServerID == serverID && client.PublicKey == publicKey {
+			return client, true
+		}
+	}
+	return nil, false
+}
+
 // GetStats возвращает статистику
 func (s *Storage) GetStats() Stats {
 	s.mu.RLock()
@@ -199,6 +597,12 @@ func (s *Storage) GetStats() Stats {
 		if client.Downloaded {
 			stats.DownloadedCount++
 		}
+		if client.QuotaExceeded {
+			stats.OverQuotaCount++
+		}
+		if client.ConfigOutdated {
+			stats.OutdatedCount++
+		}
 	}
 
 	return stats
@@ -229,18 +633,25 @@ func convertPeerToClient(serverID string, peer *wgtypes.Peer, ts time.Time) *Cli
 	}
 
 	client := &Client{
-		ID:         GenerateClientID(),
-		ServerID:   serverID,
-		Name:       peer.PublicKey.String(),
-		PublicKey:  peer.PublicKey.String(),
-		AllowedIPs: strings.Join(allowed, ", "),
-		IsActive:   true,
-		CreatedAt:  ts,
-		UpdatedAt:  ts,
+		ID:            GenerateClientID(),
+		ServerID:      serverID,
+		Name:          peer.PublicKey.String(),
+		PublicKey:     peer.PublicKey.String(),
+		AllowedIPs:    strings.Join(allowed, ", "),
+		IsActive:      true,
+		CreatedAt:     ts,
+		UpdatedAt:     ts,
+		ReceiveBytes:  peer.ReceiveBytes,
+		TransmitBytes: peer.TransmitBytes,
+		CounterRx:     peer.ReceiveBytes,
+		CounterTx:     peer.TransmitBytes,
 	}
 
 	if peer.LastHandshakeTime.IsZero() {
 		client.IsActive = false
+	} else {
+		handshake := peer.LastHandshakeTime
+		client.LastHandshake = &handshake
 	}
 
 	return client
@@ -0,0 +1,387 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sealer шифрует секреты перед записью на диск и расшифровывает при чтении
+type Sealer interface {
+	Seal(plaintext string) (string, error)
+	Open(sealed string) (string, error)
+}
+
+// snapshotVersion версия формата файла состояния
+const snapshotVersion = 1
+
+// snapshot содержимое файла состояния. Приватные ключи и секреты подписок
+// в нем зашифрованы.
+type snapshot struct {
+	Version  int                    `json:"version"`
+	SavedAt  time.Time              `json:"saved_at"`
+	Servers  []*Server              `json:"servers"`
+	Clients  []*Client              `json:"clients"`
+	Groups   []*Group               `json:"groups,omitempty"`
+	Webhooks []*WebhookSubscription `json:"webhooks,omitempty"`
+
+	WebhookDeadLetters []WebhookDeadLetter `json:"webhook_dead_letters,omitempty"`
+}
+
+type persistence struct {
+	path   string
+	sealer Sealer
+}
+
+// EnablePersistence загружает состояние из файла path, дополняя им данные,
+// прочитанные с интерфейсов, и дальше сохраняет файл после каждого изменения.
+// Без sealer приватные ключи записываются открытым текстом.
+func (s *Storage) EnablePersistence(path string, sealer Sealer) error {
+	snap, err := readSnapshot(path, sealer)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if snap != nil {
+		s.mergeSnapshot(snap)
+	}
+	s.persist = &persistence{path: path, sealer: sealer}
+	return s.saveLocked()
+}
+
+// Flush принудительно записывает состояние в файл
+func (s *Storage) Flush() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.saveLocked()
+}
+
+// ResealStateFile перешифровывает приватные ключи в файле состояния текущим
+// мастер-ключом sealer. Возвращает число перешифрованных ключей.
+func ResealStateFile(path string, sealer Sealer) (int, error) {
+	snap, err := readSnapshot(path, sealer)
+	if err != nil {
+		return 0, err
+	}
+	if snap == nil {
+		return 0, fmt.Errorf("state file %s not found", path)
+	}
+
+	count := 0
+	for _, server := range snap.Servers {
+		if server.PrivateKey != "" {
+			count++
+		}
+	}
+	for _, client := range snap.Clients {
+		if client.PrivateKey != "" {
+			count++
+		}
+		if client.PendingPrivateKey != "" {
+			count++
+		}
+	}
+	for _, sub := range snap.Webhooks {
+		if sub.Secret != "" {
+			count++
+		}
+	}
+	return count, writeSnapshot(path, sealer, snap)
+}
+
+// mergeSnapshot объединяет сохраненное состояние с прочитанным с интерфейсов.
+// Ключи и счетчики берутся с интерфейса, остальные поля — из файла.
+func (s *Storage) mergeSnapshot(snap *snapshot) {
+	for _, saved := range snap.Servers {
+		if live, ok := s.Servers[saved.ID]; ok {
+			saved.PrivateKey = live.PrivateKey
+			saved.PublicKey = live.PublicKey
+			saved.ListenPort = live.ListenPort
+			saved.IsActive = live.IsActive
+		} else {
+			saved.IsActive = false
+		}
+		s.Servers[saved.ID] = saved
+	}
+
+	for _, saved := range snap.Clients {
+		// Пир с новым ключом во время смены ключей тоже принадлежит этому клиенту
+		var live *Client
+		for id, client := range s.Clients {
+			if client.ServerID != saved.ServerID {
+				continue
+			}
+			switch client.PublicKey {
+			case saved.PublicKey:
+				live = client
+				delete(s.Clients, id)
+			case saved.PendingPublicKey:
+				delete(s.Clients, id)
+			}
+		}
+
+		if live != nil {
+			saved.IsActive = live.IsActive
+			saved.LastHandshake = live.LastHandshake
+			saved.CounterRx = live.CounterRx
+			saved.CounterTx = live.CounterTx
+		} else {
+			saved.IsActive = false
+			saved.ResetCounters()
+		}
+		s.Clients[saved.ID] = saved
+	}
+
+	for _, group := range snap.Groups {
+		s.Groups[group.Name] = group
+	}
+	for _, sub := range snap.Webhooks {
+		s.Webhooks[sub.ID] = sub
+	}
+	s.deadLetters = snap.WebhookDeadLetters
+}
+
+// ErrNotSaved изменение не записано в файл состояния и отменено в памяти
+var ErrNotSaved = errors.New("state not saved")
+
+// changed сохраняет состояние после изменения, ошибка записи только
+// попадает в журнал. Вызывается под блокировкой.
+func (s *Storage) changed() {
+	if err := s.saveLocked(); err != nil {
+		log.Printf("не удалось сохранить состояние: %v", err)
+	}
+}
+
+// commit сохраняет состояние после изменения. Если файл записать не удалось,
+// undo возвращает прежние записи в памяти, а ошибка возвращается
+// вызывающему, чтобы тот отменил изменение интерфейса. Вызывается под
+// блокировкой.
+func (s *Storage) commit(undo func()) error {
+	if err := s.saveLocked(); err != nil {
+		undo()
+		return fmt.Errorf("%w: %v", ErrNotSaved, err)
+	}
+	return nil
+}
+
+func (s *Storage) saveLocked() error {
+	if s.persist == nil {
+		return nil
+	}
+
+	snap := &snapshot{}
+	snap.Servers, snap.Clients = s.copyLocked()
+	for _, group := range s.Groups {
+		copied := *group
+		snap.Groups = append(snap.Groups, &copied)
+	}
+	for _, sub := range s.Webhooks {
+		copied := *sub
+		snap.Webhooks = append(snap.Webhooks, &copied)
+	}
+	snap.WebhookDeadLetters = append([]WebhookDeadLetter(nil), s.deadLetters...)
+	return writeSnapshot(s.persist.path, s.persist.sealer, snap)
+}
+
+// Snapshot возвращает копии всех серверов и клиентов
+func (s *Storage) Snapshot() ([]*Server, []*Client) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.copyLocked()
+}
+
+// ReplaceServer сохраняет сервер и заменяет всех его клиентов на clients
+func (s *Storage) ReplaceServer(server *Server, clients []*Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Версии восстановленных записей должны быть больше прежних, чтобы
+	// выданные до восстановления ETag перестали совпадать
+	server.Version = s.nextServerVersion(server)
+	previous, existed := s.Servers[server.ID]
+	s.Servers[server.ID] = server
+	replaced := make(map[string]*Client)
+	for id, client := range s.Clients {
+		if client.ServerID == server.ID {
+			replaced[id] = client
+			delete(s.Clients, id)
+		}
+	}
+	for _, client := range clients {
+		if old, ok := replaced[client.ID]; ok && old.Version > client.Version {
+			client.Version = old.Version
+		}
+		client.Version++
+		s.Clients[client.ID] = client
+	}
+	return s.commit(func() {
+		for _, client := range clients {
+			delete(s.Clients, client.ID)
+		}
+		for id, client := range replaced {
+			s.Clients[id] = client
+		}
+		if existed {
+			s.Servers[server.ID] = previous
+		} else {
+			delete(s.Servers, server.ID)
+		}
+	})
+}
+
+// ReplaceGroups заменяет все группы
+func (s *Storage) ReplaceGroups(groups []*Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Groups = make(map[string]*Group, len(groups))
+	for _, group := range groups {
+		s.Groups[group.Name] = group
+	}
+	s.changed()
+}
+
+func (s *Storage) copyLocked() ([]*Server, []*Client) {
+	servers := make([]*Server, 0, len(s.Servers))
+	for _, server := range s.Servers {
+		copied := *server
+		servers = append(servers, &copied)
+	}
+	clients := make([]*Client, 0, len(s.Clients))
+	for _, client := range s.Clients {
+		copied := *client
+		clients = append(clients, &copied)
+	}
+	return servers, clients
+}
+
+func readSnapshot(path string, sealer Sealer) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state file: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("parse state file: %w", err)
+	}
+	if snap.Version > snapshotVersion {
+		return nil, fmt.Errorf("state file version %d is newer than supported %d", snap.Version, snapshotVersion)
+	}
+
+	open := func(value string) (string, error) {
+		if sealer == nil {
+			if isSealedValue(value) {
+				return "", errors.New("state file contains encrypted keys but no master key is configured")
+			}
+			return value, nil
+		}
+		return sealer.Open(value)
+	}
+	for _, server := range snap.Servers {
+		if server.PrivateKey, err = open(server.PrivateKey); err != nil {
+			return nil, fmt.Errorf("server %s: %w", server.ID, err)
+		}
+	}
+	for _, client := range snap.Clients {
+		if client.PrivateKey, err = open(client.PrivateKey); err != nil {
+			return nil, fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		if client.PendingPrivateKey, err = open(client.PendingPrivateKey); err != nil {
+			return nil, fmt.Errorf("client %s: %w", client.ID, err)
+		}
+	}
+	for _, sub := range snap.Webhooks {
+		if sub.Secret, err = open(sub.Secret); err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", sub.ID, err)
+		}
+	}
+	return &snap, nil
+}
+
+// writeSnapshot шифрует ключи и атомарно заменяет файл состояния
+func writeSnapshot(path string, sealer Sealer, snap *snapshot) error {
+	snap.Version = snapshotVersion
+	snap.SavedAt = time.Now()
+
+	seal := func(value string) (string, error) {
+		if sealer == nil {
+			return value, nil
+		}
+		return sealer.Seal(value)
+	}
+
+	var err error
+	for i, server := range snap.Servers {
+		copied := *server
+		if copied.PrivateKey, err = seal(server.PrivateKey); err != nil {
+			return fmt.Errorf("server %s: %w", server.ID, err)
+		}
+		snap.Servers[i] = &copied
+	}
+	for i, client := range snap.Clients {
+		copied := *client
+		if copied.PrivateKey, err = seal(client.PrivateKey); err != nil {
+			return fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		if copied.PendingPrivateKey, err = seal(client.PendingPrivateKey); err != nil {
+			return fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		snap.Clients[i] = &copied
+	}
+	for i, sub := range snap.Webhooks {
+		copied := *sub
+		if copied.Secret, err = seal(sub.Secret); err != nil {
+			return fmt.Errorf("webhook %s: %w", sub.ID, err)
+		}
+		snap.Webhooks[i] = &copied
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close state file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return fmt.Errorf("chmod state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+	return nil
+}
+
+// isSealedValue распознает значения, зашифрованные пакетом secrets
+func isSealedValue(value string) bool {
+	return len(value) > 4 && value[:4] == "enc:"
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wireguard-web-manager/secrets"
+)
+
+func newTestStorage() *Storage {
+	return &Storage{
+		Servers:  make(map[string]*Server),
+		Clients:  make(map[string]*Client),
+		Groups:   make(map[string]*Group),
+		Webhooks: make(map[string]*WebhookSubscription),
+	}
+}
+
+func testKeyring(t *testing.T, versions ...int) *secrets.Keyring {
+	t.Helper()
+	var entries []string
+	for _, version := range versions {
+		key := make([]byte, 32)
+		for i := range key {
+			key[i] = byte(version)
+		}
+		entries = append(entries, strconv.Itoa(version)+":"+base64.StdEncoding.EncodeToString(key))
+	}
+	keyring, err := secrets.ParseKeyring(strings.Join(entries, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+// sealedValues возвращает все зашифрованные значения файла состояния
+func sealedValues(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case string:
+			if secrets.IsSealed(v) {
+				values = append(values, v)
+			}
+		}
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	walk(doc)
+	return values
+}
+
+func TestResealStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	storage := newTestStorage()
+	if err := storage.EnablePersistence(path, testKeyring(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+	storage.AddServer(&Server{ID: "wg0", Name: "office", PrivateKey: "server-private"})
+	storage.AddClient(&Client{ID: "laptop", ServerID: "wg0", PrivateKey: "client-private", PublicKey: "client-public"})
+	storage.SetWebhookSubscription(WebhookSubscription{ID: "hook", URL: "https://example.com", Secret: "hook-secret", CreatedAt: time.Now()})
+
+	data, _ := os.ReadFile(path)
+	for _, plain := range []string{"server-private", "client-private", "hook-secret"} {
+		if strings.Contains(string(data), plain) {
+			t.Fatalf("%s written in plain text", plain)
+		}
+	}
+
+	count, err := ResealStateFile(path, testKeyring(t, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("resealed %d values, want 3", count)
+	}
+	values := sealedValues(t, path)
+	if len(values) != 3 {
+		t.Fatalf("found %d sealed values, want 3", len(values))
+	}
+	for _, value := range values {
+		if version, _ := secrets.SealedVersion(value); version != 2 {
+			t.Errorf("value sealed with version %d after reseal", version)
+		}
+	}
+
+	// Старый ключ больше не нужен
+	reopened := newTestStorage()
+	if err := reopened.EnablePersistence(path, testKeyring(t, 2)); err != nil {
+		t.Fatalf("reopen with the new key only: %v", err)
+	}
+	server, _ := reopened.CopyServer("wg0")
+	client, _ := reopened.CopyClient("laptop")
+	subs := reopened.WebhookSubscriptions()
+	if server.PrivateKey != "server-private" || client.PrivateKey != "client-private" || len(subs) != 1 || subs[0].Secret != "hook-secret" {
+		t.Errorf("reopened %q, %q, %+v", server.PrivateKey, client.PrivateKey, subs)
+	}
+
+	if err := newTestStorage().EnablePersistence(path, testKeyring(t, 1)); err == nil {
+		t.Error("state opened with the retired key")
+	}
+}
+
+func TestResealStateFileMissing(t *testing.T) {
+	if _, err := ResealStateFile(filepath.Join(t.TempDir(), "state.json"), testKeyring(t, 1)); err == nil {
+		t.Error("resealed a missing state file")
+	}
+}
+
+func TestWebhookDeadLettersPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	storage := newTestStorage()
+	if err := storage.EnablePersistence(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	storage.SetWebhookDeadLetters([]WebhookDeadLetter{{
+		ID:             "letter",
+		SubscriptionID: "hook",
+		Event:          WebhookEvent{ID: "event", Type: "client.created", Data: map[string]string{"name": "laptop"}},
+		Attempts:       5,
+		LastError:      "unexpected status 503",
+	}})
+
+	reopened := newTestStorage()
+	if err := reopened.EnablePersistence(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	letters := reopened.WebhookDeadLetters()
+	if len(letters) != 1 || letters[0].ID != "letter" || letters[0].Event.ID != "event" || letters[0].Attempts != 5 {
+		t.Fatalf("reopened dead letters %+v", letters)
+	}
+	if data, ok := letters[0].Event.Data.(map[string]interface{}); !ok || data["name"] != "laptop" {
+		t.Errorf("event data %#v", letters[0].Event.Data)
+	}
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Размер страницы списка клиентов
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Поля сортировки клиентов; префикс "-" задает обратный порядок
+const (
+	SortName          = "name"
+	SortEmail         = "email"
+	SortAddress       = "address"
+	SortCreated       = "created"
+	SortLastHandshake = "last_handshake"
+	SortTraffic       = "traffic"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ClientFilter условия отбора клиентов. Пустые поля не ограничивают выборку.
+type ClientFilter struct {
+	ServerID string
+	Search   string // подстрока имени, email, адреса или открытого ключа
+	Tag      string
+	Statuses []string // любое из состояний Status()
+}
+
+// Matches проверяет, подходит ли клиент под условия
+func (f *ClientFilter) Matches(client *Client) bool {
+	if f.ServerID != "" && client.ServerID != f.ServerID {
+		return false
+	}
+	if f.Tag != "" && !client.HasTag(strings.ToLower(f.Tag)) {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(client.Name), search) &&
+			!strings.Contains(strings.ToLower(client.Email), search) &&
+			!strings.Contains(client.AllowedIPs, search) &&
+			!strings.Contains(strings.ToLower(client.PublicKey), search) {
+			return false
+		}
+	}
+	if len(f.Statuses) > 0 {
+		status := client.Status()
+		for _, wanted := range f.Statuses {
+			if wanted == status {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ValidStatus проверяет название состояния клиента
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusActive, StatusDisabled, StatusExpired, StatusQuotaExceeded, StatusOutsideSchedule:
+		return true
+	}
+	return false
+}
+
+// ClientQuery запрос страницы списка клиентов
+type ClientQuery struct {
+	Filter ClientFilter
+	Sort   string // поле сортировки, по умолчанию name
+	Limit  int    // по умолчанию DefaultPageSize
+	Cursor string // NextCursor предыдущей страницы
+}
+
+// ClientPage страница списка клиентов
+type ClientPage struct {
+	Items      []Client // копии без приватных ключей
+	Total      int      // число клиентов, подходящих под фильтр
+	NextCursor string   // пусто на последней странице
+}
+
+// sortKey значение поля сортировки клиента; при равенстве порядок задает ID
+type sortKey struct {
+	Num int64  `json:"n,omitempty"`
+	Str string `json:"s,omitempty"`
+	ID  string `json:"id"`
+}
+
+// cursor позиция последнего клиента страницы
+type cursor struct {
+	Sort string `json:"sort"`
+	sortKey
+}
+
+func (a sortKey) less(b sortKey) bool {
+	if a.Num != b.Num {
+		return a.Num < b.Num
+	}
+	if a.Str != b.Str {
+		return a.Str < b.Str
+	}
+	return a.ID < b.ID
+}
+
+func clientSortKey(client *Client, field string) sortKey {
+	key := sortKey{ID: client.ID}
+	switch field {
+	case SortEmail:
+		key.Str = strings.ToLower(client.Email)
+	case SortAddress:
+		// IPv4 упорядочиваются численно, остальные адреса — после них по строке
+		ip := net.ParseIP(strings.Split(client.TunnelAddress(), "/")[0])
+		if ip4 := ip.To4(); ip4 != nil {
+			key.Num = int64(binary.BigEndian.Uint32(ip4))
+		} else {
+			key.Num = 1 << 32
+			key.Str = client.TunnelAddress()
+		}
+	case SortCreated:
+		key.Num = client.CreatedAt.UnixNano()
+	case SortLastHandshake:
+		if client.LastHandshake != nil {
+			key.Num = client.LastHandshake.UnixNano()
+		}
+	case SortTraffic:
+		key.Num = client.ReceiveBytes + client.TransmitBytes
+	default:
+		key.Str = strings.ToLower(client.Name)
+	}
+	return key
+}
+
+// ValidSort проверяет поле сортировки с необязательным префиксом "-"
+func ValidSort(value string) bool {
+	switch strings.TrimPrefix(value, "-") {
+	case "", SortName, SortEmail, SortAddress, SortCreated, SortLastHandshake, SortTraffic:
+		return true
+	}
+	return false
+}
+
+// QueryClients возвращает страницу клиентов, отобранных фильтром и
+// упорядоченных по полю сортировки. Курсор указывает на последнего клиента
+// предыдущей страницы, поэтому добавление и удаление клиентов между запросами
+// не приводит к пропускам и повторам.
+func (s *Storage) QueryClients(q ClientQuery) (ClientPage, error) {
+	if !ValidSort(q.Sort) {
+		return ClientPage{}, fmt.Errorf("unknown sort field %q", q.Sort)
+	}
+	sortField := q.Sort
+	if sortField == "" {
+		sortField = SortName
+	}
+	desc := strings.HasPrefix(sortField, "-")
+	field := strings.TrimPrefix(sortField, "-")
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	var after *sortKey
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != sortField {
+			return ClientPage{}, ErrInvalidCursor
+		}
+		after = &c.sortKey
+	}
+
+	type entry struct {
+		key    sortKey
+		client *Client
+	}
+
+	s.mu.RLock()
+	entries := make([]entry, 0)
+	for _, client := range s.Clients {
+		if q.Filter.Matches(client) {
+			entries = append(entries, entry{key: clientSortKey(client, field), client: client})
+		}
+	}
+	before := func(a, b sortKey) bool {
+		if desc {
+			return b.less(a)
+		}
+		return a.less(b)
+	}
+	sort.Slice(entries, func(i, j int) bool { return before(entries[i].key, entries[j].key) })
+
+	page := ClientPage{Total: len(entries), Items: make([]Client, 0, limit)}
+	start := 0
+	if after != nil {
+		start = sort.Search(len(entries), func(i int) bool { return before(*after, entries[i].key) })
+	}
+	end := start + limit
+	if end > len(entries) {
+		end = len(entries)
+	}
+	for _, item := range entries[start:end] {
+		page.Items = append(page.Items, item.client.Public())
+	}
+	s.mu.RUnlock()
+
+	if end < len(entries) {
+		page.NextCursor = encodeCursor(cursor{Sort: sortField, sortKey: entries[end-1].key})
+	}
+	return page, nil
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
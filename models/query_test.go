@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newQueryStorage хранилище с клиентами, у которых почти по каждому полю
+// сортировки есть совпадающие значения
+func newQueryStorage() *Storage {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		t := base.Add(time.Duration(minutes) * time.Minute)
+		return &t
+	}
+	s := newTestStorage()
+	for _, client := range []*Client{
+		{ID: "c1", Name: "Bob", Email: "b@example.com", AllowedIPs: "10.0.0.10/32", CreatedAt: *at(2), LastHandshake: at(5), ReceiveBytes: 100},
+		{ID: "c2", Name: "alice", Email: "A@example.com", AllowedIPs: "10.0.0.2/32", CreatedAt: *at(1), ReceiveBytes: 25, TransmitBytes: 25},
+		{ID: "c3", Name: "bob", Email: "b@example.com", AllowedIPs: "10.0.0.9/32", CreatedAt: *at(1), LastHandshake: at(5), ReceiveBytes: 40, TransmitBytes: 60},
+		{ID: "c4", Name: "Carol", Email: "c@example.com", AllowedIPs: "10.0.0.3/32", CreatedAt: *at(3)},
+		{ID: "c5", Name: "alice", AllowedIPs: "10.0.0.4/32", CreatedAt: *at(0), LastHandshake: at(1), TransmitBytes: 50},
+		{ID: "c6", Name: "dave", AllowedIPs: "fd00::2/128", CreatedAt: *at(3), LastHandshake: at(2), ReceiveBytes: 300},
+	} {
+		client.ServerID = "wg0"
+		s.Clients[client.ID] = client
+	}
+	return s
+}
+
+// walkClients проходит все страницы списка и возвращает ID клиентов по порядку
+func walkClients(t *testing.T, s *Storage, sort string, limit int) []string {
+	t.Helper()
+	var ids []string
+	q := ClientQuery{Sort: sort, Limit: limit}
+	for pages := 0; ; pages++ {
+		if pages > len(s.Clients) {
+			t.Fatalf("sort %q: pagination does not end", sort)
+		}
+		page, err := s.QueryClients(q)
+		if err != nil {
+			t.Fatalf("sort %q: %v", sort, err)
+		}
+		if page.Total != len(s.Clients) {
+			t.Errorf("sort %q: total %d, want %d", sort, page.Total, len(s.Clients))
+		}
+		if len(page.Items) > limit {
+			t.Errorf("sort %q: page of %d items, limit %d", sort, len(page.Items), limit)
+		}
+		for _, item := range page.Items {
+			ids = append(ids, item.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func reversed(ids []string) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[len(ids)-1-i] = id
+	}
+	return out
+}
+
+func TestQueryClientsSortAndPages(t *testing.T) {
+	s := newQueryStorage()
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		// Совпадающие значения упорядочиваются по ID
+		{SortName, []string{"c2", "c5", "c1", "c3", "c4", "c6"}},
+		{SortEmail, []string{"c5", "c6", "c2", "c1", "c3", "c4"}},
+		// 10.0.0.10 идет после 10.0.0.9, IPv6 — после IPv4
+		{SortAddress, []string{"c2", "c4", "c5", "c3", "c1", "c6"}},
+		{SortCreated, []string{"c5", "c2", "c3", "c1", "c4", "c6"}},
+		// Клиенты без рукопожатия идут первыми
+		{SortLastHandshake, []string{"c2", "c4", "c5", "c6", "c1", "c3"}},
+		{SortTraffic, []string{"c4", "c2", "c5", "c1", "c3", "c6"}},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 4, 10} {
+			if got := walkClients(t, s, tt.field, limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sort %s, limit %d: %v, want %v", tt.field, limit, got, tt.want)
+			}
+			if got, want := walkClients(t, s, "-"+tt.field, limit), reversed(tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("sort -%s, limit %d: %v, want %v", tt.field, limit, got, want)
+			}
+		}
+	}
+	if got := walkClients(t, s, "", 4); !reflect.DeepEqual(got, tests[0].want) {
+		t.Errorf("default sort: %v, want name order", got)
+	}
+}
+
+func TestQueryClientsPrivateKeys(t *testing.T) {
+	s := newQueryStorage()
+	s.Clients["c1"].PrivateKey = "secret"
+	page, err := s.QueryClients(ClientQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range page.Items {
+		if item.PrivateKey != "" {
+			t.Errorf("client %s listed with its private key", item.ID)
+		}
+	}
+}
+
+func TestQueryClientsChangesBetweenPages(t *testing.T) {
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{SortName, []string{"c2", "c5", "c1", "c4", "c6", "zed"}},
+		{"-" + SortName, []string{"c6", "c4", "c1", "c5", "c2", "aaron"}},
+	}
+	for _, tt := range tests {
+		s := newQueryStorage()
+		page, err := s.QueryClients(ClientQuery{Sort: tt.sort, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{page.Items[0].ID, page.Items[1].ID}
+
+		// Между страницами добавлены клиенты в начало и в конец списка,
+		// удалены еще не показанный клиент и последний показанный клиент
+		s.Clients["aaron"] = &Client{ID: "aaron", Name: "aaron"}
+		s.Clients["zed"] = &Client{ID: "zed", Name: "zed"}
+		delete(s.Clients, "c3")
+		delete(s.Clients, page.Items[1].ID)
+
+		for cursor := page.NextCursor; cursor != ""; cursor = page.NextCursor {
+			page, err = s.QueryClients(ClientQuery{Sort: tt.sort, Limit: 2, Cursor: cursor})
+			if err != nil {
+				t.Fatalf("sort %s: %v", tt.sort, err)
+			}
+			for _, item := range page.Items {
+				got = append(got, item.ID)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort %s: %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestQueryClientsInvalidCursor(t *testing.T) {
+	s := newQueryStorage()
+	page, err := s.QueryClients(ClientQuery{Sort: SortName, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"not base64", SortName, "not a cursor!"},
+		{"not json", SortName, base64.RawURLEncoding.EncodeToString([]byte("name:c5"))},
+		{"other field", SortEmail, page.NextCursor},
+		{"other direction", "-" + SortName, page.NextCursor},
+		{"default sort", "", encodeCursor(cursor{Sort: SortEmail, sortKey: sortKey{ID: "c1"}})},
+	}
+	for _, tt := range tests {
+		if _, err := s.QueryClients(ClientQuery{Sort: tt.sort, Cursor: tt.cursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+
+	// Курсор без явной сортировки совпадает с курсором сортировки по имени
+	if _, err := s.QueryClients(ClientQuery{Cursor: page.NextCursor}); err != nil {
+		t.Errorf("name cursor with default sort: %v", err)
+	}
+	if _, err := s.QueryClients(ClientQuery{Sort: "size"}); err == nil || errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("unknown sort field: got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"wireguard-web-manager/wireguard"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// RotationPending сообщает, выполняется ли смена ключей клиента
+func (c *Client) RotationPending() bool {
+	return c.PendingPublicKey != ""
+}
+
+// ConfigPrivateKey ключ для выдаваемой клиенту конфигурации: во время смены
+// ключей клиент получает уже новый ключ
+func (c *Client) ConfigPrivateKey() string {
+	if c.RotationPending() {
+		return c.PendingPrivateKey
+	}
+	return c.PrivateKey
+}
+
+// BeginKeyRotation начинает смену ключей клиента. Новый пир добавляется на
+// интерфейс без адресов, поэтому старая конфигурация продолжает работать до
+// завершения смены. privateKey пуст, если ключ сгенерирован самим клиентом.
+func BeginKeyRotation(wg *wireguard.Service, client *Client, privateKey, publicKey string, deadline time.Time) error {
+	if client.RotationPending() {
+		return errors.New("key rotation is already in progress")
+	}
+
+	client.PendingPrivateKey = privateKey
+	client.PendingPublicKey = publicKey
+	client.RotationDeadline = &deadline
+
+	if wg != nil && client.ShouldBeConnected() {
+		if err := AttachPendingPeer(wg, client); err != nil {
+			client.PendingPrivateKey = ""
+			client.PendingPublicKey = ""
+			client.RotationDeadline = nil
+			return err
+		}
+	}
+
+	client.ConfigOutdated = true
+	client.Downloaded = false
+	return nil
+}
+
+// CompleteKeyRotation переносит адреса клиента на новый пир, снимает старый
+// и делает новый ключ основным
+func CompleteKeyRotation(wg *wireguard.Service, client *Client) error {
+	if !client.RotationPending() {
+		return errors.New("key rotation is not in progress")
+	}
+
+	if wg != nil && client.ShouldBeConnected() {
+		next := *client
+		next.PublicKey = client.PendingPublicKey
+		peerCfg, err := next.PeerConfig()
+		if err != nil {
+			return err
+		}
+		if err := wg.ConfigureServer(client.ServerID, "", 0, false, []wgtypes.PeerConfig{peerCfg}); err != nil {
+			return fmt.Errorf("move addresses to new peer: %w", err)
+		}
+		if err := wg.RemovePeer(client.ServerID, client.PublicKey); err != nil {
+			return fmt.Errorf("remove old peer: %w", err)
+		}
+	}
+
+	client.PrivateKey = client.PendingPrivateKey
+	client.PublicKey = client.PendingPublicKey
+	client.PendingPrivateKey = ""
+	client.PendingPublicKey = ""
+	client.RotationDeadline = nil
+	client.LastHandshake = nil
+	client.ResetCounters()
+	return nil
+}
+
+// CancelKeyRotation отменяет смену ключей, снимая новый пир с интерфейса
+func CancelKeyRotation(wg *wireguard.Service, client *Client) error {
+	if !client.RotationPending() {
+		return errors.New("key rotation is not in progress")
+	}
+	if wg != nil {
+		if err := RemovePendingPeer(wg, client); err != nil {
+			return err
+		}
+	}
+
+	client.PendingPrivateKey = ""
+	client.PendingPublicKey = ""
+	client.RotationDeadline = nil
+	client.ConfigOutdated = false
+	return nil
+}
+
+// AttachPendingPeer добавляет на интерфейс пир с новым ключом без адресов
+func AttachPendingPeer(wg *wireguard.Service, client *Client) error {
+	if !client.RotationPending() {
+		return nil
+	}
+	peerCfg, err := client.PendingPeerConfig()
+	if err != nil {
+		return err
+	}
+	if err := wg.ConfigureServer(client.ServerID, "", 0, false, []wgtypes.PeerConfig{peerCfg}); err != nil {
+		return fmt.Errorf("add pending peer: %w", err)
+	}
+	return nil
+}
+
+// PendingPeerConfig формирует конфигурацию пира с новым ключом: без адресов,
+// чтобы не отнять их у действующего пира
+func (c *Client) PendingPeerConfig() (wgtypes.PeerConfig, error) {
+	pubKey, err := wgtypes.ParseKey(c.PendingPublicKey)
+	if err != nil {
+		return wgtypes.PeerConfig{}, fmt.Errorf("parse pending public key: %w", err)
+	}
+	keepalive := 25 * time.Second
+	return wgtypes.PeerConfig{
+		PublicKey:                   pubKey,
+		ReplaceAllowedIPs:           true,
+		PersistentKeepaliveInterval: &keepalive,
+	}, nil
+}
+
+// RemovePendingPeer снимает с интерфейса пир с новым ключом
+func RemovePendingPeer(wg *wireguard.Service, client *Client) error {
+	if !client.RotationPending() {
+		return nil
+	}
+	return wg.RemovePeer(client.ServerID, client.PendingPublicKey)
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Schedule задает окна времени, в которые клиенту разрешено подключение
+type Schedule struct {
+	Timezone string           `json:"timezone,omitempty"` // IANA, например Europe/Moscow; пусто — UTC
+	Windows  []ScheduleWindow `json:"windows"`
+}
+
+// ScheduleWindow окно доступа. Если End не позже Start, окно переходит через
+// полночь и заканчивается на следующий день.
+type ScheduleWindow struct {
+	Days  []int  `json:"days"`  // дни недели: 1 — понедельник, ..., 7 — воскресенье; пусто — каждый день
+	Start string `json:"start"` // ЧЧ:ММ
+	End   string `json:"end"`   // ЧЧ:ММ
+}
+
+// Validate проверяет корректность расписания
+func (s *Schedule) Validate() error {
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	if len(s.Windows) == 0 {
+		return errors.New("расписание не содержит ни одного окна")
+	}
+	for i, window := range s.Windows {
+		for _, day := range window.Days {
+			if day < 1 || day > 7 {
+				return fmt.Errorf("окно %d: неверный день недели %d", i+1, day)
+			}
+		}
+		if _, err := parseClock(window.Start); err != nil {
+			return fmt.Errorf("окно %d: %w", i+1, err)
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return fmt.Errorf("окно %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Allows сообщает, попадает ли момент t в одно из окон расписания
+func (s *Schedule) Allows(t time.Time) bool {
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	return s.allowsIn(t, loc)
+}
+
+func (s *Schedule) allowsIn(t time.Time, loc *time.Location) bool {
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := isoWeekday(local)
+	yesterday := today - 1
+	if yesterday == 0 {
+		yesterday = 7
+	}
+
+	for _, window := range s.Windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			continue
+		}
+
+		if start < end {
+			if window.hasDay(today) && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+
+		// Окно через полночь: вечерняя часть относится к сегодняшнему дню,
+		// утренняя — к вчерашнему
+		if window.hasDay(today) && minute >= start {
+			return true
+		}
+		if window.hasDay(yesterday) && minute < end {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange возвращает ближайший момент после t, когда результат Allows
+// изменится, или nil, если в течение недели этого не произойдет
+func (s *Schedule) NextChange(t time.Time) *time.Time {
+	loc, err := s.location()
+	if err != nil {
+		return nil
+	}
+	current := s.allowsIn(t, loc)
+	next := t.Truncate(time.Minute)
+	for i := 0; i < 7*24*60; i++ {
+		next = next.Add(time.Minute)
+		if s.allowsIn(next, loc) != current {
+			return &next
+		}
+	}
+	return nil
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+func (w ScheduleWindow) hasDay(day int) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock переводит время ЧЧ:ММ в минуты от начала суток
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("неверное время %q, ожидается ЧЧ:ММ", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func isoWeekday(t time.Time) int {
+	day := int(t.Weekday())
+	if day == 0 {
+		return 7
+	}
+	return day
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Окна расписаний для тестов. 2024-03-01 — пятница; в Берлине летнее время
+// начинается 2024-03-31 в 01:00 UTC и заканчивается 2024-10-27 в 01:00 UTC.
+var (
+	fridayNight = Schedule{Windows: []ScheduleWindow{{Days: []int{5}, Start: "22:00", End: "06:00"}}}
+	sundayNight = Schedule{Windows: []ScheduleWindow{{Days: []int{7}, Start: "23:00", End: "01:00"}}}
+	tokyoMonday = Schedule{Timezone: "Asia/Tokyo", Windows: []ScheduleWindow{{Days: []int{1}, Start: "07:00", End: "10:00"}}}
+	berlinNight = Schedule{Timezone: "Europe/Berlin", Windows: []ScheduleWindow{{Start: "01:30", End: "02:30"}}}
+	berlinTwice = Schedule{Timezone: "Europe/Berlin", Windows: []ScheduleWindow{{Start: "02:00", End: "02:30"}}}
+	wednesday   = Schedule{Windows: []ScheduleWindow{{Days: []int{3}, Start: "00:00", End: "00:00"}}}
+	always      = Schedule{Windows: []ScheduleWindow{{Start: "00:00", End: "00:00"}}}
+	unknownZone = Schedule{Timezone: "Mars/Olympus", Windows: []ScheduleWindow{{Start: "00:00", End: "00:00"}}}
+)
+
+func utc(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// requireZone пропускает тест, если в системе нет базы часовых поясов
+func requireZone(t *testing.T, schedule Schedule) {
+	t.Helper()
+	if schedule.Timezone == "" || schedule.Timezone == unknownZone.Timezone {
+		return
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		t.Skipf("time zone %s: %v", schedule.Timezone, err)
+	}
+}
+
+func TestScheduleAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		at       string
+		want     bool
+	}{
+		{"before friday window", fridayNight, "2024-03-01T21:59:00Z", false},
+		{"friday window opens", fridayNight, "2024-03-01T22:00:00Z", true},
+		{"saturday morning of friday window", fridayNight, "2024-03-02T05:59:00Z", true},
+		{"friday window closes", fridayNight, "2024-03-02T06:00:00Z", false},
+		{"saturday evening", fridayNight, "2024-03-02T23:00:00Z", false},
+		{"thursday evening", fridayNight, "2024-02-29T23:00:00Z", false},
+		{"monday morning of sunday window", sundayNight, "2024-03-04T00:30:00Z", true},
+		{"tuesday morning", sundayNight, "2024-03-05T00:30:00Z", false},
+		{"tokyo monday while sunday in utc", tokyoMonday, "2024-03-03T22:30:00Z", true},
+		{"tokyo before window", tokyoMonday, "2024-03-03T21:59:00Z", false},
+		{"tokyo window closes", tokyoMonday, "2024-03-04T01:00:00Z", false},
+		{"tokyo tuesday", tokyoMonday, "2024-03-04T22:30:00Z", false},
+		{"berlin before window", berlinNight, "2024-03-31T00:29:00Z", false},
+		{"berlin window opens", berlinNight, "2024-03-31T00:30:00Z", true},
+		{"berlin last minute before dst", berlinNight, "2024-03-31T00:59:00Z", true},
+		{"berlin dst skips window end", berlinNight, "2024-03-31T01:00:00Z", false},
+		{"berlin summer time hour", berlinTwice, "2024-10-27T00:15:00Z", true},
+		{"berlin summer time after window", berlinTwice, "2024-10-27T00:45:00Z", false},
+		{"berlin repeated hour", berlinTwice, "2024-10-27T01:15:00Z", true},
+		{"berlin repeated hour after window", berlinTwice, "2024-10-27T01:30:00Z", false},
+		{"whole day", wednesday, "2024-03-06T12:00:00Z", true},
+		{"day after whole day", wednesday, "2024-03-07T00:00:00Z", false},
+		{"unknown time zone", unknownZone, "2024-03-06T12:00:00Z", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireZone(t, tt.schedule)
+			if got := tt.schedule.Allows(utc(t, tt.at)); got != tt.want {
+				t.Errorf("Allows(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from     string
+		want     string // пусто — изменений нет
+	}{
+		{"friday window opens", fridayNight, "2024-03-01T12:00:00Z", "2024-03-01T22:00:00Z"},
+		{"seconds are truncated", fridayNight, "2024-03-01T21:59:30Z", "2024-03-01T22:00:00Z"},
+		{"friday window closes next day", fridayNight, "2024-03-01T23:00:00Z", "2024-03-02T06:00:00Z"},
+		{"next friday", fridayNight, "2024-03-02T06:00:00Z", "2024-03-08T22:00:00Z"},
+		{"tokyo window opens", tokyoMonday, "2024-03-03T12:00:00Z", "2024-03-03T22:00:00Z"},
+		{"berlin window opens before dst", berlinNight, "2024-03-30T12:00:00Z", "2024-03-31T00:30:00Z"},
+		{"berlin window cut by dst", berlinNight, "2024-03-31T00:45:00Z", "2024-03-31T01:00:00Z"},
+		{"berlin window after dst", berlinNight, "2024-03-31T01:00:00Z", "2024-03-31T23:30:00Z"},
+		{"berlin repeated hour opens", berlinTwice, "2024-10-27T00:45:00Z", "2024-10-27T01:00:00Z"},
+		{"berlin repeated hour closes", berlinTwice, "2024-10-27T01:15:00Z", "2024-10-27T01:30:00Z"},
+		{"always allowed", always, "2024-03-01T12:00:00Z", ""},
+		{"unknown time zone", unknownZone, "2024-03-01T12:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireZone(t, tt.schedule)
+			got := tt.schedule.NextChange(utc(t, tt.from))
+			switch {
+			case tt.want == "" && got != nil:
+				t.Errorf("NextChange(%s) = %v, want none", tt.from, got.UTC())
+			case tt.want != "" && got == nil:
+				t.Errorf("NextChange(%s) = none, want %s", tt.from, tt.want)
+			case tt.want != "" && !got.Equal(utc(t, tt.want)):
+				t.Errorf("NextChange(%s) = %v, want %s", tt.from, got.UTC(), tt.want)
+			}
+		})
+	}
+}
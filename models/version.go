@@ -0,0 +1,240 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrVersionConflict запись изменилась после того, как была прочитана
+var ErrVersionConflict = errors.New("record version conflict")
+
+// ErrRecordNotFound запись удалена после того, как была прочитана
+var ErrRecordNotFound = errors.New("record not found")
+
+// CompareAndUpdateServer сохраняет сервер, только если сохраненная запись еще
+// имеет версию version. Иначе возвращает ErrVersionConflict и ничего не меняет.
+// При смене приватного ключа конфигурации всех клиентов сервера помечаются
+// устаревшими в той же записи файла состояния.
+func (s *Storage) CompareAndUpdateServer(server *Server, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.Servers[server.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	if stored.Version != version {
+		return ErrVersionConflict
+	}
+	now := time.Now()
+	server.UpdatedAt = now
+	server.Version = version + 1
+	s.Servers[server.ID] = server
+
+	outdated := make(map[string]*Client)
+	if server.PrivateKey != stored.PrivateKey {
+		for id, client := range s.Clients {
+			if client.ServerID != server.ID {
+				continue
+			}
+			outdated[id] = client
+			updated := *client
+			updated.ConfigOutdated = true
+			updated.Downloaded = false
+			updated.UpdatedAt = now
+			updated.Version++
+			s.Clients[id] = &updated
+		}
+	}
+	return s.commit(func() {
+		s.Servers[server.ID] = stored
+		for id, client := range outdated {
+			s.Clients[id] = client
+		}
+	})
+}
+
+// CompareAndUpdateClient сохраняет копию client, только если сохраненная
+// запись еще имеет версию version. Запись заменяется целиком, поэтому
+// полученные ранее через GetClient указатели продолжают видеть прежнее
+// состояние и не меняются под читателем.
+func (s *Storage) CompareAndUpdateClient(client *Client, version int64) error {
+	return s.CompareAndUpdateClients([]*Client{client}, []int64{version})
+}
+
+// CompareAndUpdateClients сохраняет копии clients одной записью файла
+// состояния, только если каждый клиент еще имеет версию из versions. Иначе
+// ничего не меняется.
+func (s *Storage) CompareAndUpdateClients(clients []*Client, versions []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := make([]*Client, len(clients))
+	for i, client := range clients {
+		stored, ok := s.Clients[client.ID]
+		if !ok {
+			return ErrRecordNotFound
+		}
+		if stored.Version != versions[i] {
+			return ErrVersionConflict
+		}
+		previous[i] = stored
+	}
+	now := time.Now()
+	for i, client := range clients {
+		client.UpdatedAt = now
+		client.Version = versions[i] + 1
+		updated := *client
+		s.Clients[client.ID] = &updated
+	}
+	return s.commit(func() {
+		for _, stored := range previous {
+			s.Clients[stored.ID] = stored
+		}
+	})
+}
+
+// RecordClientUsage сохраняет учет трафика клиентов одним изменением файла
+// состояния: переносит в сохраненные записи счетчики, трафик и время
+// рукопожатия. Клиенты, удаленные или измененные после чтения, пропускаются.
+// Версия и UpdatedAt не меняются: учет трафика не считается правкой клиента и
+// не должен мешать изменениям с If-Match. Правка, прочитанная до учета,
+// вернет прежние счетчики вместе с прежним трафиком, и следующий проход
+// учтет тот же прирост заново. Возвращает копии сохраненных записей.
+func (s *Storage) RecordClientUsage(clients []Client) []Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := make([]Client, 0, len(clients))
+	previous := make([]*Client, 0, len(clients))
+	for i := range clients {
+		usage := &clients[i]
+		stored, ok := s.Clients[usage.ID]
+		if !ok || stored.Version != usage.Version {
+			continue
+		}
+		previous = append(previous, stored)
+		updated := *stored
+		updated.ReceiveBytes = usage.ReceiveBytes
+		updated.TransmitBytes = usage.TransmitBytes
+		updated.CounterRx = usage.CounterRx
+		updated.CounterTx = usage.CounterTx
+		updated.LastHandshake = usage.LastHandshake
+		updated.PeriodUsage = usage.PeriodUsage
+		updated.PeriodStart = usage.PeriodStart
+		s.Clients[updated.ID] = &updated
+		saved = append(saved, updated)
+	}
+	if len(saved) == 0 {
+		return nil
+	}
+	// Несохраненный учет не теряется: счетчики остаются прежними, и
+	// следующий проход учтет тот же прирост
+	err := s.commit(func() {
+		for _, stored := range previous {
+			s.Clients[stored.ID] = stored
+		}
+	})
+	if err != nil {
+		log.Printf("учет трафика не сохранен: %v", err)
+		return nil
+	}
+	return saved
+}
+
+// nextServerVersion версия сервера после очередного изменения. Сохраненная
+// запись может быть другим экземпляром с большей версией.
+func (s *Storage) nextServerVersion(server *Server) int64 {
+	if stored, ok := s.Servers[server.ID]; ok && stored.Version > server.Version {
+		return stored.Version + 1
+	}
+	return server.Version + 1
+}
+
+// nextClientVersion версия клиента после очередного изменения
+func (s *Storage) nextClientVersion(client *Client) int64 {
+	if stored, ok := s.Clients[client.ID]; ok && stored.Version > client.Version {
+		return stored.Version + 1
+	}
+	return client.Version + 1
+}
+
+// CompareAndDeleteClient удаляет клиента, только если он еще имеет версию
+// version. Возвращает копию удаленной записи.
+func (s *Storage) CompareAndDeleteClient(id string, version int64) (Client, error) {
+	removed, err := s.CompareAndDeleteClients([]string{id}, []int64{version})
+	if err != nil {
+		return Client{}, err
+	}
+	return removed[0], nil
+}
+
+// CompareAndDeleteClients удаляет клиентов ids одной записью файла состояния,
+// только если каждый еще имеет версию из versions. Иначе ничего не меняется.
+// Возвращает копии удаленных записей.
+func (s *Storage) CompareAndDeleteClients(ids []string, versions []int64) ([]Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := make([]*Client, len(ids))
+	for i, id := range ids {
+		stored, ok := s.Clients[id]
+		if !ok {
+			return nil, ErrRecordNotFound
+		}
+		if stored.Version != versions[i] {
+			return nil, ErrVersionConflict
+		}
+		previous[i] = stored
+	}
+	removed := make([]Client, len(previous))
+	for i, stored := range previous {
+		delete(s.Clients, stored.ID)
+		removed[i] = *stored
+	}
+	err := s.commit(func() {
+		for _, stored := range previous {
+			s.Clients[stored.ID] = stored
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// CompareAndDeleteServer удаляет сервер вместе с его клиентами, только если
+// сервер еще имеет версию version. Возвращает копии удаленных записей.
+func (s *Storage) CompareAndDeleteServer(id string, version int64) (Server, []Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.Servers[id]
+	if !ok {
+		return Server{}, nil, ErrRecordNotFound
+	}
+	if stored.Version != version {
+		return Server{}, nil, ErrVersionConflict
+	}
+	removed := make([]Client, 0)
+	previous := make(map[string]*Client)
+	for clientID, client := range s.Clients {
+		if client.ServerID == id {
+			removed = append(removed, *client)
+			previous[clientID] = client
+			delete(s.Clients, clientID)
+		}
+	}
+	delete(s.Servers, id)
+	err := s.commit(func() {
+		s.Servers[id] = stored
+		for clientID, client := range previous {
+			s.Clients[clientID] = client
+		}
+	})
+	if err != nil {
+		return Server{}, nil, err
+	}
+	return *stored, removed, nil
+}
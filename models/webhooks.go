@@ -0,0 +1,79 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// WebhookSubscription подписка на webhook-уведомления. Хранится вместе с
+// состоянием, секрет подписи в файле состояния шифруется, как приватные ключи.
+type WebhookSubscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // ключ HMAC-подписи
+	Events    []string  `json:"events"`           // пусто — все события
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookSubscriptions возвращает копии подписок в порядке создания
+func (s *Storage) WebhookSubscriptions() []WebhookSubscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]WebhookSubscription, 0, len(s.Webhooks))
+	for _, sub := range s.Webhooks {
+		result = append(result, *sub)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// SetWebhookSubscription сохраняет подписку, заменяя подписку с тем же ID
+func (s *Storage) SetWebhookSubscription(sub WebhookSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Webhooks[sub.ID] = &sub
+	s.changed()
+}
+
+// DeleteWebhookSubscription удаляет подписку
+func (s *Storage) DeleteWebhookSubscription(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Webhooks, id)
+	s.changed()
+}
+
+// WebhookEvent событие, отправляемое подписчикам
+type WebhookEvent struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// WebhookDeadLetter событие, которое не удалось доставить за все попытки.
+// Хранится вместе с состоянием, чтобы его можно было отправить повторно после
+// перезапуска.
+type WebhookDeadLetter struct {
+	ID             string       `json:"id"`
+	SubscriptionID string       `json:"subscription_id"`
+	Event          WebhookEvent `json:"event"`
+	Attempts       int          `json:"attempts"`
+	LastError      string       `json:"last_error"`
+	Time           time.Time    `json:"time"`
+}
+
+// WebhookDeadLetters возвращает копию списка недоставленных событий
+func (s *Storage) WebhookDeadLetters() []WebhookDeadLetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]WebhookDeadLetter(nil), s.deadLetters...)
+}
+
+// SetWebhookDeadLetters заменяет список недоставленных событий
+func (s *Storage) SetWebhookDeadLetters(letters []WebhookDeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append([]WebhookDeadLetter(nil), letters...)
+	s.changed()
+}
@@ -0,0 +1,230 @@
+package quota
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+	"wireguard-web-manager/webhooks"
+	"wireguard-web-manager/wireguard"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// DefaultInterval период опроса счетчиков трафика
+const DefaultInterval = time.Minute
+
+// Enforcer периодически снимает счетчики трафика пиров, ведет учет по периодам
+// и снимает с интерфейса клиентов, исчерпавших квоту. Счетчики читаются с
+// интерфейса напрямую, а клиенты меняются только через сервис.
+type Enforcer struct {
+	wg     *wireguard.Service
+	svc    *service.Service
+	events webhooks.Publisher
+
+	mu       sync.Mutex
+	interval time.Duration
+	reset    chan struct{}
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewEnforcer(wg *wireguard.Service, svc *service.Service, events webhooks.Publisher, interval time.Duration) *Enforcer {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Enforcer{
+		wg:       wg,
+		svc:      svc,
+		events:   events,
+		interval: interval,
+		reset:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает фоновый опрос
+func (e *Enforcer) Start() {
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.currentInterval())
+		defer ticker.Stop()
+
+		for {
+			if err := e.Poll(time.Now()); err != nil {
+				log.Printf("учет трафика: %v", err)
+			}
+			if !e.wait(ticker) {
+				return
+			}
+		}
+	}()
+}
+
+// wait ждет следующего прохода; false — остановка
+func (e *Enforcer) wait(ticker *time.Ticker) bool {
+	for {
+		select {
+		case <-e.stop:
+			return false
+		case <-e.reset:
+			ticker.Reset(e.currentInterval())
+		case <-ticker.C:
+			return true
+		}
+	}
+}
+
+// SetInterval меняет период опроса без перезапуска
+func (e *Enforcer) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	e.mu.Lock()
+	e.interval = interval
+	e.mu.Unlock()
+
+	select {
+	case e.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Enforcer) currentInterval() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.interval
+}
+
+// Stop останавливает опрос и дожидается завершения текущего прохода
+func (e *Enforcer) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+// Poll выполняет один проход учета трафика
+func (e *Enforcer) Poll(now time.Time) error {
+	if e.wg == nil {
+		return nil
+	}
+
+	devices, err := e.wg.Devices()
+	if err != nil {
+		return err
+	}
+
+	peers := make(map[string]*wgtypes.Peer)
+	for _, device := range devices {
+		for i := range device.Peers {
+			peer := &device.Peers[i]
+			peers[device.Name+"/"+peer.PublicKey.String()] = peer
+		}
+	}
+
+	var usage []models.Client
+	firstConnect := make(map[string]bool)
+	for _, client := range e.svc.Clients() {
+		peer := peers[client.ServerID+"/"+client.PublicKey]
+		next, changed := account(client, peer, now)
+		if next.QuotaExceeded != client.QuotaExceeded {
+			e.enforce(client, next)
+			continue
+		}
+		if changed {
+			usage = append(usage, next)
+			firstConnect[next.ID] = client.LastHandshake == nil && next.LastHandshake != nil
+		}
+	}
+
+	// Учет трафика всех клиентов сохраняется одной записью состояния
+	for _, saved := range e.svc.RecordUsage(usage) {
+		if firstConnect[saved.ID] {
+			e.publish(webhooks.EventClientFirstConnected, &saved)
+		}
+	}
+	return nil
+}
+
+// account учитывает трафик копии клиента к моменту now и возвращает новое
+// состояние. peer равен nil, если пира клиента сейчас нет на интерфейсе.
+// При смене периода снимается признак превышения квоты, при исчерпании квоты
+// он ставится. changed сообщает, что изменился учет трафика.
+func account(client models.Client, peer *wgtypes.Peer, now time.Time) (models.Client, bool) {
+	next := client
+	changed := false
+
+	periodStart := models.QuotaPeriodStart(next.QuotaPeriod, now)
+	if next.PeriodStart == nil || next.PeriodStart.Before(periodStart) {
+		next.PeriodStart = &periodStart
+		next.PeriodUsage = 0
+		next.QuotaExceeded = false
+		changed = true
+	}
+
+	if peer != nil {
+		if next.CounterRx != peer.ReceiveBytes || next.CounterTx != peer.TransmitBytes {
+			changed = true
+		}
+		rx := counterDelta(next.CounterRx, peer.ReceiveBytes)
+		tx := counterDelta(next.CounterTx, peer.TransmitBytes)
+		next.CounterRx = peer.ReceiveBytes
+		next.CounterTx = peer.TransmitBytes
+		next.ReceiveBytes += rx
+		next.TransmitBytes += tx
+		next.PeriodUsage += rx + tx
+
+		if !peer.LastHandshakeTime.IsZero() && (next.LastHandshake == nil || !next.LastHandshake.Equal(peer.LastHandshakeTime)) {
+			handshake := peer.LastHandshakeTime
+			next.LastHandshake = &handshake
+			changed = true
+		}
+	}
+
+	if next.QuotaBytes > 0 && !next.QuotaExceeded && next.PeriodUsage >= next.QuotaBytes {
+		next.QuotaExceeded = true
+	}
+	return next, changed
+}
+
+// enforce сохраняет переход клиента через квоту: сервис снимает пир при
+// превышении квоты и возвращает его после сброса периода
+func (e *Enforcer) enforce(client, next models.Client) {
+	updated, err := e.svc.UpdateClient(next, client.Version)
+	if err != nil {
+		// Клиент изменен или удален после чтения: переход повторится в
+		// следующий проход, если он еще нужен
+		log.Printf("учет трафика клиента %s: %v", client.Name, err)
+		return
+	}
+	if client.LastHandshake == nil && updated.LastHandshake != nil {
+		e.publish(webhooks.EventClientFirstConnected, &updated)
+	}
+	if updated.QuotaExceeded {
+		log.Printf("клиент %s превысил квоту трафика и отключен", updated.Name)
+		e.publish(webhooks.EventClientQuotaExceeded, &updated)
+		return
+	}
+	if updated.ShouldBeConnected() {
+		log.Printf("клиент %s снова подключен после сброса квоты", updated.Name)
+	}
+}
+
+func (e *Enforcer) publish(eventType string, client *models.Client) {
+	if e.events != nil {
+		e.events.Publish(eventType, webhooks.ClientPayload(client))
+	}
+}
+
+// counterDelta возвращает прирост счетчика с учетом его сброса при пересоздании пира
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
@@ -0,0 +1,192 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"wireguard-web-manager/models"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		previous, current int64
+		want              int64
+	}{
+		{"first reading", 0, 100, 100},
+		{"growth", 100, 150, 50},
+		{"no traffic", 150, 150, 0},
+		{"peer re-created", 150, 40, 40},
+		{"peer re-created without traffic", 150, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := counterDelta(tt.previous, tt.current); got != tt.want {
+			t.Errorf("%s: counterDelta(%d, %d) = %d, want %d", tt.name, tt.previous, tt.current, got, tt.want)
+		}
+	}
+}
+
+// usage поля учета трафика клиента; время хранится в секундах Unix, чтобы
+// значения можно было сравнивать целиком
+type usage struct {
+	PeriodStart   int64
+	PeriodUsage   int64
+	ReceiveBytes  int64
+	TransmitBytes int64
+	CounterRx     int64
+	CounterTx     int64
+	QuotaExceeded bool
+	LastHandshake int64
+}
+
+func usageOf(client models.Client) usage {
+	u := usage{
+		PeriodUsage:   client.PeriodUsage,
+		ReceiveBytes:  client.ReceiveBytes,
+		TransmitBytes: client.TransmitBytes,
+		CounterRx:     client.CounterRx,
+		CounterTx:     client.CounterTx,
+		QuotaExceeded: client.QuotaExceeded,
+	}
+	if client.PeriodStart != nil {
+		u.PeriodStart = client.PeriodStart.Unix()
+	}
+	if client.LastHandshake != nil {
+		u.LastHandshake = client.LastHandshake.Unix()
+	}
+	return u
+}
+
+func TestAccount(t *testing.T) {
+	day := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	ptr := func(value time.Time) *time.Time { return &value }
+	peer := func(rx, tx int64, handshake time.Time) *wgtypes.Peer {
+		return &wgtypes.Peer{ReceiveBytes: rx, TransmitBytes: tx, LastHandshakeTime: handshake}
+	}
+
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) // пятница
+	march := day("2024-03-01").Unix()
+	handshake := now.Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		client  models.Client
+		peer    *wgtypes.Peer
+		want    usage
+		changed bool
+	}{
+		{
+			name:    "first poll starts period",
+			client:  models.Client{},
+			want:    usage{PeriodStart: march},
+			changed: true,
+		},
+		{
+			name:    "traffic within period",
+			client:  models.Client{PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 150, ReceiveBytes: 100, TransmitBytes: 50, CounterRx: 100, CounterTx: 50},
+			peer:    peer(300, 80, time.Time{}),
+			want:    usage{PeriodStart: march, PeriodUsage: 380, ReceiveBytes: 300, TransmitBytes: 80, CounterRx: 300, CounterTx: 80},
+			changed: true,
+		},
+		{
+			name:   "counters unchanged",
+			client: models.Client{PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 150, CounterRx: 100, CounterTx: 50},
+			peer:   peer(100, 50, time.Time{}),
+			want:   usage{PeriodStart: march, PeriodUsage: 150, CounterRx: 100, CounterTx: 50},
+		},
+		{
+			name:    "peer re-created",
+			client:  models.Client{PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 1500, ReceiveBytes: 1000, TransmitBytes: 500, CounterRx: 1000, CounterTx: 500},
+			peer:    peer(40, 10, time.Time{}),
+			want:    usage{PeriodStart: march, PeriodUsage: 1550, ReceiveBytes: 1040, TransmitBytes: 510, CounterRx: 40, CounterTx: 10},
+			changed: true,
+		},
+		{
+			name:   "peer not on interface",
+			client: models.Client{PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 150, CounterRx: 100, CounterTx: 50},
+			want:   usage{PeriodStart: march, PeriodUsage: 150, CounterRx: 100, CounterTx: 50},
+		},
+		{
+			name:    "month rollover clears exceeded quota",
+			client:  models.Client{QuotaBytes: 1000, PeriodStart: ptr(day("2024-02-01")), PeriodUsage: 5000, QuotaExceeded: true},
+			want:    usage{PeriodStart: march},
+			changed: true,
+		},
+		{
+			name:    "rollover counts traffic in new period",
+			client:  models.Client{PeriodStart: ptr(day("2024-02-01")), PeriodUsage: 5000, CounterRx: 100, CounterTx: 100},
+			peer:    peer(150, 100, time.Time{}),
+			want:    usage{PeriodStart: march, PeriodUsage: 50, ReceiveBytes: 50, CounterRx: 150, CounterTx: 100},
+			changed: true,
+		},
+		{
+			name:    "rollover with traffic over quota",
+			client:  models.Client{QuotaBytes: 100, PeriodStart: ptr(day("2024-02-01")), PeriodUsage: 5000, QuotaExceeded: true},
+			peer:    peer(150, 0, time.Time{}),
+			want:    usage{PeriodStart: march, PeriodUsage: 150, ReceiveBytes: 150, CounterRx: 150, QuotaExceeded: true},
+			changed: true,
+		},
+		{
+			name:    "daily rollover",
+			client:  models.Client{QuotaPeriod: models.QuotaPeriodDay, PeriodStart: ptr(day("2024-03-14")), PeriodUsage: 10},
+			want:    usage{PeriodStart: day("2024-03-15").Unix()},
+			changed: true,
+		},
+		{
+			name:   "same week",
+			client: models.Client{QuotaPeriod: models.QuotaPeriodWeek, PeriodStart: ptr(day("2024-03-11")), PeriodUsage: 10},
+			want:   usage{PeriodStart: day("2024-03-11").Unix(), PeriodUsage: 10},
+		},
+		{
+			name:    "quota reached",
+			client:  models.Client{QuotaBytes: 1000, PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 900},
+			peer:    peer(60, 40, time.Time{}),
+			want:    usage{PeriodStart: march, PeriodUsage: 1000, ReceiveBytes: 60, TransmitBytes: 40, CounterRx: 60, CounterTx: 40, QuotaExceeded: true},
+			changed: true,
+		},
+		{
+			name:    "quota not reached",
+			client:  models.Client{QuotaBytes: 1000, PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 900},
+			peer:    peer(60, 39, time.Time{}),
+			want:    usage{PeriodStart: march, PeriodUsage: 999, ReceiveBytes: 60, TransmitBytes: 39, CounterRx: 60, CounterTx: 39},
+			changed: true,
+		},
+		{
+			name:   "exceeded quota kept within period",
+			client: models.Client{QuotaBytes: 1000, PeriodStart: ptr(day("2024-03-01")), PeriodUsage: 1200, QuotaExceeded: true},
+			want:   usage{PeriodStart: march, PeriodUsage: 1200, QuotaExceeded: true},
+		},
+		{
+			name:    "first handshake",
+			client:  models.Client{PeriodStart: ptr(day("2024-03-01"))},
+			peer:    peer(0, 0, handshake),
+			want:    usage{PeriodStart: march, LastHandshake: handshake.Unix()},
+			changed: true,
+		},
+		{
+			name:   "same handshake",
+			client: models.Client{PeriodStart: ptr(day("2024-03-01")), LastHandshake: ptr(handshake)},
+			peer:   peer(0, 0, handshake),
+			want:   usage{PeriodStart: march, LastHandshake: handshake.Unix()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, changed := account(tt.client, tt.peer, now)
+			if got := usageOf(next); got != tt.want {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/service"
+	"wireguard-web-manager/webhooks"
+	"wireguard-web-manager/wireguard"
+)
+
+// DefaultInterval период проверки границ окон доступа
+const DefaultInterval = 30 * time.Second
+
+// Scheduler добавляет и снимает пиры клиентов на границах окон доступа
+// и по истечении срока действия доступа. Рукопожатия читаются с интерфейса
+// напрямую, а клиенты меняются только через сервис.
+type Scheduler struct {
+	wg     *wireguard.Service
+	svc    *service.Service
+	events webhooks.Publisher
+
+	mu       sync.Mutex
+	interval time.Duration
+	reset    chan struct{}
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func New(wg *wireguard.Service, svc *service.Service, events webhooks.Publisher, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Scheduler{
+		wg:       wg,
+		svc:      svc,
+		events:   events,
+		interval: interval,
+		reset:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start запускает фоновую проверку расписаний
+func (s *Scheduler) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.currentInterval())
+		defer ticker.Stop()
+
+		for {
+			s.Tick(time.Now())
+			if !s.wait(ticker) {
+				return
+			}
+		}
+	}()
+}
+
+// wait ждет следующего прохода; false — остановка
+func (s *Scheduler) wait(ticker *time.Ticker) bool {
+	for {
+		select {
+		case <-s.stop:
+			return false
+		case <-s.reset:
+			ticker.Reset(s.currentInterval())
+		case <-ticker.C:
+			return true
+		}
+	}
+}
+
+// SetInterval меняет период проверки без перезапуска
+func (s *Scheduler) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+
+	select {
+	case s.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) currentInterval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
+// Stop останавливает проверку и дожидается завершения текущего прохода
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+// Tick приводит состояние всех клиентов с расписанием, сроком действия или
+// незавершенной сменой ключей к моменту now. Клиент, измененный другим
+// запросом во время прохода, будет обработан в следующий проход.
+func (s *Scheduler) Tick(now time.Time) {
+	handshakes := make(map[string]map[string]bool)
+	for _, client := range s.svc.Clients() {
+		if client.RotationPending() {
+			rotated, err := s.rotate(client, now, handshakes)
+			if err != nil {
+				log.Printf("смена ключей клиента %s: %v", client.Name, err)
+				continue
+			}
+			client = rotated
+		}
+
+		if !client.Expired && client.ExpiredAt(now) {
+			if err := s.expire(client); err != nil {
+				log.Printf("срок действия клиента %s: %v", client.Name, err)
+			}
+			continue
+		}
+
+		if client.Schedule == nil {
+			continue
+		}
+		next := client
+		if !Apply(&next, now) {
+			continue
+		}
+		updated, err := s.svc.UpdateClient(next, client.Version)
+		if err != nil {
+			log.Printf("расписание клиента %s: %v", client.Name, err)
+			continue
+		}
+		switch {
+		case client.ShouldBeConnected() && !updated.ShouldBeConnected():
+			log.Printf("клиент %s отключен: вне окна доступа", client.Name)
+		case !client.ShouldBeConnected() && updated.ShouldBeConnected():
+			log.Printf("клиент %s подключен: начало окна доступа", client.Name)
+		}
+	}
+}
+
+// expire отмечает истечение срока действия доступа клиента; сервис снимает
+// его пир с интерфейса
+func (s *Scheduler) expire(client models.Client) error {
+	next := client
+	next.Expired = true
+	updated, err := s.svc.UpdateClient(next, client.Version)
+	if err != nil {
+		return fmt.Errorf("снять пир по истечении срока: %w", err)
+	}
+	log.Printf("клиент %s отключен: истек срок действия доступа", updated.Name)
+
+	if s.events != nil {
+		s.events.Publish(webhooks.EventClientExpired, webhooks.ClientPayload(&updated))
+	}
+	return nil
+}
+
+// rotate завершает смену ключей клиента после первого рукопожатия нового
+// пира или по истечении отведенного срока и возвращает новое состояние
+// клиента. handshakes кэширует ключи пиров с рукопожатием по серверам в
+// пределах одного прохода.
+func (s *Scheduler) rotate(client models.Client, now time.Time, handshakes map[string]map[string]bool) (models.Client, error) {
+	due := client.RotationDeadline == nil || !client.RotationDeadline.After(now)
+	if !due && s.wg != nil {
+		seen, ok := handshakes[client.ServerID]
+		if !ok {
+			seen = make(map[string]bool)
+			device, err := s.wg.Device(client.ServerID)
+			if err != nil {
+				return client, fmt.Errorf("прочитать интерфейс: %w", err)
+			}
+			for _, peer := range device.Peers {
+				if !peer.LastHandshakeTime.IsZero() {
+					seen[peer.PublicKey.String()] = true
+				}
+			}
+			handshakes[client.ServerID] = seen
+		}
+		due = seen[client.PendingPublicKey]
+	}
+	if !due {
+		return client, nil
+	}
+
+	rotated, err := s.svc.CompleteClientKeyRotation(client.ID, client.Version)
+	if err != nil {
+		return client, err
+	}
+	log.Printf("клиент %s перешел на новый ключ", client.Name)
+	return rotated, nil
+}
+
+// Apply вычисляет, находится ли клиент в окне доступа в момент now, и
+// обновляет OutsideSchedule и время следующей границы окна. Пир не
+// меняется: его переносит сервис при сохранении клиента. Возвращает true,
+// если состояние клиента изменилось.
+func Apply(client *models.Client, now time.Time) bool {
+	outside := false
+	if client.Schedule != nil {
+		outside = !client.Schedule.Allows(now)
+	}
+
+	if outside == client.OutsideSchedule {
+		if client.Schedule == nil || client.NextScheduleChange != nil && client.NextScheduleChange.After(now) {
+			return false
+		}
+		next := client.Schedule.NextChange(now)
+		if next == nil && client.NextScheduleChange == nil {
+			return false
+		}
+		client.NextScheduleChange = next
+		return true
+	}
+
+	client.OutsideSchedule = outside
+	client.NextScheduleChange = nil
+	if client.Schedule != nil {
+		client.NextScheduleChange = client.Schedule.NextChange(now)
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"wireguard-web-manager/models"
+)
+
+func at(t *testing.T, value string) *time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &parsed
+}
+
+func TestApply(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skipf("time zone database: %v", err)
+	}
+	// Ночное окно по берлинскому времени; 2024-03-31 в 01:00 UTC начинается
+	// летнее время, и окно заканчивается раньше
+	night := &models.Schedule{Timezone: "Europe/Berlin", Windows: []models.ScheduleWindow{{Start: "23:00", End: "02:30"}}}
+	always := &models.Schedule{Windows: []models.ScheduleWindow{{Start: "00:00", End: "00:00"}}}
+
+	tests := []struct {
+		name        string
+		schedule    *models.Schedule
+		outside     bool
+		next        string // NextScheduleChange до прохода
+		now         string
+		changed     bool
+		wantOutside bool
+		wantNext    string
+	}{
+		{
+			name: "no schedule",
+			now:  "2024-03-30T12:00:00Z",
+		},
+		{
+			name: "schedule removed while outside", outside: true, next: "2024-03-30T22:00:00Z",
+			now:     "2024-03-30T12:00:00Z",
+			changed: true,
+		},
+		{
+			name: "window closes", schedule: night, next: "2024-03-30T01:30:00Z",
+			now:     "2024-03-30T01:30:00Z",
+			changed: true, wantOutside: true, wantNext: "2024-03-30T22:00:00Z",
+		},
+		{
+			name: "window opens", schedule: night, outside: true, next: "2024-03-30T22:00:00Z",
+			now:     "2024-03-30T22:00:00Z",
+			changed: true, wantNext: "2024-03-31T01:00:00Z",
+		},
+		{
+			name: "window closes at dst", schedule: night, next: "2024-03-31T01:00:00Z",
+			now:     "2024-03-31T01:00:00Z",
+			changed: true, wantOutside: true, wantNext: "2024-03-31T21:00:00Z",
+		},
+		{
+			name: "boundary not reached", schedule: night, outside: true, next: "2024-03-30T22:00:00Z",
+			now:         "2024-03-30T12:00:00Z",
+			wantOutside: true, wantNext: "2024-03-30T22:00:00Z",
+		},
+		{
+			name: "boundary unknown", schedule: night, outside: true,
+			now:     "2024-03-30T12:00:00Z",
+			changed: true, wantOutside: true, wantNext: "2024-03-30T22:00:00Z",
+		},
+		{
+			name: "stale boundary", schedule: night, outside: true, next: "2024-03-29T22:00:00Z",
+			now:     "2024-03-30T12:00:00Z",
+			changed: true, wantOutside: true, wantNext: "2024-03-30T22:00:00Z",
+		},
+		{
+			name: "always allowed", schedule: always,
+			now: "2024-03-30T12:00:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := models.Client{Schedule: tt.schedule, OutsideSchedule: tt.outside}
+			if tt.next != "" {
+				client.NextScheduleChange = at(t, tt.next)
+			}
+			if changed := Apply(&client, *at(t, tt.now)); changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if client.OutsideSchedule != tt.wantOutside {
+				t.Errorf("OutsideSchedule = %v, want %v", client.OutsideSchedule, tt.wantOutside)
+			}
+			switch {
+			case tt.wantNext == "" && client.NextScheduleChange != nil:
+				t.Errorf("NextScheduleChange = %v, want none", client.NextScheduleChange.UTC())
+			case tt.wantNext != "" && client.NextScheduleChange == nil:
+				t.Errorf("NextScheduleChange = none, want %s", tt.wantNext)
+			case tt.wantNext != "" && !client.NextScheduleChange.Equal(*at(t, tt.wantNext)):
+				t.Errorf("NextScheduleChange = %v, want %s", client.NextScheduleChange.UTC(), tt.wantNext)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Переменные окружения с мастер-ключами
+const (
+	EnvMasterKey     = "WG_MASTER_KEY"
+	EnvMasterKeyFile = "WG_MASTER_KEY_FILE"
+)
+
+// Prefix начинает каждое зашифрованное значение
+const Prefix = "enc:"
+
+const keySize = 32
+
+var ErrNoKey = errors.New("master key is not configured")
+
+// Keyring набор мастер-ключей по версиям. Новые значения шифруются ключом
+// с наибольшей версией, расшифровываются — ключом, указанным в значении.
+//
+// Каждое значение шифруется собственным случайным ключом данных (DEK),
+// который, в свою очередь, шифруется мастер-ключом (envelope encryption).
+// Формат: enc:<версия>:<nonce+зашифрованный DEK>:<nonce+шифротекст>, части в base64.
+type Keyring struct {
+	keys    map[int][]byte
+	current int
+}
+
+// LoadKeyring читает мастер-ключи из файла WG_MASTER_KEY_FILE или переменной
+// WG_MASTER_KEY. Возвращает ErrNoKey, если не задано ни то, ни другое.
+func LoadKeyring() (*Keyring, error) {
+	if path := os.Getenv(EnvMasterKeyFile); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read master key file: %w", err)
+		}
+		return ParseKeyring(string(data))
+	}
+	if value := os.Getenv(EnvMasterKey); value != "" {
+		return ParseKeyring(value)
+	}
+	return nil, ErrNoKey
+}
+
+// ParseKeyring разбирает список ключей, разделенных переводами строк или
+// запятыми. Каждый ключ задается как <версия>:<base64> или просто <base64>
+// для версии 1. Строки, начинающиеся с #, пропускаются.
+func ParseKeyring(text string) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[int][]byte)}
+
+	entries := strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		version := 1
+		encoded := entry
+		if idx := strings.Index(entry, ":"); idx > 0 {
+			parsed, err := strconv.Atoi(entry[:idx])
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("invalid master key version %q", entry[:idx])
+			}
+			version, encoded = parsed, entry[idx+1:]
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key %d: %w", version, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("master key %d: must be %d bytes, got %d", version, keySize, len(key))
+		}
+		if _, exists := keyring.keys[version]; exists {
+			return nil, fmt.Errorf("duplicate master key version %d", version)
+		}
+
+		keyring.keys[version] = key
+		if version > keyring.current {
+			keyring.current = version
+		}
+	}
+
+	if len(keyring.keys) == 0 {
+		return nil, ErrNoKey
+	}
+	return keyring, nil
+}
+
+// GenerateKey возвращает новый случайный мастер-ключ в base64
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generate master key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// CurrentVersion версия ключа, которым шифруются новые значения
+func (k *Keyring) CurrentVersion() int {
+	return k.current
+}
+
+// Versions версии всех загруженных ключей по возрастанию
+func (k *Keyring) Versions() []int {
+	versions := make([]int, 0, len(k.keys))
+	for version := range k.keys {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Seal шифрует значение текущим мастер-ключом. Пустая строка не шифруется.
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("generate data key: %w", err)
+	}
+
+	aad := []byte(strconv.Itoa(k.current))
+	wrapped, err := encrypt(k.keys[k.current], dek, aad)
+	if err != nil {
+		return "", fmt.Errorf("wrap data key: %w", err)
+	}
+	ciphertext, err := encrypt(dek, []byte(plaintext), aad)
+	if err != nil {
+		return "", fmt.Errorf("encrypt value: %w", err)
+	}
+
+	return Prefix + strconv.Itoa(k.current) + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open расшифровывает значение. Значения без префикса enc: считаются
+// записанными до включения шифрования и возвращаются как есть.
+func (k *Keyring) Open(sealed string) (string, error) {
+	if !IsSealed(sealed) {
+		return sealed, nil
+	}
+
+	version, wrapped, ciphertext, err := split(sealed)
+	if err != nil {
+		return "", err
+	}
+	master, ok := k.keys[version]
+	if !ok {
+		return "", fmt.Errorf("master key version %d is not loaded", version)
+	}
+
+	aad := []byte(strconv.Itoa(version))
+	dek, err := decrypt(master, wrapped, aad)
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key (version %d): %w", version, err)
+	}
+	plaintext, err := decrypt(dek, ciphertext, aad)
+	if err != nil {
+		return "", fmt.Errorf("decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed сообщает, зашифровано ли значение
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// SealedVersion возвращает версию мастер-ключа зашифрованного значения
+func SealedVersion(sealed string) (int, error) {
+	version, _, _, err := split(sealed)
+	return version, err
+}
+
+func split(sealed string) (int, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(sealed, Prefix), ":")
+	if len(parts) != 3 {
+		return 0, nil, nil, errors.New("malformed sealed value")
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, nil, errors.New("malformed sealed value version")
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed sealed data key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed sealed ciphertext: %w", err)
+	}
+	return version, wrapped, ciphertext, nil
+}
+
+func encrypt(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func decrypt(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
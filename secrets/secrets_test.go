@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(fill byte) string {
+	key := make([]byte, keySize)
+	for i := range key {
+		key[i] = fill
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func mustKeyring(t *testing.T, text string) *Keyring {
+	t.Helper()
+	keyring, err := ParseKeyring(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	keyring := mustKeyring(t, testKey(1))
+
+	sealed, err := keyring.Seal("private key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "private key") {
+		t.Fatalf("value is not sealed: %q", sealed)
+	}
+	if version, err := SealedVersion(sealed); err != nil || version != 1 {
+		t.Errorf("sealed version %d (%v), want 1", version, err)
+	}
+	opened, err := keyring.Open(sealed)
+	if err != nil || opened != "private key" {
+		t.Fatalf("open: %q, %v", opened, err)
+	}
+
+	again, _ := keyring.Seal("private key")
+	if again == sealed {
+		t.Error("sealing the same value twice gave the same result")
+	}
+
+	if sealed, err := keyring.Seal(""); err != nil || sealed != "" {
+		t.Errorf("empty value sealed to %q (%v)", sealed, err)
+	}
+	if opened, err := keyring.Open("plain"); err != nil || opened != "plain" {
+		t.Errorf("value written before encryption: %q, %v", opened, err)
+	}
+}
+
+func TestOpenWithWrongOrUnknownKey(t *testing.T) {
+	sealed, err := mustKeyring(t, "2:"+testKey(2)).Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mustKeyring(t, "1:"+testKey(1)).Open(sealed); err == nil || !strings.Contains(err.Error(), "version 2 is not loaded") {
+		t.Errorf("unknown version: got %v", err)
+	}
+	if _, err := mustKeyring(t, "2:"+testKey(3)).Open(sealed); err == nil {
+		t.Error("opened with a different key of the same version")
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	// У обеих версий один ключ: значение с подмененной версией отличается
+	// только дополнительными данными (AAD)
+	keyring := mustKeyring(t, "1:"+testKey(1)+"\n2:"+testKey(1))
+	sealed, err := keyring.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(strings.TrimPrefix(sealed, Prefix), ":")
+
+	flip := func(encoded string) string {
+		data, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 1
+		return base64.RawStdEncoding.EncodeToString(data)
+	}
+
+	for name, value := range map[string]string{
+		"ciphertext": Prefix + parts[0] + ":" + parts[1] + ":" + flip(parts[2]),
+		"data key":   Prefix + parts[0] + ":" + flip(parts[1]) + ":" + parts[2],
+		"aad":        Prefix + "1:" + parts[1] + ":" + parts[2],
+		"truncated":  Prefix + parts[0] + ":" + parts[1] + ":" + parts[2][:8],
+		"malformed":  Prefix + parts[0] + ":" + parts[1],
+	} {
+		if _, err := keyring.Open(value); err == nil {
+			t.Errorf("%s: tampered value opened", name)
+		}
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	keyring := mustKeyring(t, "# old\n1:"+testKey(1)+", 3:"+testKey(3)+"\n\n2:"+testKey(2))
+	if got := keyring.Versions(); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("versions %v", got)
+	}
+	if keyring.CurrentVersion() != 3 {
+		t.Errorf("current version %d, want 3", keyring.CurrentVersion())
+	}
+	if mustKeyring(t, testKey(1)).CurrentVersion() != 1 {
+		t.Error("key without a version is not version 1")
+	}
+
+	for name, text := range map[string]string{
+		"empty":        "# nothing\n",
+		"short key":    base64.StdEncoding.EncodeToString([]byte("short")),
+		"bad base64":   "1:not base64!",
+		"bad version":  "x:" + testKey(1),
+		"zero version": "0:" + testKey(1),
+		"duplicate":    "1:" + testKey(1) + "\n1:" + testKey(2),
+	} {
+		if _, err := ParseKeyring(text); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestSealAfterRotation(t *testing.T) {
+	old := mustKeyring(t, "1:"+testKey(1))
+	sealed, err := old.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := mustKeyring(t, "1:"+testKey(1)+"\n2:"+testKey(2))
+	opened, err := rotated.Open(sealed)
+	if err != nil || opened != "secret" {
+		t.Fatalf("old value after rotation: %q, %v", opened, err)
+	}
+	resealed, err := rotated.Seal(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := SealedVersion(resealed); version != 2 {
+		t.Errorf("resealed with version %d, want 2", version)
+	}
+	if opened, err := mustKeyring(t, "2:"+testKey(2)).Open(resealed); err != nil || opened != "secret" {
+		t.Errorf("resealed value without the old key: %q, %v", opened, err)
+	}
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"wireguard-web-manager/models"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Массовые действия над клиентами
+const (
+	BulkDisable = "disable"
+	BulkEnable  = "enable"
+	BulkDelete  = "delete"
+)
+
+// BulkError ошибка массовой операции. ServerID пуст, если ошибка в данных
+// клиента, а не при изменении интерфейса; ClientID пуст, если ошибка
+// относится ко всему серверу.
+type BulkError struct {
+	ServerID string
+	ClientID string
+	Err      error
+}
+
+func (e *BulkError) Error() string {
+	switch {
+	case e.ServerID == "":
+		return fmt.Sprintf("client %s: %v", e.ClientID, e.Err)
+	case e.ClientID != "":
+		return fmt.Sprintf("%s: client %s: %v", e.ServerID, e.ClientID, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.ServerID, e.Err)
+}
+
+func (e *BulkError) Unwrap() error { return e.Err }
+
+// CreateClients добавляет пиры подключаемых клиентов одной конфигурацией на
+// каждый сервер и сохраняет всех клиентов. Клиенты создаются все вместе или
+// не создаются вовсе. Возвращает копии созданных клиентов.
+func (s *Service) CreateClients(clients []models.Client) ([]models.Client, error) {
+	created := make([]models.Client, len(clients))
+	copy(created, clients)
+
+	err := s.run(func(u *unit) error {
+		changes := newPeerChanges()
+		attached := make([]*models.Client, 0, len(created))
+		for i := range created {
+			client := &created[i]
+			if _, ok := s.storage.CopyServer(client.ServerID); !ok {
+				return &BulkError{ClientID: client.ID, Err: ErrServerNotFound}
+			}
+			if err := s.checkUnique(client, ""); err != nil {
+				return &BulkError{ClientID: client.ID, Err: err}
+			}
+			if err := checkBatchUnique(client, created[:i]); err != nil {
+				return &BulkError{ClientID: client.ID, Err: err}
+			}
+			client.IsActive = false
+			if s.wg == nil || !client.ShouldBeConnected() {
+				continue
+			}
+			if err := changes.attach(client); err != nil {
+				return &BulkError{ClientID: client.ID, Err: err}
+			}
+			attached = append(attached, client)
+		}
+
+		if s.wg != nil {
+			if err := s.applyChanges(u, changes, attached); err != nil {
+				return err
+			}
+		}
+		for _, client := range attached {
+			client.IsActive = true
+		}
+		stored := make([]*models.Client, len(created))
+		for i := range created {
+			client := created[i]
+			stored[i] = &client
+		}
+		if err := s.storage.AddClients(stored); err != nil {
+			return err
+		}
+		for i := range created {
+			created[i].Version = stored[i].Version
+		}
+		return nil
+	})
+	return created, err
+}
+
+// checkBatchUnique проверяет, что адрес и открытый ключ клиента не заняты
+// клиентами того же сервера, создаваемыми вместе с ним
+func checkBatchUnique(client *models.Client, batch []models.Client) error {
+	address := hostAddress(client.TunnelAddress())
+	for i := range batch {
+		other := &batch[i]
+		if other.ServerID != client.ServerID {
+			continue
+		}
+		if other.PublicKey == client.PublicKey {
+			return ErrKeyTaken
+		}
+		if address != "" && hostAddress(other.TunnelAddress()) == address {
+			return ErrAddressTaken
+		}
+	}
+	return nil
+}
+
+// BulkClientAction отключает, включает или удаляет клиентов, если все они
+// еще имеют прочитанные версии. Пиры меняются одной конфигурацией на каждый
+// сервер. Изменения применяются ко всем клиентам или ни к одному. Возвращает
+// копии клиентов после изменения, при удалении — удаленные записи.
+func (s *Service) BulkClientAction(action string, clients []models.Client) ([]models.Client, error) {
+	var result []models.Client
+	err := s.run(func(u *unit) error {
+		current := make([]models.Client, len(clients))
+		for i := range clients {
+			stored, ok := s.storage.CopyClient(clients[i].ID)
+			if !ok {
+				return &BulkError{ClientID: clients[i].ID, Err: ErrNotFound}
+			}
+			if stored.Version != clients[i].Version {
+				return &BulkError{ClientID: clients[i].ID, Err: ErrConflict}
+			}
+			current[i] = stored
+		}
+
+		next := make([]models.Client, len(current))
+		detached := make([]bool, len(current))
+		changes := newPeerChanges()
+		attached := make([]*models.Client, 0, len(current))
+		for i := range current {
+			next[i] = current[i]
+			switch action {
+			case BulkDisable:
+				next[i].IsDisabled = true
+			case BulkEnable:
+				next[i].IsDisabled = false
+			case BulkDelete:
+			default:
+				return fmt.Errorf("unknown bulk action %q", action)
+			}
+
+			wasConnected := current[i].ShouldBeConnected()
+			detached[i] = wasConnected && (action == BulkDelete || !next[i].ShouldBeConnected())
+			if s.wg == nil {
+				continue
+			}
+			var err error
+			switch {
+			case action == BulkDelete || detached[i]:
+				err = changes.detach(&current[i])
+			case !wasConnected && next[i].ShouldBeConnected():
+				err = changes.attach(&next[i])
+				attached = append(attached, &next[i])
+			}
+			if err != nil {
+				return &BulkError{ClientID: current[i].ID, Err: err}
+			}
+		}
+
+		// Ограничения скорости и маршруты применяются только к подключаемым
+		// клиентам: при снятии пира ошибка их очистки не мешает операции
+		if s.wg != nil {
+			if err := s.applyChanges(u, changes, attached); err != nil {
+				return err
+			}
+		}
+
+		// Все клиенты сохраняются одной записью: версии проверены под
+		// блокировкой сервиса, поэтому запись может не выполниться только при
+		// изменении в обход сервиса или ошибке записи файла состояния
+		versions := make([]int64, len(current))
+		for i := range current {
+			versions[i] = current[i].Version
+		}
+		if action == BulkDelete {
+			ids := make([]string, len(current))
+			for i := range current {
+				ids[i] = current[i].ID
+			}
+			removed, err := s.storage.CompareAndDeleteClients(ids, versions)
+			if err != nil {
+				return err
+			}
+			result = removed
+		} else {
+			updates := make([]*models.Client, len(next))
+			for i := range next {
+				client := &next[i]
+				switch {
+				case detached[i]:
+					client.IsActive = false
+					client.ResetCounters()
+				case !current[i].ShouldBeConnected() && client.ShouldBeConnected():
+					client.IsActive = true
+				}
+				updates[i] = client
+			}
+			if err := s.storage.CompareAndUpdateClients(updates, versions); err != nil {
+				return err
+			}
+			result = next
+		}
+
+		if s.wg != nil {
+			for i := range current {
+				if detached[i] {
+					s.clearPeerState(&current[i])
+				}
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// clearPeerState снимает ограничения скорости и маршруты площадки клиента,
+// пир которого уже снят с интерфейса. Ошибки только записываются в журнал.
+func (s *Service) clearPeerState(client *models.Client) {
+	if !client.RateLimit().IsZero() {
+		if err := s.wg.ClearRateLimit(client.ServerID, client.TunnelAddress()); err != nil {
+			log.Printf("не удалось снять ограничение скорости клиента %s: %v", client.Name, err)
+		}
+	}
+	if len(client.Subnets) > 0 {
+		if err := models.RemoveSiteRoutes(s.wg, client); err != nil {
+			log.Printf("не удалось удалить маршруты площадки %s: %v", client.Name, err)
+		}
+	}
+}
+
+// peerChanges изменения пиров по серверам и обратные им изменения для отката
+type peerChanges struct {
+	apply   map[string][]wgtypes.PeerConfig
+	inverse map[string][]wgtypes.PeerConfig
+}
+
+func newPeerChanges() *peerChanges {
+	return &peerChanges{
+		apply:   make(map[string][]wgtypes.PeerConfig),
+		inverse: make(map[string][]wgtypes.PeerConfig),
+	}
+}
+
+func (p *peerChanges) add(serverID string, peerCfg wgtypes.PeerConfig) {
+	p.apply[serverID] = append(p.apply[serverID], peerCfg)
+}
+
+func (p *peerChanges) undo(serverID string, peerCfg wgtypes.PeerConfig) {
+	p.inverse[serverID] = append(p.inverse[serverID], peerCfg)
+}
+
+// attach добавляет пир клиента (и новый пир при смене ключей)
+func (p *peerChanges) attach(client *models.Client) error {
+	peerCfg, err := client.PeerConfig()
+	if err != nil {
+		return err
+	}
+	p.add(client.ServerID, peerCfg)
+	p.undo(client.ServerID, removePeerConfig(peerCfg.PublicKey))
+
+	if client.RotationPending() {
+		pending, err := client.PendingPeerConfig()
+		if err != nil {
+			return err
+		}
+		p.add(client.ServerID, pending)
+		p.undo(client.ServerID, removePeerConfig(pending.PublicKey))
+	}
+	return nil
+}
+
+// detach снимает пир клиента (и новый пир при смене ключей)
+func (p *peerChanges) detach(client *models.Client) error {
+	peerCfg, err := client.PeerConfig()
+	if err != nil {
+		return err
+	}
+	p.add(client.ServerID, removePeerConfig(peerCfg.PublicKey))
+	if client.ShouldBeConnected() {
+		p.undo(client.ServerID, peerCfg)
+	}
+
+	if client.RotationPending() {
+		pending, err := client.PendingPeerConfig()
+		if err != nil {
+			return err
+		}
+		p.add(client.ServerID, removePeerConfig(pending.PublicKey))
+		if client.ShouldBeConnected() {
+			p.undo(client.ServerID, pending)
+		}
+	}
+	return nil
+}
+
+// applyChanges применяет изменения пиров одной конфигурацией на каждый
+// сервер, затем маршруты площадок и ограничения скорости подключаемых
+// клиентов attached. Шаг с ошибкой мог выполниться частично, поэтому его
+// отмена выполняется сразу.
+func (s *Service) applyChanges(u *unit, changes *peerChanges, attached []*models.Client) error {
+	servers := make([]string, 0, len(changes.apply))
+	for serverID := range changes.apply {
+		servers = append(servers, serverID)
+	}
+	sort.Strings(servers)
+
+	for _, serverID := range servers {
+		serverID := serverID
+		undo := func() error {
+			return s.wg.ApplyPeers(serverID, changes.inverse[serverID])
+		}
+		if err := u.do(func() error {
+			return s.wg.ApplyPeers(serverID, changes.apply[serverID])
+		}, undo); err != nil {
+			undoPartial(undo)
+			return &BulkError{ServerID: serverID, Err: err}
+		}
+	}
+
+	for _, client := range attached {
+		if len(client.Subnets) == 0 {
+			continue
+		}
+		client := client
+		undo := func() error {
+			return models.RemoveSiteRoutes(s.wg, client)
+		}
+		if err := u.do(func() error {
+			return models.AddSiteRoutes(s.wg, client)
+		}, undo); err != nil {
+			undoPartial(undo)
+			return &BulkError{ServerID: client.ServerID, ClientID: client.ID, Err: err}
+		}
+	}
+
+	for _, client := range attached {
+		if client.RateLimit().IsZero() {
+			continue
+		}
+		client := client
+		err := u.do(func() error {
+			return s.wg.SetRateLimit(client.ServerID, client.TunnelAddress(), client.RateLimit())
+		}, func() error {
+			return s.wg.ClearRateLimit(client.ServerID, client.TunnelAddress())
+		})
+		if err != nil {
+			return &BulkError{ServerID: client.ServerID, ClientID: client.ID, Err: err}
+		}
+	}
+	return nil
+}
+
+// undoPartial отменяет шаг, который не выполнился, но мог успеть изменить
+// интерфейс
+func undoPartial(undo func() error) {
+	if err := undo(); err != nil {
+		log.Printf("не удалось отменить изменение интерфейса: %v", err)
+	}
+}
+
+func removePeerConfig(key wgtypes.Key) wgtypes.PeerConfig {
+	return wgtypes.PeerConfig{PublicKey: key, Remove: true}
+}
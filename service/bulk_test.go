@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"wireguard-web-manager/models"
+)
+
+func TestCreateClientsRejectsWholeBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		batch   []models.Client
+		wantID  string
+		wantErr error
+	}{
+		{
+			name:    "address of stored client",
+			batch:   []models.Client{testClient("tablet", "10.0.0.3/32"), testClient("phone", "10.0.0.2/32")},
+			wantID:  "phone",
+			wantErr: ErrAddressTaken,
+		},
+		{
+			name:    "address within batch",
+			batch:   []models.Client{testClient("tablet", "10.0.0.3/32"), testClient("phone", "10.0.0.3/32")},
+			wantID:  "phone",
+			wantErr: ErrAddressTaken,
+		},
+		{
+			name: "key within batch",
+			batch: []models.Client{
+				testClient("tablet", "10.0.0.3/32"),
+				{ID: "phone", ServerID: "wg0", Name: "phone", PublicKey: "tablet-key", AllowedIPs: "10.0.0.4/32"},
+			},
+			wantID:  "phone",
+			wantErr: ErrKeyTaken,
+		},
+		{
+			name:    "unknown server",
+			batch:   []models.Client{testClient("tablet", "10.0.0.3/32"), {ID: "phone", ServerID: "wg9", AllowedIPs: "10.0.0.4/32"}},
+			wantID:  "phone",
+			wantErr: ErrServerNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, storage, _ := newTestService(t)
+			if _, err := svc.CreateClient(testClient("laptop", "10.0.0.2/32")); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := svc.CreateClients(tt.batch)
+			var bulkErr *BulkError
+			if !errors.As(err, &bulkErr) || bulkErr.ClientID != tt.wantID || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v for client %s", err, tt.wantErr, tt.wantID)
+			}
+			if clients := storage.GetAllClients(); len(clients) != 1 {
+				t.Errorf("%d clients stored after a rejected batch, want 1", len(clients))
+			}
+		})
+	}
+}
+
+func TestCreateClients(t *testing.T) {
+	svc, storage, _ := newTestService(t)
+	created, err := svc.CreateClients([]models.Client{testClient("laptop", "10.0.0.2/32"), testClient("phone", "10.0.0.3/32")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range created {
+		stored, ok := storage.CopyClient(client.ID)
+		if !ok || stored.Version != 1 || client.Version != 1 {
+			t.Errorf("client %s: stored %+v, returned version %d", client.ID, stored, client.Version)
+		}
+	}
+}
+
+func TestBulkClientActionRejectsWholeBatch(t *testing.T) {
+	for _, action := range []string{BulkDisable, BulkDelete} {
+		t.Run(action, func(t *testing.T) {
+			svc, storage, _ := newTestService(t)
+			created, err := svc.CreateClients([]models.Client{testClient("laptop", "10.0.0.2/32"), testClient("phone", "10.0.0.3/32")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Телефон изменен после того, как список был прочитан
+			renamed := created[1]
+			renamed.Name = "renamed"
+			if _, err := svc.UpdateClient(renamed, renamed.Version); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = svc.BulkClientAction(action, created)
+			var bulkErr *BulkError
+			if !errors.As(err, &bulkErr) || bulkErr.ClientID != "phone" || !errors.Is(err, ErrConflict) {
+				t.Fatalf("got %v, want conflict for phone", err)
+			}
+			_, err = svc.BulkClientAction(action, []models.Client{created[0], {ID: "missing", Version: 1}})
+			if !errors.As(err, &bulkErr) || bulkErr.ClientID != "missing" || !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want not found for missing", err)
+			}
+
+			stored, ok := storage.CopyClient("laptop")
+			if !ok || stored.IsDisabled || stored.Version != created[0].Version {
+				t.Errorf("laptop changed by a rejected batch: %+v, %v", stored, ok)
+			}
+			if clients := storage.GetAllClients(); len(clients) != 2 {
+				t.Errorf("%d clients stored after a rejected batch, want 2", len(clients))
+			}
+		})
+	}
+}
+
+func TestBulkClientActionUnsaved(t *testing.T) {
+	svc, storage, state := newTestService(t)
+	created, err := svc.CreateClients([]models.Client{testClient("laptop", "10.0.0.2/32"), testClient("phone", "10.0.0.3/32")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.fail(t)
+	for _, action := range []string{BulkDisable, BulkDelete} {
+		if _, err := svc.BulkClientAction(action, created); !errors.Is(err, ErrNotSaved) {
+			t.Errorf("%s: got %v, want ErrNotSaved", action, err)
+		}
+	}
+	for _, client := range created {
+		stored, ok := storage.CopyClient(client.ID)
+		if !ok || stored.IsDisabled || stored.Version != client.Version {
+			t.Errorf("client %s changed by a failed save: %+v, %v", client.ID, stored, ok)
+		}
+	}
+
+	state.recover(t)
+	updated, err := svc.BulkClientAction(BulkDisable, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range updated {
+		if stored, _ := storage.CopyClient(client.ID); !stored.IsDisabled || stored.Version != client.Version {
+			t.Errorf("client %s not disabled: %+v", client.ID, stored)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"wireguard-web-manager/models"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Client возвращает копию клиента
+func (s *Service) Client(id string) (models.Client, error) {
+	client, ok := s.storage.CopyClient(id)
+	if !ok {
+		return models.Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+// Clients возвращает копии всех клиентов
+func (s *Service) Clients() []models.Client {
+	return s.storage.CopyClients()
+}
+
+// CreateClient добавляет пир клиента на интерфейс, если клиент должен быть
+// подключен, и сохраняет клиента. Ключ и адрес повторно проверяются на
+// уникальность: между проверкой в запросе и созданием их мог занять другой клиент.
+func (s *Service) CreateClient(client models.Client) (models.Client, error) {
+	err := s.run(func(u *unit) error {
+		if _, ok := s.storage.CopyServer(client.ServerID); !ok {
+			return ErrServerNotFound
+		}
+		if err := s.checkUnique(&client, ""); err != nil {
+			return err
+		}
+
+		client.IsActive = false
+		if s.wg != nil && client.ShouldBeConnected() {
+			if err := s.attach(u, &client); err != nil {
+				return err
+			}
+		}
+		return s.storage.AddClient(&client)
+	})
+	return client, err
+}
+
+// UpdateClient приводит пир клиента на интерфейсе к состоянию next и
+// сохраняет next, если клиент еще имеет версию version. Пир снимается или
+// добавляется, когда меняется ShouldBeConnected; у подключенного клиента
+// заменяются адреса и ограничения скорости. Ключи не меняются.
+func (s *Service) UpdateClient(next models.Client, version int64) (models.Client, error) {
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(next.ID)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+		if next.AllowedIPs != current.AllowedIPs {
+			if err := s.checkUnique(&next, current.ID); err != nil {
+				return err
+			}
+		}
+
+		if s.wg != nil {
+			if err := s.syncPeer(u, &current, &next); err != nil {
+				return err
+			}
+		}
+		return s.storage.CompareAndUpdateClient(&next, version)
+	})
+	return next, err
+}
+
+// DeleteClient снимает пир клиента с интерфейса и удаляет клиента, если он
+// еще имеет версию version. Возвращает копию удаленной записи.
+func (s *Service) DeleteClient(id string, version int64) (models.Client, error) {
+	var removed models.Client
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(id)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+
+		if s.wg != nil {
+			if err := s.detach(u, &current); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		removed, err = s.storage.CompareAndDeleteClient(id, version)
+		return err
+	})
+	return removed, err
+}
+
+// syncPeer переводит пир клиента на интерфейсе из состояния current в next
+func (s *Service) syncPeer(u *unit, current, next *models.Client) error {
+	wasConnected := current.ShouldBeConnected()
+	connected := next.ShouldBeConnected()
+
+	switch {
+	case wasConnected && !connected:
+		detached := *current
+		if err := s.detach(u, &detached); err != nil {
+			return err
+		}
+		next.IsActive = false
+		next.ResetCounters()
+		return nil
+
+	case !wasConnected && connected:
+		return s.attach(u, next)
+
+	case !connected:
+		return nil
+	}
+
+	if next.AllowedIPs != current.AllowedIPs || next.Endpoint != current.Endpoint || !sameSubnets(next.Subnets, current.Subnets) {
+		// PeerConfig заменяет адреса пира целиком
+		err := u.do(func() error {
+			return s.applyPeer(next)
+		}, func() error {
+			return s.applyPeer(current)
+		})
+		if err != nil {
+			return fmt.Errorf("update peer addresses: %w", err)
+		}
+	}
+	if !sameSubnets(next.Subnets, current.Subnets) {
+		err := u.do(func() error {
+			return s.replaceRoutes(current, next)
+		}, func() error {
+			return s.replaceRoutes(next, current)
+		})
+		if err != nil {
+			return fmt.Errorf("update site routes: %w", err)
+		}
+	}
+
+	if next.TunnelAddress() == current.TunnelAddress() && next.RateLimit() == current.RateLimit() {
+		return nil
+	}
+	if !current.RateLimit().IsZero() {
+		err := u.do(func() error {
+			return s.wg.ClearRateLimit(current.ServerID, current.TunnelAddress())
+		}, func() error {
+			return s.wg.SetRateLimit(current.ServerID, current.TunnelAddress(), current.RateLimit())
+		})
+		if err != nil {
+			return fmt.Errorf("clear rate limit: %w", err)
+		}
+	}
+	if !next.RateLimit().IsZero() {
+		err := u.do(func() error {
+			return s.wg.SetRateLimit(next.ServerID, next.TunnelAddress(), next.RateLimit())
+		}, func() error {
+			return s.wg.ClearRateLimit(next.ServerID, next.TunnelAddress())
+		})
+		if err != nil {
+			return fmt.Errorf("apply rate limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// attach добавляет пир клиента на интерфейс
+func (s *Service) attach(u *unit, client *models.Client) error {
+	err := u.do(func() error {
+		return models.AttachPeer(s.wg, client)
+	}, func() error {
+		detached := *client
+		return models.DetachPeer(s.wg, &detached)
+	})
+	if err != nil {
+		// AttachPeer мог успеть добавить пир до ошибки ограничения скорости
+		detached := *client
+		if rmErr := models.DetachPeer(s.wg, &detached); rmErr != nil {
+			log.Printf("не удалось снять пир клиента %s: %v", client.Name, rmErr)
+		}
+		return fmt.Errorf("attach peer: %w", err)
+	}
+	return nil
+}
+
+// detach снимает пир клиента с интерфейса. Отмена возвращает пир, только если
+// клиент был подключен.
+func (s *Service) detach(u *unit, client *models.Client) error {
+	wasConnected := client.ShouldBeConnected()
+	restored := *client
+	err := u.do(func() error {
+		return models.DetachPeer(s.wg, client)
+	}, func() error {
+		if !wasConnected {
+			return nil
+		}
+		return models.AttachPeer(s.wg, &restored)
+	})
+	if err != nil {
+		return fmt.Errorf("detach peer: %w", err)
+	}
+	return nil
+}
+
+// replaceRoutes заменяет маршруты сетей площадки from маршрутами to
+func (s *Service) replaceRoutes(from, to *models.Client) error {
+	if err := models.AddSiteRoutes(s.wg, to); err != nil {
+		return err
+	}
+	kept := make(map[string]bool, len(to.Subnets))
+	for _, subnet := range to.Subnets {
+		kept[subnet] = true
+	}
+	stale := *from
+	stale.Subnets = nil
+	for _, subnet := range from.Subnets {
+		if !kept[subnet] {
+			stale.Subnets = append(stale.Subnets, subnet)
+		}
+	}
+	return models.RemoveSiteRoutes(s.wg, &stale)
+}
+
+// sameSubnets сравнивает списки сетей площадки
+func sameSubnets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) applyPeer(client *models.Client) error {
+	peerCfg, err := client.PeerConfig()
+	if err != nil {
+		return err
+	}
+	return s.wg.ApplyPeers(client.ServerID, []wgtypes.PeerConfig{peerCfg})
+}
+
+// checkUnique проверяет, что открытый ключ и туннельный адрес клиента не
+// заняты другими клиентами сервера. exceptID исключает самого клиента.
+func (s *Service) checkUnique(client *models.Client, exceptID string) error {
+	address := hostAddress(client.TunnelAddress())
+	for id, other := range s.storage.GetClientsByServerID(client.ServerID) {
+		if id == exceptID {
+			continue
+		}
+		if exceptID == "" && other.PublicKey == client.PublicKey {
+			return ErrKeyTaken
+		}
+		if address != "" && hostAddress(other.TunnelAddress()) == address {
+			return ErrAddressTaken
+		}
+	}
+	return nil
+}
+
+// hostAddress отбрасывает маску из адреса вида 10.0.0.2/32
+func hostAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if idx := strings.Index(addr, "/"); idx > 0 {
+		addr = addr[:idx]
+	}
+	return addr
+}
+
+// MarkConfigDelivered отмечает, что клиент получил актуальную конфигурацию.
+// Возвращает копии клиента до и после изменения.
+func (s *Service) MarkConfigDelivered(id string) (models.Client, models.Client, error) {
+	var before, next models.Client
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(id)
+		if !ok {
+			return ErrNotFound
+		}
+		before, next = current, current
+		now := time.Now()
+		next.Downloaded = true
+		next.DownloadAt = &now
+		next.ConfigOutdated = false
+		return s.storage.CompareAndUpdateClient(&next, current.Version)
+	})
+	return before, next, err
+}
+
+// MarkClientOutdated помечает конфигурацию клиента устаревшей, например
+// после изменения маршрутов его группы. Возвращает копию клиента.
+func (s *Service) MarkClientOutdated(id string) (models.Client, error) {
+	var next models.Client
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(id)
+		if !ok {
+			return ErrNotFound
+		}
+		next = current
+		next.ConfigOutdated = true
+		next.Downloaded = false
+		return s.storage.CompareAndUpdateClient(&next, current.Version)
+	})
+	return next, err
+}
+
+// RecordUsage сохраняет учет трафика клиентов, прочитанных через Client или
+// Clients. Интерфейс не меняется: переходы через квоту выполняет
+// UpdateClient. Клиенты, измененные после чтения, пропускаются, их трафик
+// учитывается в следующий раз по тем же счетчикам ядра. Возвращает копии
+// сохраненных клиентов.
+func (s *Service) RecordUsage(clients []models.Client) []models.Client {
+	if len(clients) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.storage.RecordClientUsage(clients)
+}
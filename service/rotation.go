@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"wireguard-web-manager/models"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// RotateClientKey начинает смену ключей клиента, если он еще имеет версию
+// version: новый пир добавляется на интерфейс рядом со старым. При immediate
+// адреса сразу переносятся на новый пир, а старый снимается.
+func (s *Service) RotateClientKey(id string, version int64, privateKey, publicKey string, deadline time.Time, immediate bool) (models.Client, error) {
+	var next models.Client
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(id)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+		if _, exists := s.storage.FindClientByPublicKey(current.ServerID, publicKey); exists {
+			return ErrKeyTaken
+		}
+
+		next = current
+		// Отмена получает состояние сразу после начала смены: после
+		// завершения смены next уже без нового ключа
+		var pending models.Client
+		err := u.do(func() error {
+			if err := models.BeginKeyRotation(s.wg, &next, privateKey, publicKey, deadline); err != nil {
+				return err
+			}
+			pending = next
+			return nil
+		}, func() error {
+			return models.CancelKeyRotation(s.wg, &pending)
+		})
+		if err != nil {
+			return fmt.Errorf("begin key rotation: %w", err)
+		}
+
+		if immediate {
+			if err := s.completeRotation(u, &next); err != nil {
+				return err
+			}
+		}
+		return s.storage.CompareAndUpdateClient(&next, version)
+	})
+	return next, err
+}
+
+// CompleteClientKeyRotation переносит адреса клиента на новый пир и делает
+// новый ключ основным, если клиент еще имеет версию version
+func (s *Service) CompleteClientKeyRotation(id string, version int64) (models.Client, error) {
+	var next models.Client
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(id)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+
+		next = current
+		if err := s.completeRotation(u, &next); err != nil {
+			return err
+		}
+		return s.storage.CompareAndUpdateClient(&next, version)
+	})
+	return next, err
+}
+
+// completeRotation завершает смену ключей клиента. Отмена возвращает адреса
+// старому пиру и снимает их с нового. CompleteKeyRotation может не
+// выполниться между переносом адресов и снятием старого пира, поэтому при
+// ошибке отмена выполняется сразу.
+func (s *Service) completeRotation(u *unit, client *models.Client) error {
+	previous := *client
+	undo := func() error {
+		return s.restoreRotation(&previous)
+	}
+	if err := u.do(func() error {
+		return models.CompleteKeyRotation(s.wg, client)
+	}, undo); err != nil {
+		undoPartial(undo)
+		return fmt.Errorf("complete key rotation: %w", err)
+	}
+	return nil
+}
+
+// restoreRotation возвращает пиры клиента в состояние до завершения смены
+// ключей: старый пир с адресами клиента, новый — без адресов
+func (s *Service) restoreRotation(client *models.Client) error {
+	if s.wg == nil || !client.ShouldBeConnected() || !client.RotationPending() {
+		return nil
+	}
+	pending, err := client.PendingPeerConfig()
+	if err != nil {
+		return err
+	}
+	peerCfg, err := client.PeerConfig()
+	if err != nil {
+		return err
+	}
+	return s.wg.ApplyPeers(client.ServerID, []wgtypes.PeerConfig{pending, peerCfg})
+}
+
+// CancelClientKeyRotation снимает новый пир клиента и отменяет смену ключей,
+// если клиент еще имеет версию version
+func (s *Service) CancelClientKeyRotation(id string, version int64) (models.Client, error) {
+	var next models.Client
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyClient(id)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+
+		next = current
+		err := u.do(func() error {
+			return models.CancelKeyRotation(s.wg, &next)
+		}, func() error {
+			if s.wg == nil || !current.ShouldBeConnected() {
+				return nil
+			}
+			return models.AttachPendingPeer(s.wg, &current)
+		})
+		if err != nil {
+			return fmt.Errorf("cancel key rotation: %w", err)
+		}
+		return s.storage.CompareAndUpdateClient(&next, version)
+	})
+	return next, err
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/wireguard"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Server возвращает копию сервера
+func (s *Service) Server(id string) (models.Server, error) {
+	server, ok := s.storage.CopyServer(id)
+	if !ok {
+		return models.Server{}, ErrNotFound
+	}
+	return server, nil
+}
+
+// Servers возвращает копии всех серверов
+func (s *Service) Servers() []models.Server {
+	return s.storage.CopyServers()
+}
+
+// CreateServer создает интерфейс сервера без пиров и сохраняет сервер
+func (s *Service) CreateServer(server models.Server) (models.Server, error) {
+	err := s.run(func(u *unit) error {
+		if _, exists := s.storage.CopyServer(server.ID); exists {
+			return ErrServerExists
+		}
+		if s.wg != nil {
+			if err := s.wg.ConfigureServer(server.ID, server.PrivateKey, server.ListenPort, true, nil); err != nil {
+				return fmt.Errorf("configure interface: %w", err)
+			}
+		}
+		return s.storage.AddServer(&server)
+	})
+	return server, err
+}
+
+// UpdateServer применяет ключ и порт сервера к интерфейсу и сохраняет next,
+// если сервер еще имеет версию version. При смене ключа конфигурации всех
+// клиентов сервера помечаются устаревшими.
+func (s *Service) UpdateServer(next models.Server, version int64) (models.Server, error) {
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyServer(next.ID)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+
+		keyRotated := next.PrivateKey != current.PrivateKey
+		if keyRotated {
+			now := time.Now()
+			next.KeyRotatedAt = &now
+		}
+
+		if s.wg != nil {
+			err := u.do(func() error {
+				return s.wg.ConfigureServer(next.ID, next.PrivateKey, next.ListenPort, false, nil)
+			}, func() error {
+				return s.wg.ConfigureServer(current.ID, current.PrivateKey, current.ListenPort, false, nil)
+			})
+			if err != nil {
+				return fmt.Errorf("configure interface: %w", err)
+			}
+		}
+
+		return s.storage.CompareAndUpdateServer(&next, version)
+	})
+	return next, err
+}
+
+// DeleteServer снимает все пиры с интерфейса сервера и удаляет сервер вместе
+// с клиентами, если он еще имеет версию version. Возвращает копии удаленных
+// записей.
+func (s *Service) DeleteServer(id string, version int64) (models.Server, []models.Client, error) {
+	var (
+		server  models.Server
+		removed []models.Client
+	)
+	err := s.run(func(u *unit) error {
+		current, ok := s.storage.CopyServer(id)
+		if !ok {
+			return ErrNotFound
+		}
+		if current.Version != version {
+			return ErrConflict
+		}
+
+		if s.wg != nil {
+			clients := s.serverClients(id)
+			err := u.do(func() error {
+				return s.wg.ConfigureServer(id, "", 0, true, nil)
+			}, func() error {
+				return s.restorePeers(current, clients)
+			})
+			if err != nil {
+				return fmt.Errorf("clear interface: %w", err)
+			}
+		}
+
+		var err error
+		server, removed, err = s.storage.CompareAndDeleteServer(id, version)
+		if err != nil {
+			return err
+		}
+
+		if s.wg != nil {
+			for i := range removed {
+				client := &removed[i]
+				if client.ShouldBeConnected() && !client.RateLimit().IsZero() {
+					if err := s.wg.ClearRateLimit(id, client.TunnelAddress()); err != nil {
+						log.Printf("не удалось снять ограничение скорости клиента %s: %v", client.Name, err)
+					}
+				}
+			}
+			if err := s.wg.SyncRoutes(id, nil); err != nil {
+				log.Printf("не удалось удалить маршруты площадок %s: %v", id, err)
+			}
+		}
+		return nil
+	})
+	return server, removed, err
+}
+
+// Devices возвращает интерфейсы WireGuard хоста; без WireGuard — пустой список
+func (s *Service) Devices() ([]*wgtypes.Device, error) {
+	if s.wg == nil {
+		return nil, nil
+	}
+	return s.wg.Devices()
+}
+
+// RestoreServer заменяет сервер и всех его клиентов записями из резервной
+// копии. Интерфейс настраивается заново с пирами подключаемых клиентов; если
+// настроить его не удалось, прежние пиры возвращаются, а хранилище не
+// меняется. Ошибки ограничений скорости и маршрутов площадок восстановление
+// не отменяют и возвращаются как предупреждения.
+func (s *Service) RestoreServer(server models.Server, clients []models.Client) ([]string, error) {
+	var warnings []string
+	err := s.run(func(u *unit) error {
+		for i := range clients {
+			clients[i].IsActive = s.wg != nil && clients[i].ShouldBeConnected()
+			clients[i].ResetCounters()
+		}
+
+		if s.wg != nil {
+			previous, existed := s.storage.CopyServer(server.ID)
+			previousClients := s.serverClients(server.ID)
+			if err := s.restorePeers(server, clients); err != nil {
+				if existed {
+					undoPartial(func() error { return s.restorePeers(previous, previousClients) })
+				}
+				return err
+			}
+
+			for i := range clients {
+				client := &clients[i]
+				if client.ShouldBeConnected() && !client.RateLimit().IsZero() {
+					if err := s.wg.SetRateLimit(server.ID, client.TunnelAddress(), client.RateLimit()); err != nil {
+						warnings = append(warnings, fmt.Sprintf("client %s: rate limit not applied: %v", client.Name, err))
+					}
+				}
+			}
+
+			sites := make([]*models.Client, 0, len(clients))
+			for i := range clients {
+				sites = append(sites, &clients[i])
+			}
+			networks, err := models.SiteRoutes(sites)
+			if err == nil {
+				err = s.wg.SyncRoutes(server.ID, networks)
+			}
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("site routes not applied: %v", err))
+			}
+		}
+
+		server.IsActive = s.wg != nil
+		stored := make([]*models.Client, len(clients))
+		for i := range clients {
+			client := clients[i]
+			stored[i] = &client
+		}
+		return s.storage.ReplaceServer(&server, stored)
+	})
+	return warnings, err
+}
+
+// serverClients копии клиентов сервера
+func (s *Service) serverClients(serverID string) []models.Client {
+	stored := s.storage.GetClientsByServerID(serverID)
+	clients := make([]models.Client, 0, len(stored))
+	for _, client := range stored {
+		clients = append(clients, *client)
+	}
+	return clients
+}
+
+// restorePeers возвращает на интерфейс пиры подключенных клиентов сервера
+func (s *Service) restorePeers(server models.Server, clients []models.Client) error {
+	peers := make([]wgtypes.PeerConfig, 0, len(clients))
+	for i := range clients {
+		client := &clients[i]
+		if !client.ShouldBeConnected() {
+			continue
+		}
+		peerCfg, err := client.PeerConfig()
+		if err != nil {
+			return fmt.Errorf("client %s: %w", client.ID, err)
+		}
+		peers = append(peers, peerCfg)
+		if client.RotationPending() {
+			pending, err := client.PendingPeerConfig()
+			if err != nil {
+				return fmt.Errorf("client %s: %w", client.ID, err)
+			}
+			peers = append(peers, pending)
+		}
+	}
+	return s.wg.ConfigureServer(server.ID, server.PrivateKey, server.ListenPort, true, peers)
+}
+
+// SyncRoutes приводит маршруты сетей площадок на интерфейсах серверов к
+// подключенным площадкам. Маршруты пропадают вместе с интерфейсом и могут
+// остаться от площадок, удаленных, пока приложение не работало, поэтому они
+// сверяются при запуске.
+func (s *Service) SyncRoutes() {
+	if s.wg == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, server := range s.storage.CopyServers() {
+		if !server.IsActive {
+			continue
+		}
+		clients := s.serverClients(server.ID)
+		sites := make([]*models.Client, 0, len(clients))
+		for i := range clients {
+			sites = append(sites, &clients[i])
+		}
+		networks, err := models.SiteRoutes(sites)
+		if err == nil {
+			err = s.wg.SyncRoutes(server.ID, networks)
+		}
+		if err != nil {
+			log.Printf("не удалось восстановить маршруты площадок %s: %v", server.ID, err)
+		}
+	}
+}
+
+// SyncRateLimits приводит ограничения скорости на интерфейсах серверов к
+// сохраненным у клиентов. Правила tc пропадают вместе с интерфейсом, поэтому
+// при запуске ограничения клиентов с пиром на интерфейсе применяются заново,
+// а ограничения клиентов без лимита или без пира снимаются.
+func (s *Service) SyncRateLimits() {
+	if s.wg == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, server := range s.storage.CopyServers() {
+		if !server.IsActive {
+			continue
+		}
+		applied, err := s.wg.RateLimits(server.ID)
+		if err != nil {
+			log.Printf("не удалось прочитать ограничения скорости %s: %v", server.ID, err)
+			continue
+		}
+		for _, client := range s.serverClients(server.ID) {
+			minor, err := wireguard.AddressMinor(client.TunnelAddress())
+			if err != nil {
+				continue
+			}
+			limit := client.RateLimit()
+			if !client.IsActive {
+				limit = wireguard.RateLimit{}
+			}
+			current, ok := applied[minor]
+			switch {
+			case !limit.IsZero() && current != limit:
+				err = s.wg.SetRateLimit(server.ID, client.TunnelAddress(), limit)
+			case limit.IsZero() && ok:
+				err = s.wg.ClearRateLimit(server.ID, client.TunnelAddress())
+			}
+			if err != nil {
+				log.Printf("не удалось восстановить ограничение скорости клиента %s: %v", client.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"wireguard-web-manager/models"
+	"wireguard-web-manager/wireguard"
+)
+
+var (
+	// ErrNotFound запись не найдена или удалена во время операции
+	ErrNotFound = models.ErrRecordNotFound
+	// ErrConflict запись изменена после того, как была прочитана
+	ErrConflict = models.ErrVersionConflict
+	// ErrNotSaved файл состояния не записан, изменение отменено
+	ErrNotSaved = models.ErrNotSaved
+	// ErrServerNotFound сервер клиента не найден
+	ErrServerNotFound = errors.New("server not found")
+	// ErrServerExists сервер с таким именем уже есть
+	ErrServerExists = errors.New("server already exists")
+	// ErrAddressTaken адрес клиента занят другим клиентом сервера
+	ErrAddressTaken = errors.New("address is used by another client")
+	// ErrKeyTaken открытый ключ клиента уже есть на сервере
+	ErrKeyTaken = errors.New("public key is used by another client")
+)
+
+// Service выполняет изменения серверов и клиентов как единое целое: изменение
+// интерфейса WireGuard и запись в хранилище. Если какой-либо шаг не удался,
+// уже выполненные изменения интерфейса отменяются в обратном порядке, а
+// хранилище не меняется. Наружу отдаются копии записей, а не указатели из
+// хранилища.
+type Service struct {
+	storage *models.Storage
+	wg      *wireguard.Service // nil — меняется только хранилище
+
+	mu sync.Mutex // операции выполняются по одной
+}
+
+// New создает сервис. wg может быть nil.
+func New(storage *models.Storage, wg *wireguard.Service) *Service {
+	return &Service{storage: storage, wg: wg}
+}
+
+// unit выполняемая операция: отмены уже сделанных изменений интерфейса
+type unit struct {
+	undo []func() error
+}
+
+// do выполняет шаг и запоминает его отмену
+func (u *unit) do(step, undo func() error) error {
+	if err := step(); err != nil {
+		return err
+	}
+	if undo != nil {
+		u.undo = append(u.undo, undo)
+	}
+	return nil
+}
+
+// rollback отменяет сделанные шаги в обратном порядке. Ошибки отмены только
+// записываются в журнал: исходная ошибка важнее.
+func (u *unit) rollback() {
+	for i := len(u.undo) - 1; i >= 0; i-- {
+		if err := u.undo[i](); err != nil {
+			log.Printf("не удалось отменить изменение интерфейса: %v", err)
+		}
+	}
+}
+
+// run выполняет операцию, откатывая ее при ошибке
+func (s *Service) run(op func(u *unit) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &unit{}
+	if err := op(u); err != nil {
+		u.rollback()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wireguard-web-manager/models"
+)
+
+// stateFile файл состояния тестового хранилища. Пока он подменен
+// каталогом, записать состояние нельзя.
+type stateFile string
+
+func (f stateFile) fail(t *testing.T) {
+	t.Helper()
+	if err := os.Remove(string(f)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(string(f), 0o700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f stateFile) recover(t *testing.T) {
+	t.Helper()
+	if err := os.Remove(string(f)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestService сервис без интерфейсов WireGuard над хранилищем с файлом
+// состояния и сервером wg0
+func newTestService(t *testing.T) (*Service, *models.Storage, stateFile) {
+	t.Helper()
+	storage := &models.Storage{
+		Servers:  make(map[string]*models.Server),
+		Clients:  make(map[string]*models.Client),
+		Groups:   make(map[string]*models.Group),
+		Webhooks: make(map[string]*models.WebhookSubscription),
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := storage.EnablePersistence(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	svc := New(storage, nil)
+	if _, err := svc.CreateServer(models.Server{ID: "wg0", Name: "office", Network: "10.0.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	return svc, storage, stateFile(path)
+}
+
+func testClient(id, address string) models.Client {
+	return models.Client{ID: id, ServerID: "wg0", Name: id, PublicKey: id + "-key", AllowedIPs: address}
+}
+
+func TestUnsavedChangesAreRolledBack(t *testing.T) {
+	svc, storage, state := newTestService(t)
+	created, err := svc.CreateClient(testClient("laptop", "10.0.0.2/32"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.fail(t)
+
+	if _, err := svc.CreateClient(testClient("phone", "10.0.0.3/32")); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("create: got %v, want ErrNotSaved", err)
+	}
+	if _, ok := storage.CopyClient("phone"); ok {
+		t.Error("unsaved client is kept in memory")
+	}
+
+	renamed := created
+	renamed.Name = "renamed"
+	if _, err := svc.UpdateClient(renamed, created.Version); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("update: got %v, want ErrNotSaved", err)
+	}
+	if _, err := svc.DeleteClient(created.ID, created.Version); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("delete: got %v, want ErrNotSaved", err)
+	}
+	server, _ := svc.Server("wg0")
+	if _, _, err := svc.DeleteServer("wg0", server.Version); !errors.Is(err, ErrNotSaved) {
+		t.Errorf("delete server: got %v, want ErrNotSaved", err)
+	}
+
+	stored, ok := storage.CopyClient(created.ID)
+	if !ok || stored.Name != created.Name || stored.Version != created.Version {
+		t.Errorf("client after failed saves: %+v, %v", stored, ok)
+	}
+	if _, ok := storage.CopyServer("wg0"); !ok {
+		t.Error("server removed by a failed save")
+	}
+
+	state.recover(t)
+	if _, err := svc.UpdateClient(renamed, created.Version); err != nil {
+		t.Errorf("update after recovery: %v", err)
+	}
+}
+
+func TestUnsavedKeyRotationKeepsClientConfigs(t *testing.T) {
+	svc, storage, state := newTestService(t)
+	created, err := svc.CreateClient(testClient("laptop", "10.0.0.2/32"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := svc.Server("wg0")
+	rotated := server
+	rotated.PrivateKey = "new-key"
+
+	state.fail(t)
+	if _, err := svc.UpdateServer(rotated, server.Version); !errors.Is(err, ErrNotSaved) {
+		t.Fatalf("update server: got %v, want ErrNotSaved", err)
+	}
+	if stored, _ := storage.CopyClient(created.ID); stored.ConfigOutdated || stored.Version != created.Version {
+		t.Errorf("client marked outdated by a failed save: %+v", stored)
+	}
+
+	state.recover(t)
+	if _, err := svc.UpdateServer(rotated, server.Version); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := storage.CopyClient(created.ID); !stored.ConfigOutdated {
+		t.Error("client config not marked outdated after key rotation")
+	}
+}
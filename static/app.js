@@ -1,13 +1,24 @@
 // Глобальные переменные
 let currentServer = null;
 
+// Перевод сообщения по каталогу window.I18N, который страница получает от
+// сервера. %s и %d заменяются аргументами по порядку.
+function t(message, ...args) {
+    const catalog = window.I18N || {};
+    let text = catalog[message] || message;
+    args.forEach(arg => {
+        text = text.replace(/%[sd]/, arg);
+    });
+    return text;
+}
+
 // Создание нового сервера
 function createNewServer() {
     console.log('Creating new server...');
     
     // Проверяем, что мы на правильной странице
     if (window.location.pathname !== '/dashboard') {
-        showAlert('Функция доступна только на странице dashboard', 'warning');
+        showAlert(t('Функция доступна только на странице dashboard'), 'warning');
         return;
     }
     
@@ -17,26 +28,13 @@ function createNewServer() {
     const serverForm = document.getElementById('serverForm');
     if (!serverForm) {
         console.error('Server form not found');
-        showAlert('Форма сервера не найдена', 'danger');
+        showAlert(t('Форма сервера не найдена'), 'danger');
         return;
     }
     
-    // Очищаем форму
+    // Очищаем форму: reset() возвращает значения по умолчанию из настроек сервера
     serverForm.reset();
     
-    // Устанавливаем значения по умолчанию
-    const elements = {
-        serverPort: document.getElementById('serverPort'),
-        serverNetwork: document.getElementById('serverNetwork'),
-        serverDNS: document.getElementById('serverDNS'),
-        serverAllowedIPs: document.getElementById('serverAllowedIPs')
-    };
-    
-    if (elements.serverPort) elements.serverPort.value = 51820;
-    if (elements.serverNetwork) elements.serverNetwork.value = '10.0.0.0/24';
-    if (elements.serverDNS) elements.serverDNS.value = '8.8.8.8';
-    if (elements.serverAllowedIPs) elements.serverAllowedIPs.value = '0.0.0.0/0';
-    
     // Скрываем информацию о сервере
     const serverInfo = document.getElementById('serverInfo');
     if (serverInfo) {
@@ -44,7 +42,7 @@ function createNewServer() {
     }
     
     // Показываем уведомление
-    showAlert('Форма очищена. Готов к созданию нового сервера', 'info');
+    showAlert(t('Форма очищена. Готов к созданию нового сервера'), 'info');
 }
 
 // Инициализация при загрузке страницы
@@ -113,19 +111,19 @@ function populateServerForm(server) {
         elements.serverName.value = server.name || '';
     }
     if (elements.serverPort) {
-        elements.serverPort.value = server.listen_port || 51820;
+        elements.serverPort.value = server.listen_port || elements.serverPort.defaultValue;
     }
     if (elements.serverNetwork) {
-        elements.serverNetwork.value = server.network || '10.0.0.0/24';
+        elements.serverNetwork.value = server.network || elements.serverNetwork.defaultValue;
     }
     if (elements.serverDNS) {
-        elements.serverDNS.value = server.dns || '8.8.8.8';
+        elements.serverDNS.value = server.dns || elements.serverDNS.defaultValue;
     }
     if (elements.serverEndpoint) {
         elements.serverEndpoint.value = server.endpoint || '';
     }
     if (elements.serverAllowedIPs) {
-        elements.serverAllowedIPs.value = server.allowed_ips || '0.0.0.0/0';
+        elements.serverAllowedIPs.value = server.allowed_ips || elements.serverAllowedIPs.defaultValue;
     }
 }
 
@@ -141,16 +139,16 @@ function showServerInfo(server) {
     
     // Проверяем существование каждого элемента перед установкой текста
     if (elements.currentServerId) {
-        elements.currentServerId.textContent = server.id || 'Не задан';
+        elements.currentServerId.textContent = server.id || t('Не задан');
     }
     if (elements.currentServerPort) {
-        elements.currentServerPort.textContent = server.listen_port || 'Не задан';
+        elements.currentServerPort.textContent = server.listen_port || t('Не задан');
     }
     if (elements.currentServerNetwork) {
-        elements.currentServerNetwork.textContent = server.network || 'Не задана';
+        elements.currentServerNetwork.textContent = server.network || t('Не задана');
     }
     if (elements.currentServerEndpoint) {
-        elements.currentServerEndpoint.textContent = server.endpoint || 'Не задан';
+        elements.currentServerEndpoint.textContent = server.endpoint || t('Не задан');
     }
     if (elements.serverInfo) {
         elements.serverInfo.style.display = 'block';
@@ -173,28 +171,37 @@ async function handleServerSubmit(event) {
     try {
         const method = currentServer ? 'PUT' : 'POST';
         const url = currentServer ? `/api/server/${currentServer.id}` : '/api/server';
-        const action = currentServer ? 'обновлен' : 'создан';
+        const successMessage = currentServer ? t('Сервер успешно обновлен') : t('Сервер успешно создан');
+        
+        const headers = {
+            'Content-Type': 'application/json'
+        };
+        // Изменения другого администратора не перезаписываются: сервер вернет 412
+        if (currentServer) {
+            headers['If-Match'] = `"${currentServer.version}"`;
+        }
         
         const response = await fetch(url, {
             method: method,
-            headers: {
-                'Content-Type': 'application/json'
-            },
+            headers: headers,
             body: JSON.stringify(formData)
         });
         
         const data = await response.json();
         
         if (data.success) {
-            showAlert(`Сервер успешно ${action}`, 'success');
+            showAlert(successMessage, 'success');
             currentServer = data.data;
             showServerInfo(data.data);
+        } else if (response.status === 412) {
+            showAlert(t('Ошибка: %s', data.error), 'warning');
+            loadServerConfig();
         } else {
-            showAlert('Ошибка: ' + data.error, 'danger');
+            showAlert(t('Ошибка: %s', data.error), 'danger');
         }
     } catch (error) {
         console.error('Ошибка сохранения сервера:', error);
-        showAlert('Ошибка сохранения сервера', 'danger');
+        showAlert(t('Ошибка сохранения сервера'), 'danger');
     }
 }
 
@@ -203,16 +210,41 @@ async function handleClientSubmit(event) {
     event.preventDefault();
     
     if (!currentServer) {
-        showAlert('Сначала настройте сервер', 'warning');
+        showAlert(t('Сначала настройте сервер'), 'warning');
         return;
     }
     
+    const quotaGB = parseFloat(document.getElementById('clientQuota').value) || 0;
+    
     const formData = {
         server_id: currentServer.id,
         name: document.getElementById('clientName').value,
-        email: document.getElementById('clientEmail').value
+        email: document.getElementById('clientEmail').value,
+        tags: document.getElementById('clientTags').value.split(',').map(tag => tag.trim()).filter(tag => tag),
+        public_key: document.getElementById('clientPublicKey').value.trim(),
+        quota_bytes: Math.round(quotaGB * 1024 * 1024 * 1024),
+        quota_period: document.getElementById('clientQuotaPeriod').value,
+        egress_kbit: parseInt(document.getElementById('clientEgress').value) || 0,
+        ingress_kbit: parseInt(document.getElementById('clientIngress').value) || 0
     };
     
+    const expiresAt = document.getElementById('clientExpiresAt').value;
+    if (expiresAt) {
+        formData.expires_at = new Date(expiresAt).toISOString();
+    }
+
+    // Заполненные поля площадки делают пир шлюзом другой сети
+    const splitList = id => document.getElementById(id).value.split(',').map(item => item.trim()).filter(item => item);
+    const subnets = splitList('clientSubnets');
+    const localSubnets = splitList('clientLocalSubnets');
+    const endpoint = document.getElementById('clientEndpoint').value.trim();
+    if (subnets.length || localSubnets.length || endpoint) {
+        formData.kind = 'site';
+        formData.subnets = subnets;
+        formData.local_subnets = localSubnets;
+        formData.endpoint = endpoint;
+    }
+    
     try {
         const response = await fetch('/api/clients', {
             method: 'POST',
@@ -225,16 +257,16 @@ async function handleClientSubmit(event) {
         const data = await response.json();
         
         if (data.success) {
-            showAlert('Клиент добавлен', 'success');
+            showAlert(t('Клиент добавлен'), 'success');
             document.getElementById('clientForm').reset();
             loadClients();
             loadStats();
         } else {
-            showAlert('Ошибка: ' + data.error, 'danger');
+            showAlert(t('Ошибка: %s', data.error), 'danger');
         }
     } catch (error) {
         console.error('Ошибка добавления клиента:', error);
-        showAlert('Ошибка добавления клиента', 'danger');
+        showAlert(t('Ошибка добавления клиента'), 'danger');
     }
 }
 
@@ -249,18 +281,28 @@ async function loadClients() {
     }
     
     try {
-        const serverId = currentServer ? currentServer.id : '';
-        const url = serverId ? `/api/clients?server_id=${serverId}` : '/api/clients';
-        
-        console.log('Fetching clients from:', url);
-        const response = await fetch(url);
-        const data = await response.json();
+        const params = new URLSearchParams({ sort: 'name', limit: '1000' });
+        if (currentServer) {
+            params.set('server_id', currentServer.id);
+        }
         
-        console.log('Clients API response:', data);
+        // Список отдается страницами: проходим по курсорам до последней
+        const clients = [];
+        let cursor = '';
+        do {
+            if (cursor) {
+                params.set('cursor', cursor);
+            }
+            const response = await fetch(`/api/clients?${params}`);
+            const data = await response.json();
+            if (!data.success) {
+                return;
+            }
+            clients.push(...data.data);
+            cursor = data.next_cursor;
+        } while (cursor);
         
-        if (data.success) {
-            renderClients(data.data);
-        }
+        renderClients(clients);
     } catch (error) {
         console.error('Ошибка загрузки клиентов:', error);
         renderClients([]);
@@ -296,32 +338,42 @@ function renderClients(clients) {
     console.log('Element found, proceeding to render...');
     
     if (clients.length === 0) {
-        tbody.innerHTML = '<tr><td colspan="6" class="text-center">Клиенты не найдены</td></tr>';
+        tbody.innerHTML = `<tr><td colspan="7" class="text-center">${t('Клиенты не найдены')}</td></tr>`;
         return;
     }
     
     tbody.innerHTML = clients.map(client => `
         <tr>
-            <td>${client.name}</td>
+            <td>${client.name}${(client.tags || []).map(tag => ` <span class="text-muted">#${tag}</span>`).join('')}</td>
             <td>${client.email || '-'}</td>
-            <td>${client.allowed_ips}</td>
+            <td>${client.allowed_ips}${(client.subnets || []).length ? `<br><span class="text-muted">${t('Сети площадки: %s', client.subnets.join(', '))}</span>` : ''}</td>
             <td>
                 <span class="status-badge ${getStatusClass(client)}">
                     ${getStatusText(client)}
                 </span>
             </td>
+            <td>${formatUsage(client)}</td>
             <td>
-                ${client.downloaded ? '<span class="text-success">✓</span>' : '<span class="text-muted">✗</span>'}
+                ${client.config_outdated ? `<span class="text-warning" title="${t('Нужна новая конфигурация')}">⟳</span>` : client.downloaded ? '<span class="text-success">✓</span>' : '<span class="text-muted">✗</span>'}
             </td>
             <td>
-                <button class="btn btn-primary" onclick="downloadConfig('${client.id}')" title="Скачать конфиг">
-                    Скачать
+                <button class="btn btn-primary" onclick="downloadConfig('${client.id}')" title="${t('Скачать конфиг')}">
+                    ${t('Скачать')}
                 </button>
-                <button class="btn btn-warning" onclick="toggleClient('${client.id}', ${client.is_disabled})" title="${client.is_disabled ? 'Включить' : 'Отключить'}">
-                    ${client.is_disabled ? 'Включить' : 'Отключить'}
+                <button class="btn btn-primary" onclick="createDownloadLink('${client.id}')" title="${t('Одноразовая ссылка на конфиг')}">
+                    ${t('Ссылка')}
                 </button>
-                <button class="btn btn-danger" onclick="deleteClient('${client.id}')" title="Удалить">
-                    Удалить
+                ${client.email ? `<button class="btn btn-primary" onclick="sendConfig('${client.id}')" title="${t('Отправить конфиг на %s', client.email)}">
+                    ${t('На email')}
+                </button>` : ''}
+                <button class="btn btn-secondary" onclick="rotateClientKey('${client.id}')" title="${t('Сменить ключи клиента')}">
+                    ${t('Ключ')}
+                </button>
+                <button class="btn btn-warning" onclick="toggleClient('${client.id}', ${client.is_disabled})" title="${client.is_disabled ? t('Включить') : t('Отключить')}">
+                    ${client.is_disabled ? t('Включить') : t('Отключить')}
+                </button>
+                <button class="btn btn-danger" onclick="deleteClient('${client.id}')" title="${t('Удалить')}">
+                    ${t('Удалить')}
                 </button>
             </td>
         </tr>
@@ -331,15 +383,42 @@ function renderClients(clients) {
 // Получение CSS класса для статуса
 function getStatusClass(client) {
     if (client.is_disabled) return 'status-disabled';
+    if (client.expired) return 'status-inactive';
+    if (client.quota_exceeded) return 'status-inactive';
+    if (client.outside_schedule) return 'status-inactive';
     if (client.downloaded) return 'status-downloaded';
     return 'status-active';
 }
 
 // Получение текста статуса
 function getStatusText(client) {
-    if (client.is_disabled) return 'Отключен';
-    if (client.downloaded) return 'Активен (скачал)';
-    return 'Активен';
+    if (client.is_disabled) return t('Отключен');
+    if (client.expired) return t('Срок истек');
+    if (client.quota_exceeded) return t('Квота исчерпана');
+    if (client.outside_schedule) return t('Вне окна доступа');
+    if (client.downloaded) return t('Активен (скачал)');
+    return t('Активен');
+}
+
+// Форматирование объема трафика
+function formatBytes(bytes) {
+    const units = [t('Б'), t('КБ'), t('МБ'), t('ГБ'), t('ТБ')];
+    let value = bytes || 0;
+    let unit = 0;
+    while (value >= 1024 && unit < units.length - 1) {
+        value /= 1024;
+        unit++;
+    }
+    return `${value.toFixed(unit === 0 ? 0 : 1)} ${units[unit]}`;
+}
+
+// Трафик клиента за текущий период относительно квоты
+function formatUsage(client) {
+    const used = formatBytes(client.period_usage);
+    if (!client.quota_bytes) {
+        return used;
+    }
+    return `${used} / ${formatBytes(client.quota_bytes)}`;
 }
 
 // Скачивание конфигурации клиента
@@ -347,6 +426,76 @@ function downloadConfig(clientId) {
     window.open(`/api/clients/${clientId}/config`, '_blank');
 }
 
+// Создание одноразовой ссылки на конфигурацию клиента
+async function createDownloadLink(clientId) {
+    try {
+        const response = await fetch(`/api/clients/${clientId}/links`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ kind: 'config', ttl_minutes: 60 })
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            prompt(t('Ссылка действует 1 час и открывается один раз:'), data.data.url);
+        } else {
+            showAlert(t('Ошибка: %s', data.error), 'danger');
+        }
+    } catch (error) {
+        console.error('Ошибка создания ссылки:', error);
+        showAlert(t('Ошибка создания ссылки'), 'danger');
+    }
+}
+
+// Отправка конфигурации клиента на email
+async function sendConfig(clientId) {
+    try {
+        const response = await fetch(`/api/clients/${clientId}/send-config`, {
+            method: 'POST'
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            showAlert(data.message, 'success');
+        } else {
+            showAlert(t('Ошибка: %s', data.error), 'danger');
+        }
+    } catch (error) {
+        console.error('Ошибка отправки конфигурации:', error);
+        showAlert(t('Ошибка отправки конфигурации'), 'danger');
+    }
+}
+
+// Смена ключей клиента: старая конфигурация работает еще сутки
+async function rotateClientKey(clientId) {
+    if (!confirm(t('Сгенерировать клиенту новые ключи? Старая конфигурация перестанет работать после подключения с новой или через 24 часа.'))) {
+        return;
+    }
+    
+    try {
+        const response = await fetch(`/api/clients/${clientId}/rotate-key`, {
+            method: 'POST'
+        });
+        
+        const data = await response.json();
+        
+        if (data.success) {
+            showAlert(t('Ключи сменены, передайте клиенту новую конфигурацию'), 'success');
+            loadClients();
+            loadStats();
+        } else {
+            showAlert(t('Ошибка: %s', data.error), 'danger');
+        }
+    } catch (error) {
+        console.error('Ошибка смены ключей:', error);
+        showAlert(t('Ошибка смены ключей'), 'danger');
+    }
+}
+
 // Переключение статуса клиента
 async function toggleClient(clientId, isDisabled) {
     try {
@@ -358,21 +507,21 @@ async function toggleClient(clientId, isDisabled) {
         const data = await response.json();
         
         if (data.success) {
-            showAlert(`Клиент ${isDisabled ? 'включен' : 'отключен'}`, 'success');
+            showAlert(isDisabled ? t('Клиент включен') : t('Клиент отключен'), 'success');
             loadClients();
             loadStats();
         } else {
-            showAlert('Ошибка: ' + data.error, 'danger');
+            showAlert(t('Ошибка: %s', data.error), 'danger');
         }
     } catch (error) {
         console.error('Ошибка переключения клиента:', error);
-        showAlert('Ошибка изменения статуса клиента', 'danger');
+        showAlert(t('Ошибка изменения статуса клиента'), 'danger');
     }
 }
 
 // Удаление клиента
 async function deleteClient(clientId) {
-    if (!confirm('Вы уверены, что хотите удалить этого клиента?')) {
+    if (!confirm(t('Вы уверены, что хотите удалить этого клиента?'))) {
         return;
     }
     
@@ -384,15 +533,15 @@ async function deleteClient(clientId) {
         const data = await response.json();
         
         if (data.success) {
-            showAlert('Клиент удален', 'success');
+            showAlert(t('Клиент удален'), 'success');
             loadClients();
             loadStats();
         } else {
-            showAlert('Ошибка: ' + data.error, 'danger');
+            showAlert(t('Ошибка: %s', data.error), 'danger');
         }
     } catch (error) {
         console.error('Ошибка удаления клиента:', error);
-        showAlert('Ошибка удаления клиента', 'danger');
+        showAlert(t('Ошибка удаления клиента'), 'danger');
     }
 }
 
@@ -416,7 +565,8 @@ function updateStatsDisplay(stats) {
         totalClients: document.getElementById('totalClients'),
         activeClients: document.getElementById('activeClients'),
         disabledClients: document.getElementById('disabledClients'),
-        downloadedCount: document.getElementById('downloadedCount')
+        downloadedCount: document.getElementById('downloadedCount'),
+        overQuotaCount: document.getElementById('overQuotaCount')
     };
     
     // Проверяем существование каждого элемента перед установкой текста
@@ -432,6 +582,9 @@ function updateStatsDisplay(stats) {
     if (elements.downloadedCount) {
         elements.downloadedCount.textContent = stats.downloaded_count;
     }
+    if (elements.overQuotaCount) {
+        elements.overQuotaCount.textContent = stats.over_quota_count;
+    }
 }
 
 // Обновление статистики
@@ -440,9 +593,9 @@ function refreshStats() {
     if (window.location.pathname === '/dashboard') {
         loadStats();
         loadClients();
-        showAlert('Данные обновлены', 'info');
+        showAlert(t('Данные обновлены'), 'info');
     } else {
-        showAlert('Обновление доступно только на странице dashboard', 'warning');
+        showAlert(t('Обновление доступно только на странице dashboard'), 'warning');
     }
 }
 
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"wireguard-web-manager/certs"
+	"wireguard-web-manager/config"
+)
+
+// setupTLS готовит настройки HTTPS для режима cfg.Mode; в режиме off
+// возвращает nil. challenge оборачивает обработчик HTTP-сервера
+// перенаправления: в режиме acme он отвечает на проверки http-01.
+func setupTLS(cfg config.TLS) (tlsConfig *tls.Config, challenge func(http.Handler) http.Handler, err error) {
+	switch cfg.Mode {
+	case config.TLSFile:
+		source, err := certs.NewFileSource(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return source.TLSConfig(), nil, nil
+
+	case config.TLSSelfSigned:
+		cert, created, err := certs.EnsureSelfSigned(cfg.CertFile, cfg.KeyFile, cfg.Hosts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if created {
+			log.Printf("создан самоподписанный сертификат %s", cfg.CertFile)
+		}
+		log.Printf("самоподписанный сертификат для %s действует до %s, отпечаток SHA-256: %s",
+			strings.Join(append(cert.DNSNames, ipStrings(cert.IPAddresses)...), ", "),
+			cert.NotAfter.Format("2006-01-02"), certs.Fingerprint(cert))
+		source, err := certs.NewFileSource(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return source.TLSConfig(), nil, nil
+
+	case config.TLSACME:
+		manager, err := certs.NewACME(certs.ACMEOptions{
+			Directory: cfg.ACME.Directory,
+			Email:     cfg.ACME.Email,
+			CacheDir:  cfg.ACME.CacheDir,
+			CARoot:    cfg.ACME.CARoot,
+			Hosts:     cfg.Hosts,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler, nil
+	}
+	return nil, nil, nil
+}
+
+// redirectToHTTPS перенаправляет запросы на тот же хост и путь по HTTPS на
+// порт адреса listen
+func redirectToHTTPS(listen string) http.Handler {
+	_, port, _ := net.SplitHostPort(listen)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+		host = strings.Trim(host, "[]")
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// 301 для GET и HEAD, 308 для остальных, чтобы не потерять метод и тело
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
+
+func ipStrings(ips []net.IP) []string {
+	values := make([]string, len(ips))
+	for i, ip := range ips {
+		values[i] = ip.String()
+	}
+	return values
+}
@@ -0,0 +1,239 @@
+package users
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrExists пользователь с таким именем уже есть
+var ErrExists = errors.New("user already exists")
+
+// Store пользователи панели в файле формата htpasswd: строка name:hash,
+// хеши bcrypt. Файл перечитывается, когда меняется, поэтому пользователь,
+// добавленный командой user add, может войти без перезапуска сервера.
+type Store struct {
+	path string
+
+	mu       sync.Mutex
+	hashes   map[string][]byte
+	modTime  time.Time
+	verified map[string][sha256.Size]byte // успешные проверки, чтобы не считать bcrypt на каждый запрос
+}
+
+// Open загружает пользователей из файла path. Отсутствующий файл означает,
+// что пользователей нет.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Empty сообщает, что пользователей нет
+func (s *Store) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshLocked()
+	return len(s.hashes) == 0
+}
+
+// Authenticate проверяет имя и пароль
+func (s *Store) Authenticate(name, password string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshLocked()
+
+	hash, ok := s.hashes[name]
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(password))
+	if verified, ok := s.verified[name]; ok && verified == sum {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	s.verified[name] = sum
+	return true
+}
+
+// Add добавляет пользователя и записывает файл
+func (s *Store) Add(name, password string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if password == "" {
+		return errors.New("password is empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return err
+	}
+	if _, ok := s.hashes[name]; ok {
+		return ErrExists
+	}
+	s.hashes[name] = hash
+	return s.writeLocked()
+}
+
+// Entry пользователь с хешем пароля, как в файле пользователей
+type Entry struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"` // bcrypt
+}
+
+// ValidateEntry проверяет имя пользователя и хеш bcrypt
+func ValidateEntry(entry Entry) error {
+	if err := validateName(entry.Name); err != nil {
+		return err
+	}
+	if _, err := bcrypt.Cost([]byte(entry.Hash)); err != nil {
+		return fmt.Errorf("invalid password hash: %w", err)
+	}
+	return nil
+}
+
+// Entries возвращает пользователей с хешами, упорядоченных по имени
+func (s *Store) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshLocked()
+
+	entries := make([]Entry, 0, len(s.hashes))
+	for name, hash := range s.hashes {
+		entries = append(entries, Entry{Name: name, Hash: string(hash)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Replace заменяет всех пользователей на entries и записывает файл
+func (s *Store) Replace(entries []Entry) error {
+	hashes := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		if err := ValidateEntry(entry); err != nil {
+			return err
+		}
+		if _, dup := hashes[entry.Name]; dup {
+			return fmt.Errorf("user %s: %w", entry.Name, ErrExists)
+		}
+		hashes[entry.Name] = []byte(entry.Hash)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes, s.verified = hashes, map[string][sha256.Size]byte{}
+	return s.writeLocked()
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+		return fmt.Errorf("invalid user name %q", name)
+	}
+	return nil
+}
+
+// refreshLocked перечитывает файл, если он изменился или удален
+func (s *Store) refreshLocked() {
+	info, err := os.Stat(s.path)
+	if err == nil && info.ModTime().Equal(s.modTime) {
+		return
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	s.reloadLocked()
+}
+
+// reloadLocked читает файл. При ошибке загруженные пользователи остаются:
+// испорченный файл не должен отключать вход.
+func (s *Store) reloadLocked() error {
+	if s.hashes == nil {
+		s.hashes, s.verified = map[string][]byte{}, map[string][sha256.Size]byte{}
+	}
+
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.hashes, s.verified, s.modTime = map[string][]byte{}, map[string][sha256.Size]byte{}, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(text, ":")
+		if !ok || name == "" {
+			return fmt.Errorf("%s:%d: expected name:hash", s.path, line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		hashes[name] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	s.hashes, s.verified, s.modTime = hashes, map[string][sha256.Size]byte{}, info.ModTime()
+	return nil
+}
+
+// writeLocked атомарно заменяет файл пользователей
+func (s *Store) writeLocked() error {
+	names := make([]string, 0, len(s.hashes))
+	for name := range s.hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s:%s\n", name, s.hashes[name])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
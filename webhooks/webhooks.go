@@ -0,0 +1,516 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"wireguard-web-manager/models"
+
+	"github.com/google/uuid"
+)
+
+// События жизненного цикла клиента
+const (
+	EventClientCreated        = "client.created"
+	EventClientUpdated        = "client.updated"
+	EventClientDisabled       = "client.disabled"
+	EventClientEnabled        = "client.enabled"
+	EventClientDeleted        = "client.deleted"
+	EventClientExpired        = "client.expired"
+	EventClientQuotaExceeded  = "client.quota_exceeded"
+	EventClientFirstConnected = "client.first_connected"
+)
+
+// Events перечень поддерживаемых событий
+var Events = []string{
+	EventClientCreated,
+	EventClientUpdated,
+	EventClientDisabled,
+	EventClientEnabled,
+	EventClientDeleted,
+	EventClientExpired,
+	EventClientQuotaExceeded,
+	EventClientFirstConnected,
+}
+
+// Заголовки исходящих запросов
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature" // sha256=<hex HMAC-SHA256 тела запроса>
+)
+
+// Статусы доставки
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed" // попытка не удалась, будет повтор
+	StatusDead      = "dead"   // попытки исчерпаны, событие в списке недоставленных
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBaseDelay   = time.Second
+	defaultTimeout     = 10 * time.Second
+	deliveryLogSize    = 1000
+	deadLetterLimit    = 1000
+)
+
+// errStopped причина недоставки событий, опубликованных после остановки
+var errStopped = errors.New("dispatcher stopped")
+
+// Publisher публикует события для подписчиков
+type Publisher interface {
+	Publish(eventType string, data interface{})
+}
+
+// Subscription подписка на события
+type Subscription = models.WebhookSubscription
+
+// Store хранит подписки и недоставленные события между перезапусками
+type Store interface {
+	WebhookSubscriptions() []Subscription
+	SetWebhookSubscription(sub Subscription)
+	DeleteWebhookSubscription(id string)
+	WebhookDeadLetters() []DeadLetter
+	SetWebhookDeadLetters(letters []DeadLetter)
+}
+
+// Event событие, отправляемое подписчикам
+type Event = models.WebhookEvent
+
+// Delivery запись журнала доставки
+type Delivery struct {
+	ID             string    `json:"id"`
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	Attempt        int       `json:"attempt"`
+	Status         string    `json:"status"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// DeadLetter событие, которое не удалось доставить за все попытки
+type DeadLetter = models.WebhookDeadLetter
+
+// Options параметры диспетчера
+type Options struct {
+	Client      *http.Client  // по умолчанию клиент с таймаутом 10 секунд
+	MaxAttempts int           // по умолчанию 5
+	BaseDelay   time.Duration // задержка перед первым повтором, далее удваивается; по умолчанию 1 секунда
+	Store       Store         // откуда загружаются и куда сохраняются подписки и недоставленные события; nil — только в памяти
+}
+
+// Dispatcher рассылает события подписчикам с повторами и журналом доставки
+type Dispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	store       Store
+
+	mu            sync.RWMutex
+	subscriptions map[string]*Subscription
+	deliveries    []Delivery
+	deadLetters   []DeadLetter
+
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	closed  bool
+	closing bool // Close ждет доставок, недоставленные события сохранятся разом
+}
+
+func NewDispatcher(opts Options) *Dispatcher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = defaultBaseDelay
+	}
+	d := &Dispatcher{
+		client:        opts.Client,
+		maxAttempts:   opts.MaxAttempts,
+		baseDelay:     opts.BaseDelay,
+		store:         opts.Store,
+		subscriptions: make(map[string]*Subscription),
+		stop:          make(chan struct{}),
+	}
+	if d.store != nil {
+		for _, sub := range d.store.WebhookSubscriptions() {
+			stored := sub
+			d.subscriptions[sub.ID] = &stored
+		}
+		d.deadLetters = d.store.WebhookDeadLetters()
+	}
+	return d
+}
+
+// Close прекращает повторы и дожидается завершения текущих доставок.
+// События, повторы которых прерваны, попадают в список недоставленных, и
+// список сохраняется в хранилище.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		d.closing = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closing {
+		d.closing = false
+		d.saveDeadLettersLocked()
+	}
+}
+
+// AddSubscription проверяет и сохраняет подписку. Если секрет не задан, он генерируется.
+func (d *Dispatcher) AddSubscription(sub Subscription) (Subscription, error) {
+	if err := ValidateSubscription(sub); err != nil {
+		return Subscription{}, err
+	}
+	if sub.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Subscription{}, fmt.Errorf("generate secret: %w", err)
+		}
+		sub.Secret = hex.EncodeToString(secret)
+	}
+
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.saveLocked(sub)
+	return sub, nil
+}
+
+// RestoreSubscription сохраняет подписку из резервной копии с прежними
+// идентификатором и секретом, заменяя подписку с тем же идентификатором
+func (d *Dispatcher) RestoreSubscription(sub Subscription) error {
+	if sub.ID == "" || sub.Secret == "" {
+		return errors.New("subscription id and secret are required")
+	}
+	if err := ValidateSubscription(sub); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.saveLocked(sub)
+	return nil
+}
+
+// ValidateSubscription проверяет адрес и события подписки
+func ValidateSubscription(sub Subscription) error {
+	parsed, err := url.Parse(sub.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	for _, event := range sub.Events {
+		if !knownEvent(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// RemoveSubscription удаляет подписку
+func (d *Dispatcher) RemoveSubscription(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subscriptions[id]; !ok {
+		return false
+	}
+	delete(d.subscriptions, id)
+	if d.store != nil {
+		d.store.DeleteWebhookSubscription(id)
+	}
+	return true
+}
+
+// saveLocked сохраняет подписку в памяти и в хранилище. Вызывается под
+// блокировкой, чтобы порядок записей в хранилище совпадал с порядком изменений.
+func (d *Dispatcher) saveLocked(sub Subscription) {
+	stored := sub
+	d.subscriptions[sub.ID] = &stored
+	if d.store != nil {
+		d.store.SetWebhookSubscription(sub)
+	}
+}
+
+// Subscriptions возвращает подписки без секретов
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	result := make([]Subscription, 0, len(d.subscriptions))
+	for _, sub := range d.subscriptions {
+		item := *sub
+		item.Secret = ""
+		result = append(result, item)
+	}
+	return result
+}
+
+// SubscriptionsWithSecrets возвращает подписки вместе с секретами для
+// резервной копии
+func (d *Dispatcher) SubscriptionsWithSecrets() []Subscription {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	result := make([]Subscription, 0, len(d.subscriptions))
+	for _, sub := range d.subscriptions {
+		result = append(result, *sub)
+	}
+	return result
+}
+
+// Deliveries возвращает журнал доставки от новых записей к старым
+func (d *Dispatcher) Deliveries(limit int) []Delivery {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	result := make([]Delivery, 0)
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		result = append(result, d.deliveries[i])
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// DeadLetters возвращает недоставленные события
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]DeadLetter(nil), d.deadLetters...)
+}
+
+// RetryDeadLetter повторно отправляет недоставленное событие и убирает его из списка
+func (d *Dispatcher) RetryDeadLetter(id string) bool {
+	d.mu.Lock()
+	var letter DeadLetter
+	var sub *Subscription
+	for i := range d.deadLetters {
+		if d.deadLetters[i].ID != id {
+			continue
+		}
+		letter = d.deadLetters[i]
+		sub = d.subscriptions[letter.SubscriptionID]
+		if sub != nil {
+			d.deadLetters = append(d.deadLetters[:i], d.deadLetters[i+1:]...)
+			d.saveDeadLettersLocked()
+		}
+		break
+	}
+	d.mu.Unlock()
+
+	if sub == nil {
+		return false
+	}
+	d.deliver(*sub, letter.Event)
+	return true
+}
+
+// Publish рассылает событие всем подходящим подписчикам. Отправка выполняется
+// в фоне, вызов не блокируется.
+func (d *Dispatcher) Publish(eventType string, data interface{}) {
+	event := Event{
+		ID:   uuid.New().String(),
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+
+	d.mu.RLock()
+	targets := make([]Subscription, 0)
+	for _, sub := range d.subscriptions {
+		if wants(sub, eventType) {
+			targets = append(targets, *sub)
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, sub := range targets {
+		d.deliver(sub, event)
+	}
+}
+
+// ClientPayload возвращает копию клиента для отправки подписчикам — без приватного ключа
+func ClientPayload(client *models.Client) models.Client {
+	return client.Public()
+}
+
+// Sign вычисляет значение заголовка подписи для тела запроса
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись тела запроса; предназначена для получателей
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func (d *Dispatcher) deliver(sub Subscription, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("webhook: не удалось сериализовать событие %s: %v", event.Type, err)
+		return
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		d.addDeadLetter(sub, event, 0, errStopped)
+		return
+	}
+	d.wg.Add(1)
+	d.mu.Unlock()
+
+	go func() {
+		defer d.wg.Done()
+
+		delay := d.baseDelay
+		for attempt := 1; ; attempt++ {
+			statusCode, err := d.send(sub, event, body)
+			delivery := Delivery{
+				ID:             uuid.New().String(),
+				SubscriptionID: sub.ID,
+				EventID:        event.ID,
+				EventType:      event.Type,
+				Attempt:        attempt,
+				StatusCode:     statusCode,
+				Time:           time.Now(),
+			}
+
+			switch {
+			case err == nil:
+				delivery.Status = StatusDelivered
+				d.logDelivery(delivery)
+				return
+			case attempt >= d.maxAttempts:
+				delivery.Status = StatusDead
+				delivery.Error = err.Error()
+				d.logDelivery(delivery)
+				d.addDeadLetter(sub, event, attempt, err)
+				return
+			default:
+				delivery.Status = StatusFailed
+				delivery.Error = err.Error()
+				d.logDelivery(delivery)
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-d.stop:
+				timer.Stop()
+				d.addDeadLetter(sub, event, attempt, err)
+				return
+			case <-timer.C:
+			}
+			delay *= 2
+		}
+	}()
+}
+
+func (d *Dispatcher) send(sub Subscription, event Event, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, event.ID)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) logDelivery(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > deliveryLogSize {
+		d.deliveries = d.deliveries[len(d.deliveries)-deliveryLogSize:]
+	}
+}
+
+func (d *Dispatcher) addDeadLetter(sub Subscription, event Event, attempts int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadLetters = append(d.deadLetters, DeadLetter{
+		ID:             uuid.New().String(),
+		SubscriptionID: sub.ID,
+		Event:          event,
+		Attempts:       attempts,
+		LastError:      err.Error(),
+		Time:           time.Now(),
+	})
+	// Недоступный подписчик не должен расходовать память без предела:
+	// старые недоставленные события отбрасываются
+	if len(d.deadLetters) > deadLetterLimit {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-deadLetterLimit:]
+	}
+	if !d.closing {
+		d.saveDeadLettersLocked()
+	}
+	log.Printf("webhook: событие %s не доставлено на %s: %v", event.Type, sub.URL, err)
+}
+
+// saveDeadLettersLocked сохраняет список недоставленных событий в хранилище.
+// Вызывается под блокировкой.
+func (d *Dispatcher) saveDeadLettersLocked() {
+	if d.store != nil {
+		d.store.SetWebhookDeadLetters(d.deadLetters)
+	}
+}
+
+func wants(sub *Subscription, eventType string) bool {
+	if len(sub.Events) == 0 {
+		return true
+	}
+	for _, event := range sub.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func knownEvent(eventType string) bool {
+	for _, event := range Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
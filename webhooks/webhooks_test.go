@@ -0,0 +1,322 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver подписчик, отвечающий кодами из statuses по порядку; после
+// них — 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	times    []time.Time
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	r.times = append(r.times, time.Now())
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newTestDispatcher(t *testing.T, opts Options) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(opts)
+	t.Cleanup(d.Close)
+	return d
+}
+
+func subscribe(t *testing.T, d *Dispatcher, url string) Subscription {
+	t.Helper()
+	sub, err := d.AddSubscription(Subscription{URL: url})
+	if err != nil {
+		t.Fatalf("add subscription: %v", err)
+	}
+	return sub
+}
+
+// waitFor ждет выполнения условия, пока доставка идет в фоне
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	recv := &receiver{}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := newTestDispatcher(t, Options{})
+	sub := subscribe(t, d, srv.URL)
+	if sub.Secret == "" {
+		t.Fatal("secret was not generated")
+	}
+
+	d.Publish(EventClientCreated, map[string]string{"name": "laptop"})
+	waitFor(t, "delivery", func() bool { return len(d.Deliveries(0)) == 1 })
+
+	recv.mu.Lock()
+	req, body := recv.requests[0], recv.bodies[0]
+	recv.mu.Unlock()
+
+	if !Verify(sub.Secret, body, req.Header.Get(HeaderSignature)) {
+		t.Errorf("signature %q does not match body", req.Header.Get(HeaderSignature))
+	}
+	if Verify("other", body, req.Header.Get(HeaderSignature)) {
+		t.Error("signature matches a different secret")
+	}
+	if got := req.Header.Get(HeaderEvent); got != EventClientCreated {
+		t.Errorf("%s = %q, want %q", HeaderEvent, got, EventClientCreated)
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if event.Type != EventClientCreated || req.Header.Get(HeaderDelivery) != event.ID {
+		t.Errorf("event %+v, delivery header %q", event, req.Header.Get(HeaderDelivery))
+	}
+
+	delivery := d.Deliveries(0)[0]
+	if delivery.Status != StatusDelivered || delivery.Attempt != 1 || delivery.StatusCode != http.StatusOK {
+		t.Errorf("delivery %+v", delivery)
+	}
+}
+
+func TestSubscriptionEventFilter(t *testing.T) {
+	recv := &receiver{}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := newTestDispatcher(t, Options{})
+	if _, err := d.AddSubscription(Subscription{URL: srv.URL, Events: []string{EventClientExpired}}); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Publish(EventClientCreated, nil)
+	d.Publish(EventClientExpired, nil)
+	waitFor(t, "delivery", func() bool { return len(d.Deliveries(0)) == 1 })
+	d.Close()
+
+	if recv.count() != 1 {
+		t.Fatalf("got %d requests, want 1", recv.count())
+	}
+	if got := recv.requests[0].Header.Get(HeaderEvent); got != EventClientExpired {
+		t.Errorf("delivered %q, want %q", got, EventClientExpired)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	const base = 20 * time.Millisecond
+	d := newTestDispatcher(t, Options{BaseDelay: base})
+	subscribe(t, d, srv.URL)
+
+	d.Publish(EventClientUpdated, nil)
+	waitFor(t, "successful retry", func() bool {
+		deliveries := d.Deliveries(0)
+		return len(deliveries) > 0 && deliveries[0].Status == StatusDelivered
+	})
+
+	deliveries := d.Deliveries(0)
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d deliveries, want 3", len(deliveries))
+	}
+	for i, want := range []string{StatusDelivered, StatusFailed, StatusFailed} {
+		if deliveries[i].Status != want || deliveries[i].Attempt != 3-i {
+			t.Errorf("delivery %d: %+v, want status %s", i, deliveries[i], want)
+		}
+	}
+	if deliveries[2].StatusCode != http.StatusInternalServerError {
+		t.Errorf("first attempt status %d", deliveries[2].StatusCode)
+	}
+
+	recv.mu.Lock()
+	times := recv.times
+	recv.mu.Unlock()
+	if gap := times[1].Sub(times[0]); gap < base {
+		t.Errorf("first retry after %v, want at least %v", gap, base)
+	}
+	if gap := times[2].Sub(times[1]); gap < 2*base {
+		t.Errorf("second retry after %v, want at least %v", gap, 2*base)
+	}
+	if len(d.DeadLetters()) != 0 {
+		t.Error("delivered event is in dead letters")
+	}
+}
+
+func TestDeadLetterAndRetry(t *testing.T) {
+	recv := &receiver{statuses: []int{
+		http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+	}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	d := newTestDispatcher(t, Options{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	sub := subscribe(t, d, srv.URL)
+
+	d.Publish(EventClientDeleted, nil)
+	waitFor(t, "dead letter", func() bool { return len(d.DeadLetters()) == 1 })
+
+	letter := d.DeadLetters()[0]
+	if letter.SubscriptionID != sub.ID || letter.Attempts != 3 || letter.Event.Type != EventClientDeleted {
+		t.Errorf("dead letter %+v", letter)
+	}
+	if !strings.Contains(letter.LastError, "503") {
+		t.Errorf("last error %q does not mention the status", letter.LastError)
+	}
+	if last := d.Deliveries(1)[0]; last.Status != StatusDead {
+		t.Errorf("last delivery status %q, want %q", last.Status, StatusDead)
+	}
+
+	if d.RetryDeadLetter("missing") {
+		t.Error("retried a missing dead letter")
+	}
+	if !d.RetryDeadLetter(letter.ID) {
+		t.Fatal("dead letter was not retried")
+	}
+	waitFor(t, "redelivery", func() bool { return d.Deliveries(1)[0].Status == StatusDelivered })
+	if len(d.DeadLetters()) != 0 {
+		t.Error("retried event is still in dead letters")
+	}
+}
+
+func TestDeadLetterLimit(t *testing.T) {
+	d := newTestDispatcher(t, Options{})
+	sub := Subscription{ID: "sub", URL: "http://example.com"}
+	for i := 0; i < deadLetterLimit+5; i++ {
+		d.addDeadLetter(sub, Event{ID: strconv.Itoa(i)}, 1, errors.New("down"))
+	}
+
+	letters := d.DeadLetters()
+	if len(letters) != deadLetterLimit {
+		t.Fatalf("kept %d dead letters, want %d", len(letters), deadLetterLimit)
+	}
+	if letters[0].Event.ID != "5" {
+		t.Errorf("oldest kept event %q, want %q", letters[0].Event.ID, "5")
+	}
+}
+
+// memoryStore хранилище подписок и недоставленных событий в памяти
+type memoryStore struct {
+	mu      sync.Mutex
+	subs    map[string]Subscription
+	letters []DeadLetter
+}
+
+func (s *memoryStore) WebhookSubscriptions() []Subscription {
+	result := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		result = append(result, sub)
+	}
+	return result
+}
+
+func (s *memoryStore) SetWebhookSubscription(sub Subscription) { s.subs[sub.ID] = sub }
+
+func (s *memoryStore) DeleteWebhookSubscription(id string) { delete(s.subs, id) }
+
+func (s *memoryStore) WebhookDeadLetters() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeadLetter(nil), s.letters...)
+}
+
+func (s *memoryStore) SetWebhookDeadLetters(letters []DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append([]DeadLetter(nil), letters...)
+}
+
+func TestSubscriptionsPersisted(t *testing.T) {
+	store := &memoryStore{subs: make(map[string]Subscription)}
+
+	first := newTestDispatcher(t, Options{Store: store})
+	sub := subscribe(t, first, "https://hooks.example.com/wg")
+	removed := subscribe(t, first, "https://hooks.example.com/old")
+	if !first.RemoveSubscription(removed.ID) {
+		t.Fatal("subscription was not removed")
+	}
+
+	restarted := newTestDispatcher(t, Options{Store: store})
+	subs := restarted.SubscriptionsWithSecrets()
+	if len(subs) != 1 {
+		t.Fatalf("loaded %d subscriptions, want 1", len(subs))
+	}
+	if subs[0].ID != sub.ID || subs[0].Secret != sub.Secret || subs[0].URL != sub.URL {
+		t.Errorf("loaded %+v, want %+v", subs[0], sub)
+	}
+}
+
+func TestDeadLettersPersistedOnClose(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+	store := &memoryStore{subs: make(map[string]Subscription)}
+
+	// Повтор назначен через час: событие ждет его, когда диспетчер
+	// останавливается
+	d := NewDispatcher(Options{Store: store, BaseDelay: time.Hour})
+	sub := subscribe(t, d, srv.URL)
+	d.Publish(EventClientCreated, map[string]string{"name": "laptop"})
+	waitFor(t, "first attempt", func() bool { return len(d.Deliveries(0)) == 1 })
+
+	d.Close()
+	d.Publish(EventClientDeleted, map[string]string{"name": "phone"})
+
+	letters := store.WebhookDeadLetters()
+	if len(letters) != 2 {
+		t.Fatalf("stored %d dead letters, want 2", len(letters))
+	}
+	if letters[0].Event.Type != EventClientCreated || letters[0].Attempts != 1 || letters[0].SubscriptionID != sub.ID {
+		t.Errorf("interrupted retry stored as %+v", letters[0])
+	}
+	if letters[1].Event.Type != EventClientDeleted || letters[1].Attempts != 0 {
+		t.Errorf("event published after close stored as %+v", letters[1])
+	}
+
+	restarted := newTestDispatcher(t, Options{Store: store})
+	if got := restarted.DeadLetters(); len(got) != 2 || got[0].ID != letters[0].ID {
+		t.Fatalf("restarted dispatcher loaded %+v", got)
+	}
+	if !restarted.RetryDeadLetter(letters[0].ID) {
+		t.Fatal("stored dead letter cannot be retried")
+	}
+	waitFor(t, "retried delivery", func() bool { return recv.count() == 2 })
+	if got := store.WebhookDeadLetters(); len(got) != 1 || got[0].ID != letters[1].ID {
+		t.Errorf("after retry stored %+v", got)
+	}
+}
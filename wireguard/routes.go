@@ -0,0 +1,103 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// routeProtocol помечает маршруты сетей площадок, добавленные приложением.
+// SyncRoutes удаляет только такие маршруты и не трогает добавленные вручную.
+const routeProtocol netlink.RouteProtocol = 0x77
+
+// AddRoutes направляет сети networks в интерфейс. Существующий маршрут в ту
+// же сеть заменяется.
+func (s *Service) AddRoutes(deviceName string, networks []net.IPNet) error {
+	if len(networks) == 0 {
+		return nil
+	}
+	link, err := routeLink(deviceName)
+	if err != nil {
+		return err
+	}
+	for i := range networks {
+		if err := netlink.RouteReplace(siteRoute(link, &networks[i])); err != nil {
+			return fmt.Errorf("add route %s dev %s: %w", networks[i].String(), deviceName, err)
+		}
+	}
+	return nil
+}
+
+// RemoveRoutes удаляет маршруты сетей networks через интерфейс. Отсутствующий
+// маршрут ошибкой не считается.
+func (s *Service) RemoveRoutes(deviceName string, networks []net.IPNet) error {
+	if len(networks) == 0 {
+		return nil
+	}
+	link, err := routeLink(deviceName)
+	if err != nil {
+		return err
+	}
+	for i := range networks {
+		if err := netlink.RouteDel(siteRoute(link, &networks[i])); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("remove route %s dev %s: %w", networks[i].String(), deviceName, err)
+		}
+	}
+	return nil
+}
+
+// SyncRoutes оставляет на интерфейсе ровно маршруты сетей networks:
+// недостающие добавляются, лишние маршруты приложения удаляются
+func (s *Service) SyncRoutes(deviceName string, networks []net.IPNet) error {
+	link, err := routeLink(deviceName)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(networks))
+	for i := range networks {
+		wanted[networks[i].String()] = true
+	}
+
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Protocol:  routeProtocol,
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_PROTOCOL)
+	if err != nil {
+		return fmt.Errorf("list routes dev %s: %w", deviceName, err)
+	}
+	for i := range routes {
+		route := &routes[i]
+		if route.Dst == nil || wanted[route.Dst.String()] {
+			continue
+		}
+		if err := netlink.RouteDel(route); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return fmt.Errorf("remove route %s dev %s: %w", route.Dst.String(), deviceName, err)
+		}
+	}
+
+	return s.AddRoutes(deviceName, networks)
+}
+
+func routeLink(deviceName string) (netlink.Link, error) {
+	if deviceName == "" {
+		return nil, errors.New("device name is required")
+	}
+	link, err := netlink.LinkByName(deviceName)
+	if err != nil {
+		return nil, fmt.Errorf("lookup link %s: %w", deviceName, err)
+	}
+	return link, nil
+}
+
+func siteRoute(link netlink.Link, network *net.IPNet) *netlink.Route {
+	return &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       network,
+		Scope:     netlink.SCOPE_LINK,
+		Protocol:  routeProtocol,
+	}
+}
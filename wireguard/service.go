@@ -94,6 +94,28 @@ func (s *Service) ConfigureServer(name string, privateKey string, listenPort int
 	return nil
 }
 
+// ApplyPeers применяет изменения нескольких пиров одной конфигурацией устройства
+func (s *Service) ApplyPeers(deviceName string, peers []wgtypes.PeerConfig) error {
+	if deviceName == "" {
+		return errors.New("device name is required")
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == nil {
+		return errors.New("wireguard client not initialized")
+	}
+
+	if err := s.client.ConfigureDevice(deviceName, wgtypes.Config{Peers: peers}); err != nil {
+		return fmt.Errorf("configure peers on %s: %w", deviceName, err)
+	}
+	return nil
+}
+
 func (s *Service) RemovePeer(deviceName, peerPublicKey string) error {
 	if deviceName == "" {
 		return errors.New("device name is required")
@@ -222,3 +244,44 @@ func AllocateAddress(cidr string, used map[string]struct{}) (string, error) {
 
 	return "", errors.New("no available addresses in network")
 }
+
+// CheckAddressInNetwork проверяет, что туннельный адрес address лежит в
+// сети сервера cidr
+func CheckAddressInNetwork(address, cidr string) error {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return fmt.Errorf("parse network %s: %w", cidr, err)
+	}
+	host := strings.TrimSpace(address)
+	if idx := strings.Index(host, "/"); idx > 0 {
+		host = host[:idx]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	if !network.Contains(ip) {
+		return fmt.Errorf("address %s is outside network %s", host, network)
+	}
+	return nil
+}
+
+func GeneratePrivateKey() (wgtypes.Key, error) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("generate private key: %w", err)
+	}
+	return key, nil
+}
+
+// ParsePublicKey разбирает открытый ключ, переданный клиентом
+func ParsePublicKey(value string) (wgtypes.Key, error) {
+	key, err := wgtypes.ParseKey(strings.TrimSpace(value))
+	if err != nil {
+		return wgtypes.Key{}, fmt.Errorf("parse public key: %w", err)
+	}
+	if key == (wgtypes.Key{}) {
+		return wgtypes.Key{}, errors.New("public key is empty")
+	}
+	return key, nil
+}
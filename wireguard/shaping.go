@@ -0,0 +1,329 @@
+package wireguard
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// RateLimit ограничение скорости пира в кбит/с; 0 означает отсутствие ограничения
+type RateLimit struct {
+	IngressKbit uint64 // от клиента к серверу
+	EgressKbit  uint64 // от сервера к клиенту
+}
+
+// IsZero сообщает, что ограничения не заданы ни в одном направлении
+func (l RateLimit) IsZero() bool {
+	return l.IngressKbit == 0 && l.EgressKbit == 0
+}
+
+const (
+	// ethPIP протокол IPv4 для tc-фильтров (ETH_P_IP)
+	ethPIP = 0x0800
+
+	// Интерфейс WireGuard работает на уровне L3, поэтому смещения
+	// считаются от начала IP-заголовка
+	ipv4SrcOffset = 12
+	ipv4DstOffset = 16
+)
+
+var (
+	shapingRoot    = netlink.MakeHandle(1, 0)
+	shapingIngress = netlink.MakeHandle(0xffff, 0)
+)
+
+// SetRateLimit применяет ограничения скорости к туннельному адресу клиента.
+// Исходящий от сервера трафик ограничивается классом HTB, входящий — policing
+// на ingress-дисциплине. Направление с нулевым лимитом снимается.
+func (s *Service) SetRateLimit(deviceName, address string, limit RateLimit) error {
+	link, ip, minor, err := shapingTarget(deviceName, address)
+	if err != nil {
+		return err
+	}
+
+	if limit.EgressKbit == 0 {
+		if err := clearEgress(link, minor); err != nil {
+			return err
+		}
+	} else if err := setEgress(link, ip, minor, limit.EgressKbit); err != nil {
+		return err
+	}
+
+	if limit.IngressKbit == 0 {
+		return clearIngress(link, minor)
+	}
+	return setIngress(link, ip, minor, limit.IngressKbit)
+}
+
+// ClearRateLimit снимает все ограничения скорости с туннельного адреса клиента
+func (s *Service) ClearRateLimit(deviceName, address string) error {
+	link, _, minor, err := shapingTarget(deviceName, address)
+	if err != nil {
+		return err
+	}
+	if err := clearEgress(link, minor); err != nil {
+		return err
+	}
+	return clearIngress(link, minor)
+}
+
+// RateLimits считывает с интерфейса действующие ограничения скорости.
+// Ключ результата — младшие 16 бит туннельного адреса, см. AddressMinor.
+func (s *Service) RateLimits(deviceName string) (map[uint16]RateLimit, error) {
+	link, err := netlink.LinkByName(deviceName)
+	if err != nil {
+		return nil, fmt.Errorf("lookup link %s: %w", deviceName, err)
+	}
+
+	result := make(map[uint16]RateLimit)
+
+	classes, err := netlink.ClassList(link, shapingRoot)
+	if err != nil {
+		return nil, fmt.Errorf("list classes on %s: %w", deviceName, err)
+	}
+	for _, class := range classes {
+		htb, ok := class.(*netlink.HtbClass)
+		if !ok || htb.Parent != shapingRoot {
+			continue
+		}
+		_, minor := netlink.MajorMinor(htb.Handle)
+		limit := result[minor]
+		limit.EgressKbit = htb.Rate * 8 / 1000
+		result[minor] = limit
+	}
+
+	filters, err := netlink.FilterList(link, shapingIngress)
+	if err != nil {
+		return nil, fmt.Errorf("list ingress filters on %s: %w", deviceName, err)
+	}
+	for _, filter := range filters {
+		u32, ok := filter.(*netlink.U32)
+		if !ok {
+			continue
+		}
+		police := u32.Police
+		for _, action := range u32.Actions {
+			if p, ok := action.(*netlink.PoliceAction); ok {
+				police = p
+			}
+		}
+		if police == nil {
+			continue
+		}
+		minor := u32.Priority
+		limit := result[minor]
+		limit.IngressKbit = uint64(police.Rate) * 8 / 1000
+		result[minor] = limit
+	}
+
+	return result, nil
+}
+
+// AddressMinor возвращает номер класса HTB для туннельного адреса клиента.
+// Используются младшие 16 бит адреса, поэтому в сетях крупнее /16 номера
+// классов могут совпасть.
+func AddressMinor(address string) (uint16, error) {
+	ip, err := parseTunnelIP(address)
+	if err != nil {
+		return 0, err
+	}
+	minor := binary.BigEndian.Uint16(ip[2:])
+	if minor == 0 || minor == 0xffff {
+		return 0, fmt.Errorf("address %s cannot be shaped", address)
+	}
+	return minor, nil
+}
+
+func shapingTarget(deviceName, address string) (netlink.Link, net.IP, uint16, error) {
+	if deviceName == "" {
+		return nil, nil, 0, errors.New("device name is required")
+	}
+	link, err := netlink.LinkByName(deviceName)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("lookup link %s: %w", deviceName, err)
+	}
+	ip, err := parseTunnelIP(address)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	minor, err := AddressMinor(address)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return link, ip, minor, nil
+}
+
+func parseTunnelIP(address string) (net.IP, error) {
+	address = strings.TrimSpace(address)
+	if idx := strings.Index(address, "/"); idx > 0 {
+		address = address[:idx]
+	}
+	ip := net.ParseIP(address).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IPv4 address %q", address)
+	}
+	return ip, nil
+}
+
+func setEgress(link netlink.Link, ip net.IP, minor uint16, kbit uint64) error {
+	if err := ensureQdisc(link, "htb", func() netlink.Qdisc {
+		return netlink.NewHtb(netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    shapingRoot,
+			Parent:    netlink.HANDLE_ROOT,
+		})
+	}); err != nil {
+		return err
+	}
+
+	classID := netlink.MakeHandle(1, minor)
+	class := netlink.NewHtbClass(netlink.ClassAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    shapingRoot,
+		Handle:    classID,
+	}, netlink.HtbClassAttrs{
+		Rate: kbit * 1000,
+	})
+	if err := netlink.ClassReplace(class); err != nil {
+		return fmt.Errorf("replace htb class %s: %w", netlink.HandleStr(classID), err)
+	}
+
+	return replaceFilter(&netlink.U32{
+		FilterAttrs: filterAttrs(link, shapingRoot, minor),
+		ClassId:     classID,
+		Sel:         matchIP(ip, ipv4DstOffset),
+	})
+}
+
+func clearEgress(link netlink.Link, minor uint16) error {
+	// Без дисциплины снимать нечего, а ядро на удаление под отсутствующей
+	// дисциплиной отвечает EINVAL, а не ENOENT
+	if exists, err := hasQdisc(link, "htb", shapingRoot); err != nil || !exists {
+		return err
+	}
+	if err := ignoreMissing(netlink.FilterDel(&netlink.U32{FilterAttrs: filterAttrs(link, shapingRoot, minor)})); err != nil {
+		return fmt.Errorf("delete egress filter: %w", err)
+	}
+	class := &netlink.HtbClass{ClassAttrs: netlink.ClassAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    shapingRoot,
+		Handle:    netlink.MakeHandle(1, minor),
+	}}
+	if err := ignoreMissing(netlink.ClassDel(class)); err != nil {
+		return fmt.Errorf("delete htb class: %w", err)
+	}
+	return nil
+}
+
+func setIngress(link netlink.Link, ip net.IP, minor uint16, kbit uint64) error {
+	if err := ensureQdisc(link, "ingress", func() netlink.Qdisc {
+		return &netlink.Ingress{QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    shapingIngress,
+			Parent:    netlink.HANDLE_INGRESS,
+		}}
+	}); err != nil {
+		return err
+	}
+
+	rate := kbit * 1000 / 8
+	if rate > 1<<32-1 {
+		return fmt.Errorf("ingress rate %d kbit is too high", kbit)
+	}
+	police := netlink.NewPoliceAction()
+	police.Rate = uint32(rate)
+	police.Burst = uint32(max(rate/10, 16*1024))
+	police.ExceedAction = netlink.TC_POLICE_SHOT
+	police.NotExceedAction = netlink.TC_POLICE_OK
+
+	return replaceFilter(&netlink.U32{
+		FilterAttrs: filterAttrs(link, shapingIngress, minor),
+		Sel:         matchIP(ip, ipv4SrcOffset),
+		Actions:     []netlink.Action{police},
+	})
+}
+
+func clearIngress(link netlink.Link, minor uint16) error {
+	if exists, err := hasQdisc(link, "ingress", shapingIngress); err != nil || !exists {
+		return err
+	}
+	if err := ignoreMissing(netlink.FilterDel(&netlink.U32{FilterAttrs: filterAttrs(link, shapingIngress, minor)})); err != nil {
+		return fmt.Errorf("delete ingress filter: %w", err)
+	}
+	return nil
+}
+
+// ensureQdisc создает дисциплину, если на интерфейсе еще нет дисциплины того же типа
+// с нужным дескриптором. Существующая дисциплина не пересоздается, чтобы не
+// потерять классы других клиентов.
+func ensureQdisc(link netlink.Link, kind string, build func() netlink.Qdisc) error {
+	want := build()
+	if exists, err := hasQdisc(link, kind, want.Attrs().Handle); err != nil || exists {
+		return err
+	}
+	if err := netlink.QdiscAdd(want); err != nil {
+		return fmt.Errorf("add %s qdisc on %s: %w", kind, link.Attrs().Name, err)
+	}
+	return nil
+}
+
+// hasQdisc сообщает, есть ли на интерфейсе дисциплина типа kind с дескриптором handle
+func hasQdisc(link netlink.Link, kind string, handle uint32) (bool, error) {
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return false, fmt.Errorf("list qdiscs on %s: %w", link.Attrs().Name, err)
+	}
+	for _, qdisc := range qdiscs {
+		if qdisc.Type() == kind && qdisc.Attrs().Handle == handle {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// replaceFilter заменяет фильтр клиента. Приоритет фильтра совпадает с номером
+// класса клиента, поэтому удаление по приоритету затрагивает только его.
+func replaceFilter(filter *netlink.U32) error {
+	if err := ignoreMissing(netlink.FilterDel(&netlink.U32{FilterAttrs: filter.FilterAttrs})); err != nil {
+		return fmt.Errorf("delete filter: %w", err)
+	}
+	if err := netlink.FilterAdd(filter); err != nil {
+		return fmt.Errorf("add filter: %w", err)
+	}
+	return nil
+}
+
+func filterAttrs(link netlink.Link, parent uint32, minor uint16) netlink.FilterAttrs {
+	return netlink.FilterAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    parent,
+		Priority:  minor,
+		Protocol:  ethPIP,
+	}
+}
+
+func matchIP(ip net.IP, offset int32) *netlink.TcU32Sel {
+	return &netlink.TcU32Sel{
+		Flags: netlink.TC_U32_TERMINAL,
+		Nkeys: 1,
+		Keys: []netlink.TcU32Key{{
+			Mask: 0xffffffff,
+			Val:  binary.BigEndian.Uint32(ip),
+			Off:  offset,
+		}},
+	}
+}
+
+// ignoreMissing скрывает ошибку удаления отсутствующего объекта tc. EINVAL
+// не скрывается: им ядро отвечает и на неверные параметры фильтра или класса.
+func ignoreMissing(err error) error {
+	if errors.Is(err, syscall.ENOENT) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package wireguard
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestIgnoreMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		ignored bool
+	}{
+		{"no error", nil, true},
+		{"missing object", fmt.Errorf("delete filter: %w", syscall.ENOENT), true},
+		{"invalid argument", fmt.Errorf("delete filter: %w", syscall.EINVAL), false},
+		{"permission denied", syscall.EPERM, false},
+	}
+	for _, tt := range tests {
+		if got := ignoreMissing(tt.err); (got == nil) != tt.ignored {
+			t.Errorf("%s: ignoreMissing(%v) = %v", tt.name, tt.err, got)
+		}
+	}
+}
+
+func TestAddressMinor(t *testing.T) {
+	tests := []struct {
+		address string
+		want    uint16
+		ok      bool
+	}{
+		{"10.0.0.2/32", 2, true},
+		{"10.8.1.10", 0x010a, true},
+		{"10.0.0.0/32", 0, false},
+		{"10.0.255.255/32", 0, false},
+		{"fd00::2/128", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := AddressMinor(tt.address)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("AddressMinor(%q) = %d, %v", tt.address, got, err)
+		}
+	}
+}